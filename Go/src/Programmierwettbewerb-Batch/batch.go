@@ -0,0 +1,502 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/protocol"
+
+    "fmt"
+    "os"
+    "io"
+    "flag"
+    "sync"
+    "errors"
+    "strings"
+    "strconv"
+    "time"
+    "math/rand"
+    "encoding/json"
+    "encoding/csv"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    gamesFile = "../games.json"
+
+    // Like the middleware, so the bots behave the same as on the server.
+    defaultDeadline = 100
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Arguments
+//
+////////////////////////////////////////////////////////////////////////
+
+type BotDefinition struct {
+    Name        string
+    Command     string
+}
+
+// -bot can be given several times, every occurrence is one bot of each game.
+type BotDefinitions []BotDefinition
+
+func (definitions *BotDefinitions) String() string {
+    return fmt.Sprintf("%v", *definitions)
+}
+
+func (definitions *BotDefinitions) Set(value string) error {
+    parts := strings.SplitN(value, ":", 2)
+    if len(parts) != 2 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" {
+        return errors.New("A bot has to be given as NAME:COMMAND.")
+    }
+    *definitions = append(*definitions, BotDefinition{ Name: parts[0], Command: parts[1] })
+    return nil
+}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "NAME\n")
+    fmt.Fprintf(os.Stderr, "    Programmierwettbewerb-Batch -bot=NAME:COMMAND [-bot=NAME:COMMAND ...] [-games=N] [-game=GAME] [-physics=PROFILE] [-seed=SEED] [-protocol=text|json] [-deadline=MS] [-late=repeat|skip] [-lastTeam] [-format=json|csv] [-out=FILE]\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "DESCRIPTION\n")
+    fmt.Fprintf(os.Stderr, "    Runs N complete games without a server and as fast as possible. The bots are started as local\n")
+    fmt.Fprintf(os.Stderr, "    processes and talk the same protocol on stdin/stdout as with the middleware.\n")
+    fmt.Fprintf(os.Stderr, "    Prints the statistics of every bot at the end of every game.\n")
+    fmt.Fprintf(os.Stderr, "    A bot that does not answer within the deadline misses the step. Its last command is repeated\n")
+    fmt.Fprintf(os.Stderr, "    or skipped, and its late answer is used in the next step. Only with -deadline=0 the results\n")
+    fmt.Fprintf(os.Stderr, "    depend on nothing but the seed.\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "ARGUMENTS\n")
+    flag.PrintDefaults()
+}
+
+type ParseResult struct {
+    bots        BotDefinitions
+    numGames    int
+    gameName    string
+    physics     string
+    seed        int64
+    protocol    BotProtocol
+    deadline    time.Duration
+    latePolicy  LatePolicy
+    lastTeam    bool
+    format      string
+    outPath     string
+    debug       bool
+    mute        bool
+}
+
+func parseArguments() (ParseResult, error) {
+    var result ParseResult
+
+    flag.Usage = usage
+    flag.Var(&result.bots, "bot", "A bot as NAME:COMMAND. The teams of the game refer to these names.")
+    flag.IntVar(&result.numGames, "games", 1, "Number of games to run.")
+    flag.StringVar(&result.gameName, "game", "", "Take the settings of this game from " + gamesFile + ".")
+    flag.StringVar(&result.physics, "physics", "", "Use this physics profile from " + PhysicsDirectory + " instead of the one of the game.")
+    flag.Int64Var(&result.seed, "seed", 1, "Seed of the first game. Game i uses seed+i.")
+    protocolName := flag.String("protocol", "text", "Protocol between the batch runner and all bots: text or json.")
+    deadline := flag.Int("deadline", defaultDeadline, "Milliseconds a bot may think about a game state. 0 waits forever.")
+    lateName := flag.String("late", "repeat", "What a bot does in a step without an answer in time: repeat its last command or skip.")
+    flag.BoolVar(&result.lastTeam, "lastTeam", false, "End a game as soon as only one team is left.")
+    flag.StringVar(&result.format, "format", "json", "Output format: json or csv.")
+    flag.StringVar(&result.outPath, "out", "", "Write the results to this file instead of stdout.")
+    flag.BoolVar(&result.debug, "debug", false, "Running in debug mode.")
+    flag.BoolVar(&result.mute, "mute", false, "Drop everything the bots write to stderr.")
+
+    flag.Parse()
+
+    if len(result.bots) == 0 {
+        return result, errors.New("There has to be at least one bot.")
+    }
+    if result.numGames < 1 {
+        return result, errors.New("There has to be at least one game.")
+    }
+    if *deadline < 0 {
+        return result, errors.New("The deadline can not be negative.")
+    }
+    result.deadline = time.Duration(*deadline) * time.Millisecond
+    if result.format != "json" && result.format != "csv" {
+        return result, errors.New("The format has to be json or csv.")
+    }
+
+    var err error
+    if result.protocol, err = ParseBotProtocol(*protocolName); err != nil {
+        return result, err
+    }
+    if result.latePolicy, err = ParseLatePolicy(*lateName); err != nil {
+        return result, err
+    }
+
+    return result, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Results
+//
+////////////////////////////////////////////////////////////////////////
+
+// The statistics of one bot at the end of one game (or at its death).
+type BotResult struct {
+    Game            int         `json:"game"`
+    Seed            int64       `json:"seed"`
+    Bot             int         `json:"bot"`
+    Name            string      `json:"name"`
+    Team            string      `json:"team"`
+    Survived        bool        `json:"survived"`
+    // The steps without an answer in time.
+    Missed          int         `json:"missed"`
+    Statistics      Statistics  `json:"-"`
+}
+
+// Statistics carries the short tags of the gui protocol, the results are written with names.
+type namedStatistics struct {
+    MaxSize         float32     `json:"maxSize"`
+    MaxSurvivalTime float32     `json:"maxSurvivalTime"`
+    BlobKillCount   int         `json:"blobKillCount"`
+    BotKillCount    int         `json:"botKillCount"`
+    ToxinThrow      int         `json:"toxinThrow"`
+    SuccessfulToxin int         `json:"successfulToxin"`
+    SplitCount      int         `json:"splitCount"`
+    SuccessfulSplit int         `json:"successfulSplit"`
+    SuccessfulTeam  int         `json:"successfulTeam"`
+    BadTeaming      int         `json:"badTeaming"`
+}
+
+func (result BotResult) MarshalJSON() ([]byte, error) {
+    type plainResult BotResult
+    return json.Marshal(struct {
+        plainResult
+        Statistics      namedStatistics     `json:"statistics"`
+    }{ plainResult(result), namedStatistics(result.Statistics) })
+}
+
+var csvHeader = []string{
+    "game", "seed", "bot", "name", "team", "survived", "missed",
+    "maxSize", "maxSurvivalTime", "blobKillCount", "botKillCount", "toxinThrow",
+    "successfulToxin", "splitCount", "successfulSplit", "successfulTeam", "badTeaming",
+}
+
+func (result BotResult) csvRecord() []string {
+    s := result.Statistics
+    return []string{
+        strconv.Itoa(result.Game),
+        strconv.FormatInt(result.Seed, 10),
+        strconv.Itoa(result.Bot),
+        result.Name,
+        result.Team,
+        strconv.FormatBool(result.Survived),
+        strconv.Itoa(result.Missed),
+        strconv.FormatFloat(float64(s.MaxSize), 'f', -1, 32),
+        strconv.FormatFloat(float64(s.MaxSurvivalTime), 'f', -1, 32),
+        strconv.Itoa(s.BlobKillCount),
+        strconv.Itoa(s.BotKillCount),
+        strconv.Itoa(s.ToxinThrow),
+        strconv.Itoa(s.SuccessfulToxin),
+        strconv.Itoa(s.SplitCount),
+        strconv.Itoa(s.SuccessfulSplit),
+        strconv.Itoa(s.SuccessfulTeam),
+        strconv.Itoa(s.BadTeaming),
+    }
+}
+
+func writeResults(out io.Writer, format string, results []BotResult) error {
+    switch format {
+    case "csv":
+        writer := csv.NewWriter(out)
+        writer.Write(csvHeader)
+        for _, result := range results {
+            writer.Write(result.csvRecord())
+        }
+        writer.Flush()
+        return writer.Error()
+    default:
+        encoder := json.NewEncoder(out)
+        encoder.SetIndent("", "    ")
+        return encoder.Encode(results)
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Running a Game
+//
+////////////////////////////////////////////////////////////////////////
+
+func makeSettings(games Games, gameName string, physicsName string) (ServerSettings, float32, error) {
+    settings := NewSettings()
+    settings.MinNumberOfBots = 0
+
+    var gameTime float32
+    if gameName != "" {
+        game, ok := games[gameName]
+        if !ok {
+            return settings, 0, errors.New(fmt.Sprintf("There is no game '%v' in %v.", gameName, gamesFile))
+        }
+
+        settings.MaxNumberOfFoods  = game.Foods
+        settings.MaxNumberOfToxins = game.Toxins
+        settings.Teams             = game.Teams
+        settings.FriendlyFire      = game.FriendlyFire
+        if game.MaxBots > 0 {
+            settings.MaxNumberOfBots = game.MaxBots
+        }
+        // The field size goes first, it changes the spawn distributions and the walls.
+        settings.SetFieldSize(game.FieldSize)
+        settings.SetFoodSpawn(game.FoodSpawn)
+        settings.SetToxinSpawn(game.ToxinSpawn)
+        settings.SetBotSpawn(game.BotSpawn)
+        // The walls are checked against the spawn images of the game.
+        if err := settings.SetWalls(game.Walls); err != nil {
+            return settings, 0, errors.New(fmt.Sprintf("The walls of the game '%v' can not be used: %v", gameName, err.Error()))
+        }
+        gameTime = game.GameTime
+
+        if physicsName == "" {
+            physicsName = game.Physics
+        }
+    }
+
+    if err := settings.SetPhysics(DefaultPhysics(), physicsName); err != nil {
+        return settings, 0, errors.New(fmt.Sprintf("Could not load the physics profile '%v': %v", physicsName, err.Error()))
+    }
+
+    return settings, gameTime, nil
+}
+
+func numberOfTeams(bots map[BotId]Bot) int {
+    teams := make(map[TeamId]bool)
+    for _, bot := range bots {
+        teams[bot.TeamId] = true
+    }
+    return len(teams)
+}
+
+// Runs one game in lockstep: every step all living bots get their view, all
+// answers are collected and then the simulation advances by FixedTimeStep.
+func runGame(parseResult ParseResult, settings ServerSettings, gameTime float32, gameIndex int) ([]BotResult, error) {
+    seed := parseResult.seed + int64(gameIndex)
+    gameState := NewGameState(settings, rand.New(rand.NewSource(seed)))
+    if gameTime > 0 {
+        gameState.GameTime = gameTime
+    }
+
+    var stderr io.Writer
+    if !parseResult.mute {
+        stderr = os.Stderr
+    }
+
+    results := make([]BotResult, 0, len(parseResult.bots))
+    processes := make(map[BotId]*BotProcess)
+    missed := make(map[BotId]int)
+    lastCommands := make(map[BotId]BotCommand)
+    defer func() {
+        for _, process := range processes {
+            process.Stop()
+        }
+    }()
+
+    finish := func(botKill BotKill, survived bool) {
+        results = append(results, BotResult{
+            Game:       gameIndex,
+            Seed:       seed,
+            Bot:        int(botKill.BotId),
+            Name:       botKill.Name,
+            Team:       settings.TeamName(botKill.Name),
+            Survived:   survived,
+            Missed:     missed[botKill.BotId],
+            Statistics: botKill.StatisticsThisGame,
+        })
+        botId := botKill.BotId
+        if process, ok := processes[botId]; ok {
+            process.Stop()
+            delete(processes, botId)
+        }
+    }
+
+    // The ids start at 1, the simulation uses 0 for no bot.
+    for index, definition := range parseResult.bots {
+        botId := BotId(index + 1)
+        process, err := StartBotProcess(definition.Command, stderr)
+        if err != nil {
+            return results, errors.New(fmt.Sprintf("Could not start the bot '%v': %v", definition.Name, err.Error()))
+        }
+        processes[botId] = process
+
+        bot, ok := CreateStartingBot(&gameState, &settings, BotInfo{ Name: definition.Name }, Statistics{})
+        if !ok {
+            return results, errors.New("Due to a spawn image with a 0 spawn rate, there is no possible spawn position for the bots.")
+        }
+        gameState.Bots[botId] = bot
+    }
+
+    startingTeams := numberOfTeams(gameState.Bots)
+
+    for simulationStepCounter := 0; gameState.GameTime > 0 && len(gameState.Bots) > 0; simulationStepCounter++ {
+        if parseResult.lastTeam && startingTeams > 1 && numberOfTeams(gameState.Bots) <= 1 {
+            break
+        }
+
+        ////////////////////////////////////////////////////////////////
+        // EXCHANGE WITH THE BOTS
+        ////////////////////////////////////////////////////////////////
+        // Every bot that is finished has no process any more.
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            if _, ok := processes[botId]; !ok {
+                Logf(LtDebug, "Bot %v has no process.\n", botId)
+                delete(gameState.Bots, botId)
+            }
+        }
+        botIds := SortedBotIds(gameState.Bots)
+        responses := make([]string, len(botIds))
+        errs := make([]error, len(botIds))
+        {
+            lines := make([]string, len(botIds))
+            for i, botId := range botIds {
+                message, _ := MakeServerMiddlewareGameState(&gameState, &settings, botId, simulationStepCounter)
+                line, err := parseResult.protocol.EncodeGameState(message)
+                if err != nil {
+                    return results, errors.New(fmt.Sprintf("Could not encode the game state for bot %v: %v", botId, err.Error()))
+                }
+                lines[i] = line
+            }
+
+            var wg sync.WaitGroup
+            for i, botId := range botIds {
+                wg.Add(1)
+                go func(i int, process *BotProcess, line string) {
+                    defer wg.Done()
+                    responses[i], errs[i] = process.Exchange(line, parseResult.deadline)
+                }(i, processes[botId], lines[i])
+            }
+            wg.Wait()
+        }
+
+        // The answers are applied in the order of the ids, so the game does not depend on the timing of the bots.
+        for i, botId := range botIds {
+            bot := gameState.Bots[botId]
+            if errs[i] == ErrBotLate {
+                missed[botId] += 1
+                if command, ok := lastCommands[botId]; ok && parseResult.latePolicy == LpRepeat {
+                    bot.Command = command
+                    gameState.Bots[botId] = bot
+                }
+                continue
+            }
+            if errs[i] != nil {
+                Logf(LtDebug, "Bot %v (%v) has stopped answering.\n", botId, bot.Info.Name)
+                delete(gameState.Bots, botId)
+                finish(NewBotKill(botId, bot), false)
+                continue
+            }
+
+            command, err := parseResult.protocol.DecodeBotCommand(responses[i])
+            if err != nil {
+                Logf(LtDebug, "Could not read the response of bot %v (%v): \"%v\". %v\n", botId, bot.Info.Name, responses[i], err.Error())
+                continue
+            }
+            bot.Command = command
+            gameState.Bots[botId] = bot
+            lastCommands[botId] = command
+        }
+
+        ////////////////////////////////////////////////////////////////
+        // SIMULATION
+        ////////////////////////////////////////////////////////////////
+        profile := NewProfile()
+        StartProfileEvent(&profile, "Simulation")
+        deadBots, _, _ := Update(&gameState, &settings, &profile, FixedTimeStep, simulationStepCounter)
+        EndProfileEvent(&profile)
+
+        Replenish(&gameState, &settings)
+
+        // A bot that starved is still in the game state, without any blobs.
+        for _, botKill := range deadBots {
+            delete(gameState.Bots, botKill.BotId)
+            finish(botKill, false)
+        }
+
+        for botId, bot := range gameState.Bots {
+            bot.Command = bot.Command.WithoutActions()
+            gameState.Bots[botId] = bot
+        }
+    }
+
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        finish(NewBotKill(botId, gameState.Bots[botId]), true)
+    }
+
+    return results, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Main
+//
+////////////////////////////////////////////////////////////////////////
+
+func main() {
+    parseResult, err := parseArguments()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n\n", err.Error())
+        usage()
+        os.Exit(1)
+    }
+    SetLoggingDebug(parseResult.debug)
+    SetLoggingPrefix("BATCH")
+
+    var games Games
+    if parseResult.gameName != "" {
+        if games, err = ReadGames(gamesFile); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not read %v: %v\n", gamesFile, err.Error())
+            os.Exit(1)
+        }
+    }
+
+    settings, gameTime, err := makeSettings(games, parseResult.gameName, parseResult.physics)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+        os.Exit(1)
+    }
+    if len(parseResult.bots) > settings.MaxNumberOfBots {
+        fmt.Fprintf(os.Stderr, "The game allows only %v bots.\n", settings.MaxNumberOfBots)
+        os.Exit(1)
+    }
+
+    var out io.Writer = os.Stdout
+    if parseResult.outPath != "" {
+        file, err := os.Create(parseResult.outPath)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Could not create %v: %v\n", parseResult.outPath, err.Error())
+            os.Exit(1)
+        }
+        defer file.Close()
+        out = file
+    } else if !parseResult.debug {
+        // The log is written to stdout as well.
+        SetLoggingMute(true)
+    }
+
+    results := make([]BotResult, 0, parseResult.numGames * len(parseResult.bots))
+    for i := 0; i < parseResult.numGames; i++ {
+        gameResults, err := runGame(parseResult, settings, gameTime, i)
+        results = append(results, gameResults...)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Game %v failed: %v\n", i, err.Error())
+            break
+        }
+        fmt.Fprintf(os.Stderr, "Game %v of %v finished.\n", i + 1, parseResult.numGames)
+    }
+
+    if err := writeResults(out, parseResult.format, results); err != nil {
+        fmt.Fprintf(os.Stderr, "Could not write the results: %v\n", err.Error())
+        os.Exit(1)
+    }
+}
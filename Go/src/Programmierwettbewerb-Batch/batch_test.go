@@ -0,0 +1,75 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/protocol"
+
+    "io/ioutil"
+    "os"
+    "testing"
+)
+
+// A bot that always steers to the center.
+func writeTestBot(t *testing.T) string {
+    script, err := ioutil.TempFile("", "bot")
+    if err != nil {
+        t.Fatal(err)
+    }
+    script.WriteString("while read line; do echo \"none,500,500\"; done\n")
+    script.Close()
+    return script.Name()
+}
+
+func TestStarvingBotsLeaveTheGame(t *testing.T) {
+    script := writeTestBot(t)
+    defer os.Remove(script)
+
+    settings := NewSettings()
+    settings.MaxNumberOfFoods  = 0
+    settings.MaxNumberOfToxins = 0
+    settings.FoodDistribution  = nil
+    settings.ToxinDistribution = nil
+    settings.BotDistribution   = []Vec2{ { X: 200, Y: 200 }, { X: 800, Y: 800 } }
+    // Without food every blob loses half of its mass in each step.
+    settings.Physics.MassLoss = 0.5 * float64(settings.Physics.BotMaxMass) / FixedTimeStep
+
+    parseResult := ParseResult{
+        bots:       BotDefinitions{ { Name: "a", Command: "sh " + script }, { Name: "b", Command: "sh " + script } },
+        protocol:   BpText,
+        mute:       true,
+    }
+
+    results, err := runGame(parseResult, settings, 10, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(results) != 2 {
+        t.Fatalf("the results are %+v", results)
+    }
+    for i, result := range results {
+        // The ids start at 1.
+        if result.Survived || result.Bot != i + 1 {
+            t.Errorf("the result of bot %v is %+v", i, result)
+        }
+    }
+}
+
+func TestMakeSettingsOfABigMap(t *testing.T) {
+    games, err := ReadGames("../../../games.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    settings, gameTime, err := makeSettings(games, "big_map", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    game := games["big_map"]
+    if settings.FieldSize != (Vec2{ X: 10000, Y: 10000 }) || settings.FieldSize != game.FieldSize {
+        t.Errorf("the field size is %v", settings.FieldSize)
+    }
+    if settings.MaxNumberOfBots != game.MaxBots || gameTime != game.GameTime {
+        t.Errorf("%v bots for %v seconds", settings.MaxNumberOfBots, gameTime)
+    }
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+    .   "Programmierwettbewerb-Server/vector"
+    .   "Programmierwettbewerb-Server/shared"
+    .   "Programmierwettbewerb-Server/connections"
+    .   "Programmierwettbewerb-Server/simulation"
+    .   "Programmierwettbewerb-Server/protocol"
+    ai  "Programmierwettbewerb-Server/ai"
+
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+    "sort"
+    "strings"
+)
+
+// -------------------------------------------------------------------------------------------------
+// Local Arena
+// -------------------------------------------------------------------------------------------------
+
+// With -local the middleware runs the game itself. The bot plays against the
+// built-in opponents, without a server and without a network. The game runs
+// in lockstep and as fast as possible, so a seed always gives the same game.
+
+const (
+    // The game time between two progress lines.
+    localProgressInterval = 10.0
+    // The simulation uses 0 for no bot. The opponents follow.
+    localBotId            = BotId(1)
+)
+
+// Prepares a situation at the start of the game. The opponents are sorted by id.
+type Scenario func(gameState *GameState, settings *ServerSettings, opponents []BotId) error
+
+var scenarios = map[string]Scenario{
+    "":         func(gameState *GameState, settings *ServerSettings, opponents []BotId) error { return nil },
+    "toxin":    scenarioToxin,
+    "hunted":   scenarioHunted,
+    "prey":     scenarioPrey,
+    "crowd":    scenarioCrowd,
+}
+
+func scenarioNames() []string {
+    names := make([]string, 0, len(scenarios))
+    for name := range scenarios {
+        if name != "" {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// The bot is big enough to explode and starts right next to a toxin.
+func scenarioToxin(gameState *GameState, settings *ServerSettings, opponents []BotId) error {
+    blob := setMass(gameState, localBotId, 2 * settings.Physics.MinBlobMassToExplode)
+    toxinId := SortedToxinIds(gameState.Toxins)
+    if len(toxinId) == 0 {
+        return errors.New("There are no toxins in this game.")
+    }
+    toxin := gameState.Toxins[toxinId[0]]
+    toxin.Position = nextTo(settings, blob.Position, blob.Radius() + Radius(toxin.Mass) + 5)
+    gameState.Toxins[toxinId[0]] = toxin
+    return nil
+}
+
+// A much bigger opponent starts next to the bot.
+func scenarioHunted(gameState *GameState, settings *ServerSettings, opponents []BotId) error {
+    if len(opponents) == 0 {
+        return errors.New("The scenario needs at least one opponent.")
+    }
+    blob := gameState.Bots[localBotId].Blobs[0]
+    hunter := setMass(gameState, opponents[0], 10 * blob.Mass)
+    placeBot(gameState, opponents[0], nextTo(settings, blob.Position, blob.Radius() + hunter.Radius() + 20))
+    return nil
+}
+
+// The bot is big and a small opponent starts next to it.
+func scenarioPrey(gameState *GameState, settings *ServerSettings, opponents []BotId) error {
+    if len(opponents) == 0 {
+        return errors.New("The scenario needs at least one opponent.")
+    }
+    blob := setMass(gameState, localBotId, 500)
+    prey := setMass(gameState, opponents[0], 50)
+    placeBot(gameState, opponents[0], nextTo(settings, blob.Position, blob.Radius() + prey.Radius() + 20))
+    return nil
+}
+
+// All opponents start on a circle around the bot.
+func scenarioCrowd(gameState *GameState, settings *ServerSettings, opponents []BotId) error {
+    if len(opponents) == 0 {
+        return errors.New("The scenario needs at least one opponent.")
+    }
+    center := gameState.Bots[localBotId].Blobs[0].Position
+    for i, botId := range opponents {
+        angle := 2 * math.Pi * float64(i) / float64(len(opponents))
+        position := Add(center, Vec2{ X: float32(math.Cos(angle)) * 100, Y: float32(math.Sin(angle)) * 100 })
+        limitToField(settings, &position)
+        placeBot(gameState, botId, position)
+    }
+    return nil
+}
+
+// The bots start with a single blob with the id 0.
+func setMass(gameState *GameState, botId BotId, mass float32) Blob {
+    bot := gameState.Bots[botId]
+    blob := bot.Blobs[0]
+    blob.Mass = mass
+    bot.Blobs[0] = blob
+    bot.StatisticsThisGame.MaxSize = mass
+    gameState.Bots[botId] = bot
+    return blob
+}
+
+func placeBot(gameState *GameState, botId BotId, position Vec2) {
+    bot := gameState.Bots[botId]
+    blob := bot.Blobs[0]
+    blob.Position = position
+    bot.Blobs[0] = blob
+    gameState.Bots[botId] = bot
+}
+
+// A position in the given distance, on the side with more space.
+func nextTo(settings *ServerSettings, position Vec2, distance float32) Vec2 {
+    direction := Vec2{ X: 1 }
+    if position.X > settings.FieldSize.X / 2 {
+        direction.X = -1
+    }
+    result := Add(position, Muls(direction, distance))
+    limitToField(settings, &result)
+    return result
+}
+
+func limitToField(settings *ServerSettings, position *Vec2) {
+    position.X = float32(math.Max(0, math.Min(float64(position.X), float64(settings.FieldSize.X))))
+    position.Y = float32(math.Max(0, math.Min(float64(position.Y), float64(settings.FieldSize.Y))))
+}
+
+// -------------------------------------------------------------------------------------------------
+
+type localOpponent struct {
+    botId       BotId
+    bot         ai.Bot
+}
+
+func parseOpponents(list string) []string {
+    var names []string
+    for _, name := range strings.Split(list, ",") {
+        if name = strings.TrimSpace(name); name != "" {
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+func botMass(bot Bot) float32 {
+    var mass float32
+    for _, blob := range bot.Blobs {
+        mass += blob.Mass
+    }
+    return mass
+}
+
+func printLocalResult(botKill BotKill, survived bool, mass float32) {
+    state := "died"
+    if survived {
+        state = "survived"
+    }
+    statistics := botKill.StatisticsThisGame
+    Logf(LtAlways, "    %-16v %-8v mass %7.1f, max size %7.1f, survival time %5.1fs, blobs eaten %v, bots eaten %v, splits %v\n",
+        botKill.Name, state, mass, statistics.MaxSize, statistics.MaxSurvivalTime, statistics.BlobKillCount, statistics.BotKillCount, statistics.SplitCount)
+}
+
+func runLocal(parseResult ParseResult, protocol BotProtocol) error {
+    scenario, ok := scenarios[parseResult.scenario]
+    if !ok {
+        return errors.New(fmt.Sprintf("There is no scenario \"%v\". Possible scenarios are: %v.", parseResult.scenario, strings.Join(scenarioNames(), ", ")))
+    }
+
+    settings := NewSettings()
+    settings.MinNumberOfBots = 0
+    // The spawn images are only available on the server.
+    if len(settings.FoodDistribution) == 0 {
+        settings.FoodDistribution  = UniformDistribution(settings.FieldSize)
+        settings.ToxinDistribution = UniformDistribution(settings.FieldSize)
+        settings.BotDistribution   = UniformDistribution(settings.FieldSize)
+    }
+
+    gameState := NewGameState(settings, rand.New(rand.NewSource(parseResult.seed)))
+    gameState.GameTime = float32(parseResult.localTime)
+
+    //
+    // The bot and the opponents
+    //
+    name := parseResult.botName
+    if name == "" {
+        name = "me"
+    }
+    bot, ok := CreateStartingBot(&gameState, &settings, BotInfo{ Name: name }, Statistics{})
+    if !ok {
+        return errors.New("There is no spawn position for the bot.")
+    }
+    gameState.Bots[localBotId] = bot
+
+    var opponents []localOpponent
+    var opponentIds []BotId
+    for i, opponentName := range parseOpponents(parseResult.opponents) {
+        opponentBot, err := ai.NewBot(opponentName, rand.New(rand.NewSource(parseResult.seed + int64(i) + 1)))
+        if err != nil {
+            return err
+        }
+        botId := localBotId + BotId(i + 1)
+        bot, ok := CreateStartingBot(&gameState, &settings, BotInfo{ Name: fmt.Sprintf("%v-%v", opponentName, i + 1) }, Statistics{})
+        if !ok {
+            return errors.New("There is no spawn position for the opponents.")
+        }
+        gameState.Bots[botId] = bot
+        opponents = append(opponents, localOpponent{ botId: botId, bot: opponentBot })
+        opponentIds = append(opponentIds, botId)
+    }
+
+    if err := scenario(&gameState, &settings, opponentIds); err != nil {
+        return errors.New(fmt.Sprintf("The scenario \"%v\" can not be used: %v", parseResult.scenario, err.Error()))
+    }
+
+    process, err := startBot(parseResult)
+    if err != nil {
+        return errors.New(fmt.Sprintf("Could not start the bot. Error: %v", err.Error()))
+    }
+    defer process.Stop()
+
+    Logf(LtAlways, "Local game with seed %v, scenario \"%v\" and %v opponents: %v\n", parseResult.seed, parseResult.scenario, len(opponents), parseResult.opponents)
+
+    //
+    // The game
+    //
+    var results []func()
+    nextProgress := gameState.GameTime - localProgressInterval
+    for step := 0; gameState.GameTime > 0; step++ {
+        if _, alive := gameState.Bots[localBotId]; !alive {
+            break
+        }
+
+        message, _ := MakeServerMiddlewareGameState(&gameState, &settings, localBotId, step)
+        line, err := protocol.EncodeGameState(message)
+        if err != nil {
+            return errors.New(fmt.Sprintf("Could not encode the game state: %v", err.Error()))
+        }
+        // A local game waits for the bot, so it can be debugged.
+        response, err := process.Exchange(line, 0)
+        if err != nil {
+            return errors.New("Your bot has stopped answering.")
+        }
+        command, err := protocol.DecodeBotCommand(response)
+        if err != nil {
+            return errors.New(fmt.Sprintf("Something is wrong with your bot. We could not read your response: %v\nYou sent us: \"%v\"\nWe sent you: \"%v\"", err.Error(), response, line))
+        }
+        bot := gameState.Bots[localBotId]
+        bot.Command = command
+        gameState.Bots[localBotId] = bot
+
+        for _, opponent := range opponents {
+            if bot, ok := gameState.Bots[opponent.botId]; ok {
+                message, _ := MakeServerMiddlewareGameState(&gameState, &settings, opponent.botId, step)
+                bot.Command = opponent.bot.Command(message)
+                gameState.Bots[opponent.botId] = bot
+            }
+        }
+
+        profile := NewProfile()
+        deadBots, _, _ := Update(&gameState, &settings, &profile, FixedTimeStep, step)
+        Replenish(&gameState, &settings)
+
+        // A bot that starved is still in the game state, without any blobs.
+        for _, botKill := range deadBots {
+            botKill := botKill
+            delete(gameState.Bots, botKill.BotId)
+            Logf(LtAlways, "%6.1fs left: %v died.\n", gameState.GameTime, botKill.Name)
+            results = append(results, func() { printLocalResult(botKill, false, 0) })
+        }
+
+        for botId, bot := range gameState.Bots {
+            bot.Command = bot.Command.WithoutActions()
+            gameState.Bots[botId] = bot
+        }
+
+        if gameState.GameTime <= nextProgress {
+            nextProgress -= localProgressInterval
+            if bot, ok := gameState.Bots[localBotId]; ok {
+                Logf(LtAlways, "%6.1fs left: your mass is %.1f in %v blobs.\n", gameState.GameTime, botMass(bot), len(bot.Blobs))
+            }
+        }
+    }
+
+    Logf(LtAlways, "Game over.\n")
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        printLocalResult(NewBotKill(botId, bot), true, botMass(bot))
+    }
+    for _, result := range results {
+        result()
+    }
+    return nil
+}
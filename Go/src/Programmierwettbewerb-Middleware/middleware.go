@@ -3,6 +3,8 @@ package main
 import (
     vec "Programmierwettbewerb-Server/vector"
     .   "Programmierwettbewerb-Server/shared"
+    .   "Programmierwettbewerb-Server/protocol"
+    ai  "Programmierwettbewerb-Server/ai"
 
     "golang.org/x/net/websocket"
     "github.com/BurntSushi/toml"
@@ -11,15 +13,11 @@ import (
     "time"
     "flag"
     "sync"
-    "os/exec"
-    "bufio"
     "io"
-    "strconv"
     "errors"
-    "regexp"
-    "strings"
     "math"
     "math/rand"
+    "strings"
     //"bytes"
     //"reflect"
     //"io/ioutil"
@@ -36,6 +34,15 @@ const (
     // This is used, when no connection is given via command line argument.
     //globalDefaultAddress string = "ws://127.0.0.1:8080/middleware/"
     globalDefaultAddress string = "ws://cagine.fh-wedel.de:8080/middleware/"
+
+    // How long the bot may think about a game state, when nothing else is given.
+    defaultDeadline = 100 * time.Millisecond
+    // How often the latencies of the bot are sent to the server.
+    latencyReportInterval = 5 * time.Second
+
+    // The pause before the first attempt to reconnect. It doubles with every attempt.
+    reconnectMinBackoff = 250 * time.Millisecond
+    reconnectMaxBackoff = 4 * time.Second
 )
 
 
@@ -44,6 +51,11 @@ type Config struct {
     Name       string
     Bot        string
     Connection string
+    Token      string
+    Protocol   string
+    // In milliseconds.
+    Deadline   int
+    Late       string
 }
 
 
@@ -51,13 +63,18 @@ type Config struct {
 
 func usage() {
     fmt.Fprintf(os.Stderr, "NAME\n")
-    fmt.Fprintf(os.Stderr, "    Programmierwettbewerb-Middleware [-bot=BOT] [-name=NAME] [-numBots=NUM]\n")
+    fmt.Fprintf(os.Stderr, "    Programmierwettbewerb-Middleware [-bot=BOT] [-name=NAME] [-token=TOKEN] [-protocol=PROTOCOL] [-deadline=MS] [-late=POLICY] [-numBots=NUM]\n")
+    fmt.Fprintf(os.Stderr, "    Programmierwettbewerb-Middleware -local [-bot=BOT] [-protocol=PROTOCOL] [-opponents=OPPONENTS] [-scenario=SCENARIO] [-seed=SEED] [-time=SECONDS]\n")
     fmt.Fprintf(os.Stderr, "\n")
     fmt.Fprintf(os.Stderr, "CONFIG\n")
     fmt.Fprintf(os.Stderr, "    There should be a config file middleware.conf to define the default parameters:\n")
     fmt.Fprintf(os.Stderr, "\n")
     fmt.Fprintf(os.Stderr, "        name=\"myname\"\n")
     fmt.Fprintf(os.Stderr, "        bot=\"java mybot arg1 arg2 ...\"\n")
+    fmt.Fprintf(os.Stderr, "        token=\"the token of your repository\"\n")
+    fmt.Fprintf(os.Stderr, "        protocol=\"json\"\n")
+    fmt.Fprintf(os.Stderr, "        deadline=100\n")
+    fmt.Fprintf(os.Stderr, "        late=\"repeat\"\n")
     fmt.Fprintf(os.Stderr, "\n")
     fmt.Fprintf(os.Stderr, "    When arguments are provided to the program directly they will override the config file entries.\n")
     fmt.Fprintf(os.Stderr, "\n")
@@ -68,8 +85,52 @@ func usage() {
     fmt.Fprintf(os.Stderr, "    NAME\n")
     fmt.Fprintf(os.Stderr, "        name from your bot.names\n")
     fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    TOKEN\n")
+    fmt.Fprintf(os.Stderr, "        secret token of your repository, you get it from the organizers\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    PROTOCOL\n")
+    fmt.Fprintf(os.Stderr, "        text (default): the game state is sent as ([Blob], [Blob], [Food], [Toxin]),\n")
+    fmt.Fprintf(os.Stderr, "            the bot answers with Action,Target.X,Target.Y\n")
+    fmt.Fprintf(os.Stderr, "        json: the game state is sent as one JSON object per line,\n")
+    fmt.Fprintf(os.Stderr, "            the bot answers with one object per line: {\"action\":\"split\",\"target\":{\"x\":162,\"y\":925}}\n")
+    fmt.Fprintf(os.Stderr, "            single blobs can be steered with \"blobs\":[{\"index\":3,\"action\":\"throw\",\"target\":{\"x\":10,\"y\":20}}]\n")
+    fmt.Fprintf(os.Stderr, "            on maps with walls, \"walls\" has the solid rectangles in the view window: [{\"pos\":{\"X\":0,\"Y\":0},\"size\":{\"X\":10,\"Y\":10}}]\n")
+    fmt.Fprintf(os.Stderr, "            before a game starts, the bot waits without blobs: \"lobby\" is true and \"countdown\" has the seconds until the start\n")
+    fmt.Fprintf(os.Stderr, "            (-1 while the start is not planned yet), a text bot gets its first game state at the start\n")
+    fmt.Fprintf(os.Stderr, "            when the time of the game is over, \"gameOver\" has the winners and the standings of all players:\n")
+    fmt.Fprintf(os.Stderr, "            {\"game\":\"final\",\"scoring\":\"mass\",\"winners\":[\"team1\"],\"standings\":[{\"place\":1,\"player\":\"team1\",\"score\":812,...}]}\n")
+    fmt.Fprintf(os.Stderr, "            the middleware also logs them\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    MS\n")
+    fmt.Fprintf(os.Stderr, "        milliseconds your bot may think about a game state (default 100, 0 waits forever)\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    POLICY\n")
+    fmt.Fprintf(os.Stderr, "        what is sent to the server for a game state without an answer in time:\n")
+    fmt.Fprintf(os.Stderr, "        repeat (default): the last command again, skip: nothing\n")
+    fmt.Fprintf(os.Stderr, "        late answers are still sent, when they arrive\n")
+    fmt.Fprintf(os.Stderr, "\n")
     fmt.Fprintf(os.Stderr, "    NUM\n")
     fmt.Fprintf(os.Stderr, "        number of bots to spawn\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "LOCAL GAMES\n")
+    fmt.Fprintf(os.Stderr, "    With -local there is no server. The middleware runs the game itself, as fast as your bot answers.\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    OPPONENTS\n")
+    fmt.Fprintf(os.Stderr, "        comma separated list of built-in bots (default food,food,food): %v\n", strings.Join(ai.BotNames(), ", "))
+    fmt.Fprintf(os.Stderr, "        with an optional level easy, medium (default) or hard, e.g. hunter:hard\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    SCENARIO\n")
+    fmt.Fprintf(os.Stderr, "        a situation to start in (default none):\n")
+    fmt.Fprintf(os.Stderr, "        toxin: your bot is big and starts next to a toxin\n")
+    fmt.Fprintf(os.Stderr, "        hunted: the first opponent is much bigger and starts next to your bot\n")
+    fmt.Fprintf(os.Stderr, "        prey: your bot is big and the first opponent is small and starts next to it\n")
+    fmt.Fprintf(os.Stderr, "        crowd: all opponents start around your bot\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    SEED\n")
+    fmt.Fprintf(os.Stderr, "        the same seed gives the same game, as long as your bot does the same (default 1)\n")
+    fmt.Fprintf(os.Stderr, "\n")
+    fmt.Fprintf(os.Stderr, "    SECONDS\n")
+    fmt.Fprintf(os.Stderr, "        length of the game in game seconds (default 120)\n")
 }
 
 // -------------------------------------------------------------------------------------------------
@@ -112,8 +173,17 @@ type ParseResult struct {
     mute        bool
     botPath     string
     botName     string
+    botToken    string
+    protocol    string
+    deadline    int
+    late        string
     numBots     int
     serverURL   string
+    local       bool
+    opponents   string
+    scenario    string
+    seed        int64
+    localTime   int
 }
 
 func parseArguments() (parseResult ParseResult, e error) {
@@ -124,8 +194,17 @@ func parseArguments() (parseResult ParseResult, e error) {
     var muteFlag        = flag.Bool("mute", false, "Mute the output.")
     var botPath         = flag.String("bot", "", "Path to the bot")
     var botName         = flag.String("name", "", "Test name")
+    var botToken        = flag.String("token", "", "Token of the repository")
+    var protocolFlag    = flag.String("protocol", "", "Protocol between the middleware and the bot: text or json")
+    var deadlineFlag    = flag.Int("deadline", -1, "Milliseconds the bot may think about a game state")
+    var lateFlag        = flag.String("late", "", "What is sent for a game state without an answer in time: repeat or skip")
     var numBotsFlag     = flag.Int("numBots", 1, "Number of bots to start.")
     var serverURLFlag   = flag.String("connection", "", "URL to connect to the server")
+    var localFlag       = flag.Bool("local", false, "Play a local game without a server")
+    var opponentsFlag   = flag.String("opponents", "food,food,food", "Built-in opponents of a local game")
+    var scenarioFlag    = flag.String("scenario", "", "Situation at the start of a local game")
+    var seedFlag        = flag.Int64("seed", 1, "Seed of a local game")
+    var timeFlag        = flag.Int("time", 120, "Game seconds of a local game")
 
     flag.Parse()
 
@@ -135,8 +214,17 @@ func parseArguments() (parseResult ParseResult, e error) {
         mute:       *muteFlag,
         botPath:    *botPath,
         botName:    *botName,
+        botToken:   *botToken,
+        protocol:   *protocolFlag,
+        deadline:   *deadlineFlag,
+        late:       *lateFlag,
         numBots:    *numBotsFlag,
         serverURL:  *serverURLFlag,
+        local:      *localFlag,
+        opponents:  *opponentsFlag,
+        scenario:   *scenarioFlag,
+        seed:       *seedFlag,
+        localTime:  *timeFlag,
     }
 
     return result, nil
@@ -147,61 +235,30 @@ func parseArguments() (parseResult ParseResult, e error) {
 type ServerConnection struct {
     GameStateFromServer     chan(ServerMiddlewareGameState)
     BotCommandToServer      chan(BotCommand)
+    LatencyToServer         chan(LatencyHistogram)
 }
 
 // -------------------------------------------------------------------------------------------------
 
-type Bot struct {
-    process     *exec.Cmd
-    stdin       io.WriteCloser
-    stdout      io.ReadCloser
-    stderr      io.ReadCloser
+type Timing struct {
+    // Zero waits forever.
+    deadline    time.Duration
+    latePolicy  LatePolicy
 }
 
-func startBot(parseResults ParseResult) (bot Bot, error error) {
-
-
-    commandString := parseResults.botPath
-    stringList := strings.Fields(commandString)
-
-    bot.process = exec.Command(stringList[0], stringList[1:]...)
-
-    stdin, err := bot.process.StdinPipe()
-    if err != nil {
-        return bot, err
-    }
-    bot.stdin = stdin
-
-    stdout, err := bot.process.StdoutPipe()
-    if err != nil {
-        return bot, err
-    }
-    bot.stdout = stdout
-
-    stderr, err := bot.process.StderrPipe()
-    if err != nil {
-        return bot, err
-    }
-    bot.stderr = stderr
+// -------------------------------------------------------------------------------------------------
 
+func startBot(parseResults ParseResult) (*BotProcess, error) {
     // Pass everything that the bot sends on stderr to stdout
+    var stderr io.Writer
     if !parseResults.mute {
-        bot.process.Stderr = os.Stdout
-    }
-
-    if err = bot.process.Start(); err != nil {
-        return bot, err
+        stderr = os.Stdout
     }
-
-    return bot, nil
+    return StartBotProcess(parseResults.botPath, stderr)
 }
 
-func stopBot(bot Bot) {
-    bot.stdin.Close()
-    bot.stdout.Close()
-    bot.stderr.Close()
-
-    if err := bot.process.Process.Kill(); err != nil {
+func stopBot(bot *BotProcess) {
+    if err := bot.Stop(); err != nil {
         fatalExit(fmt.Sprintf("Could not kill the bot. Error: %v\n", err.Error()), ecBotProblem)
     }
 }
@@ -234,11 +291,9 @@ func connectionIsTerminated(runningState chan(bool), test string) bool {
 }
 
 
-func setupServerConnection(address string, botInfo BotInfo, runningState chan(bool), wg sync.WaitGroup) (serverConnection ServerConnection, error error) {
-    connection := ServerConnection{
-        GameStateFromServer:    make(chan ServerMiddlewareGameState, 1),
-        BotCommandToServer:     make(chan BotCommand),
-    }
+// Dials the server and registers the bot. With a session the bot of the session is resumed instead.
+func connectToServer(address string, botInfo BotInfo, session string) (*websocket.Conn, ServerMiddlewareRegistration, error) {
+    var registration ServerMiddlewareRegistration
 
     //
     // Connect to the websocket server
@@ -246,7 +301,7 @@ func setupServerConnection(address string, botInfo BotInfo, runningState chan(bo
     origin := "http://localhost/" // TODO(henk): What is the origin?
     ws, err := websocket.Dial(address, "", origin)
     if err != nil {
-        return connection, errors.New(fmt.Sprintf("Could not connect to server:  %v\n", err.Error()))
+        return nil, registration, errors.New(fmt.Sprintf("Could not connect to server:  %v\n", err.Error()))
     }
 
     //
@@ -257,72 +312,109 @@ func setupServerConnection(address string, botInfo BotInfo, runningState chan(bo
         BotCommand:         nil,
         BotInfo:            &botInfo,
     }
-    websocket.JSON.Send(ws, message)
+    if session != "" {
+        botInfo.Token = ""
+        message.Session = session
+    }
+    if err := websocket.JSON.Send(ws, message); err != nil {
+        ws.Close()
+        return nil, registration, errors.New(fmt.Sprintf("Could not register at the server: %v\n", err.Error()))
+    }
+
+    if err := websocket.JSON.Receive(ws, &registration); err != nil {
+        ws.Close()
+        return nil, registration, errors.New(fmt.Sprintf("The server did not answer the registration: %v\n", err.Error()))
+    }
+    if registration.Error != "" {
+        ws.Close()
+        return nil, registration, errors.New(fmt.Sprintf("The server refused the registration: %v\n", registration.Error))
+    }
+
+    return ws, registration, nil
+}
+
+// Tries to resume the session with growing pauses, until the server gives up the bot.
+func reconnect(address string, botInfo BotInfo, registration ServerMiddlewareRegistration, runningState chan(bool)) (*websocket.Conn, error) {
+    gracePeriod := time.Duration(float64(registration.GracePeriod) * float64(time.Second))
+    start := time.Now()
+    backoff := reconnectMinBackoff
+
+    for time.Since(start) < gracePeriod {
+        if connectionIsTerminated(runningState, "reconnect") {
+            return nil, errors.New("The middleware is shutting down.")
+        }
+
+        Logf(LtAlways, "The connection to the server dropped. Reconnecting in %v...\n", backoff)
+        time.Sleep(backoff)
+
+        ws, answer, err := connectToServer(address, botInfo, registration.Session)
+        if err == nil {
+            Logf(LtAlways, "Resumed the session of bot %v.\n", answer.BotId)
+            return ws, nil
+        }
+        if answer.Error != "" && !answer.Retry {
+            return nil, err
+        }
+        Logf(LtDebug, "%v", err.Error())
+
+        backoff *= 2
+        if backoff > reconnectMaxBackoff {
+            backoff = reconnectMaxBackoff
+        }
+    }
+    return nil, errors.New("The server has given up the bot.")
+}
+
+func setupServerConnection(address string, botInfo BotInfo, runningState chan(bool), wg sync.WaitGroup) (serverConnection ServerConnection, error error) {
+    connection := ServerConnection{
+        GameStateFromServer:    make(chan ServerMiddlewareGameState, 1),
+        BotCommandToServer:     make(chan BotCommand),
+        LatencyToServer:        make(chan LatencyHistogram, 1),
+    }
 
+    ws, registration, err := connectToServer(address, botInfo, "")
+    if err != nil {
+        return connection, err
+    }
+    Logf(LtDebug, "Registered as bot %v.\n", registration.BotId)
 
     //
-    // Receive the messages from the server
+    // The channels stay the same, when the connection is resumed
     //
     wg.Add(1)
     go func() {
         defer wg.Done()
         for {
+            serveConnection(ws, connection, runningState)
 
-            if connectionIsTerminated(runningState, "from Server") {
-                Logf(LtDebug, "Receiving from Server has stopped.\n")
+            if connectionIsTerminated(runningState, "after connection") {
                 break
             }
 
-            var bytes []byte
-            err := websocket.Message.Receive(ws, &bytes)
-
-            var message ServerMiddlewareGameState
-            err = json.Unmarshal(bytes, &message)
-
+            ws, err = reconnect(address, botInfo, registration, runningState)
             if err != nil {
-                Logf(LtDebug, "Receive failed: %v\n", err.Error())
-                terminateNonBlocking(runningState, "from Server 2")
+                Logf(LtAlways, "Could not resume the session: %v\n", err.Error())
+                terminateNonBlocking(runningState, "reconnect 2")
                 break
             }
-
-            messageString := abbreviate(fmt.Sprintf("%v", message), 32)
-            Logf(LtDebug | LtVerbose, "Received message from the server: %v.\n", messageString)
-
-
-            select {
-            case connection.GameStateFromServer <- message: // Put message in the channel unless it is full
-                Logf(LtDebug | LtVerbose, "Added to channel 'fromServer': \"%v\"\n", messageString)
-            default:
-                //Logln(LtDebug, "Channel for messages from the server is full.")
-
-                // Read message from the channel to free it and try again!
-                //var message ServerMiddlewareGameState
-                select {
-                case msg := <-serverConnection.GameStateFromServer:
-                    //message = msg
-                    msg = msg
-                    select {
-                    case connection.GameStateFromServer <- message:
-                    default:
-                        Logf(LtDebug, "SHIIIIIIIT!!!\n")
-                    }
-
-                default:
-                    // Right now there is nothing to read from the channel!
-                    // Maybe next time :)
-                    //continue
-                }
-            }
         }
         Logf(LtDebug, "Finished for good. 1.\n")
     }()
 
+    return connection, nil
+}
+
+// Passes the messages between the websocket and the channels until the connection drops.
+func serveConnection(ws *websocket.Conn, connection ServerConnection, runningState chan(bool)) {
+    done := make(chan struct{})
+    var sending sync.WaitGroup
+
     //
     // Send messages to the server
     //
-    wg.Add(1)
+    sending.Add(1)
     go func() {
-        defer wg.Done()
+        defer sending.Done()
         for {
 
             if connectionIsTerminated(runningState, "to Server") {
@@ -330,281 +422,250 @@ func setupServerConnection(address string, botInfo BotInfo, runningState chan(bo
                 break
             }
 
-            var command BotCommand
-
-            command = <-connection.BotCommandToServer
-
-            message := MessageMiddlewareServer{
-                Type:               MmstBotCommand,
-                BotCommand:         &command,
-                BotInfo:            nil,
+            var message MessageMiddlewareServer
+            select {
+            case command := <-connection.BotCommandToServer:
+                message = MessageMiddlewareServer{
+                    Type:               MmstBotCommand,
+                    BotCommand:         &command,
+                    BotInfo:            nil,
+                }
+            case latency := <-connection.LatencyToServer:
+                message = MessageMiddlewareServer{
+                    Type:               MmstLatencyReport,
+                    Latency:            &latency,
+                }
+            case <-done:
+                return
             }
 
             err := websocket.JSON.Send(ws, message)
             if err != nil {
-                terminateNonBlocking(runningState, "to Server 2")
                 Logf(LtDebug, "Send failed: %v\n", err.Error())
+                // Unblocks the receiving.
+                ws.Close()
                 break
             }
         }
         Logf(LtDebug, "Finished for good. 2.\n")
     }()
 
-    return connection, nil
-}
-
-func writeToBot(stdin io.WriteCloser, input string) {
-    io.WriteString(stdin, input)
-    //io.Copy(stdin, bytes.NewBufferString(input))
-}
-
-func readFromBot(stdout io.ReadCloser) string {
-    // If this costs performance - take it out and pass the reader!
-    var reader = bufio.NewReader(stdout)
-    b, _ := reader.ReadString('\n')
+    //
+    // Receive the messages from the server
+    //
+    for {
 
-    return string(b)
-}
+        if connectionIsTerminated(runningState, "from Server") {
+            Logf(LtDebug, "Receiving from Server has stopped.\n")
+            break
+        }
 
-// to convert a float number to a string
-func fToS(input_num float32) string {
-    return strconv.FormatFloat(float64(input_num), 'f', 6, 32)
-}
+        var bytes []byte
+        err := websocket.Message.Receive(ws, &bytes)
 
-// Blob = (BotId, TeamId, Index, Position, Mass)
-func blobsToString (blobs []ServerMiddlewareBlob) string {
-    blobsString := "["
-    first := true
-    for _,blob := range blobs {
-        if !first {
-            blobsString += ","
+        var message ServerMiddlewareGameState
+        if err == nil {
+            err = json.Unmarshal(bytes, &message)
         }
-        positionString := "(" + fToS(blob.Position.X) + "," + fToS(blob.Position.Y) + ")"
-        blobsString += "(" + fmt.Sprint(blob.BotId) + "," + fmt.Sprint(blob.TeamId) + "," + fmt.Sprint(blob.Index) + "," + positionString + "," + fmt.Sprint(blob.Mass) + ")"
-        first = false
-    }
-    blobsString += "]"
-    return blobsString
-}
 
-func foodToString (food []Food) string {
-    foodString := "["
-    first := true
-    for _,f := range food {
-        if !first {
-            foodString += ","
+        if err != nil {
+            Logf(LtDebug, "Receive failed: %v\n", err.Error())
+            break
         }
-        positionString := "(" + fToS(f.Position.X) + "," + fToS(f.Position.Y) + ")"
-        foodString += "(" + positionString + "," +  "10)"
-        first = false
-    }
-    foodString += "]"
 
-    return foodString
-}
+        messageString := abbreviate(fmt.Sprintf("%v", message), 32)
+        Logf(LtDebug | LtVerbose, "Received message from the server: %v.\n", messageString)
 
-func toxinToString(toxins []Toxin) string {
-    toxinString := "["
-    first := true
-    for _,t := range toxins {
-        if !first {
-            toxinString += ","
+
+        select {
+        case connection.GameStateFromServer <- message: // Put message in the channel unless it is full
+            Logf(LtDebug | LtVerbose, "Added to channel 'fromServer': \"%v\"\n", messageString)
+        default:
+            // Replace the old message in the channel with the new one.
+            select {
+            case <-connection.GameStateFromServer:
+                select {
+                case connection.GameStateFromServer <- message:
+                default:
+                    Logf(LtDebug, "SHIIIIIIIT!!!\n")
+                }
+
+            default:
+                // Right now there is nothing to read from the channel!
+                // Maybe next time :)
+            }
         }
-        toxinString += "((" + fToS(t.Position.X) + "," + fToS(t.Position.Y) + ")," + fmt.Sprint(t.Mass) + ")"
-        first = false
     }
 
-    toxinString += "]"
-    return toxinString
+    close(done)
+    ws.Close()
+    sending.Wait()
 }
 
-// To literally this format: ([Blob], [Blob], [Food], [Toxin])
-func jsonToString(msg ServerMiddlewareGameState) string {
-
-    myBlobString    := blobsToString(msg.MyBlob)
-    otherBlobString := blobsToString(msg.OtherBlobs)
-    foodString      := foodToString(msg.Food)
-    toxinString     := toxinToString(msg.Toxin)
-    botString       := "(" + myBlobString + "," + otherBlobString + "," + foodString + "," + toxinString + ")"
+func sendCommand(serverConnection ServerConnection, command BotCommand) {
+    select {
+        case serverConnection.BotCommandToServer <- command:
+            Logf(LtDebug | LtVerbose, "Added to channel 'toServer': \"%v\"\n", command)
+        default:
+            //Logln(LtDebug, "Could not add message to channel 'toServer'. Channel is full.")
 
-    return botString
-}
+            // Read message from the channel to free it and try again!
+            //var message ServerMiddlewareGameState
+            select {
+            case msg := <-serverConnection.BotCommandToServer:
+                //message = msg
+                msg = msg
+                select {
+                case serverConnection.BotCommandToServer <- command:
+                default:
+                    Logf(LtDebug, "SHIIIIIIIT!!!\n")
+                }
 
-func matchCommand(cmd string) (BotActionType, bool) {
-    match, _ := regexp.MatchString("none|split|throw", cmd)
-    action := BatNone
-    switch cmd {
-    case "split":
-        action = BatSplit
-    case "throw":
-        action = BatThrow
+            default:
+                // Right now there is nothing to read from the channel!
+                // Maybe next time :)
+                //continue
+            }
     }
-    return action, match
 }
 
-func matchTarget(slice []string) (vec.Vec2, bool) {
-    x,e1 := strconv.ParseFloat(slice[0], 32)
-    y,e2 := strconv.ParseFloat(slice[1], 32)
-
-    //Logf(LtDebug, "The command %v, %v\n", e1, e2)
-
-    if e1 != nil || e2 != nil {
-        return vec.NullVec2(), false
+// The author of the bot sees the latencies, when the bot is too slow. The organisers see them on the server.
+func reportLatency(serverConnection ServerConnection, histogram LatencyHistogram) {
+    if histogram.Answers == 0 && histogram.Missed == 0 {
+        return
     }
 
-    return vec.Vec2{float32(x), float32(y)}, true
-}
-
-// Examples:
-// none,739.825806,654.041382
-// none,162,925
-// 739.825806,654.041382
-// 162,925
-func matchSlice(slice []string) (BotActionType, vec.Vec2, bool) {
-    var action = BatNone
-    var target vec.Vec2
-
-    switch len(slice) {
-        case 2: // So it doesn't end up in default. 2 is perfectly all right. Defaults to action=None.
-        case 3:
-            tmpAction, matchCmd := matchCommand(slice[0])
-            if !matchCmd {
-                Logf(LtDebug, "The command '" + slice[0] + "' is not recognized! We use None for now... Please repair your bot!\n")
-            } else {
-                action = tmpAction
-            }
-            slice = slice[1:]
-        default:
-            Logf(LtDebug, "There is not enough information. It should be (Action,(Target.X, Target.Y))!\n")
-            return action, target, false
+    logType := LtDebug
+    if histogram.Late > 0 || histogram.Missed > 0 {
+        logType = LtAlways
     }
+    Logf(logType, "Latency of your bot: %v\n", histogram)
 
-    tmpTarget, matchTarget := matchTarget(slice)
-    if !matchTarget {
-        Logf(LtDebug, "The target '" + strings.Join(slice,",") + "' is not recognized! Please repair your bot!\n")
-        return action, target, false
-    } else {
-        target = tmpTarget
+    select {
+    case serverConnection.LatencyToServer <- histogram:
+    default:
+        Logf(LtDebug, "Could not send the latency report. The last one is still waiting.\n")
     }
-
-    return action, target, true
 }
 
-func parseBotResponse(response string) (BotCommand, bool) {
-
-    str := strings.ToLower(response)
-    str = strings.Replace(str, " ",  "", -1)
-    str = strings.Replace(str, "\n", "", -1)
-    str = strings.Replace(str, "\r", "", -1)
-    str = strings.Replace(str, "\t", "", -1)
-    str = strings.Replace(str, "(",  "", -1)
-    str = strings.Replace(str, ")",  "", -1)
-    str = strings.Replace(str, "[",  "", -1)
-    str = strings.Replace(str, "]",  "", -1)
-    str = strings.Replace(str, "{",  "", -1)
-    str = strings.Replace(str, "}",  "", -1)
-
-
-
-    s := strings.Split(str, ",")
-
-    action, target, ok := matchSlice(s)
-
-    wrapper := BotCommand{
-        Action:     action,
-        Target:      target,
+func logGameOver(gameOver GameOver) {
+    Logf(LtAlways, "The game %v is over. Winner: %v (scoring: %v)\n", gameOver.Game, strings.Join(gameOver.Winners, ", "), gameOver.Scoring)
+    for _, standing := range gameOver.Standings {
+        Logf(LtAlways, "  %v. %v: %v\n", standing.Place, standing.Player, standing.Score)
     }
-
-    return wrapper, ok
 }
 
-
-
-
-func work(bot Bot, serverConnection ServerConnection, runningState chan(bool)) {
+// The bot gets a new game state as soon as it answered the last one. The game
+// states that arrive while the bot is thinking are missed.
+func work(bot *BotProcess, protocol BotProtocol, timing Timing, serverConnection ServerConnection, runningState chan(bool)) {
     ticker := time.NewTicker(time.Millisecond * 20)
-    var lastTime = time.Now()
-    var fpsAdd float32
-    fpsAdd = 0
-    var fpsCnt = 0
-    for t := range ticker.C {
-        var dt = float32(t.Sub(lastTime).Nanoseconds()) / 1e9
-        lastTime = t
-
-        if fpsCnt == 9 {
-            //Logf(LtDebug, "fps: %v\n", fpsAdd / float32(fpsCnt+1))
-            fpsAdd = 0
-            fpsCnt = 0
+    defer ticker.Stop()
+    reportTicker := time.NewTicker(latencyReportInterval)
+    defer reportTicker.Stop()
+
+    var (
+        waiting         bool
+        sentAt          time.Time
+        sentString      string
+        deadline        <-chan time.Time
+        lastCommand     *BotCommand
+        histogram       LatencyHistogram
+        lobbyCountdown  int
+        gameOver        bool
+    )
+
+    missGameState := func() {
+        histogram.Missed += 1
+        if timing.latePolicy == LpRepeat && lastCommand != nil {
+            sendCommand(serverConnection, *lastCommand)
         }
-        fpsCnt += 1
-        fpsAdd += 1.0 / dt
+    }
 
-        if connectionIsTerminated(runningState, "work") {
-            Logf(LtDebug, "Work has stopped.\n")
-            break
-        }
+    stop := func(reason string) {
+        terminateNonBlocking(runningState, reason)
+        Logf(LtDebug, "Work has stopped.\n")
+    }
 
-        //message := <-serverConnection.GameStateFromServer
-        var message ServerMiddlewareGameState
+    for {
         select {
-        case msg := <-serverConnection.GameStateFromServer:
-            message = msg
-        default:
-            // Right now there is nothing to read from the channel!
-            // Maybe next time :)
-            continue
-        }
+        case <-ticker.C:
+            if connectionIsTerminated(runningState, "work") {
+                Logf(LtDebug, "Work has stopped.\n")
+                return
+            }
 
-        messageString := jsonToString(message)
+        case <-reportTicker.C:
+            reportLatency(serverConnection, histogram)
+            histogram = LatencyHistogram{}
 
-        writeToBot(bot.stdin, messageString + "\n")
-        response := readFromBot(bot.stdout)
+        case message := <-serverConnection.GameStateFromServer:
+            // A JSON bot gets the standings in the game state, the log has them for every bot.
+            if message.GameOver != nil && !gameOver {
+                logGameOver(*message.GameOver)
+            }
+            gameOver = message.GameOver != nil
 
-        if response == "" {
-            //runningState <- false
-            terminateNonBlocking(runningState, "work 2")
-            Logf(LtDebug, "Work has stopped.\n")
-            //close(serverConnection.BotCommandToServer)
-            //close(serverConnection.GameStateFromServer)
-            break
-        }
+            // The text protocol cannot tell a bot without blobs about the lobby.
+            if message.Lobby && protocol == BpText {
+                if countdown := int(math.Ceil(float64(message.Countdown))); countdown != lobbyCountdown {
+                    Logf(LtDebug, "Waiting in the lobby, countdown: %v\n", countdown)
+                    lobbyCountdown = countdown
+                }
+                continue
+            }
+            if waiting {
+                missGameState()
+                continue
+            }
 
-        command, ok := parseBotResponse(response)
+            messageString, err := protocol.EncodeGameState(message)
+            if err != nil {
+                Logf(LtDebug, "Could not encode the game state: %v\n", err.Error())
+                continue
+            }
 
-        if !ok {
-            Logf(LtAlways, "Something is wrong with your bot. We could not read your response.\n")
-            Logf(LtAlways, "You sent us: \"%v\"\n", response)
-            Logf(LtAlways, "We sent you: \"%v\"\n", messageString)
-            usage()
-            os.Exit(0)
-        }
+            if err := bot.Send(messageString); err != nil {
+                stop("work 2")
+                return
+            }
+            waiting = true
+            sentAt = time.Now()
+            sentString = messageString
+            if timing.deadline > 0 {
+                deadline = time.After(timing.deadline)
+            }
 
+        case <-deadline:
+            deadline = nil
+            missGameState()
 
-        select {
-            case serverConnection.BotCommandToServer <- command:
-                Logf(LtDebug | LtVerbose, "Added to channel 'toServer': \"%v\"\n", command)
-            default:
-                //Logln(LtDebug, "Could not add message to channel 'toServer'. Channel is full.")
+        case response, ok := <-bot.Responses():
+            if !ok {
+                stop("work 3")
+                return
+            }
+            if !waiting {
+                Logf(LtDebug, "The bot answered without a game state: \"%v\"\n", response)
+                continue
+            }
 
-                // Read message from the channel to free it and try again!
-                //var message ServerMiddlewareGameState
-                select {
-                case msg := <-serverConnection.BotCommandToServer:
-                    //message = msg
-                    msg = msg
-                    select {
-                    case serverConnection.BotCommandToServer <- command:
-                    default:
-                        Logf(LtDebug, "SHIIIIIIIT!!!\n")
-                    }
+            latency := time.Since(sentAt)
+            histogram.Add(latency, timing.deadline > 0 && latency > timing.deadline)
+            waiting = false
+            deadline = nil
 
-                default:
-                    // Right now there is nothing to read from the channel!
-                    // Maybe next time :)
-                    //continue
-                }
+            command, err := protocol.DecodeBotCommand(response)
 
+            if err != nil {
+                Logf(LtAlways, "Something is wrong with your bot. We could not read your response: %v\n", err.Error())
+                Logf(LtAlways, "You sent us: \"%v\"\n", response)
+                Logf(LtAlways, "We sent you: \"%v\"\n", sentString)
+                usage()
+                os.Exit(0)
+            }
 
+            lastCommand = &command
+            sendCommand(serverConnection, command)
         }
     }
 }
@@ -683,6 +744,40 @@ func main() {
     if parseResult.serverURL == "" {
         parseResult.serverURL = config.Connection
     }
+    if parseResult.botToken == "" {
+        parseResult.botToken = config.Token
+    }
+    if parseResult.protocol == "" {
+        parseResult.protocol = config.Protocol
+    }
+    protocol, err := ParseBotProtocol(parseResult.protocol)
+    if err != nil {
+        fatalError(err, ecParameterProblem)
+    }
+    if parseResult.deadline < 0 {
+        parseResult.deadline = config.Deadline
+        if parseResult.deadline <= 0 {
+            parseResult.deadline = int(defaultDeadline / time.Millisecond)
+        }
+    }
+    if parseResult.late == "" {
+        parseResult.late = config.Late
+    }
+    latePolicy, err := ParseLatePolicy(parseResult.late)
+    if err != nil {
+        fatalError(err, ecParameterProblem)
+    }
+    timing := Timing{
+        deadline:   time.Duration(parseResult.deadline) * time.Millisecond,
+        latePolicy: latePolicy,
+    }
+
+    if parseResult.local {
+        if err := runLocal(parseResult, protocol); err != nil {
+            fatalError(err, ecParameterProblem)
+        }
+        return
+    }
 
     //
     // Start the bots, initialize the connections and start the work
@@ -719,6 +814,7 @@ func main() {
                 Name:       parseResult.botName,
                 Color:      makeRandomColor(),
                 ImagePath:  "",
+                Token:      parseResult.botToken,
             }
             runningState := make(chan bool, 1)
             serverConnection, err := setupServerConnection(address, botInfo, runningState, wg)
@@ -729,7 +825,7 @@ func main() {
             //
             // Handle the stuff
             //
-            work(bot, serverConnection, runningState)
+            work(bot, protocol, timing, serverConnection, runningState)
             Logf(LtDebug, "Finished for good. 3.\n")
         }()
 
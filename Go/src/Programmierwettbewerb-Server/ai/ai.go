@@ -0,0 +1,406 @@
+package ai
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "errors"
+    "fmt"
+    "math"
+    "math/rand"
+    "sort"
+    "strings"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Bots
+//
+////////////////////////////////////////////////////////////////////////
+
+// A bot that runs inside of the Go programs instead of behind a middleware.
+// It sees the same game state as the bots of the students.
+type Bot interface {
+    Command(state ServerMiddlewareGameState) BotCommand
+}
+
+type Level int
+const (
+    LvEasy      Level = iota
+    LvMedium
+    LvHard
+)
+
+var levelNames = []string{ "easy", "medium", "hard" }
+
+func (level Level) String() string {
+    return levelNames[level]
+}
+
+func ParseLevel(name string) (Level, error) {
+    for i, levelName := range levelNames {
+        if levelName == name {
+            return Level(i), nil
+        }
+    }
+    return LvMedium, errors.New(fmt.Sprintf("There is no level \"%v\". Possible levels are: %v.", name, strings.Join(levelNames, ", ")))
+}
+
+// The number of game states, after which a bot of the level thinks again.
+// In between it keeps its last target.
+func (level Level) reactionTicks() int {
+    return [...]int{ 10, 4, 1 }[level]
+}
+
+// Easy bots do not look out for bigger blobs.
+func (level Level) flees() bool {
+    return level > LvEasy
+}
+
+// All random decisions of a bot are taken from the given generator, so a seed reproduces a game.
+type BotFactory func(level Level, random *rand.Rand) Bot
+
+var botFactories = map[string]BotFactory{
+    "idle":     func(level Level, random *rand.Rand) Bot { return &idleBot{} },
+    "food":     func(level Level, random *rand.Rand) Bot { return &foodBot{ level: level, random: random } },
+    "hunter":   func(level Level, random *rand.Rand) Bot { return &hunterBot{ foodBot: foodBot{ level: level, random: random } } },
+    "splitter": func(level Level, random *rand.Rand) Bot { return &hunterBot{ foodBot: foodBot{ level: level, random: random }, splits: true } },
+    "toxin":    func(level Level, random *rand.Rand) Bot { return &toxinBot{ foodBot: foodBot{ level: level, random: random } } },
+}
+
+// The name can have a level, e.g. "hunter:hard". The default level is medium.
+func NewBot(name string, random *rand.Rand) (Bot, error) {
+    level := LvMedium
+    if i := strings.Index(name, ":"); i >= 0 {
+        var err error
+        if level, err = ParseLevel(name[i+1:]); err != nil {
+            return nil, err
+        }
+        name = name[:i]
+    }
+
+    factory, ok := botFactories[name]
+    if !ok {
+        return nil, errors.New(fmt.Sprintf("There is no bot \"%v\". Possible bots are: %v.", name, strings.Join(BotNames(), ", ")))
+    }
+    return &slowBot{ bot: factory(level, random), reactionTicks: level.reactionTicks() }, nil
+}
+
+// Sorted by name.
+func BotNames() []string {
+    names := make([]string, 0, len(botFactories))
+    for name := range botFactories {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Reaction Time
+//
+////////////////////////////////////////////////////////////////////////
+
+// Only asks the bot every few game states and keeps its target in between.
+// The actions are not repeated.
+type slowBot struct {
+    bot             Bot
+    reactionTicks   int
+    ticks           int
+    last            BotCommand
+}
+
+func (bot *slowBot) Command(state ServerMiddlewareGameState) BotCommand {
+    if bot.ticks % bot.reactionTicks == 0 {
+        bot.last = bot.bot.Command(state)
+        bot.ticks += 1
+        return bot.last
+    }
+    bot.ticks += 1
+    return bot.last.WithoutActions()
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Idle
+//
+////////////////////////////////////////////////////////////////////////
+
+// Stays where it is. Good to practice hunting.
+type idleBot struct {
+}
+
+func (bot *idleBot) Command(state ServerMiddlewareGameState) BotCommand {
+    return BotCommand{ Action: BatNone, Target: center(state.MyBlob) }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Food
+//
+////////////////////////////////////////////////////////////////////////
+
+// Runs to the nearest food. From the medium level on it runs away from bigger blobs.
+type foodBot struct {
+    level       Level
+    random      *rand.Rand
+    wanderTo    Vec2
+}
+
+func (bot *foodBot) Command(state ServerMiddlewareGameState) BotCommand {
+    if len(state.MyBlob) == 0 {
+        return BotCommand{ Action: BatNone, Target: bot.wanderTo }
+    }
+
+    me := biggest(state.MyBlob)
+    if target, ok := bot.flee(state, me); ok {
+        return BotCommand{ Action: BatNone, Target: target }
+    }
+    return BotCommand{ Action: BatNone, Target: bot.eat(state, me.Position) }
+}
+
+// The target for the nearest food or a random point of the field.
+func (bot *foodBot) eat(state ServerMiddlewareGameState, position Vec2) Vec2 {
+    if food, ok := nearestFood(state.Food, position); ok {
+        return food.Position
+    }
+    return bot.wander(state, position)
+}
+
+// Without anything in sight the bot walks to a random point of the field.
+func (bot *foodBot) wander(state ServerMiddlewareGameState, position Vec2) Vec2 {
+    if Dist(position, bot.wanderTo) < 10 || bot.wanderTo == NullVec2() {
+        bot.wanderTo = Mulv(RandomVec2From(bot.random), state.FieldSize)
+    }
+    return bot.wanderTo
+}
+
+// Runs away from the nearest blob, that could eat the given one.
+func (bot *foodBot) flee(state ServerMiddlewareGameState, me ServerMiddlewareBlob) (Vec2, bool) {
+    if !bot.level.flees() {
+        return NullVec2(), false
+    }
+    threat, ok := nearestThreat(state, me)
+    if !ok {
+        return NullVec2(), false
+    }
+    away := NormalizeOrZero(Sub(me.Position, threat.Position))
+    if away == NullVec2() {
+        away = Vec2{ X: 1 }
+    }
+    target := Add(me.Position, Muls(away, 200))
+    // In a corner the bot runs along the border.
+    target.X = float32(math.Max(0, math.Min(float64(target.X), float64(state.FieldSize.X))))
+    target.Y = float32(math.Max(0, math.Min(float64(target.Y), float64(state.FieldSize.Y))))
+    return target, true
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Hunter
+//
+////////////////////////////////////////////////////////////////////////
+
+// Chases the nearest blob it can eat and eats food otherwise. The splitter
+// splits towards its prey, when the half of it is still big enough.
+type hunterBot struct {
+    foodBot
+    splits      bool
+}
+
+func (bot *hunterBot) Command(state ServerMiddlewareGameState) BotCommand {
+    if len(state.MyBlob) == 0 {
+        return BotCommand{ Action: BatNone, Target: bot.wanderTo }
+    }
+
+    me := biggest(state.MyBlob)
+    if target, ok := bot.flee(state, me); ok {
+        return BotCommand{ Action: BatNone, Target: target }
+    }
+
+    prey, ok := nearestPrey(state, me.Mass)
+    if !ok {
+        return BotCommand{ Action: BatNone, Target: bot.eat(state, me.Position) }
+    }
+
+    target := prey.Position
+    if bot.level == LvHard {
+        // Aims at the place the prey will be.
+        target = Add(target, Muls(prey.Velocity, 0.3))
+    }
+    if bot.splits && bot.canSplitOnto(state, me, prey) {
+        return BotCommand{ Action: BatSplit, Target: target }
+    }
+    return BotCommand{ Action: BatNone, Target: target }
+}
+
+func (bot *hunterBot) canSplitOnto(state ServerMiddlewareGameState, me ServerMiddlewareBlob, prey ServerMiddlewareBlob) bool {
+    maxBlobs := [...]int{ 2, 4, 8 }[bot.level]
+    half := me.Mass / 2
+    return me.Mass >= splitMass &&
+        len(state.MyBlob) < maxBlobs &&
+        canEat(half, prey.Mass) &&
+        Dist(me.Position, prey.Position) < splitReach + radius(me.Mass)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Toxin
+//
+////////////////////////////////////////////////////////////////////////
+
+// Feeds toxins with food, so they are shot at big blobs behind them.
+// It gets into position behind a toxin first and eats food otherwise.
+type toxinBot struct {
+    foodBot
+}
+
+func (bot *toxinBot) Command(state ServerMiddlewareGameState) BotCommand {
+    if len(state.MyBlob) == 0 {
+        return BotCommand{ Action: BatNone, Target: bot.wanderTo }
+    }
+
+    me := biggest(state.MyBlob)
+    if target, ok := bot.flee(state, me); ok {
+        return BotCommand{ Action: BatNone, Target: target }
+    }
+
+    toxin, victim, ok := bot.shot(state, me)
+    if !ok || me.Mass <= throwMass {
+        return BotCommand{ Action: BatNone, Target: bot.eat(state, me.Position) }
+    }
+
+    // The toxin flies in the direction of the thrown food.
+    aim := NormalizeOrZero(Sub(victim.Position, toxin.Position))
+    if dot(NormalizeOrZero(Sub(toxin.Position, me.Position)), aim) > [...]float32{ 0.8, 0.9, 0.97 }[bot.level] {
+        return BotCommand{ Action: BatThrow, Target: toxin.Position }
+    }
+    behind := Sub(toxin.Position, Muls(aim, radius(me.Mass) + 40))
+    return BotCommand{ Action: BatNone, Target: behind }
+}
+
+// The toxin and the big blob, that is nearest to it.
+func (bot *toxinBot) shot(state ServerMiddlewareGameState, me ServerMiddlewareBlob) (ServerMiddlewareToxin, ServerMiddlewareBlob, bool) {
+    var bestToxin ServerMiddlewareToxin
+    var bestVictim ServerMiddlewareBlob
+    bestDistance := float32(toxinReach)
+    found := false
+    for _, toxin := range state.Toxin {
+        if Dist(me.Position, toxin.Position) > toxinReach {
+            continue
+        }
+        for _, other := range state.OtherBlobs {
+            if other.TeamId == me.TeamId || other.Mass < explodeMass {
+                continue
+            }
+            if distance := Dist(toxin.Position, other.Position); distance < bestDistance {
+                bestToxin, bestVictim, bestDistance, found = toxin, other, distance, true
+            }
+        }
+    }
+    return bestToxin, bestVictim, found
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Helpers
+//
+////////////////////////////////////////////////////////////////////////
+
+// The bots do not know the physics of the server. These are the defaults.
+const (
+    splitMass   = 100
+    throwMass   = 100
+    explodeMass = 400
+    // How far a split blob flies.
+    splitReach  = 60
+    // How far a toxin is shot.
+    toxinReach  = 250
+)
+
+// Same as connections.Radius.
+func radius(mass uint32) float32 {
+    return float32(math.Sqrt(float64(mass) / math.Pi))
+}
+
+// Same rule as in the simulation.
+func canEat(mass uint32, otherMass uint32) bool {
+    return float32(otherMass) < 0.9 * float32(mass)
+}
+
+func dot(lhs Vec2, rhs Vec2) float32 {
+    return lhs.X * rhs.X + lhs.Y * rhs.Y
+}
+
+// The center of mass of the blobs.
+func center(blobs []ServerMiddlewareBlob) Vec2 {
+    var sum Vec2
+    var mass float32
+    for _, blob := range blobs {
+        sum = Add(sum, Muls(blob.Position, float32(blob.Mass)))
+        mass += float32(blob.Mass)
+    }
+    if mass == 0 {
+        return sum
+    }
+    return Muls(sum, 1 / mass)
+}
+
+func biggest(blobs []ServerMiddlewareBlob) ServerMiddlewareBlob {
+    var result ServerMiddlewareBlob
+    for i, blob := range blobs {
+        if i == 0 || blob.Mass > result.Mass {
+            result = blob
+        }
+    }
+    return result
+}
+
+func nearestFood(foods []ServerMiddlewareFood, position Vec2) (ServerMiddlewareFood, bool) {
+    var result ServerMiddlewareFood
+    found := false
+    for _, food := range foods {
+        if !found || DistFast(position, food.Position) < DistFast(position, result.Position) {
+            result = food
+            found = true
+        }
+    }
+    return result, found
+}
+
+// The nearest blob of another team, that could eat the given one and is close to it.
+func nearestThreat(state ServerMiddlewareGameState, me ServerMiddlewareBlob) (ServerMiddlewareBlob, bool) {
+    var result ServerMiddlewareBlob
+    found := false
+    for _, other := range state.OtherBlobs {
+        if other.TeamId == me.TeamId || !canEat(other.Mass, me.Mass) {
+            continue
+        }
+        if Dist(me.Position, other.Position) > radius(other.Mass) + radius(me.Mass) + splitReach + 40 {
+            continue
+        }
+        if !found || DistFast(me.Position, other.Position) < DistFast(me.Position, result.Position) {
+            result = other
+            found = true
+        }
+    }
+    return result, found
+}
+
+// The nearest blob of another team, that a blob with the mass can eat.
+func nearestPrey(state ServerMiddlewareGameState, mass uint32) (ServerMiddlewareBlob, bool) {
+    me := biggest(state.MyBlob)
+    var result ServerMiddlewareBlob
+    found := false
+    for _, other := range state.OtherBlobs {
+        if other.TeamId == me.TeamId || !canEat(mass, other.Mass) {
+            continue
+        }
+        if !found || DistFast(me.Position, other.Position) < DistFast(me.Position, result.Position) {
+            result = other
+            found = true
+        }
+    }
+    return result, found
+}
@@ -0,0 +1,159 @@
+package ai
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "math/rand"
+    "testing"
+)
+
+func newTestState(myBlobs []ServerMiddlewareBlob, foods []ServerMiddlewareFood) ServerMiddlewareGameState {
+    return ServerMiddlewareGameState{
+        MyBlob:     myBlobs,
+        Food:       foods,
+        FieldSize:  Vec2{ X: 1000, Y: 1000 },
+    }
+}
+
+func TestNewBot(t *testing.T) {
+    for _, name := range BotNames() {
+        if bot, err := NewBot(name, rand.New(rand.NewSource(1))); bot == nil || err != nil {
+            t.Errorf("bot %v can not be created: %v", name, err)
+        }
+    }
+    if _, err := NewBot("unknown", rand.New(rand.NewSource(1))); err == nil {
+        t.Errorf("unknown bot is created")
+    }
+}
+
+func TestFoodBot(t *testing.T) {
+    me := []ServerMiddlewareBlob{ { Position: Vec2{ X: 500, Y: 500 }, Mass: 100 } }
+
+    tests := []struct {
+        name        string
+        foods       []ServerMiddlewareFood
+        wantTarget  Vec2
+    }{
+        { "nearest food",   []ServerMiddlewareFood{ { Position: Vec2{ X: 100, Y: 100 } }, { Position: Vec2{ X: 520, Y: 490 } } },  Vec2{ X: 520, Y: 490 } },
+        { "single food",    []ServerMiddlewareFood{ { Position: Vec2{ X: 900, Y: 10 } } },                                          Vec2{ X: 900, Y: 10 } },
+    }
+
+    for _, test := range tests {
+        bot, _ := NewBot("food", rand.New(rand.NewSource(1)))
+        if command := bot.Command(newTestState(me, test.foods)); command.Target != test.wantTarget || command.Action != BatNone {
+            t.Errorf("%v: command is %+v, want target %v", test.name, command, test.wantTarget)
+        }
+    }
+
+    // Without food the bot wanders inside of the field and keeps its target.
+    bot, _ := NewBot("food", rand.New(rand.NewSource(1)))
+    first := bot.Command(newTestState(me, nil)).Target
+    second := bot.Command(newTestState(me, nil)).Target
+    if first != second || first.X < 0 || first.X > 1000 || first.Y < 0 || first.Y > 1000 {
+        t.Errorf("wandering targets are %v and %v", first, second)
+    }
+}
+
+func TestIdleBotStays(t *testing.T) {
+    bot, _ := NewBot("idle", rand.New(rand.NewSource(1)))
+    blobs := []ServerMiddlewareBlob{ { Position: Vec2{ X: 100, Y: 100 }, Mass: 100 }, { Position: Vec2{ X: 200, Y: 100 }, Mass: 300 } }
+    if command := bot.Command(newTestState(blobs, nil)); command.Target != (Vec2{ X: 175, Y: 100 }) {
+        t.Errorf("target is %v, want the center of mass", command.Target)
+    }
+}
+
+func TestNewBotLevels(t *testing.T) {
+    tests := []struct {
+        name        string
+        wantErr     bool
+    }{
+        { "hunter:easy",    false },
+        { "splitter:hard",  false },
+        { "toxin:medium",   false },
+        { "food:expert",    true },
+        { "unknown:hard",   true },
+    }
+
+    for _, test := range tests {
+        if _, err := NewBot(test.name, rand.New(rand.NewSource(1))); (err != nil) != test.wantErr {
+            t.Errorf("%v: error is %v", test.name, err)
+        }
+    }
+}
+
+func TestSlowBotKeepsItsTarget(t *testing.T) {
+    bot, _ := NewBot("splitter:easy", rand.New(rand.NewSource(1)))
+    me := []ServerMiddlewareBlob{ { BotId: 1, TeamId: 1, Position: Vec2{ X: 500, Y: 500 }, Mass: 400 } }
+    prey := []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 530, Y: 500 }, Mass: 50 } }
+    state := newTestState(me, nil)
+    state.OtherBlobs = prey
+
+    first := bot.Command(state)
+    if first.Action != BatSplit {
+        t.Errorf("first command is %+v, want a split", first)
+    }
+    // The prey moves, but the easy bot has not noticed yet and does not split again.
+    state.OtherBlobs[0].Position = Vec2{ X: 100, Y: 100 }
+    if second := bot.Command(state); second.Action != BatNone || second.Target != first.Target {
+        t.Errorf("second command is %+v, want the target %v without an action", second, first.Target)
+    }
+}
+
+func TestHunterBot(t *testing.T) {
+    me := ServerMiddlewareBlob{ BotId: 1, TeamId: 1, Position: Vec2{ X: 500, Y: 500 }, Mass: 300 }
+    food := []ServerMiddlewareFood{ { Position: Vec2{ X: 510, Y: 500 } } }
+
+    tests := []struct {
+        name        string
+        bot         string
+        others      []ServerMiddlewareBlob
+        wantAction  BotActionType
+        wantTarget  Vec2
+    }{
+        { "eats food without prey",     "hunter",   nil,                                                                                                BatNone,    Vec2{ X: 510, Y: 500 } },
+        { "chases prey",                "hunter",   []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 700, Y: 500 }, Mass: 100 } },     BatNone,    Vec2{ X: 700, Y: 500 } },
+        { "ignores team mates",         "hunter",   []ServerMiddlewareBlob{ { BotId: 2, TeamId: 1, Position: Vec2{ X: 700, Y: 500 }, Mass: 100 } },     BatNone,    Vec2{ X: 510, Y: 500 } },
+        { "ignores equal blobs",        "hunter",   []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 700, Y: 500 }, Mass: 290 } },     BatNone,    Vec2{ X: 510, Y: 500 } },
+        { "flees from bigger blobs",    "hunter",   []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 540, Y: 500 }, Mass: 1000 } },    BatNone,    Vec2{ X: 300, Y: 500 } },
+        { "splits onto close prey",     "splitter", []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 550, Y: 500 }, Mass: 100 } },     BatSplit,   Vec2{ X: 550, Y: 500 } },
+        { "does not split onto far prey", "splitter", []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 800, Y: 500 }, Mass: 100 } }, BatNone,    Vec2{ X: 800, Y: 500 } },
+        { "does not split onto big prey", "splitter", []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 550, Y: 500 }, Mass: 200 } }, BatNone,    Vec2{ X: 550, Y: 500 } },
+    }
+
+    for _, test := range tests {
+        bot, _ := NewBot(test.bot, rand.New(rand.NewSource(1)))
+        state := newTestState([]ServerMiddlewareBlob{ me }, food)
+        state.OtherBlobs = test.others
+        if command := bot.Command(state); command.Action != test.wantAction || command.Target != test.wantTarget {
+            t.Errorf("%v: command is %+v, want %v to %v", test.name, command, test.wantAction, test.wantTarget)
+        }
+    }
+}
+
+func TestToxinBot(t *testing.T) {
+    toxin := []ServerMiddlewareToxin{ { Position: Vec2{ X: 600, Y: 500 }, Mass: 60 } }
+    victim := []ServerMiddlewareBlob{ { BotId: 2, TeamId: 2, Position: Vec2{ X: 750, Y: 500 }, Mass: 500 } }
+
+    tests := []struct {
+        name        string
+        position    Vec2
+        mass        uint32
+        wantAction  BotActionType
+        wantTarget  Vec2
+    }{
+        { "throws behind the toxin",    Vec2{ X: 520, Y: 500 }, 200,    BatThrow,   Vec2{ X: 600, Y: 500 } },
+        { "gets behind the toxin",      Vec2{ X: 600, Y: 400 }, 200,    BatNone,    Vec2{ X: 600 - radius(200) - 40, Y: 500 } },
+        { "too small to throw",         Vec2{ X: 520, Y: 500 }, 90,     BatNone,    Vec2{ X: 520, Y: 510 } },
+    }
+
+    for _, test := range tests {
+        bot, _ := NewBot("toxin:hard", rand.New(rand.NewSource(1)))
+        state := newTestState([]ServerMiddlewareBlob{ { BotId: 1, TeamId: 1, Position: test.position, Mass: test.mass } }, []ServerMiddlewareFood{ { Position: Vec2{ X: 520, Y: 510 } } })
+        state.Toxin = toxin
+        state.OtherBlobs = victim
+        if command := bot.Command(state); command.Action != test.wantAction || command.Target != test.wantTarget {
+            t.Errorf("%v: command is %+v, want %v to %v", test.name, command, test.wantAction, test.wantTarget)
+        }
+    }
+}
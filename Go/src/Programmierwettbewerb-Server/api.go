@@ -0,0 +1,563 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/tournament"
+
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Admin API
+//
+////////////////////////////////////////////////////////////////////////
+
+// The HTTP JSON version of the /servercommand/ websocket, so the organisation
+// can be scripted and several organisers can work at the same time.
+// Every request needs the header "Authorization: Bearer <server password>".
+//
+//     GET     /api/v1/status              the ApiStatus
+//     GET     /api/v1/options             the spawn images, games, tournaments and physics profiles
+//     PATCH   /api/v1/settings            an ApiSettingsChange
+//     POST    /api/v1/simulation/start    in the lobby of a game it starts the countdown
+//     POST    /api/v1/simulation/stop
+//     POST    /api/v1/game                {"name": "teams", "bots": ["a", "b"]}, the bots are optional
+//     POST    /api/v1/bots/kill           {"aboveMass": 500}, without a mass all bots are killed
+//     POST    /api/v1/bots/kill-remote
+//     POST    /api/v1/config/reload
+//     POST    /api/v1/tournament/start    {"name": "cup"}
+//     POST    /api/v1/tournament/stop
+//     POST    /api/v1/server/update
+//     POST    /api/v1/server/restart
+//
+// The changes go through the update loop like the commands of the websocket.
+// The answer is sent, when the loop has handled them, and has the new status:
+//     {"status": {...}} or {"error": "..."}
+
+const (
+    apiPrefix           = "/api/v1/"
+    apiMaxBodySize      = 1 << 16
+    // The update loop handles the commands in the next step, unless the server is shutting down.
+    apiCommandTimeout   = 5 * time.Second
+
+    // The highest counts the settings accept. More would stall the update loop.
+    apiMaxBots          = 1000
+    apiMaxFoods         = 100000
+    apiMaxToxins        = 10000
+    // Every bot of botsToStart is started this often.
+    apiMaxBotCount      = 100
+)
+
+type ApiSettings struct {
+    MinNumberOfBots     int         `json:"minNumberOfBots"`
+    MaxNumberOfBots     int         `json:"maxNumberOfBots"`
+    MaxNumberOfFoods    int         `json:"maxNumberOfFoods"`
+    MaxNumberOfToxins   int         `json:"maxNumberOfToxins"`
+    BotCount            int         `json:"botCount"`
+    BotsToStart         []string    `json:"botsToStart"`
+    Physics             string      `json:"physics"`
+    FoodSpawn           string      `json:"foodSpawn"`
+    ToxinSpawn          string      `json:"toxinSpawn"`
+    BotSpawn            string      `json:"botSpawn"`
+    Walls               string      `json:"walls"`
+    // Only a game can change it.
+    FieldSize           Vec2        `json:"fieldSize"`
+    GameMode            bool        `json:"gameMode"`
+    Profiling           bool        `json:"profiling"`
+}
+
+// Only the given fields are changed.
+type ApiSettingsChange struct {
+    MinNumberOfBots     *int        `json:"minNumberOfBots"`
+    MaxNumberOfBots     *int        `json:"maxNumberOfBots"`
+    MaxNumberOfFoods    *int        `json:"maxNumberOfFoods"`
+    MaxNumberOfToxins   *int        `json:"maxNumberOfToxins"`
+    BotCount            *int        `json:"botCount"`
+    BotsToStart         []string    `json:"botsToStart"`
+    Physics             *string     `json:"physics"`
+    FoodSpawn           *string     `json:"foodSpawn"`
+    ToxinSpawn          *string     `json:"toxinSpawn"`
+    BotSpawn            *string     `json:"botSpawn"`
+    Walls               *string     `json:"walls"`
+    GameMode            *bool       `json:"gameMode"`
+    Profiling           *bool       `json:"profiling"`
+}
+
+type ApiStatus struct {
+    Running             bool        `json:"running"`
+    Replay              bool        `json:"replay"`
+    GameName            string      `json:"gameName"`
+    GameTime            float32     `json:"gameTime"`
+    Tournament          string      `json:"tournament"`
+    Bots                int         `json:"bots"`
+    Foods               int         `json:"foods"`
+    Toxins              int         `json:"toxins"`
+    Guis                int         `json:"guis"`
+    // Only set while the bots wait for the start of a game.
+    Lobby               *ApiLobby   `json:"lobby,omitempty"`
+    // Only set after the time of the game is over.
+    GameOver            *GameOver   `json:"gameOver,omitempty"`
+    Settings            ApiSettings `json:"settings"`
+}
+
+type ApiLobby struct {
+    Waiting             int         `json:"waiting"`
+    // -1 until the simulation is started.
+    Countdown           float32     `json:"countdown"`
+}
+
+type ApiOptions struct {
+    SpawnImages         []string    `json:"spawnImages"`
+    Games               []string    `json:"games"`
+    Tournaments         []string    `json:"tournaments"`
+    Physics             []string    `json:"physics"`
+}
+
+// The update loop writes the status after every step, the handlers of the API read it.
+// The password is copied with it, because ReloadConfig replaces the running config.
+var apiStatusMutex sync.Mutex
+var apiStatus ApiStatus
+var serverPassword string
+
+func updateApiStatus(gameState *GameState) {
+    status := ApiStatus{
+        Running:    !app.stopped,
+        Replay:     app.replay != nil,
+        GameName:   app.gameName,
+        Bots:       len(gameState.Bots),
+        Foods:      len(gameState.Foods),
+        Toxins:     len(gameState.Toxins),
+        Guis:       app.guiConnections.Count(),
+        GameOver:   app.gameOver,
+        Settings:   ApiSettings{
+            MinNumberOfBots:    app.settings.MinNumberOfBots,
+            MaxNumberOfBots:    app.settings.MaxNumberOfBots,
+            MaxNumberOfFoods:   app.settings.MaxNumberOfFoods,
+            MaxNumberOfToxins:  app.settings.MaxNumberOfToxins,
+            BotCount:           app.settings.BotCount,
+            BotsToStart:        append([]string{}, app.settings.BotsToStart...),
+            Physics:            app.settings.PhysicsName,
+            FoodSpawn:          app.settings.FoodDistributionName,
+            ToxinSpawn:         app.settings.ToxinDistributionName,
+            BotSpawn:           app.settings.BotDistributionName,
+            Walls:              app.settings.WallsName,
+            FieldSize:          app.settings.FieldSize,
+            GameMode:           app.gameMode,
+            Profiling:          app.profiling,
+        },
+    }
+    if app.gameMode {
+        status.GameTime = gameState.GameTime
+    }
+    if app.tournament != nil {
+        status.Tournament = app.tournament.tournament.Name
+    }
+    if app.lobby.Active {
+        status.Lobby = &ApiLobby{ Waiting: len(app.lobby.Waiting), Countdown: app.lobby.Countdown }
+    }
+
+    apiStatusMutex.Lock()
+    apiStatus = status
+    serverPassword = app.runningConfig.Password
+    apiStatusMutex.Unlock()
+}
+
+func currentApiStatus() ApiStatus {
+    apiStatusMutex.Lock()
+    defer apiStatusMutex.Unlock()
+    return apiStatus
+}
+
+func currentServerPassword() string {
+    apiStatusMutex.Lock()
+    defer apiStatusMutex.Unlock()
+    return serverPassword
+}
+
+func currentApiOptions() ApiOptions {
+    gameNames := make([]string, 0, len(games))
+    for gameName := range games {
+        gameNames = append(gameNames, gameName)
+    }
+    sort.Strings(gameNames)
+
+    return ApiOptions{
+        SpawnImages:    spawnImageNames(),
+        Games:          gameNames,
+        Tournaments:    TournamentNames(),
+        Physics:        PhysicsNames(),
+    }
+}
+
+// The bitmaps in ../Public/spawns, that can be used as spawn images.
+func spawnImageNames() []string {
+    var imageNames []string
+    entries, _ := ioutil.ReadDir("../Public/spawns")
+    for _, entry := range entries {
+        if filepath.Ext(MakeLocalSpawnName(entry.Name())) == ".bmp" {
+            imageNames = append(imageNames, entry.Name())
+        }
+    }
+    return imageNames
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Validation
+//
+////////////////////////////////////////////////////////////////////////
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// Checks the change against the status and returns the commands for it.
+func settingsCommands(change ApiSettingsChange, status ApiStatus, options ApiOptions) ([]Command, error) {
+    var commands []Command
+
+    counts := []struct {
+        name    string
+        value   *int
+        command string
+        min     int
+        max     int
+    }{
+        { "minNumberOfBots",    change.MinNumberOfBots,     "MinNumberOfBots",      0, apiMaxBots },
+        // Without any bot nobody can join.
+        { "maxNumberOfBots",    change.MaxNumberOfBots,     "MaxNumberOfBots",      1, apiMaxBots },
+        { "maxNumberOfFoods",   change.MaxNumberOfFoods,    "MaxNumberOfFoods",     0, apiMaxFoods },
+        { "maxNumberOfToxins",  change.MaxNumberOfToxins,   "MaxNumberOfToxins",    0, apiMaxToxins },
+        { "botCount",           change.BotCount,            "BotCount",             0, apiMaxBotCount },
+    }
+    for _, count := range counts {
+        if count.value == nil {
+            continue
+        }
+        if *count.value < count.min || *count.value > count.max {
+            return nil, errors.New(fmt.Sprintf("%v must be between %v and %v.", count.name, count.min, count.max))
+        }
+        commands = append(commands, Command{ Type: count.command, Value: *count.value })
+    }
+
+    minNumberOfBots, maxNumberOfBots := status.Settings.MinNumberOfBots, status.Settings.MaxNumberOfBots
+    if change.MinNumberOfBots != nil { minNumberOfBots = *change.MinNumberOfBots }
+    if change.MaxNumberOfBots != nil { maxNumberOfBots = *change.MaxNumberOfBots }
+    if minNumberOfBots > maxNumberOfBots {
+        return nil, errors.New(fmt.Sprintf("minNumberOfBots (%v) must not be above maxNumberOfBots (%v).", minNumberOfBots, maxNumberOfBots))
+    }
+
+    if change.BotsToStart != nil {
+        for _, name := range change.BotsToStart {
+            if name == "" || strings.Contains(name, ",") {
+                return nil, errors.New(fmt.Sprintf("The bot name '%v' in botsToStart is empty or contains a comma.", name))
+            }
+        }
+        commands = append(commands, Command{ Type: "BotsToStart", Bots: strings.Join(change.BotsToStart, ",") })
+    }
+
+    // The empty name is the default physics.
+    if change.Physics != nil {
+        if *change.Physics != "" && !contains(options.Physics, *change.Physics) {
+            return nil, errors.New(fmt.Sprintf("The physics profile '%v' does not exist.", *change.Physics))
+        }
+        commands = append(commands, Command{ Type: "PhysicsProfile", Profile: *change.Physics })
+    }
+
+    spawns := []struct {
+        name    string
+        image   *string
+        command string
+    }{
+        { "foodSpawn",  change.FoodSpawn,   "FoodSpawnImage" },
+        { "toxinSpawn", change.ToxinSpawn,  "ToxinSpawnImage" },
+        { "botSpawn",   change.BotSpawn,    "BotSpawnImage" },
+    }
+    for _, spawn := range spawns {
+        if spawn.image == nil {
+            continue
+        }
+        if !contains(options.SpawnImages, *spawn.image) {
+            return nil, errors.New(fmt.Sprintf("The %v image '%v' does not exist.", spawn.name, *spawn.image))
+        }
+        commands = append(commands, Command{ Type: spawn.command, Image: *spawn.image })
+    }
+
+    // The empty name removes the walls.
+    if change.Walls != nil {
+        if *change.Walls != "" && !contains(options.SpawnImages, *change.Walls) {
+            return nil, errors.New(fmt.Sprintf("The walls image '%v' does not exist.", *change.Walls))
+        }
+        // The spawn images are changed before the walls.
+        spawnImages := []string{ status.Settings.FoodSpawn, status.Settings.ToxinSpawn, status.Settings.BotSpawn }
+        for i, spawn := range spawns {
+            if spawn.image != nil {
+                spawnImages[i] = *spawn.image
+            }
+        }
+        if err := CheckWalls(status.Settings.FieldSize, *change.Walls, spawnImages...); err != nil {
+            return nil, err
+        }
+        commands = append(commands, Command{ Type: "WallsImage", Image: *change.Walls })
+    }
+
+    if change.GameMode != nil {
+        commands = append(commands, Command{ Type: "GameMode", State: *change.GameMode })
+    }
+    if change.Profiling != nil && *change.Profiling != status.Settings.Profiling {
+        commands = append(commands, Command{ Type: "ToggleProfiling" })
+    }
+    return commands, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Handlers
+//
+////////////////////////////////////////////////////////////////////////
+
+type apiError struct {
+    code        int
+    message     string
+}
+
+func newApiError(code int, format string, args ...interface{}) *apiError {
+    return &apiError{ code, fmt.Sprintf(format, args...) }
+}
+
+// Returns the commands to queue, nil for a request that changes nothing.
+type apiHandler func(r *http.Request) ([]Command, *apiError)
+
+type apiRoute struct {
+    method      string
+    handler     apiHandler
+    // The answer is sent right away, because the loop does not answer any more.
+    noWait      bool
+}
+
+var apiRoutes = map[string]apiRoute{
+    "status":           { "GET",    func(r *http.Request) ([]Command, *apiError) { return nil, nil }, false },
+    "settings":         { "PATCH",  apiChangeSettings, false },
+    "simulation/start": { "POST",   apiCommand(Command{ Type: "StartSimulation" }), false },
+    "simulation/stop":  { "POST",   apiCommand(Command{ Type: "StopSimulation" }), false },
+    "game":             { "POST",   apiStartGame, false },
+    "bots/kill":        { "POST",   apiKillBots, false },
+    "bots/kill-remote": { "POST",   apiCommand(Command{ Type: "KillAllRemoteBots" }), false },
+    "config/reload":    { "POST",   apiReloadConfig, false },
+    "tournament/start": { "POST",   apiStartTournament, false },
+    "tournament/stop":  { "POST",   apiCommand(Command{ Type: "StopTournament" }), false },
+    "server/update":    { "POST",   apiCommand(Command{ Type: "UpdateServer" }), false },
+    "server/restart":   { "POST",   apiCommand(Command{ Type: "RestartServer" }), true },
+}
+
+func apiCommand(command Command) apiHandler {
+    return func(r *http.Request) ([]Command, *apiError) {
+        return []Command{ command }, nil
+    }
+}
+
+// An empty body is the same as {}.
+func readApiBody(r *http.Request, value interface{}) *apiError {
+    body, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        return newApiError(http.StatusBadRequest, "The body could not be read: %v", err.Error())
+    }
+    if len(strings.TrimSpace(string(body))) == 0 {
+        return nil
+    }
+    decoder := json.NewDecoder(strings.NewReader(string(body)))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(value); err != nil {
+        return newApiError(http.StatusBadRequest, "The body is not valid: %v", err.Error())
+    }
+    return nil
+}
+
+func apiChangeSettings(r *http.Request) ([]Command, *apiError) {
+    var change ApiSettingsChange
+    if err := readApiBody(r, &change); err != nil {
+        return nil, err
+    }
+    commands, err := settingsCommands(change, currentApiStatus(), currentApiOptions())
+    if err != nil {
+        return nil, newApiError(http.StatusBadRequest, "%v", err.Error())
+    }
+    return commands, nil
+}
+
+func apiStartGame(r *http.Request) ([]Command, *apiError) {
+    var request struct {
+        Name    string      `json:"name"`
+        Bots    []string    `json:"bots"`
+    }
+    if err := readApiBody(r, &request); err != nil {
+        return nil, err
+    }
+    game, ok := games[request.Name]
+    if !ok {
+        return nil, newApiError(http.StatusNotFound, "The game '%v' does not exist.", request.Name)
+    }
+    if err := CheckWalls(game.FieldSize, game.Walls, game.FoodSpawn, game.ToxinSpawn, game.BotSpawn); err != nil {
+        return nil, newApiError(http.StatusBadRequest, "The game '%v' can not be played: %v", request.Name, err.Error())
+    }
+    for _, name := range request.Bots {
+        if name == "" || strings.Contains(name, ",") {
+            return nil, newApiError(http.StatusBadRequest, "The bot name '%v' is empty or contains a comma.", name)
+        }
+    }
+    return []Command{ { Type: "GameName", GameName: request.Name, Bots: strings.Join(request.Bots, ",") } }, nil
+}
+
+func apiKillBots(r *http.Request) ([]Command, *apiError) {
+    var request struct {
+        AboveMass   *int    `json:"aboveMass"`
+    }
+    if err := readApiBody(r, &request); err != nil {
+        return nil, err
+    }
+    if request.AboveMass == nil {
+        return []Command{ { Type: "KillAllBots" } }, nil
+    }
+    if *request.AboveMass < 0 {
+        return nil, newApiError(http.StatusBadRequest, "aboveMass must not be negative.")
+    }
+    return []Command{ { Type: "KillBotsAboveMassThreshold", Value: *request.AboveMass } }, nil
+}
+
+func apiReloadConfig(r *http.Request) ([]Command, *apiError) {
+    conf, err := readConfig(runningConfFile)
+    if err != nil {
+        return nil, newApiError(http.StatusInternalServerError, "The config could not be read: %v", err.Error())
+    }
+    return []Command{ { Type: "ReloadConfig", Config: &conf } }, nil
+}
+
+func apiStartTournament(r *http.Request) ([]Command, *apiError) {
+    var request struct {
+        Name    string  `json:"name"`
+    }
+    if err := readApiBody(r, &request); err != nil {
+        return nil, err
+    }
+    if !contains(TournamentNames(), request.Name) {
+        return nil, newApiError(http.StatusNotFound, "The tournament '%v' does not exist.", request.Name)
+    }
+    if status := currentApiStatus(); status.Tournament != "" {
+        return nil, newApiError(http.StatusConflict, "The tournament '%v' is still running.", status.Tournament)
+    }
+    return []Command{ { Type: "StartTournament", Tournament: request.Name } }, nil
+}
+
+func isApiAuthorized(r *http.Request) bool {
+    const prefix = "Bearer "
+    header := r.Header.Get("Authorization")
+    password := currentServerPassword()
+    if password == "" || !strings.HasPrefix(header, prefix) {
+        return false
+    }
+    return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(password)) == 1
+}
+
+func writeApiAnswer(w http.ResponseWriter, code int, answer interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(answer)
+}
+
+func writeApiError(w http.ResponseWriter, err *apiError) {
+    writeApiAnswer(w, err.code, struct {
+        Error   string  `json:"error"`
+    }{ err.message })
+}
+
+func handleApi(w http.ResponseWriter, r *http.Request) {
+    if !isApiAuthorized(r) {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        writeApiError(w, newApiError(http.StatusUnauthorized, "The server password is missing or wrong."))
+        return
+    }
+
+    name := strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/")
+    if name == "options" {
+        if r.Method != "GET" {
+            writeApiError(w, newApiError(http.StatusMethodNotAllowed, "%v needs GET.", r.URL.Path))
+            return
+        }
+        writeApiAnswer(w, http.StatusOK, struct {
+            Options ApiOptions  `json:"options"`
+        }{ currentApiOptions() })
+        return
+    }
+
+    route, ok := apiRoutes[name]
+    if !ok {
+        writeApiError(w, newApiError(http.StatusNotFound, "%v does not exist.", r.URL.Path))
+        return
+    }
+    if r.Method != route.method {
+        w.Header().Set("Allow", route.method)
+        writeApiError(w, newApiError(http.StatusMethodNotAllowed, "%v needs %v.", r.URL.Path, route.method))
+        return
+    }
+
+    r.Body = http.MaxBytesReader(w, r.Body, apiMaxBodySize)
+    commands, apiErr := route.handler(r)
+    if apiErr != nil {
+        writeApiError(w, apiErr)
+        return
+    }
+
+    if len(commands) > 0 {
+        if app.replay != nil {
+            writeApiError(w, newApiError(http.StatusConflict, "The server does not take commands, while a replay is running."))
+            return
+        }
+        Logf(LtDebug, "API %v %v from %v\n", r.Method, r.URL.Path, r.RemoteAddr)
+
+        // All the commands of a request are handled in the same step.
+        done := make(chan bool)
+        if !route.noWait {
+            commands[len(commands) - 1].done = done
+        }
+        app.serverCommandsMutex.Lock()
+        app.serverCommands = append(app.serverCommands, commands...)
+        app.serverCommandsMutex.Unlock()
+        // The loop does not run in standby, but the commands should not wait for the next connection.
+        wakeUpFromStandby()
+
+        if route.noWait {
+            writeApiAnswer(w, http.StatusAccepted, struct {
+                Status  ApiStatus   `json:"status"`
+            }{ currentApiStatus() })
+            return
+        }
+
+        select {
+            case <-done:
+            case <-time.After(apiCommandTimeout):
+                writeApiError(w, newApiError(http.StatusGatewayTimeout, "The server did not handle the command in time."))
+                return
+        }
+    }
+
+    writeApiAnswer(w, http.StatusOK, struct {
+        Status  ApiStatus   `json:"status"`
+    }{ currentApiStatus() })
+}
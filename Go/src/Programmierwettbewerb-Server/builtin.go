@@ -0,0 +1,103 @@
+package main
+
+import (
+    .   "Programmierwettbewerb-Server/shared"
+    .   "Programmierwettbewerb-Server/simulation"
+    ai  "Programmierwettbewerb-Server/ai"
+
+    "math/rand"
+    "sort"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Built-in Bots
+//
+////////////////////////////////////////////////////////////////////////
+
+// The built-in bots keep the arena at MinNumberOfBots without starting
+// middlewares. They run inside of the update loop and take part through the
+// TickInput like every other bot, so a recording contains their registrations
+// and commands and a replay does not need them.
+// When real bots come in, the built-in bots make room for them.
+
+type BuiltinBots struct {
+    bots            map[BotId]ai.Bot
+    // The index of the next name in RunningConfig.BuiltinBots.
+    next            int
+}
+
+func NewBuiltinBots() BuiltinBots {
+    return BuiltinBots{
+        bots:   make(map[BotId]ai.Bot),
+    }
+}
+
+func (builtins *BuiltinBots) isBuiltin(botId BotId) bool {
+    _, ok := builtins.bots[botId]
+    return ok
+}
+
+// Sorted by id, so the commands reach the input in the same order in every run with the seed.
+func (builtins *BuiltinBots) sortedIds() []BotId {
+    botIds := make([]BotId, 0, len(builtins.bots))
+    for botId := range builtins.bots {
+        botIds = append(botIds, botId)
+    }
+    sort.Slice(botIds, func(i, j int) bool { return botIds[i] < botIds[j] })
+    return botIds
+}
+
+// Adds the registrations, commands and terminations of the built-in bots to the input.
+// The names come from the running config and are used in turn.
+func (builtins *BuiltinBots) collect(gameState *GameState, settings *ServerSettings, names []string, input *TickInput, tick int) {
+    // Dead bots and the ones, that did not fit into the game any more.
+    for botId := range builtins.bots {
+        if _, ok := gameState.Bots[botId]; !ok && !app.lobby.isWaiting(botId) {
+            delete(builtins.bots, botId)
+        }
+    }
+
+    if len(names) > 0 {
+        numberOfBots := len(gameState.Bots) + len(app.lobby.Waiting) + len(input.Registrations) - len(input.Terminations)
+        if numberOfBots < settings.MinNumberOfBots {
+            builtins.add(names, input)
+        } else if numberOfBots > settings.MinNumberOfBots && len(builtins.bots) > 0 {
+            builtins.removeNewest(input)
+        }
+    }
+
+    for _, botId := range builtins.sortedIds() {
+        if message, ok := MakeServerMiddlewareGameState(gameState, settings, botId, tick); ok {
+            input.Commands = append(input.Commands, MiddlewareCommand{ BotId: botId, BotCommand: builtins.bots[botId].Command(message) })
+        }
+    }
+}
+
+// One bot per step is enough to fill the arena quickly.
+func (builtins *BuiltinBots) add(names []string, input *TickInput) {
+    name := names[builtins.next % len(names)]
+    builtins.next += 1
+
+    botId := app.ids.createBotId()
+    bot, err := ai.NewBot(name, rand.New(rand.NewSource(app.seed + int64(botId))))
+    if err != nil {
+        Logf(LtDebug, "Could not start the built-in bot: %v\n", err.Error())
+        return
+    }
+    builtins.bots[botId] = bot
+
+    input.Registrations = append(input.Registrations, MiddlewareRegistration{
+        BotId:      botId,
+        BotInfo:    BotInfo{ Name: name, Color: Color{ R: 128, G: 128, B: 128 } },
+    })
+    Logf(LtDebug, "Started the built-in bot %v: %v\n", botId, name)
+}
+
+func (builtins *BuiltinBots) removeNewest(input *TickInput) {
+    botIds := builtins.sortedIds()
+    // It stays in the map until it is gone from the game state.
+    botId := botIds[len(botIds) - 1]
+    input.Terminations = append(input.Terminations, botId)
+    Logf(LtDebug, "Removed the built-in bot %v to make room.\n", botId)
+}
@@ -0,0 +1,302 @@
+package connections
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/vector"
+
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Gui Camera
+//
+////////////////////////////////////////////////////////////////////////
+
+// A binary gui chooses its camera with a message on /gui/, for example
+//     {"camera": "bot", "botId": 3}
+//     {"camera": "team", "teamId": 2}
+//     {"camera": "director"}
+//     {"camera": "free"}
+// Except for the free view, the gui only gets the blobs, food and toxins
+// inside of the region of the camera. The infos and statistics of all bots
+// are sent anyway, because the highscore needs them.
+// All guis with the same camera share one GuiCameraStream.
+
+type GuiCameraMode int
+const (
+    CmFree GuiCameraMode = iota
+    CmBot
+    CmTeam
+    CmDirector
+)
+
+type GuiCamera struct {
+    Mode        GuiCameraMode
+    BotId       BotId
+    TeamId      TeamId
+}
+
+type GuiCameraMessage struct {
+    Camera      string      `json:"camera"`
+    BotId       BotId       `json:"botId"`
+    TeamId      TeamId      `json:"teamId"`
+}
+
+func ParseGuiCamera(data []byte) (GuiCamera, error) {
+    var message GuiCameraMessage
+    if err := json.Unmarshal(data, &message); err != nil {
+        return GuiCamera{}, errors.New(fmt.Sprintf("The camera message is no valid JSON: %v", err.Error()))
+    }
+    switch message.Camera {
+        case "free":        return GuiCamera{ Mode: CmFree }, nil
+        case "bot":         return GuiCamera{ Mode: CmBot, BotId: message.BotId }, nil
+        case "team":        return GuiCamera{ Mode: CmTeam, TeamId: message.TeamId }, nil
+        case "director":    return GuiCamera{ Mode: CmDirector }, nil
+    }
+    return GuiCamera{}, errors.New(fmt.Sprintf("The camera '%v' is unknown.", message.Camera))
+}
+
+const (
+    // The space around the blobs of a team or a fight.
+    cameraMargin        = 50
+    // About the view window of a bot with a mass of 100.
+    cameraMinSize       = 200
+    // Blobs of two bots, that are closer than this, are fighting.
+    fightDistance       = 60
+    // The director only cuts to another fight, if it has that much more mass.
+    fightSwitchFactor   = 1.5
+)
+
+// Keeps the encoder and the state of one camera from step to step.
+type GuiCameraStream struct {
+    Camera      GuiCamera
+    encoder     GuiEncoder
+    region      ViewWindow
+    hasRegion   bool
+    // The two bots the director shows.
+    fight       [2]BotId
+    fightMass   float32
+}
+
+func NewGuiCameraStream(camera GuiCamera) *GuiCameraStream {
+    return &GuiCameraStream{ Camera: camera }
+}
+
+// Every camera shows all walls, there are only a few of them.
+func (stream *GuiCameraStream) Encode(bots map[BotId]Bot, foods map[FoodId]Food, toxins map[ToxinId]Toxin, teams map[string]ServerGuiTeam, walls []Wall, gameTime float32, fieldSize Vec2, standings []GameStanding) *GuiFrame {
+    var snapshot GuiSnapshot
+    if stream.Camera.Mode == CmFree {
+        stream.region = ViewWindow{ Size: fieldSize }
+        snapshot = MakeGuiSnapshot(bots, foods, toxins, teams, gameTime)
+    } else {
+        // A camera, that has lost its bot or team, stays where it was.
+        if region, ok := stream.findRegion(bots); ok {
+            stream.region = region
+            stream.hasRegion = true
+        } else if !stream.hasRegion {
+            stream.region = ViewWindow{ Size: fieldSize }
+        }
+        snapshot = MakeGuiSnapshot(botsInView(bots, stream.region), foodsInView(foods, stream.region), toxinsInView(toxins, stream.region), teams, gameTime)
+    }
+    snapshot.Region = quantizeViewWindow(stream.region)
+    snapshot.FieldSize = [2]int32{ quantize(fieldSize.X), quantize(fieldSize.Y) }
+    snapshot.Standings = standings
+    for _, wall := range walls {
+        snapshot.Walls = append(snapshot.Walls, quantizeViewWindow(ViewWindow{ Position: wall.Position, Size: wall.Size }))
+    }
+
+    frame := stream.encoder.Encode(snapshot)
+    frame.Camera = stream.Camera
+    return frame
+}
+
+func (stream *GuiCameraStream) findRegion(bots map[BotId]Bot) (ViewWindow, bool) {
+    switch stream.Camera.Mode {
+        case CmBot:
+            bot, ok := bots[stream.Camera.BotId]
+            return bot.ViewWindow, ok
+        case CmTeam:
+            var blobs []Blob
+            for _, bot := range bots {
+                if bot.TeamId == stream.Camera.TeamId {
+                    blobs = appendBlobs(blobs, bot)
+                }
+            }
+            return regionAround(blobs)
+        case CmDirector:
+            return stream.direct(bots)
+    }
+    return ViewWindow{}, false
+}
+
+// Stays with the current fight, until a clearly bigger one starts somewhere else.
+// Without any fight the director shows the biggest bot.
+func (stream *GuiCameraStream) direct(bots map[BotId]Bot) (ViewWindow, bool) {
+    fight, mass, found := biggestFight(bots)
+    if current, ok := fightMass(bots, stream.fight); ok && stream.fightMass > 0 && (!found || mass < current * fightSwitchFactor) {
+        fight, mass, found = stream.fight, current, true
+    }
+
+    if !found {
+        stream.fightMass = 0
+        botId, ok := biggestBot(bots)
+        if !ok {
+            return ViewWindow{}, false
+        }
+        return regionAround(appendBlobs(nil, bots[botId]))
+    }
+
+    stream.fight = fight
+    stream.fightMass = mass
+    return regionAround(appendBlobs(appendBlobs(nil, bots[fight[0]]), bots[fight[1]]))
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Regions
+//
+////////////////////////////////////////////////////////////////////////
+
+func appendBlobs(blobs []Blob, bot Bot) []Blob {
+    for _, blob := range bot.Blobs {
+        blobs = append(blobs, blob)
+    }
+    return blobs
+}
+
+// A square around all the blobs, like the view window of a bot.
+func regionAround(blobs []Blob) (ViewWindow, bool) {
+    if len(blobs) == 0 {
+        return ViewWindow{}, false
+    }
+    min := Vec2{ X: math.MaxFloat32, Y: math.MaxFloat32 }
+    max := Vec2{ X: -math.MaxFloat32, Y: -math.MaxFloat32 }
+    for _, blob := range blobs {
+        radius := blob.Radius()
+        min.X = float32(math.Min(float64(min.X), float64(blob.Position.X - radius)))
+        min.Y = float32(math.Min(float64(min.Y), float64(blob.Position.Y - radius)))
+        max.X = float32(math.Max(float64(max.X), float64(blob.Position.X + radius)))
+        max.Y = float32(math.Max(float64(max.Y), float64(blob.Position.Y + radius)))
+    }
+    size := float32(math.Max(float64(max.X - min.X), float64(max.Y - min.Y))) + 2*cameraMargin
+    size = float32(math.Max(float64(size), cameraMinSize))
+    center := Muls(Add(min, max), 0.5)
+    return ViewWindow{
+        Position:   Sub(center, Vec2{ X: size / 2, Y: size / 2 }),
+        Size:       Vec2{ X: size, Y: size },
+    }, true
+}
+
+// The bots stay, so their view windows and statistics are still known. Only their blobs are filtered.
+func botsInView(bots map[BotId]Bot, region ViewWindow) map[BotId]Bot {
+    result := make(map[BotId]Bot, len(bots))
+    for botId, bot := range bots {
+        blobs := make(map[BlobId]Blob)
+        for blobId, blob := range bot.Blobs {
+            if IsInViewWindow(region, blob.Position, blob.Radius()) {
+                blobs[blobId] = blob
+            }
+        }
+        bot.Blobs = blobs
+        result[botId] = bot
+    }
+    return result
+}
+
+func foodsInView(foods map[FoodId]Food, region ViewWindow) map[FoodId]Food {
+    result := make(map[FoodId]Food)
+    for foodId, food := range foods {
+        if IsInViewWindow(region, food.Position, Radius(food.Mass)) {
+            result[foodId] = food
+        }
+    }
+    return result
+}
+
+func toxinsInView(toxins map[ToxinId]Toxin, region ViewWindow) map[ToxinId]Toxin {
+    result := make(map[ToxinId]Toxin)
+    for toxinId, toxin := range toxins {
+        if IsInViewWindow(region, toxin.Position, Radius(toxin.Mass)) {
+            result[toxinId] = toxin
+        }
+    }
+    return result
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Director
+//
+////////////////////////////////////////////////////////////////////////
+
+func sortedBotIds(bots map[BotId]Bot) []BotId {
+    botIds := make([]BotId, 0, len(bots))
+    for botId := range bots {
+        botIds = append(botIds, botId)
+    }
+    sort.Slice(botIds, func(i, j int) bool { return botIds[i] < botIds[j] })
+    return botIds
+}
+
+func botMass(bot Bot) float32 {
+    var mass float32 = 0
+    for _, blob := range bot.Blobs {
+        mass += blob.Mass
+    }
+    return mass
+}
+
+func biggestBot(bots map[BotId]Bot) (BotId, bool) {
+    var biggest BotId
+    var biggestMass float32 = -1
+    for _, botId := range sortedBotIds(bots) {
+        if mass := botMass(bots[botId]); mass > biggestMass {
+            biggest, biggestMass = botId, mass
+        }
+    }
+    return biggest, biggestMass >= 0
+}
+
+// Two bots are fighting, when they are not in the same team and two of their blobs nearly touch.
+func areFighting(bot1, bot2 Bot) bool {
+    if bot1.TeamId == bot2.TeamId {
+        return false
+    }
+    for _, blob1 := range bot1.Blobs {
+        for _, blob2 := range bot2.Blobs {
+            if Dist(blob1.Position, blob2.Position) - blob1.Radius() - blob2.Radius() < fightDistance {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// The mass of both bots, if they still fight.
+func fightMass(bots map[BotId]Bot, fight [2]BotId) (float32, bool) {
+    bot1, ok1 := bots[fight[0]]
+    bot2, ok2 := bots[fight[1]]
+    if !ok1 || !ok2 || !areFighting(bot1, bot2) {
+        return 0, false
+    }
+    return botMass(bot1) + botMass(bot2), true
+}
+
+func biggestFight(bots map[BotId]Bot) ([2]BotId, float32, bool) {
+    var fight [2]BotId
+    var biggestMass float32 = 0
+    botIds := sortedBotIds(bots)
+    for i, botId1 := range botIds {
+        for _, botId2 := range botIds[i+1:] {
+            if mass, ok := fightMass(bots, [2]BotId{ botId1, botId2 }); ok && mass > biggestMass {
+                fight, biggestMass = [2]BotId{ botId1, botId2 }, mass
+            }
+        }
+    }
+    return fight, biggestMass, biggestMass > 0
+}
@@ -0,0 +1,114 @@
+package connections
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/vector"
+
+    "testing"
+)
+
+func TestParseGuiCamera(t *testing.T) {
+    tests := []struct {
+        message     string
+        camera      GuiCamera
+        ok          bool
+    }{
+        { `{"camera": "free"}`,                 GuiCamera{ Mode: CmFree },                  true },
+        { `{"camera": "bot", "botId": 3}`,      GuiCamera{ Mode: CmBot, BotId: 3 },         true },
+        { `{"camera": "team", "teamId": 2}`,    GuiCamera{ Mode: CmTeam, TeamId: 2 },       true },
+        { `{"camera": "director", "botId": 3}`, GuiCamera{ Mode: CmDirector },              true },
+        { `{"camera": "drone"}`,                GuiCamera{},                                false },
+        { `camera`,                             GuiCamera{},                                false },
+    }
+    for _, test := range tests {
+        camera, err := ParseGuiCamera([]byte(test.message))
+        if camera != test.camera || (err == nil) != test.ok {
+            t.Errorf("%v: camera %+v, error %v", test.message, camera, err)
+        }
+    }
+}
+
+func cameraBot(teamId TeamId, positions ...Vec2) Bot {
+    bot := testBot("bot", teamId, make(map[BlobId]Blob))
+    for i, position := range positions {
+        bot.Blobs[BlobId(i)] = Blob{ Position: position, Mass: 100 }
+    }
+    return bot
+}
+
+func TestGuiCameraStreamSendsOnlyTheRegion(t *testing.T) {
+    bots := map[BotId]Bot{
+        1: cameraBot(1, Vec2{ X: 100, Y: 100 }, Vec2{ X: 200, Y: 150 }),
+        2: cameraBot(1, Vec2{ X: 150, Y: 250 }),
+        3: cameraBot(2, Vec2{ X: 800, Y: 800 }),
+    }
+    foods := map[FoodId]Food{ 1: { Position: Vec2{ X: 150, Y: 150 }, Mass: 2 }, 2: { Position: Vec2{ X: 900, Y: 100 }, Mass: 2 } }
+    field := Vec2{ X: 1000, Y: 1000 }
+
+    team := NewGuiCameraStream(GuiCamera{ Mode: CmTeam, TeamId: 1 })
+    state := NewGuiSnapshot()
+    if _, err := ApplyGuiFrame(&state, team.Encode(bots, foods, nil, nil, nil, 0, field, nil).Keyframe()); err != nil {
+        t.Fatal(err)
+    }
+    if len(state.Bots[1].Blobs) != 2 || len(state.Bots[2].Blobs) != 1 || len(state.Bots[3].Blobs) != 0 {
+        t.Errorf("the team camera shows the blobs %v, %v and %v", state.Bots[1].Blobs, state.Bots[2].Blobs, state.Bots[3].Blobs)
+    }
+    if _, ok := state.Infos[3]; !ok {
+        t.Errorf("the infos of bots outside of the region are missing")
+    }
+    if _, ok := state.Foods[1]; !ok || len(state.Foods) != 1 {
+        t.Errorf("the team camera shows the foods %v", state.Foods)
+    }
+
+    // The camera stays, where it was, when the team is gone.
+    region := state.Region
+    delete(bots, 1)
+    delete(bots, 2)
+    if _, err := ApplyGuiFrame(&state, team.Encode(bots, foods, nil, nil, nil, 0, field, nil).Delta); err != nil || state.Region != region {
+        t.Errorf("the region is %v instead of %v, error %v", state.Region, region, err)
+    }
+
+    free := NewGuiCameraStream(GuiCamera{ Mode: CmFree })
+    state = NewGuiSnapshot()
+    ApplyGuiFrame(&state, free.Encode(bots, foods, nil, nil, nil, 0, field, nil).Keyframe())
+    if len(state.Foods) != 2 || state.Region != [4]int32{ 0, 0, 10000, 10000 } {
+        t.Errorf("the free camera shows %v foods in the region %v", len(state.Foods), state.Region)
+    }
+}
+
+func TestDirectorStaysWithTheFight(t *testing.T) {
+    bots := map[BotId]Bot{
+        1: cameraBot(1, Vec2{ X: 100, Y: 100 }),
+        2: cameraBot(2, Vec2{ X: 130, Y: 100 }),
+        3: cameraBot(3, Vec2{ X: 700, Y: 700 }),
+        4: cameraBot(4, Vec2{ X: 730, Y: 700 }),
+        // Teammates do not fight.
+        5: cameraBot(5, Vec2{ X: 400, Y: 400 }, Vec2{ X: 410, Y: 400 }, Vec2{ X: 420, Y: 400 }),
+        6: cameraBot(5, Vec2{ X: 430, Y: 400 }),
+    }
+
+    director := NewGuiCameraStream(GuiCamera{ Mode: CmDirector })
+    director.Encode(bots, nil, nil, nil, nil, 0, Vec2{}, nil)
+    if director.fight != [2]BotId{ 1, 2 } {
+        t.Fatalf("the director shows the fight %v", director.fight)
+    }
+
+    // A slightly bigger fight is not worth a cut.
+    bot := bots[3]
+    bot.Blobs[1] = Blob{ Position: Vec2{ X: 700, Y: 720 }, Mass: 50 }
+    bots[3] = bot
+    director.Encode(bots, nil, nil, nil, nil, 0, Vec2{}, nil)
+    if director.fight != [2]BotId{ 1, 2 } {
+        t.Errorf("the director cut to the fight %v", director.fight)
+    }
+
+    bot.Blobs[2] = Blob{ Position: Vec2{ X: 720, Y: 720 }, Mass: 200 }
+    bots[3] = bot
+    director.Encode(bots, nil, nil, nil, nil, 0, Vec2{}, nil)
+    if director.fight != [2]BotId{ 3, 4 } {
+        t.Errorf("the director shows the fight %v instead of the much bigger one", director.fight)
+    }
+    if !IsInViewWindow(director.region, Vec2{ X: 730, Y: 700 }, 0) || IsInViewWindow(director.region, Vec2{ X: 100, Y: 100 }, 0) {
+        t.Errorf("the region %+v does not show the fight", director.region)
+    }
+}
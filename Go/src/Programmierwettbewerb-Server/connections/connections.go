@@ -100,6 +100,8 @@ type Blob struct {
     IsSplit      bool
     ReunionTime  float32
     IndividualTargetVec    Vec2
+    // The movement of the last step in units per second.
+    Velocity     Vec2
 }
 
 func Radius(mass float32) float32 {
@@ -201,6 +203,14 @@ func NewServerGuiToxin(toxin Toxin) ServerGuiToxin {
     return ServerGuiToxin{ ToFixedVec2(toxin.Position, serverGuiDecimalPlaceFactor), int(toxin.Mass) }
 }
 
+// The totals of a team over its living and dead bots.
+type ServerGuiTeam struct {
+    Name        string      `json:"name"`
+    Mass        int         `json:"mass"`
+    Bots        int         `json:"bots"`
+    Statistics  Statistics  `json:"statistics"`
+}
+
 type ServerGuiUpdateMessage struct {
     // "JSON objects only support strings as keys; to encode a Go map type it must be of the form map[string]T (where T is any Go type supported by the json package)."
     // Source: http://blog.golang.org/json-and-go
@@ -215,6 +225,12 @@ type ServerGuiUpdateMessage struct {
     StatisticsThisGame          map[string]Statistics           `json:"8"`
     StatisticsGlobal            map[string]Statistics           `json:"9"`
     GameTime                    float32                         `json:"10"`
+    Teams                       map[string]ServerGuiTeam        `json:"11"`
+    // null while the walls stay the same, otherwise all of them.
+    Walls                       []Wall                          `json:"12"`
+    FieldSize                   Vec2                            `json:"13"`
+    // The final ranking after the time of the game is over, otherwise null.
+    GameOver                    *GameOver                       `json:"14"`
 }
 
 func NewServerGuiUpdateMessage() ServerGuiUpdateMessage {
@@ -230,6 +246,8 @@ func NewServerGuiUpdateMessage() ServerGuiUpdateMessage {
         StatisticsThisGame:         make(map[string]Statistics),
         StatisticsGlobal:           make(map[string]Statistics),
         GameTime:                   0,
+        // Only set in the messages that carry the team totals.
+        Teams:                      nil,
     }
 }
 
@@ -244,6 +262,10 @@ type GuiConnection struct {
     IsNewConnection             bool
     MessageChannel              chan ServerGuiUpdateMessage
     StopServerNotification      chan bool
+    // Binary guis get the GuiFrames instead of the ServerGuiUpdateMessages.
+    Binary                      bool
+    FrameChannel                chan *GuiFrame
+    Camera                      GuiCamera
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -270,6 +292,30 @@ func (guiConnections *GuiConnections) Count() int {
     return len(guiConnections.connections)
 }
 
+// The cameras of all the binary guis.
+func (guiConnections *GuiConnections) BinaryCameras() map[GuiCamera]bool {
+    guiConnections.mutex.Lock()
+    defer guiConnections.mutex.Unlock()
+
+    cameras := make(map[GuiCamera]bool)
+    for _, guiConnection := range guiConnections.connections {
+        if guiConnection.Binary {
+            cameras[guiConnection.Camera] = true
+        }
+    }
+    return cameras
+}
+
+func (guiConnections *GuiConnections) SetCamera(guiId GuiId, camera GuiCamera) {
+    guiConnections.mutex.Lock()
+    defer guiConnections.mutex.Unlock()
+
+    if guiConnection, found := guiConnections.connections[guiId]; found {
+        guiConnection.Camera = camera
+        guiConnections.connections[guiId] = guiConnection
+    }
+}
+
 func (guiConnections *GuiConnections) MakeAllOld() {
     guiConnections.mutex.Lock()
     for guiConnectionId, guiConnection := range guiConnections.connections {
@@ -294,6 +340,7 @@ func (guiConnections *GuiConnections) Delete(guiId GuiId) {
     if found {
         guiConnection.Connection.Close()        
         close(guiConnection.MessageChannel)
+        close(guiConnection.FrameChannel)
         delete(guiConnections.connections, guiId)
     }
 }
@@ -0,0 +1,760 @@
+package connections
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "sync"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Binary Gui Stream
+//
+////////////////////////////////////////////////////////////////////////
+
+// Guis that connect to /gui/?format=binary get this format instead of the
+// gzipped JSON of the ServerGuiUpdateMessages. The server encodes every step
+// once for all of these guis: a delta to the step before and, only when a gui
+// needs it, a keyframe with everything. A gui, that is new or has missed a
+// frame, gets the keyframe.
+//
+// Frame:
+//     byte        guiStreamVersion
+//     byte        GfkKeyframe or GfkDelta
+//     uvarint     sequence number
+//     float32     game time, -1 without a game with a time limit
+//     sections    each starts with a section tag, the tag 0 ends the frame
+//
+// Sections, all numbers are uvarints unless noted:
+//     GsBotInfos              n × botId, name, color (3 bytes), image
+//     GsDeletedBots           n × botId (the infos, blobs and statistics are gone)
+//     GsBots                  n × botId, teamId, view window (4 coords),
+//                                 m × blobId, x, y, mass,
+//                                 k × deleted blobId
+//     GsFoods                 n × foodId, x, y, mass
+//     GsDeletedFoods          n × foodId
+//     GsToxins                n × toxinId, x, y, mass
+//     GsDeletedToxins         n × toxinId
+//     GsStatisticsThisGame    n × botId, statistics
+//     GsStatisticsGlobal      n × botId, statistics
+//     GsTeams                 n × key, name, mass, bots, statistics
+//     GsDeletedTeams          n × key
+//     GsRegion                1 × the region of the camera (4 coords)
+//     GsWalls                 n × wall (4 coords), replaces all walls
+//     GsFieldSize             1 × width and height of the field (2 coords)
+//     GsStandings             n × place, player, score (float), mass (float), kills,
+//                                 survival time (float), replaces all standings,
+//                                 n is 0 when a new game starts
+//
+// Strings are a length and the bytes. Floats are little endian float32.
+// Statistics are MaxSize and MaxSurvivalTime as floats and the 8 counters.
+// Coordinates are quantized to 1/serverGuiDecimalPlaceFactor units. A coord is
+// the zigzag varint of the difference to the last value of the coordinate, that
+// the gui knows, or to 0 for new things and in keyframes.
+
+const (
+    guiStreamVersion = 1
+)
+
+type GuiFrameKind byte
+const (
+    GfkKeyframe     GuiFrameKind = iota + 1
+    GfkDelta
+)
+
+type GuiSection byte
+const (
+    GsEnd                   GuiSection = iota
+    GsBotInfos
+    GsDeletedBots
+    GsBots
+    GsFoods
+    GsDeletedFoods
+    GsToxins
+    GsDeletedToxins
+    GsStatisticsThisGame
+    GsStatisticsGlobal
+    GsTeams
+    GsDeletedTeams
+    GsRegion
+    GsWalls
+    GsFieldSize
+    GsStandings
+)
+
+func quantize(value float32) int32 {
+    return int32(math.Floor(float64(value * serverGuiDecimalPlaceFactor) + 0.5))
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Snapshot
+//
+////////////////////////////////////////////////////////////////////////
+
+// Food, toxins and blobs with quantized positions.
+type GuiThing struct {
+    X           int32
+    Y           int32
+    Mass        uint32
+}
+
+type GuiBot struct {
+    TeamId      TeamId
+    // X, Y, width and height.
+    ViewWindow  [4]int32
+    Blobs       map[BlobId]GuiThing
+}
+
+// Everything a gui shows of one step. It is not changed after it is made.
+type GuiSnapshot struct {
+    GameTime            float32
+    Infos               map[BotId]BotInfo
+    Bots                map[BotId]GuiBot
+    Foods               map[FoodId]GuiThing
+    Toxins              map[ToxinId]GuiThing
+    StatisticsThisGame  map[BotId]Statistics
+    StatisticsGlobal    map[BotId]Statistics
+    Teams               map[string]ServerGuiTeam
+    // X, Y, width and height of what the camera shows, see GuiCamera.
+    Region              [4]int32
+    // X, Y, width and height of every wall. They are only sent, when they change.
+    Walls               [][4]int32
+    // Width and height of the field.
+    FieldSize           [2]int32
+    // The final ranking, nil while the game is running.
+    Standings           []GameStanding
+}
+
+func NewGuiSnapshot() GuiSnapshot {
+    return GuiSnapshot{
+        Infos:              make(map[BotId]BotInfo),
+        Bots:               make(map[BotId]GuiBot),
+        Foods:              make(map[FoodId]GuiThing),
+        Toxins:             make(map[ToxinId]GuiThing),
+        StatisticsThisGame: make(map[BotId]Statistics),
+        StatisticsGlobal:   make(map[BotId]Statistics),
+        Teams:              make(map[string]ServerGuiTeam),
+    }
+}
+
+func quantizeViewWindow(viewWindow ViewWindow) [4]int32 {
+    return [4]int32{
+        quantize(viewWindow.Position.X), quantize(viewWindow.Position.Y),
+        quantize(viewWindow.Size.X), quantize(viewWindow.Size.Y),
+    }
+}
+
+func MakeGuiSnapshot(bots map[BotId]Bot, foods map[FoodId]Food, toxins map[ToxinId]Toxin, teams map[string]ServerGuiTeam, gameTime float32) GuiSnapshot {
+    snapshot := NewGuiSnapshot()
+    snapshot.GameTime = gameTime
+
+    for botId, bot := range bots {
+        guiBot := GuiBot{
+            TeamId:     bot.TeamId,
+            ViewWindow: quantizeViewWindow(bot.ViewWindow),
+            Blobs:      make(map[BlobId]GuiThing, len(bot.Blobs)),
+        }
+        for blobId, blob := range bot.Blobs {
+            guiBot.Blobs[blobId] = GuiThing{ quantize(blob.Position.X), quantize(blob.Position.Y), uint32(blob.Mass) }
+        }
+        snapshot.Bots[botId] = guiBot
+        snapshot.Infos[botId] = BotInfo{ Name: bot.Info.Name, Color: bot.Info.Color, ImagePath: bot.Info.ImagePath }
+        snapshot.StatisticsThisGame[botId] = bot.StatisticsThisGame
+        snapshot.StatisticsGlobal[botId] = bot.StatisticsOverall
+    }
+    for foodId, food := range foods {
+        snapshot.Foods[foodId] = GuiThing{ quantize(food.Position.X), quantize(food.Position.Y), uint32(food.Mass) }
+    }
+    for toxinId, toxin := range toxins {
+        snapshot.Toxins[toxinId] = GuiThing{ quantize(toxin.Position.X), quantize(toxin.Position.Y), uint32(toxin.Mass) }
+    }
+    for key, team := range teams {
+        snapshot.Teams[key] = team
+    }
+    return snapshot
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Encoder
+//
+////////////////////////////////////////////////////////////////////////
+
+// One encoded step, that is shared by all binary guis with the same camera.
+type GuiFrame struct {
+    Sequence        uint32
+    Delta           []byte
+    // The deltas of different cameras do not fit together.
+    Camera          GuiCamera
+
+    snapshot        *GuiSnapshot
+    keyframeOnce    sync.Once
+    keyframe        []byte
+}
+
+// Encoded on the first call, usually by the sending go-routine of a new gui.
+func (frame *GuiFrame) Keyframe() []byte {
+    frame.keyframeOnce.Do(func() {
+        frame.keyframe = encodeGuiFrame(GfkKeyframe, frame.Sequence, nil, frame.snapshot)
+    })
+    return frame.keyframe
+}
+
+type GuiEncoder struct {
+    previous    *GuiSnapshot
+    sequence    uint32
+}
+
+func (encoder *GuiEncoder) Encode(snapshot GuiSnapshot) *GuiFrame {
+    encoder.sequence += 1
+    frame := &GuiFrame{
+        Sequence:   encoder.sequence,
+        Delta:      encodeGuiFrame(GfkDelta, encoder.sequence, encoder.previous, &snapshot),
+        snapshot:   &snapshot,
+    }
+    encoder.previous = &snapshot
+    return frame
+}
+
+// Without binary guis there is nothing to encode. The next gui starts with a keyframe anyway.
+func (encoder *GuiEncoder) Reset() {
+    encoder.previous = nil
+}
+
+type guiWriter struct {
+    buffer      []byte
+    scratch     [binary.MaxVarintLen64]byte
+}
+
+func (writer *guiWriter) byte(value byte) {
+    writer.buffer = append(writer.buffer, value)
+}
+
+func (writer *guiWriter) uvarint(value uint64) {
+    n := binary.PutUvarint(writer.scratch[:], value)
+    writer.buffer = append(writer.buffer, writer.scratch[:n]...)
+}
+
+func (writer *guiWriter) coord(value int32, previous int32) {
+    n := binary.PutVarint(writer.scratch[:], int64(value) - int64(previous))
+    writer.buffer = append(writer.buffer, writer.scratch[:n]...)
+}
+
+func (writer *guiWriter) float(value float32) {
+    binary.LittleEndian.PutUint32(writer.scratch[:4], math.Float32bits(value))
+    writer.buffer = append(writer.buffer, writer.scratch[:4]...)
+}
+
+func (writer *guiWriter) string(value string) {
+    writer.uvarint(uint64(len(value)))
+    writer.buffer = append(writer.buffer, value...)
+}
+
+func (writer *guiWriter) thing(id uint32, thing GuiThing, previous GuiThing) {
+    writer.uvarint(uint64(id))
+    writer.coord(thing.X, previous.X)
+    writer.coord(thing.Y, previous.Y)
+    writer.uvarint(uint64(thing.Mass))
+}
+
+func (writer *guiWriter) statistics(statistics Statistics) {
+    writer.float(statistics.MaxSize)
+    writer.float(statistics.MaxSurvivalTime)
+    for _, counter := range []int{
+        statistics.BlobKillCount, statistics.BotKillCount, statistics.ToxinThrow, statistics.SuccessfulToxin,
+        statistics.SplitCount, statistics.SuccessfulSplit, statistics.SuccessfulTeam, statistics.BadTeaming,
+    } {
+        writer.uvarint(uint64(counter))
+    }
+}
+
+func (writer *guiWriter) ids(section GuiSection, ids []uint32) {
+    if len(ids) == 0 {
+        return
+    }
+    writer.byte(byte(section))
+    writer.uvarint(uint64(len(ids)))
+    for _, id := range ids {
+        writer.uvarint(uint64(id))
+    }
+}
+
+func sortedUint32s(ids []uint32) []uint32 {
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+// Without a previous snapshot everything is written.
+func encodeGuiFrame(kind GuiFrameKind, sequence uint32, previous *GuiSnapshot, snapshot *GuiSnapshot) []byte {
+    if previous == nil {
+        empty := NewGuiSnapshot()
+        previous = &empty
+    }
+    writer := guiWriter{ buffer: make([]byte, 0, 1024) }
+    writer.byte(guiStreamVersion)
+    writer.byte(byte(kind))
+    writer.uvarint(uint64(sequence))
+    writer.float(snapshot.GameTime)
+
+    //
+    // Bots
+    //
+    var changedInfos, deletedBots, changedBots []uint32
+    for botId, info := range snapshot.Infos {
+        if previousInfo, ok := previous.Infos[botId]; !ok || previousInfo != info {
+            changedInfos = append(changedInfos, uint32(botId))
+        }
+    }
+    for botId := range previous.Bots {
+        if _, ok := snapshot.Bots[botId]; !ok {
+            deletedBots = append(deletedBots, uint32(botId))
+        }
+    }
+    for botId, bot := range snapshot.Bots {
+        if previousBot, ok := previous.Bots[botId]; !ok || !sameGuiBot(previousBot, bot) {
+            changedBots = append(changedBots, uint32(botId))
+        }
+    }
+
+    if len(changedInfos) > 0 {
+        writer.byte(byte(GsBotInfos))
+        writer.uvarint(uint64(len(changedInfos)))
+        for _, id := range sortedUint32s(changedInfos) {
+            info := snapshot.Infos[BotId(id)]
+            writer.uvarint(uint64(id))
+            writer.string(info.Name)
+            writer.byte(info.Color.R)
+            writer.byte(info.Color.G)
+            writer.byte(info.Color.B)
+            writer.string(info.ImagePath)
+        }
+    }
+    writer.ids(GsDeletedBots, sortedUint32s(deletedBots))
+
+    if len(changedBots) > 0 {
+        writer.byte(byte(GsBots))
+        writer.uvarint(uint64(len(changedBots)))
+        for _, id := range sortedUint32s(changedBots) {
+            bot := snapshot.Bots[BotId(id)]
+            previousBot := previous.Bots[BotId(id)]
+            writer.uvarint(uint64(id))
+            writer.uvarint(uint64(bot.TeamId))
+            for i := range bot.ViewWindow {
+                writer.coord(bot.ViewWindow[i], previousBot.ViewWindow[i])
+            }
+
+            var changedBlobs, deletedBlobs []uint32
+            for blobId, blob := range bot.Blobs {
+                if previousBlob, ok := previousBot.Blobs[blobId]; !ok || previousBlob != blob {
+                    changedBlobs = append(changedBlobs, uint32(blobId))
+                }
+            }
+            for blobId := range previousBot.Blobs {
+                if _, ok := bot.Blobs[blobId]; !ok {
+                    deletedBlobs = append(deletedBlobs, uint32(blobId))
+                }
+            }
+            writer.uvarint(uint64(len(changedBlobs)))
+            for _, blobId := range sortedUint32s(changedBlobs) {
+                writer.thing(blobId, bot.Blobs[BlobId(blobId)], previousBot.Blobs[BlobId(blobId)])
+            }
+            writer.uvarint(uint64(len(deletedBlobs)))
+            for _, blobId := range sortedUint32s(deletedBlobs) {
+                writer.uvarint(uint64(blobId))
+            }
+        }
+    }
+
+    //
+    // Foods and toxins
+    //
+    var changedFoods, deletedFoods []uint32
+    for foodId, food := range snapshot.Foods {
+        if previousFood, ok := previous.Foods[foodId]; !ok || previousFood != food {
+            changedFoods = append(changedFoods, uint32(foodId))
+        }
+    }
+    for foodId := range previous.Foods {
+        if _, ok := snapshot.Foods[foodId]; !ok {
+            deletedFoods = append(deletedFoods, uint32(foodId))
+        }
+    }
+    if len(changedFoods) > 0 {
+        writer.byte(byte(GsFoods))
+        writer.uvarint(uint64(len(changedFoods)))
+        for _, id := range sortedUint32s(changedFoods) {
+            writer.thing(id, snapshot.Foods[FoodId(id)], previous.Foods[FoodId(id)])
+        }
+    }
+    writer.ids(GsDeletedFoods, sortedUint32s(deletedFoods))
+
+    var changedToxins, deletedToxins []uint32
+    for toxinId, toxin := range snapshot.Toxins {
+        if previousToxin, ok := previous.Toxins[toxinId]; !ok || previousToxin != toxin {
+            changedToxins = append(changedToxins, uint32(toxinId))
+        }
+    }
+    for toxinId := range previous.Toxins {
+        if _, ok := snapshot.Toxins[toxinId]; !ok {
+            deletedToxins = append(deletedToxins, uint32(toxinId))
+        }
+    }
+    if len(changedToxins) > 0 {
+        writer.byte(byte(GsToxins))
+        writer.uvarint(uint64(len(changedToxins)))
+        for _, id := range sortedUint32s(changedToxins) {
+            writer.thing(id, snapshot.Toxins[ToxinId(id)], previous.Toxins[ToxinId(id)])
+        }
+    }
+    writer.ids(GsDeletedToxins, sortedUint32s(deletedToxins))
+
+    //
+    // Statistics and teams
+    //
+    writeStatistics := func(section GuiSection, statistics map[BotId]Statistics, previousStatistics map[BotId]Statistics) {
+        var changed []uint32
+        for botId, value := range statistics {
+            if previousValue, ok := previousStatistics[botId]; !ok || previousValue != value {
+                changed = append(changed, uint32(botId))
+            }
+        }
+        if len(changed) == 0 {
+            return
+        }
+        writer.byte(byte(section))
+        writer.uvarint(uint64(len(changed)))
+        for _, id := range sortedUint32s(changed) {
+            writer.uvarint(uint64(id))
+            writer.statistics(statistics[BotId(id)])
+        }
+    }
+    writeStatistics(GsStatisticsThisGame, snapshot.StatisticsThisGame, previous.StatisticsThisGame)
+    writeStatistics(GsStatisticsGlobal, snapshot.StatisticsGlobal, previous.StatisticsGlobal)
+
+    var changedTeams, deletedTeams []string
+    for key, team := range snapshot.Teams {
+        if previousTeam, ok := previous.Teams[key]; !ok || previousTeam != team {
+            changedTeams = append(changedTeams, key)
+        }
+    }
+    for key := range previous.Teams {
+        if _, ok := snapshot.Teams[key]; !ok {
+            deletedTeams = append(deletedTeams, key)
+        }
+    }
+    sort.Strings(changedTeams)
+    sort.Strings(deletedTeams)
+    if len(changedTeams) > 0 {
+        writer.byte(byte(GsTeams))
+        writer.uvarint(uint64(len(changedTeams)))
+        for _, key := range changedTeams {
+            team := snapshot.Teams[key]
+            writer.string(key)
+            writer.string(team.Name)
+            writer.uvarint(uint64(team.Mass))
+            writer.uvarint(uint64(team.Bots))
+            writer.statistics(team.Statistics)
+        }
+    }
+    if len(deletedTeams) > 0 {
+        writer.byte(byte(GsDeletedTeams))
+        writer.uvarint(uint64(len(deletedTeams)))
+        for _, key := range deletedTeams {
+            writer.string(key)
+        }
+    }
+
+    if snapshot.Region != previous.Region {
+        writer.byte(byte(GsRegion))
+        writer.uvarint(1)
+        for i := range snapshot.Region {
+            writer.coord(snapshot.Region[i], previous.Region[i])
+        }
+    }
+
+    if snapshot.FieldSize != previous.FieldSize {
+        writer.byte(byte(GsFieldSize))
+        writer.uvarint(1)
+        for i := range snapshot.FieldSize {
+            writer.coord(snapshot.FieldSize[i], previous.FieldSize[i])
+        }
+    }
+
+    if !sameWalls(snapshot.Walls, previous.Walls) {
+        writer.byte(byte(GsWalls))
+        writer.uvarint(uint64(len(snapshot.Walls)))
+        for _, wall := range snapshot.Walls {
+            for i := range wall {
+                writer.coord(wall[i], 0)
+            }
+        }
+    }
+
+    if !sameStandings(snapshot.Standings, previous.Standings) {
+        writer.byte(byte(GsStandings))
+        writer.uvarint(uint64(len(snapshot.Standings)))
+        for _, standing := range snapshot.Standings {
+            writer.uvarint(uint64(standing.Place))
+            writer.string(standing.Player)
+            writer.float(standing.Score)
+            writer.float(standing.Mass)
+            writer.uvarint(uint64(standing.Kills))
+            writer.float(standing.SurvivalTime)
+        }
+    }
+
+    writer.byte(byte(GsEnd))
+    return writer.buffer
+}
+
+// Only the fields, that are sent, count.
+func sameStandings(lhs []GameStanding, rhs []GameStanding) bool {
+    if len(lhs) != len(rhs) {
+        return false
+    }
+    for i := range lhs {
+        if lhs[i].Place != rhs[i].Place || lhs[i].Player != rhs[i].Player || lhs[i].Score != rhs[i].Score ||
+            lhs[i].Mass != rhs[i].Mass || lhs[i].Kills != rhs[i].Kills || lhs[i].SurvivalTime != rhs[i].SurvivalTime {
+            return false
+        }
+    }
+    return true
+}
+
+func sameWalls(lhs [][4]int32, rhs [][4]int32) bool {
+    if len(lhs) != len(rhs) {
+        return false
+    }
+    for i := range lhs {
+        if lhs[i] != rhs[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func sameGuiBot(lhs GuiBot, rhs GuiBot) bool {
+    if lhs.TeamId != rhs.TeamId || lhs.ViewWindow != rhs.ViewWindow || len(lhs.Blobs) != len(rhs.Blobs) {
+        return false
+    }
+    for blobId, blob := range lhs.Blobs {
+        if other, ok := rhs.Blobs[blobId]; !ok || other != blob {
+            return false
+        }
+    }
+    return true
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Decoder
+//
+////////////////////////////////////////////////////////////////////////
+
+var errGuiFrameTruncated = errors.New("The gui frame is truncated.")
+
+type guiReader struct {
+    buffer      []byte
+    err         error
+}
+
+func (reader *guiReader) byte() byte {
+    if reader.err != nil || len(reader.buffer) < 1 {
+        reader.err = errGuiFrameTruncated
+        return 0
+    }
+    value := reader.buffer[0]
+    reader.buffer = reader.buffer[1:]
+    return value
+}
+
+func (reader *guiReader) uvarint() uint64 {
+    if reader.err != nil {
+        return 0
+    }
+    value, n := binary.Uvarint(reader.buffer)
+    if n <= 0 {
+        reader.err = errGuiFrameTruncated
+        return 0
+    }
+    reader.buffer = reader.buffer[n:]
+    return value
+}
+
+func (reader *guiReader) coord(previous int32) int32 {
+    if reader.err != nil {
+        return 0
+    }
+    value, n := binary.Varint(reader.buffer)
+    if n <= 0 {
+        reader.err = errGuiFrameTruncated
+        return 0
+    }
+    reader.buffer = reader.buffer[n:]
+    return int32(int64(previous) + value)
+}
+
+func (reader *guiReader) float() float32 {
+    if reader.err != nil || len(reader.buffer) < 4 {
+        reader.err = errGuiFrameTruncated
+        return 0
+    }
+    value := math.Float32frombits(binary.LittleEndian.Uint32(reader.buffer))
+    reader.buffer = reader.buffer[4:]
+    return value
+}
+
+func (reader *guiReader) string() string {
+    length := reader.uvarint()
+    if reader.err != nil || uint64(len(reader.buffer)) < length {
+        reader.err = errGuiFrameTruncated
+        return ""
+    }
+    value := string(reader.buffer[:length])
+    reader.buffer = reader.buffer[length:]
+    return value
+}
+
+func (reader *guiReader) thing(previous GuiThing) GuiThing {
+    x := reader.coord(previous.X)
+    y := reader.coord(previous.Y)
+    return GuiThing{ X: x, Y: y, Mass: uint32(reader.uvarint()) }
+}
+
+func (reader *guiReader) statistics() Statistics {
+    statistics := Statistics{ MaxSize: reader.float(), MaxSurvivalTime: reader.float() }
+    for _, counter := range []*int{
+        &statistics.BlobKillCount, &statistics.BotKillCount, &statistics.ToxinThrow, &statistics.SuccessfulToxin,
+        &statistics.SplitCount, &statistics.SuccessfulSplit, &statistics.SuccessfulTeam, &statistics.BadTeaming,
+    } {
+        *counter = int(reader.uvarint())
+    }
+    return statistics
+}
+
+// Applies a frame to the state of a gui and returns its sequence number.
+// A keyframe replaces the whole state.
+func ApplyGuiFrame(state *GuiSnapshot, frame []byte) (uint32, error) {
+    reader := guiReader{ buffer: frame }
+    if version := reader.byte(); reader.err == nil && version != guiStreamVersion {
+        return 0, errors.New(fmt.Sprintf("The gui frame has the version %v instead of %v.", version, guiStreamVersion))
+    }
+    kind := GuiFrameKind(reader.byte())
+    sequence := uint32(reader.uvarint())
+    gameTime := reader.float()
+    if reader.err != nil {
+        return 0, reader.err
+    }
+    if kind == GfkKeyframe {
+        *state = NewGuiSnapshot()
+    }
+    state.GameTime = gameTime
+
+    for {
+        section := GuiSection(reader.byte())
+        if reader.err != nil {
+            return 0, reader.err
+        }
+        if section == GsEnd {
+            return sequence, nil
+        }
+
+        count := int(reader.uvarint())
+        if section == GsWalls {
+            state.Walls = nil
+        }
+        if section == GsStandings {
+            state.Standings = nil
+        }
+        for i := 0; i < count && reader.err == nil; i++ {
+            switch section {
+            case GsBotInfos:
+                botId := BotId(reader.uvarint())
+                info := BotInfo{ Name: reader.string() }
+                info.Color = Color{ R: reader.byte(), G: reader.byte(), B: reader.byte() }
+                info.ImagePath = reader.string()
+                state.Infos[botId] = info
+            case GsDeletedBots:
+                botId := BotId(reader.uvarint())
+                delete(state.Infos, botId)
+                delete(state.Bots, botId)
+                delete(state.StatisticsThisGame, botId)
+                delete(state.StatisticsGlobal, botId)
+            case GsBots:
+                botId := BotId(reader.uvarint())
+                previous := state.Bots[botId]
+                bot := GuiBot{ TeamId: TeamId(reader.uvarint()), Blobs: make(map[BlobId]GuiThing) }
+                for j := range bot.ViewWindow {
+                    bot.ViewWindow[j] = reader.coord(previous.ViewWindow[j])
+                }
+                for blobId, blob := range previous.Blobs {
+                    bot.Blobs[blobId] = blob
+                }
+                changed := int(reader.uvarint())
+                for j := 0; j < changed && reader.err == nil; j++ {
+                    blobId := BlobId(reader.uvarint())
+                    bot.Blobs[blobId] = reader.thing(bot.Blobs[blobId])
+                }
+                deleted := int(reader.uvarint())
+                for j := 0; j < deleted && reader.err == nil; j++ {
+                    delete(bot.Blobs, BlobId(reader.uvarint()))
+                }
+                state.Bots[botId] = bot
+            case GsFoods:
+                foodId := FoodId(reader.uvarint())
+                state.Foods[foodId] = reader.thing(state.Foods[foodId])
+            case GsDeletedFoods:
+                delete(state.Foods, FoodId(reader.uvarint()))
+            case GsToxins:
+                toxinId := ToxinId(reader.uvarint())
+                state.Toxins[toxinId] = reader.thing(state.Toxins[toxinId])
+            case GsDeletedToxins:
+                delete(state.Toxins, ToxinId(reader.uvarint()))
+            case GsStatisticsThisGame:
+                botId := BotId(reader.uvarint())
+                state.StatisticsThisGame[botId] = reader.statistics()
+            case GsStatisticsGlobal:
+                botId := BotId(reader.uvarint())
+                state.StatisticsGlobal[botId] = reader.statistics()
+            case GsTeams:
+                key := reader.string()
+                team := ServerGuiTeam{ Name: reader.string() }
+                team.Mass = int(reader.uvarint())
+                team.Bots = int(reader.uvarint())
+                team.Statistics = reader.statistics()
+                state.Teams[key] = team
+            case GsDeletedTeams:
+                delete(state.Teams, reader.string())
+            case GsRegion:
+                for j := range state.Region {
+                    state.Region[j] = reader.coord(state.Region[j])
+                }
+            case GsFieldSize:
+                for j := range state.FieldSize {
+                    state.FieldSize[j] = reader.coord(state.FieldSize[j])
+                }
+            case GsWalls:
+                var wall [4]int32
+                for j := range wall {
+                    wall[j] = reader.coord(0)
+                }
+                state.Walls = append(state.Walls, wall)
+            case GsStandings:
+                standing := GameStanding{ Place: int(reader.uvarint()), Player: reader.string() }
+                standing.Score = reader.float()
+                standing.Mass = reader.float()
+                standing.Kills = int(reader.uvarint())
+                standing.SurvivalTime = reader.float()
+                state.Standings = append(state.Standings, standing)
+            default:
+                return 0, errors.New(fmt.Sprintf("The gui frame has the unknown section %v.", section))
+            }
+        }
+    }
+}
@@ -0,0 +1,137 @@
+package connections
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/vector"
+
+    "reflect"
+    "testing"
+)
+
+func testBot(name string, teamId TeamId, blobs map[BlobId]Blob) Bot {
+    return Bot{
+        Info:               BotInfo{ Name: name, Color: Color{ R: 1, G: 2, B: 3 }, Token: "secret" },
+        TeamId:             teamId,
+        ViewWindow:         ViewWindow{ Position: Vec2{ X: 10, Y: 20 }, Size: Vec2{ X: 300, Y: 200 } },
+        Blobs:              blobs,
+        StatisticsThisGame: Statistics{ MaxSize: 123.5, BlobKillCount: 2 },
+    }
+}
+
+func testSnapshots() []GuiSnapshot {
+    teams := map[string]ServerGuiTeam{ "a": { Name: "a", Mass: 300, Bots: 2 } }
+
+    first := MakeGuiSnapshot(
+        map[BotId]Bot{
+            1: testBot("one", 1, map[BlobId]Blob{ 0: { Position: Vec2{ X: 100.04, Y: 200 }, Mass: 100 }, 1: { Position: Vec2{ X: 110, Y: 200 }, Mass: 50 } }),
+            2: testBot("two", 2, map[BlobId]Blob{ 2: { Position: Vec2{ X: 500, Y: 500 }, Mass: 200 } }),
+        },
+        map[FoodId]Food{ 1: { Position: Vec2{ X: 1, Y: 2 }, Mass: 2 }, 2: { Position: Vec2{ X: 3, Y: 4 }, Mass: 3 } },
+        map[ToxinId]Toxin{ 1: { Position: Vec2{ X: 600, Y: 600 }, Mass: 60 } },
+        teams,
+        100)
+    first.Walls = [][4]int32{ { 0, 0, 1000, 500 }, { 5000, 5000, 100, 100 } }
+    first.FieldSize = [2]int32{ 10000, 10000 }
+
+    // The first bot moves and loses a blob, the second one dies, a third one comes in.
+    bot := testBot("one", 1, map[BlobId]Blob{ 0: { Position: Vec2{ X: 99.5, Y: 201 }, Mass: 140 } })
+    bot.StatisticsThisGame.BlobKillCount = 3
+    second := MakeGuiSnapshot(
+        map[BotId]Bot{
+            1: bot,
+            3: testBot("three", 3, map[BlobId]Blob{ 3: { Position: Vec2{ X: 700, Y: 10 }, Mass: 100 } }),
+        },
+        map[FoodId]Food{ 2: { Position: Vec2{ X: 3, Y: 4.5 }, Mass: 3 }, 3: { Position: Vec2{ X: 5, Y: 6 }, Mass: 1 } },
+        map[ToxinId]Toxin{},
+        map[string]ServerGuiTeam{ "b": { Name: "b", Mass: 100, Bots: 1 } },
+        99.97)
+    // One wall is gone.
+    second.Walls = [][4]int32{ { 0, 0, 1000, 500 } }
+    second.FieldSize = [2]int32{ 100000, 50000 }
+    // The game is over. Only the sent fields of the standings come back.
+    second.Standings = []GameStanding{ { Place: 1, Player: "one", Score: 140, Mass: 140, Kills: 1, SurvivalTime: 30.5 }, { Place: 2, Player: "three", Score: 100, Mass: 100 } }
+
+    // A new game starts without standings.
+    third := first
+
+    return []GuiSnapshot{ first, second, third }
+}
+
+func TestGuiStreamRoundTrip(t *testing.T) {
+    snapshots := testSnapshots()
+
+    var encoder GuiEncoder
+    var frames []*GuiFrame
+    for _, snapshot := range snapshots {
+        frames = append(frames, encoder.Encode(snapshot))
+    }
+
+    // A gui that was there from the start.
+    state := NewGuiSnapshot()
+    for i, frame := range frames {
+        data := frame.Delta
+        if i == 0 {
+            data = frame.Keyframe()
+        }
+        sequence, err := ApplyGuiFrame(&state, data)
+        if err != nil || sequence != frame.Sequence {
+            t.Fatalf("frame %v: sequence %v, error %v", i, sequence, err)
+        }
+        if !reflect.DeepEqual(state, snapshots[i]) {
+            t.Errorf("frame %v: state is\n%+v\nwant\n%+v", i, state, snapshots[i])
+        }
+    }
+
+    // A gui that comes in later only needs the keyframe.
+    late := NewGuiSnapshot()
+    late.Foods[42] = GuiThing{ X: 1 }
+    if _, err := ApplyGuiFrame(&late, frames[1].Keyframe()); err != nil || !reflect.DeepEqual(late, snapshots[1]) {
+        t.Errorf("keyframe: state is %+v, error %v", late, err)
+    }
+
+    if late.Bots[1].Blobs[0] != (GuiThing{ X: 995, Y: 2010, Mass: 140 }) {
+        t.Errorf("blob is %+v, want the position quantized to a tenth", late.Bots[1].Blobs[0])
+    }
+    if state.Infos[1].Token != "" {
+        t.Errorf("the token is sent to the guis")
+    }
+}
+
+func TestGuiStreamDeltaOnlyHasChanges(t *testing.T) {
+    snapshots := testSnapshots()
+
+    var encoder GuiEncoder
+    full := encoder.Encode(snapshots[1])
+    unchanged := encoder.Encode(snapshots[1])
+
+    // Version, kind, sequence, game time and the end tag.
+    if len(unchanged.Delta) != 1 + 1 + 1 + 4 + 1 {
+        t.Errorf("delta without changes has %v bytes", len(unchanged.Delta))
+    }
+    if len(full.Delta) != len(full.Keyframe()) {
+        t.Errorf("the first delta has %v bytes and the keyframe %v", len(full.Delta), len(full.Keyframe()))
+    }
+
+    encoder.Reset()
+    if again := encoder.Encode(snapshots[1]); len(again.Delta) != len(full.Delta) {
+        t.Errorf("delta after a reset has %v bytes, want %v", len(again.Delta), len(full.Delta))
+    }
+}
+
+func TestGuiStreamBrokenFrames(t *testing.T) {
+    var encoder GuiEncoder
+    frame := encoder.Encode(testSnapshots()[0]).Keyframe()
+
+    for _, length := range []int{ 0, 1, 5, len(frame) / 2, len(frame) - 1 } {
+        state := NewGuiSnapshot()
+        if _, err := ApplyGuiFrame(&state, frame[:length]); err == nil {
+            t.Errorf("frame truncated to %v bytes is accepted", length)
+        }
+    }
+
+    wrongVersion := append([]byte{ guiStreamVersion + 1 }, frame[1:]...)
+    state := NewGuiSnapshot()
+    if _, err := ApplyGuiFrame(&state, wrongVersion); err == nil {
+        t.Errorf("frame with a wrong version is accepted")
+    }
+}
@@ -0,0 +1,335 @@
+package integrity
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "os"
+    "sort"
+    "sync"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    IntegrityDirectory = "../Integrity/"
+
+    // A middleware answers once per game state, so one command per step is normal.
+    // The rest gives some slack for commands that are delayed by the network.
+    commandsPerTick = 3
+
+    // A bot that gets more than floodingLimit commands dropped within
+    // floodingWindow steps is kicked.
+    floodingWindow = 100
+    floodingLimit  = 100
+
+    // More than a bot can have blobs.
+    maxBlobCommands = 64
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Violations
+//
+////////////////////////////////////////////////////////////////////////
+
+type Violation int
+const (
+    ViOverBudget        Violation = iota
+    ViOutOfField
+    ViInvalidCommand
+    ViFlooding
+)
+
+func (violation Violation) String() string {
+    switch violation {
+    case ViOverBudget:
+        return "more commands than allowed in one step"
+    case ViOutOfField:
+        return "target outside of the field"
+    case ViInvalidCommand:
+        return "invalid number or action"
+    case ViFlooding:
+        return "flooding"
+    }
+    return "unknown"
+}
+
+// What happens with a command after the check.
+type CommandVerdict int
+const (
+    CvAccept            CommandVerdict = iota
+    CvDrop
+    CvKick
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Report
+//
+////////////////////////////////////////////////////////////////////////
+
+// All violations of the bots with one name since the server was started.
+type Report struct {
+    Name                string      `json:"name"`
+    Connections         int         `json:"connections"`
+    Commands            int         `json:"commands"`
+    OverBudget          int         `json:"overBudget"`
+    OutOfField          int         `json:"outOfField"`
+    InvalidCommands     int         `json:"invalidCommands"`
+    Kicks               int         `json:"kicks"`
+    LastViolation       time.Time   `json:"lastViolation"`
+    // Reported by the middlewares.
+    Latency             LatencyHistogram    `json:"latency"`
+}
+
+func (report *Report) count(violation Violation) {
+    switch violation {
+    case ViOverBudget:
+        report.OverBudget += 1
+    case ViOutOfField:
+        report.OutOfField += 1
+    case ViInvalidCommand:
+        report.InvalidCommands += 1
+    case ViFlooding:
+        report.Kicks += 1
+    }
+    report.LastViolation = time.Now()
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Monitor
+//
+////////////////////////////////////////////////////////////////////////
+
+type botBudget struct {
+    name                string
+    commandsThisTick    int
+    droppedInWindow     int
+    windowStart         int
+    // Every kind of violation is only logged once per bot, the rest goes into the report.
+    logged              map[Violation]bool
+}
+
+// Checks the commands of the middlewares, before they reach the simulation.
+// The receiving go-routines call CheckCommand, the main loop calls NextTick.
+type Monitor struct {
+    mutex               sync.Mutex
+    fieldSize           Vec2
+    tick                int
+    bots                map[BotId]*botBudget
+    reports             map[string]*Report
+    started             time.Time
+}
+
+func NewMonitor(fieldSize Vec2) Monitor {
+    return Monitor{
+        fieldSize:  fieldSize,
+        bots:       make(map[BotId]*botBudget),
+        reports:    make(map[string]*Report),
+        started:    time.Now(),
+    }
+}
+
+// Commands of connections that are not registered are dropped.
+func (monitor *Monitor) Register(botId BotId, name string) {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    monitor.bots[botId] = &botBudget{
+        name:           name,
+        windowStart:    monitor.tick,
+        logged:         make(map[Violation]bool),
+    }
+    monitor.report(name).Connections += 1
+}
+
+// The report stays, only the budget is removed.
+func (monitor *Monitor) Unregister(botId BotId) {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    delete(monitor.bots, botId)
+}
+
+// Starts the budgets of a new simulation step.
+func (monitor *Monitor) NextTick(fieldSize Vec2) {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    monitor.tick += 1
+    monitor.fieldSize = fieldSize
+    for _, budget := range monitor.bots {
+        budget.commandsThisTick = 0
+        if monitor.tick - budget.windowStart >= floodingWindow {
+            budget.windowStart = monitor.tick
+            budget.droppedInWindow = 0
+        }
+    }
+}
+
+// Targets outside of the field are moved onto the border of the field.
+func (monitor *Monitor) CheckCommand(botId BotId, command *BotCommand) CommandVerdict {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    budget, ok := monitor.bots[botId]
+    if !ok {
+        return CvDrop
+    }
+    report := monitor.report(budget.name)
+    report.Commands += 1
+
+    budget.commandsThisTick += 1
+
+    var violation Violation
+    switch {
+    case budget.commandsThisTick > commandsPerTick:
+        violation = ViOverBudget
+    case !isValidCommand(command):
+        violation = ViInvalidCommand
+    default:
+        if monitor.limitTargets(command) {
+            monitor.violate(botId, budget, report, ViOutOfField)
+        }
+        return CvAccept
+    }
+
+    monitor.violate(botId, budget, report, violation)
+
+    budget.droppedInWindow += 1
+    if budget.droppedInWindow > floodingLimit {
+        monitor.violate(botId, budget, report, ViFlooding)
+        delete(monitor.bots, botId)
+        return CvKick
+    }
+    return CvDrop
+}
+
+// The latencies of a bot, as the middleware measured them.
+func (monitor *Monitor) AddLatency(botId BotId, histogram LatencyHistogram) {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    budget, ok := monitor.bots[botId]
+    if !ok {
+        return
+    }
+    monitor.report(budget.name).Latency.Merge(histogram)
+
+    if histogram.Missed > 0 {
+        LogfColored(LtDebug, LcYellow, "SLOW_BOT. NAME=\"%v\". BotId=%v. %v\n", budget.name, botId, histogram)
+    }
+}
+
+func isValidCommand(command *BotCommand) bool {
+    if isInvalidNumber(command.Target.X) || isInvalidNumber(command.Target.Y) || command.Action > BatSplit {
+        return false
+    }
+    if len(command.Blobs) > maxBlobCommands {
+        return false
+    }
+    for _, blobCommand := range command.Blobs {
+        if isInvalidNumber(blobCommand.Target.X) || isInvalidNumber(blobCommand.Target.Y) || blobCommand.Action > BatSplit {
+            return false
+        }
+    }
+    return true
+}
+
+// Returns true, if one of the targets was outside of the field.
+func (monitor *Monitor) limitTargets(command *BotCommand) bool {
+    outOfField := false
+    if !isInField(command.Target, monitor.fieldSize) {
+        command.Target = limitToField(command.Target, monitor.fieldSize)
+        outOfField = true
+    }
+    for i, blobCommand := range command.Blobs {
+        if !isInField(blobCommand.Target, monitor.fieldSize) {
+            command.Blobs[i].Target = limitToField(blobCommand.Target, monitor.fieldSize)
+            outOfField = true
+        }
+    }
+    return outOfField
+}
+
+func (monitor *Monitor) violate(botId BotId, budget *botBudget, report *Report, violation Violation) {
+    report.count(violation)
+    if !budget.logged[violation] || violation == ViFlooding {
+        budget.logged[violation] = true
+        LogfColored(LtDebug, LcRed, "INTEGRITY. NAME=\"%v\". BotId=%v. Violation: %v.\n", budget.name, botId, violation)
+    }
+}
+
+func (monitor *Monitor) report(name string) *Report {
+    report, ok := monitor.reports[name]
+    if !ok {
+        report = &Report{ Name: name }
+        monitor.reports[name] = report
+    }
+    return report
+}
+
+// Sorted by name.
+func (monitor *Monitor) Reports() []Report {
+    monitor.mutex.Lock()
+    defer monitor.mutex.Unlock()
+
+    reports := make([]Report, 0, len(monitor.reports))
+    for _, report := range monitor.reports {
+        reports = append(reports, *report)
+    }
+    sort.Slice(reports, func(i, j int) bool { return reports[i].Name < reports[j].Name })
+    return reports
+}
+
+// Every server run writes its own file, so the reports of a tournament can be reviewed afterwards.
+func (monitor *Monitor) WriteReports() error {
+    reports := monitor.Reports()
+    if len(reports) == 0 {
+        return nil
+    }
+
+    if err := os.MkdirAll(IntegrityDirectory, 0755); err != nil {
+        return err
+    }
+
+    content, err := json.MarshalIndent(reports, "", "    ")
+    if err != nil {
+        return err
+    }
+
+    filename := fmt.Sprintf("%vintegrity_%v.json", IntegrityDirectory, monitor.started.Format("2006-01-02_15-04-05"))
+    return ioutil.WriteFile(filename, content, 0644)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Helpers
+//
+////////////////////////////////////////////////////////////////////////
+
+func isInvalidNumber(value float32) bool {
+    return math.IsNaN(float64(value)) || math.IsInf(float64(value), 0)
+}
+
+func isInField(position Vec2, fieldSize Vec2) bool {
+    return position.X >= 0 && position.Y >= 0 && position.X <= fieldSize.X && position.Y <= fieldSize.Y
+}
+
+func limitToField(position Vec2, fieldSize Vec2) Vec2 {
+    return Vec2{
+        X: float32(math.Max(0, math.Min(float64(position.X), float64(fieldSize.X)))),
+        Y: float32(math.Max(0, math.Min(float64(position.Y), float64(fieldSize.Y)))),
+    }
+}
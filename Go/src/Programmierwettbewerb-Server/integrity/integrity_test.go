@@ -0,0 +1,145 @@
+package integrity
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "math"
+    "testing"
+    "time"
+)
+
+var testFieldSize = Vec2{ X: 1000, Y: 1000 }
+
+func TestCheckCommand(t *testing.T) {
+    nan := float32(math.NaN())
+
+    tests := []struct {
+        name            string
+        command         BotCommand
+        wantVerdict     CommandVerdict
+        wantTarget      Vec2
+        wantReport      Report
+    }{
+        { "valid command",      BotCommand{ Action: BatSplit, Target: Vec2{ X: 10, Y: 20 } },     CvAccept, Vec2{ X: 10, Y: 20 },    Report{ Name: "a", Connections: 1, Commands: 1 } },
+        { "outside the field",  BotCommand{ Action: BatNone,  Target: Vec2{ X: -5, Y: 2000 } },   CvAccept, Vec2{ X: 0, Y: 1000 },   Report{ Name: "a", Connections: 1, Commands: 1, OutOfField: 1 } },
+        { "not a number",       BotCommand{ Action: BatNone,  Target: Vec2{ X: nan, Y: 20 } },    CvDrop,   Vec2{ X: nan, Y: 20 },   Report{ Name: "a", Connections: 1, Commands: 1, InvalidCommands: 1 } },
+        { "unknown action",     BotCommand{ Action: 7,        Target: Vec2{ X: 10, Y: 20 } },     CvDrop,   Vec2{ X: 10, Y: 20 },    Report{ Name: "a", Connections: 1, Commands: 1, InvalidCommands: 1 } },
+        { "invalid blob",       BotCommand{ Action: BatNone,  Target: Vec2{ X: 10, Y: 20 }, Blobs: []BlobCommand{ { BlobId: 1, Action: BatNone, Target: Vec2{ X: nan, Y: 1 } } } },    CvDrop,   Vec2{ X: 10, Y: 20 },    Report{ Name: "a", Connections: 1, Commands: 1, InvalidCommands: 1 } },
+    }
+
+    for _, test := range tests {
+        monitor := NewMonitor(testFieldSize)
+        monitor.Register(1, "a")
+
+        command := test.command
+        if verdict := monitor.CheckCommand(1, &command); verdict != test.wantVerdict {
+            t.Errorf("%v: verdict is %v, want %v", test.name, verdict, test.wantVerdict)
+        }
+        if !math.IsNaN(float64(test.wantTarget.X)) && command.Target != test.wantTarget {
+            t.Errorf("%v: target is %v, want %v", test.name, command.Target, test.wantTarget)
+        }
+
+        report := monitor.Reports()[0]
+        report.LastViolation = test.wantReport.LastViolation
+        if report != test.wantReport {
+            t.Errorf("%v: report is %+v, want %+v", test.name, report, test.wantReport)
+        }
+    }
+}
+
+func TestBlobTargetsAreLimitedToTheField(t *testing.T) {
+    monitor := NewMonitor(testFieldSize)
+    monitor.Register(1, "a")
+
+    command := BotCommand{ Target: Vec2{ X: 10, Y: 20 }, Blobs: []BlobCommand{ { BlobId: 3, Action: BatSplit, Target: Vec2{ X: 1500, Y: 20 } } } }
+    if verdict := monitor.CheckCommand(1, &command); verdict != CvAccept {
+        t.Fatalf("verdict is %v", verdict)
+    }
+    if command.Target != (Vec2{ X: 10, Y: 20 }) || command.Blobs[0].Target != (Vec2{ X: 1000, Y: 20 }) {
+        t.Errorf("targets are %v and %v", command.Target, command.Blobs[0].Target)
+    }
+    if report := monitor.Reports()[0]; report.OutOfField != 1 {
+        t.Errorf("report is %+v", report)
+    }
+}
+
+func TestCommandBudget(t *testing.T) {
+    monitor := NewMonitor(testFieldSize)
+    monitor.Register(1, "a")
+    command := BotCommand{ Action: BatNone, Target: Vec2{ X: 10, Y: 20 } }
+
+    for i := 0; i < commandsPerTick; i++ {
+        if verdict := monitor.CheckCommand(1, &command); verdict != CvAccept {
+            t.Fatalf("command %v within the budget is not accepted: %v", i, verdict)
+        }
+    }
+    if verdict := monitor.CheckCommand(1, &command); verdict != CvDrop {
+        t.Errorf("command over the budget is not dropped: %v", verdict)
+    }
+
+    monitor.NextTick(testFieldSize)
+    if verdict := monitor.CheckCommand(1, &command); verdict != CvAccept {
+        t.Errorf("command in the next step is not accepted: %v", verdict)
+    }
+}
+
+func TestFloodingIsKicked(t *testing.T) {
+    monitor := NewMonitor(testFieldSize)
+    monitor.Register(1, "a")
+    command := BotCommand{ Action: BatNone, Target: Vec2{ X: 10, Y: 20 } }
+
+    verdict := CvAccept
+    for i := 0; i < commandsPerTick + floodingLimit + 1 && verdict != CvKick; i++ {
+        verdict = monitor.CheckCommand(1, &command)
+    }
+    if verdict != CvKick {
+        t.Fatalf("flooding bot is not kicked")
+    }
+    if verdict := monitor.CheckCommand(1, &command); verdict != CvDrop {
+        t.Errorf("command of a kicked bot is not dropped: %v", verdict)
+    }
+    if report := monitor.Reports()[0]; report.Kicks != 1 || report.OverBudget != floodingLimit + 1 {
+        t.Errorf("report does not show the flooding: %+v", report)
+    }
+}
+
+func TestUnregisteredCommandsAreDropped(t *testing.T) {
+    monitor := NewMonitor(testFieldSize)
+    command := BotCommand{ Action: BatNone, Target: Vec2{ X: 10, Y: 20 } }
+
+    if verdict := monitor.CheckCommand(1, &command); verdict != CvDrop {
+        t.Errorf("command of an unregistered bot is not dropped: %v", verdict)
+    }
+    if reports := monitor.Reports(); len(reports) != 0 {
+        t.Errorf("unregistered bot has a report: %+v", reports)
+    }
+}
+
+func TestLatencyReports(t *testing.T) {
+    monitor := NewMonitor(testFieldSize)
+    monitor.Register(1, "a")
+
+    var first LatencyHistogram
+    first.Add(3 * time.Millisecond, false)
+    first.Add(150 * time.Millisecond, true)
+    var second LatencyHistogram
+    second.Add(time.Second, true)
+    second.Missed = 2
+
+    monitor.AddLatency(1, first)
+    monitor.AddLatency(1, second)
+    monitor.AddLatency(2, second)
+
+    latency := monitor.Reports()[0].Latency
+    wantBuckets := [len(LatencyBucketBounds) + 1]int{ 1, 0, 0, 0, 0, 1, 0, 1 }
+    if latency.Buckets != wantBuckets {
+        t.Errorf("buckets are %v, want %v", latency.Buckets, wantBuckets)
+    }
+    if latency.Answers != 3 || latency.Late != 2 || latency.Missed != 2 || latency.MaxMs != 1000 {
+        t.Errorf("latency is %+v", latency)
+    }
+    if mean := latency.MeanMs(); math.Abs(mean - 1153.0 / 3) > 1e-9 {
+        t.Errorf("mean is %v", mean)
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/simulation"
+
+    "sort"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Lobby
+//
+////////////////////////////////////////////////////////////////////////
+
+// Every game starts with a lobby. The bots that register in it wait without
+// blobs and get game states with "lobby" set and the seconds until the start.
+// StartSimulation only starts the countdown. When it is over, all waiting bots
+// spawn in the same step in a random order, so connecting faster is no advantage.
+// Bots that register after the start spawn right away as before.
+
+const defaultLobbyTime = 5
+
+type Lobby struct {
+    Active          bool
+    // Seconds until the start, -1 until the simulation is started.
+    Countdown       float32
+    Waiting         []MiddlewareRegistration
+}
+
+func (lobby *Lobby) open() {
+    *lobby = Lobby{ Active: true, Countdown: -1 }
+}
+
+func (lobby *Lobby) isWaiting(botId BotId) bool {
+    for _, registration := range lobby.Waiting {
+        if registration.BotId == botId {
+            return true
+        }
+    }
+    return false
+}
+
+func (lobby *Lobby) leave(botId BotId) bool {
+    for i, registration := range lobby.Waiting {
+        if registration.BotId == botId {
+            lobby.Waiting = append(lobby.Waiting[:i], lobby.Waiting[i+1:]...)
+            return true
+        }
+    }
+    return false
+}
+
+func (lobby *Lobby) startCountdown(game Game) {
+    lobby.Countdown = game.LobbyTime
+    if lobby.Countdown <= 0 {
+        lobby.Countdown = defaultLobbyTime
+    }
+}
+
+// Counts down and returns true in the step the game starts.
+func (lobby *Lobby) update(dt float32) bool {
+    if !lobby.Active || lobby.Countdown < 0 {
+        return false
+    }
+    lobby.Countdown -= dt
+    return lobby.Countdown <= 0
+}
+
+// What a waiting bot gets instead of a game state.
+func (lobby *Lobby) message(settings *ServerSettings, gameTime float32, tick int) ServerMiddlewareGameState {
+    return ServerMiddlewareGameState{
+        FieldSize:  settings.FieldSize,
+        GameTime:   ToFixed(gameTime, 100),
+        Tick:       tick,
+        Lobby:      true,
+        Countdown:  ToFixed(lobby.Countdown, 100),
+    }
+}
+
+// Spawns all waiting bots and closes the lobby. The order comes from the random
+// generator of the game, so a seed gives the same spawns in a replay.
+func (lobby *Lobby) close(gameState *GameState, settings *ServerSettings) {
+    waiting := lobby.Waiting
+    sort.Slice(waiting, func(i, j int) bool { return waiting[i].BotId < waiting[j].BotId })
+    gameState.Random.Shuffle(len(waiting), func(i, j int) { waiting[i], waiting[j] = waiting[j], waiting[i] })
+
+    for _, registration := range waiting {
+        spawnBot(gameState, settings, registration)
+    }
+    LogfColored(LtDebug, LcGreen, "The game starts with %v bots\n", len(waiting))
+    *lobby = Lobby{}
+}
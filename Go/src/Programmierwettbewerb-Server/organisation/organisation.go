@@ -9,6 +9,10 @@ import (
     "os"
     "math"
     "bufio"
+    "strings"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/hex"
 )
 
 ////////////////////////////////////////////////////////////////////////
@@ -43,6 +47,8 @@ var botNames = "bot.names"
 var statisticsPath = "../Statistics/"
 var playerStatsFile = "playerStats.json"
 var svnBasePath = "../SVN/"
+var tokenExtension = ".token"
+var tokenLength = 16
 // Old date, so it updates the data the very first time.
 var lastUpdate = time.Date(2016, time.January, 1, 1, 1, 1, 1, time.FixedZone("Europe", 1))
 var playerData SvnPlayerData
@@ -188,6 +194,47 @@ func updateJsonFile(pathToSvn string, repos string) {
     f.Sync()
 }
 
+////////////////////////////////////////////////////////////////////////
+//
+// Tokens
+//
+////////////////////////////////////////////////////////////////////////
+
+// Every repository gets a secret token next to its checkout, for example ../SVN/pwb_04.token.
+// The team puts it into its middleware.conf, so nobody else can play with the names of the team.
+func makeTokenFileName(repos string) string {
+    return svnBasePath + repos + tokenExtension
+}
+
+// An existing token is never replaced, the teams already got it.
+func createToken(repos string) {
+    filename := makeTokenFileName(repos)
+    if _, err := os.Stat(filename); err == nil {
+        return
+    }
+
+    secret := make([]byte, tokenLength)
+    if _, err := rand.Read(secret); err != nil {
+        Logf(LtDebug, "Could not create a token for the repository %v: %v\n", repos, err)
+        return
+    }
+    if err := ioutil.WriteFile(filename, []byte(hex.EncodeToString(secret) + "\n"), 0600); err != nil {
+        Logf(LtDebug, "Could not write the token for the repository %v: %v\n", repos, err)
+        return
+    }
+    Logf(LtDebug, "Created a new token for the repository %v.\n", repos)
+}
+
+func checkToken(repos string, token string) bool {
+    content, err := ioutil.ReadFile(makeTokenFileName(repos))
+    if err != nil {
+        Logf(LtDebug, "There is no token for the repository %v: %v\n", repos, err)
+        return false
+    }
+    expected := strings.TrimSpace(string(content))
+    return subtle.ConstantTimeCompare([]byte(expected), []byte(strings.TrimSpace(token))) == 1
+}
+
 func StartNewGame(name string) {
     playerStatsFile = name + ".json"
     var tmpData SvnPlayerData
@@ -212,16 +259,16 @@ func UpdateAllSVN(svnUpdate, svnPull bool) {
 
     <- fileNotInUse
 
-    if svnUpdate {
-        files, _ := ioutil.ReadDir(svnBasePath)
-        for _, f := range files {
-            if f.IsDir() {
+    files, _ := ioutil.ReadDir(svnBasePath)
+    for _, f := range files {
+        if f.IsDir() {
+            if svnUpdate {
                 if svnPull {
                     pullSVN(svnBasePath + "/" + f.Name())
                 }
                 updateJsonFile(svnBasePath + "/" + f.Name(), f.Name())
-
             }
+            createToken(f.Name())
         }
     }
 
@@ -230,8 +277,8 @@ func UpdateAllSVN(svnUpdate, svnPull bool) {
     lastUpdate = time.Now()
 }
 
-func WriteStatisticToFile(botName string, stats Statistics) {
-
+// The SVN repository, that has the nickname in its bot.names. Empty, if there is none.
+func RepositoryOf(botName string) string {
     var repos string
 
     for svnName,svn := range playerData.SvnReposInformation {
@@ -241,6 +288,12 @@ func WriteStatisticToFile(botName string, stats Statistics) {
             }
         }
     }
+    return repos
+}
+
+func WriteStatisticToFile(botName string, stats Statistics) {
+
+    repos := RepositoryOf(botName)
     if repos == "" {
         Logf(LtDebug, "Something went wrong, the repos for %v is not found " +
             "while trying to save your statistics... Please do not change your bot.names while testing!\n", botName)
@@ -286,9 +339,10 @@ func WriteStatisticToFile(botName string, stats Statistics) {
 // --> The server is started in the GOBIN path!!!
 // --> Every SVN directory must contain a bot.names file (or should normally, nothing breaks if it isn't there)!
 //
-// This function checks, if the given nickname is a valid one, (from at least one bot.names).
+// This function checks, if the given nickname is a valid one, (from at least one bot.names)
+// and if the token is the one of the repository with this nickname.
 // Right now, it updates itself automatically (svn update, file update, data update) every 1 minutes (maximum but only when this function is called).
-func CheckPotentialPlayer(playerNickname string, updateSVN bool) (bool, string, Statistics) {
+func CheckPotentialPlayer(playerNickname string, token string, updateSVN bool) (bool, string, Statistics) {
 
     if time.Now().Sub(lastUpdate).Minutes() > 1 && updateSVN {
         UpdateAllSVN(updateSVN, updateSVN)
@@ -297,6 +351,10 @@ func CheckPotentialPlayer(playerNickname string, updateSVN bool) (bool, string,
     for i,svn := range playerData.SvnReposInformation {
         for _,nick := range svn.Nicknames {
             if nick == playerNickname {
+                if !checkToken(i, token) {
+                    Logf(LtDebug, "The token for the name %v does not match the one of the repository %v.\n", playerNickname, i)
+                    return false, i, Statistics{}
+                }
                 return true, i, svn.Statistics
             }
         }
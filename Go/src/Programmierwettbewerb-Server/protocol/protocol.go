@@ -0,0 +1,448 @@
+package protocol
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "fmt"
+    "encoding/json"
+    "os/exec"
+    "bufio"
+    "io"
+    "errors"
+    "strconv"
+    "regexp"
+    "strings"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Game State -> Bot
+//
+////////////////////////////////////////////////////////////////////////
+
+// to convert a float number to a string
+func fToS(input_num float32) string {
+    return strconv.FormatFloat(float64(input_num), 'f', 6, 32)
+}
+
+// Blob = (BotId, TeamId, Index, Position, Mass)
+func blobsToString(blobs []ServerMiddlewareBlob) string {
+    blobsString := "["
+    first := true
+    for _,blob := range blobs {
+        if !first {
+            blobsString += ","
+        }
+        positionString := "(" + fToS(blob.Position.X) + "," + fToS(blob.Position.Y) + ")"
+        blobsString += "(" + fmt.Sprint(blob.BotId) + "," + fmt.Sprint(blob.TeamId) + "," + fmt.Sprint(blob.Index) + "," + positionString + "," + fmt.Sprint(blob.Mass) + ")"
+        first = false
+    }
+    blobsString += "]"
+    return blobsString
+}
+
+func foodToString(food []ServerMiddlewareFood) string {
+    foodString := "["
+    first := true
+    for _,f := range food {
+        if !first {
+            foodString += ","
+        }
+        positionString := "(" + fToS(f.Position.X) + "," + fToS(f.Position.Y) + ")"
+        foodString += "(" + positionString + "," + fmt.Sprint(f.Mass) + ")"
+        first = false
+    }
+    foodString += "]"
+
+    return foodString
+}
+
+func toxinToString(toxins []ServerMiddlewareToxin) string {
+    toxinString := "["
+    first := true
+    for _,t := range toxins {
+        if !first {
+            toxinString += ","
+        }
+        toxinString += "((" + fToS(t.Position.X) + "," + fToS(t.Position.Y) + ")," + fmt.Sprint(t.Mass) + ")"
+        first = false
+    }
+
+    toxinString += "]"
+    return toxinString
+}
+
+// To literally this format: ([Blob], [Blob], [Food], [Toxin])
+func GameStateToString(msg ServerMiddlewareGameState) string {
+
+    myBlobString    := blobsToString(msg.MyBlob)
+    otherBlobString := blobsToString(msg.OtherBlobs)
+    foodString      := foodToString(msg.Food)
+    toxinString     := toxinToString(msg.Toxin)
+    botString       := "(" + myBlobString + "," + otherBlobString + "," + foodString + "," + toxinString + ")"
+
+    return botString
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Bot -> Command
+//
+////////////////////////////////////////////////////////////////////////
+
+func matchCommand(cmd string) (BotActionType, bool) {
+    match, _ := regexp.MatchString("none|split|throw", cmd)
+    action := BatNone
+    switch cmd {
+    case "split":
+        action = BatSplit
+    case "throw":
+        action = BatThrow
+    }
+    return action, match
+}
+
+func matchTarget(slice []string) (Vec2, bool) {
+    x,e1 := strconv.ParseFloat(slice[0], 32)
+    y,e2 := strconv.ParseFloat(slice[1], 32)
+
+    if e1 != nil || e2 != nil {
+        return NullVec2(), false
+    }
+
+    return Vec2{ X: float32(x), Y: float32(y) }, true
+}
+
+// Examples:
+// none,739.825806,654.041382
+// none,162,925
+// 739.825806,654.041382
+// 162,925
+func matchSlice(slice []string) (BotActionType, Vec2, bool) {
+    var action = BatNone
+    var target Vec2
+
+    switch len(slice) {
+        case 2: // So it doesn't end up in default. 2 is perfectly all right. Defaults to action=None.
+        case 3:
+            tmpAction, matchCmd := matchCommand(slice[0])
+            if !matchCmd {
+                Logf(LtDebug, "The command '%v' is not recognized! We use None for now... Please repair your bot!\n", slice[0])
+            } else {
+                action = tmpAction
+            }
+            slice = slice[1:]
+        default:
+            Logf(LtDebug, "There is not enough information. It should be (Action,(Target.X, Target.Y))!\n")
+            return action, target, false
+    }
+
+    tmpTarget, matchTarget := matchTarget(slice)
+    if !matchTarget {
+        Logf(LtDebug, "The target '%v' is not recognized! Please repair your bot!\n", strings.Join(slice, ","))
+        return action, target, false
+    } else {
+        target = tmpTarget
+    }
+
+    return action, target, true
+}
+
+func ParseBotResponse(response string) (BotCommand, bool) {
+
+    str := strings.ToLower(response)
+    str = strings.Replace(str, " ",  "", -1)
+    str = strings.Replace(str, "\n", "", -1)
+    str = strings.Replace(str, "\r", "", -1)
+    str = strings.Replace(str, "\t", "", -1)
+    str = strings.Replace(str, "(",  "", -1)
+    str = strings.Replace(str, ")",  "", -1)
+    str = strings.Replace(str, "[",  "", -1)
+    str = strings.Replace(str, "]",  "", -1)
+    str = strings.Replace(str, "{",  "", -1)
+    str = strings.Replace(str, "}",  "", -1)
+
+    s := strings.Split(str, ",")
+
+    action, target, ok := matchSlice(s)
+
+    wrapper := BotCommand{
+        Action:     action,
+        Target:     target,
+    }
+
+    return wrapper, ok
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// JSON Protocol
+//
+////////////////////////////////////////////////////////////////////////
+
+// The game state is sent as one JSON object per line, exactly as the
+// middleware gets it from the server. The bot answers with one object per line:
+//
+//     {"action":"split","target":{"x":162,"y":925}}
+//
+// The action can be "none", "split" or "throw" and may be left out.
+// Single blobs can be steered with their index from "myBlobs", all other
+// blobs follow the action and target of the bot:
+//
+//     {"target":{"x":162,"y":925},"blobs":[{"index":3,"action":"throw","target":{"x":10,"y":20}}]}
+type JsonBotCommand struct {
+    Action  string              `json:"action"`
+    Target  *Vec2               `json:"target"`
+    Blobs   []JsonBlobCommand   `json:"blobs"`
+}
+
+type JsonBlobCommand struct {
+    Index   *BlobId `json:"index"`
+    Action  string  `json:"action"`
+    Target  *Vec2   `json:"target"`
+}
+
+func GameStateToJson(msg ServerMiddlewareGameState) (string, error) {
+    bytes, err := json.Marshal(msg)
+    return string(bytes), err
+}
+
+func parseJsonAction(name string) (BotActionType, error) {
+    switch strings.ToLower(name) {
+    case "", "none":
+        return BatNone, nil
+    case "split":
+        return BatSplit, nil
+    case "throw":
+        return BatThrow, nil
+    }
+    return BatNone, errors.New(fmt.Sprintf("The action \"%v\" is unknown. It has to be \"none\", \"split\" or \"throw\".", name))
+}
+
+func ParseJsonBotResponse(response string) (BotCommand, error) {
+    var jsonCommand JsonBotCommand
+    if err := json.Unmarshal([]byte(response), &jsonCommand); err != nil {
+        return BotCommand{}, errors.New(fmt.Sprintf("The response is no valid JSON object: %v", err.Error()))
+    }
+
+    if jsonCommand.Target == nil {
+        return BotCommand{}, errors.New("The response has no \"target\".")
+    }
+
+    action, err := parseJsonAction(jsonCommand.Action)
+    if err != nil {
+        return BotCommand{}, err
+    }
+
+    command := BotCommand{ Action: action, Target: *jsonCommand.Target }
+    for i, jsonBlobCommand := range jsonCommand.Blobs {
+        if jsonBlobCommand.Index == nil || jsonBlobCommand.Target == nil {
+            return BotCommand{}, errors.New(fmt.Sprintf("The blob command %v needs an \"index\" and a \"target\".", i))
+        }
+        blobAction, err := parseJsonAction(jsonBlobCommand.Action)
+        if err != nil {
+            return BotCommand{}, err
+        }
+        command.Blobs = append(command.Blobs, BlobCommand{ BlobId: *jsonBlobCommand.Index, Action: blobAction, Target: *jsonBlobCommand.Target })
+    }
+
+    return command, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Bot Protocols
+//
+////////////////////////////////////////////////////////////////////////
+
+type BotProtocol int
+const (
+    BpText      BotProtocol = iota
+    BpJson
+)
+
+// An empty name is the text protocol.
+func ParseBotProtocol(name string) (BotProtocol, error) {
+    switch strings.ToLower(name) {
+    case "", "text":
+        return BpText, nil
+    case "json":
+        return BpJson, nil
+    }
+    return BpText, errors.New(fmt.Sprintf("The protocol \"%v\" is unknown. It has to be \"text\" or \"json\".", name))
+}
+
+func (protocol BotProtocol) String() string {
+    switch protocol {
+    case BpText:
+        return "text"
+    case BpJson:
+        return "json"
+    }
+    return "unknown"
+}
+
+type LatePolicy int
+const (
+    // The last command is sent again.
+    LpRepeat    LatePolicy = iota
+    // Nothing is sent.
+    LpSkip
+)
+
+func ParseLatePolicy(name string) (LatePolicy, error) {
+    switch name {
+    case "", "repeat":
+        return LpRepeat, nil
+    case "skip":
+        return LpSkip, nil
+    }
+    return LpRepeat, errors.New(fmt.Sprintf("The late policy \"%v\" is unknown. It has to be \"repeat\" or \"skip\".", name))
+}
+
+// The line that is sent to the bot, without the newline.
+func (protocol BotProtocol) EncodeGameState(msg ServerMiddlewareGameState) (string, error) {
+    if protocol == BpJson {
+        return GameStateToJson(msg)
+    }
+    return GameStateToString(msg), nil
+}
+
+func (protocol BotProtocol) DecodeBotCommand(response string) (BotCommand, error) {
+    if protocol == BpJson {
+        return ParseJsonBotResponse(response)
+    }
+    command, ok := ParseBotResponse(response)
+    if !ok {
+        return command, errors.New("The response could not be read. It should be (Action,(Target.X, Target.Y)).")
+    }
+    return command, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Bot Process
+//
+////////////////////////////////////////////////////////////////////////
+
+// A bot running as a local subprocess. It gets one game state per line on
+// stdin and answers with one command per line on stdout.
+type BotProcess struct {
+    process     *exec.Cmd
+    stdin       io.WriteCloser
+    stdout      io.ReadCloser
+    responses   chan string
+    stopped     chan struct{}
+    // The bot has not answered the last line yet.
+    busy        bool
+}
+
+var (
+    ErrBotLate      = errors.New("The bot has not answered in time.")
+    ErrBotStopped   = errors.New("The bot has stopped answering.")
+)
+
+// Everything the bot writes to stderr is passed to the given writer (nil drops it).
+func StartBotProcess(commandString string, stderr io.Writer) (*BotProcess, error) {
+    stringList := strings.Fields(commandString)
+    if len(stringList) == 0 {
+        return nil, errors.New("The bot command is empty.")
+    }
+
+    bot := &BotProcess{
+        responses:  make(chan string),
+        stopped:    make(chan struct{}),
+    }
+    bot.process = exec.Command(stringList[0], stringList[1:]...)
+    bot.process.Stderr = stderr
+
+    stdin, err := bot.process.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    bot.stdin = stdin
+
+    stdout, err := bot.process.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+    bot.stdout = stdout
+
+    if err = bot.process.Start(); err != nil {
+        return nil, err
+    }
+
+    go bot.readResponses(bufio.NewReader(stdout))
+
+    return bot, nil
+}
+
+// The lines are read in the background, so nobody has to block on a bot that does not answer.
+func (bot *BotProcess) readResponses(reader *bufio.Reader) {
+    defer close(bot.responses)
+    for {
+        response, err := reader.ReadString('\n')
+        if response != "" {
+            select {
+            case bot.responses <- response:
+            case <-bot.stopped:
+                return
+            }
+        }
+        if err != nil {
+            return
+        }
+    }
+}
+
+func (bot *BotProcess) Send(line string) error {
+    _, err := io.WriteString(bot.stdin, line + "\n")
+    return err
+}
+
+// The answers of the bot, one line each. The channel is closed when the bot closes its stdout.
+func (bot *BotProcess) Responses() <-chan string {
+    return bot.responses
+}
+
+// Sends the line to the bot and waits at most timeout for its answer (0 waits forever).
+// A bot that is still busy with an earlier line does not get the new one. Its late answer
+// is returned instead, when it arrives.
+func (bot *BotProcess) Exchange(line string, timeout time.Duration) (string, error) {
+    if !bot.busy {
+        if err := bot.Send(line); err != nil {
+            return "", ErrBotStopped
+        }
+        bot.busy = true
+    }
+
+    var deadline <-chan time.Time
+    if timeout > 0 {
+        timer := time.NewTimer(timeout)
+        defer timer.Stop()
+        deadline = timer.C
+    }
+
+    select {
+    case response, ok := <-bot.responses:
+        if !ok {
+            return "", ErrBotStopped
+        }
+        bot.busy = false
+        return response, nil
+    case <-deadline:
+        return "", ErrBotLate
+    }
+}
+
+func (bot *BotProcess) Stop() error {
+    close(bot.stopped)
+    bot.stdin.Close()
+    bot.stdout.Close()
+
+    err := bot.process.Process.Kill()
+    bot.process.Wait()
+    return err
+}
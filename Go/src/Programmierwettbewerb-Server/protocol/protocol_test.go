@@ -0,0 +1,139 @@
+package protocol
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseJsonBotResponse(t *testing.T) {
+    tests := []struct {
+        response        string
+        wantCommand     BotCommand
+        wantError       string
+    }{
+        { `{"action":"split","target":{"x":162,"y":925}}`,  BotCommand{ Action: BatSplit, Target: Vec2{ X: 162, Y: 925 } }, "" },
+        { `{"action":"Throw","target":{"x":1.5,"y":2}}`,    BotCommand{ Action: BatThrow, Target: Vec2{ X: 1.5, Y: 2 } },   "" },
+        { `{"target":{"x":3,"y":4}}` + "\n",                BotCommand{ Action: BatNone, Target: Vec2{ X: 3, Y: 4 } },      "" },
+        { `{"action":"jump","target":{"x":3,"y":4}}`,       BotCommand{},                                                   "unknown" },
+        { `{"action":"none"}`,                              BotCommand{},                                                   "no \"target\"" },
+        { `none,162,925`,                                   BotCommand{},                                                   "no valid JSON" },
+        {
+            `{"target":{"x":3,"y":4},"blobs":[{"index":7,"action":"split","target":{"x":5,"y":6}},{"index":2,"target":{"x":1,"y":1}}]}`,
+            BotCommand{ Action: BatNone, Target: Vec2{ X: 3, Y: 4 }, Blobs: []BlobCommand{ { BlobId: 7, Action: BatSplit, Target: Vec2{ X: 5, Y: 6 } }, { BlobId: 2, Action: BatNone, Target: Vec2{ X: 1, Y: 1 } } } },
+            "",
+        },
+        { `{"target":{"x":3,"y":4},"blobs":[{"index":7}]}`,                                 BotCommand{},   "needs an \"index\" and a \"target\"" },
+        { `{"target":{"x":3,"y":4},"blobs":[{"index":7,"action":"fly","target":{"x":5,"y":6}}]}`,   BotCommand{},   "unknown" },
+    }
+
+    for _, test := range tests {
+        command, err := ParseJsonBotResponse(test.response)
+        if test.wantError == "" {
+            if err != nil || !reflect.DeepEqual(command, test.wantCommand) {
+                t.Errorf("%v: got %+v, %v, want %+v", test.response, command, err, test.wantCommand)
+            }
+        } else if err == nil || !strings.Contains(err.Error(), test.wantError) {
+            t.Errorf("%v: error is %v, want it to contain %q", test.response, err, test.wantError)
+        }
+    }
+}
+
+func TestProtocolsEncodeTheGameState(t *testing.T) {
+    state := ServerMiddlewareGameState{
+        MyBlob: []ServerMiddlewareBlob{ { BotId: 1, TeamId: 2, Index: 3, Position: Vec2{ X: 10, Y: 20 }, Mass: 50 } },
+        Food:   []ServerMiddlewareFood{ { Mass: 1, Position: Vec2{ X: 5, Y: 6 } } },
+    }
+
+    line, err := BpJson.EncodeGameState(state)
+    if err != nil || strings.Contains(line, "\n") {
+        t.Fatalf("json line is %q, %v", line, err)
+    }
+    var decoded ServerMiddlewareGameState
+    if err := json.Unmarshal([]byte(line), &decoded); err != nil || decoded.MyBlob[0] != state.MyBlob[0] || decoded.Food[0].Position != state.Food[0].Position {
+        t.Errorf("json line %q does not contain the game state: %+v, %v", line, decoded, err)
+    }
+
+    if line, _ := BpText.EncodeGameState(state); !strings.HasPrefix(line, "([(1,2,3,(10.000000,20.000000),50)],[]") {
+        t.Errorf("text line is %q", line)
+    }
+}
+
+func TestParseBotProtocol(t *testing.T) {
+    tests := []struct {
+        name            string
+        wantProtocol    BotProtocol
+        wantError       bool
+    }{
+        { "",       BpText, false },
+        { "text",   BpText, false },
+        { "JSON",   BpJson, false },
+        { "xml",    BpText, true },
+    }
+
+    for _, test := range tests {
+        protocol, err := ParseBotProtocol(test.name)
+        if protocol != test.wantProtocol || (err != nil) != test.wantError {
+            t.Errorf("%q: got %v, %v", test.name, protocol, err)
+        }
+    }
+}
+
+func TestParseLatePolicy(t *testing.T) {
+    tests := []struct {
+        name            string
+        wantPolicy      LatePolicy
+        wantError       bool
+    }{
+        { "",       LpRepeat, false },
+        { "repeat", LpRepeat, false },
+        { "skip",   LpSkip, false },
+        { "wait",   LpRepeat, true },
+    }
+
+    for _, test := range tests {
+        policy, err := ParseLatePolicy(test.name)
+        if policy != test.wantPolicy || (err != nil) != test.wantError {
+            t.Errorf("%q: got %v, %v", test.name, policy, err)
+        }
+    }
+}
+
+func TestExchangeDeadline(t *testing.T) {
+    // The bot is slow with its first answer and echoes everything else.
+    script, err := ioutil.TempFile("", "bot")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(script.Name())
+    script.WriteString("read line; sleep 0.3; echo late; while read line; do echo \"$line\"; done\n")
+    script.Close()
+
+    bot, err := StartBotProcess("sh " + script.Name(), nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := bot.Exchange("first", 50 * time.Millisecond); err != ErrBotLate {
+        t.Errorf("the slow answer gives %v", err)
+    }
+    // The busy bot does not get the second line, it is answered with the late answer.
+    if response, err := bot.Exchange("second", 0); response != "late\n" || err != nil {
+        t.Errorf("the late answer is %q, %v", response, err)
+    }
+    if response, err := bot.Exchange("third", time.Second); response != "third\n" || err != nil {
+        t.Errorf("the answer is %q, %v", response, err)
+    }
+
+    bot.Stop()
+    if _, err := bot.Exchange("fourth", time.Second); err != ErrBotStopped {
+        t.Errorf("a stopped bot gives %v", err)
+    }
+}
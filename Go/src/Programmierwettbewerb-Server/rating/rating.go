@@ -0,0 +1,229 @@
+package rating
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "math"
+    "os"
+    "sort"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    RatingDirectory = "../Statistics/Ratings/"
+    ratingFile      = "ratings.json"
+
+    initialRating   = 1500.0
+    // The most a repository can win or lose in one game.
+    kFactor         = 32.0
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Performance
+//
+////////////////////////////////////////////////////////////////////////
+
+// How well all bots of one repository did in one game.
+type Performance struct {
+    Repository      string
+    // The mass of the bots that are alive at the end of the game.
+    Mass            float32
+    // The longest survival time of the bots.
+    SurvivalTime    float32
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Placements
+//
+////////////////////////////////////////////////////////////////////////
+
+type Placement struct {
+    Repository      string
+    // 1 is the winner. Equal performances share a place.
+    Place           int
+    Mass            float32
+    SurvivalTime    float32
+    RatingBefore    float64
+    RatingAfter     float64
+}
+
+func isBetter(a Performance, b Performance) bool {
+    if a.Mass != b.Mass {
+        return a.Mass > b.Mass
+    }
+    return a.SurvivalTime > b.SurvivalTime
+}
+
+// The final mass decides, the survival time breaks ties between the dead bots.
+func Place(performances []Performance) []Placement {
+    sorted := append([]Performance{}, performances...)
+    sort.SliceStable(sorted, func(i, j int) bool { return isBetter(sorted[i], sorted[j]) })
+
+    placements := make([]Placement, len(sorted))
+    for i, performance := range sorted {
+        place := i + 1
+        if i > 0 && !isBetter(sorted[i - 1], performance) {
+            place = placements[i - 1].Place
+        }
+        placements[i] = Placement{
+            Repository:     performance.Repository,
+            Place:          place,
+            Mass:           performance.Mass,
+            SurvivalTime:   performance.SurvivalTime,
+        }
+    }
+    return placements
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Ratings
+//
+////////////////////////////////////////////////////////////////////////
+
+type Rating struct {
+    Repository      string      `json:"repository"`
+    Rating          float64     `json:"rating"`
+    Games           int         `json:"games"`
+    Wins            int         `json:"wins"`
+    // The change of the last game.
+    LastChange      float64     `json:"lastChange"`
+}
+
+type GameRating struct {
+    Game            string
+    Time            time.Time
+    Placements      []Placement
+}
+
+// The current rating of every repository and all rated games.
+type Ratings struct {
+    Ratings         map[string]Rating
+    History         []GameRating
+}
+
+func NewRatings() Ratings {
+    return Ratings{ Ratings: make(map[string]Rating) }
+}
+
+func (ratings *Ratings) rating(repository string) Rating {
+    if rating, ok := ratings.Ratings[repository]; ok {
+        return rating
+    }
+    return Rating{ Repository: repository, Rating: initialRating }
+}
+
+// Every game is rated like a set of duels between all pairs of repositories,
+// so the change of a game has the same size as in a single duel.
+func (ratings *Ratings) RateGame(game string, performances []Performance) GameRating {
+    placements := Place(performances)
+    if len(placements) < 2 {
+        return GameRating{ Game: game, Time: time.Now(), Placements: placements }
+    }
+
+    for i := range placements {
+        placements[i].RatingBefore = ratings.rating(placements[i].Repository).Rating
+    }
+
+    for i := range placements {
+        var change float64
+        for j := range placements {
+            if i == j {
+                continue
+            }
+            change += actualScore(placements[i].Place, placements[j].Place) - expectedScore(placements[i].RatingBefore, placements[j].RatingBefore)
+        }
+        placements[i].RatingAfter = placements[i].RatingBefore + kFactor * change / float64(len(placements) - 1)
+    }
+
+    for _, placement := range placements {
+        rating := ratings.rating(placement.Repository)
+        rating.Rating = placement.RatingAfter
+        rating.LastChange = placement.RatingAfter - placement.RatingBefore
+        rating.Games += 1
+        if placement.Place == 1 {
+            rating.Wins += 1
+        }
+        ratings.Ratings[placement.Repository] = rating
+    }
+
+    gameRating := GameRating{ Game: game, Time: time.Now(), Placements: placements }
+    ratings.History = append(ratings.History, gameRating)
+    return gameRating
+}
+
+func expectedScore(rating float64, opponentRating float64) float64 {
+    return 1 / (1 + math.Pow(10, (opponentRating - rating) / 400))
+}
+
+func actualScore(place int, opponentPlace int) float64 {
+    switch {
+    case place < opponentPlace:
+        return 1
+    case place == opponentPlace:
+        return 0.5
+    }
+    return 0
+}
+
+// The best rating first.
+func (ratings *Ratings) Ranking() []Rating {
+    ranking := make([]Rating, 0, len(ratings.Ratings))
+    for _, rating := range ratings.Ratings {
+        ranking = append(ranking, rating)
+    }
+    sort.Slice(ranking, func(i, j int) bool {
+        if ranking[i].Rating != ranking[j].Rating {
+            return ranking[i].Rating > ranking[j].Rating
+        }
+        return ranking[i].Repository < ranking[j].Repository
+    })
+    return ranking
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Files
+//
+////////////////////////////////////////////////////////////////////////
+
+// Without a file every repository starts with the initial rating.
+func LoadRatings() (Ratings, error) {
+    ratings := NewRatings()
+
+    content, err := ioutil.ReadFile(RatingDirectory + ratingFile)
+    if os.IsNotExist(err) {
+        return ratings, nil
+    }
+    if err != nil {
+        return ratings, err
+    }
+
+    if err := json.Unmarshal(content, &ratings); err != nil {
+        return NewRatings(), err
+    }
+    if ratings.Ratings == nil {
+        ratings.Ratings = make(map[string]Rating)
+    }
+    return ratings, nil
+}
+
+func (ratings *Ratings) Save() error {
+    if err := os.MkdirAll(RatingDirectory, 0755); err != nil {
+        return err
+    }
+
+    content, err := json.MarshalIndent(ratings, "", "    ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(RatingDirectory + ratingFile, content, 0644)
+}
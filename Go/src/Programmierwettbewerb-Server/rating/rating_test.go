@@ -0,0 +1,81 @@
+package rating
+
+import (
+    "math"
+    "testing"
+)
+
+func TestPlace(t *testing.T) {
+    tests := []struct {
+        name            string
+        performances    []Performance
+        wantOrder       []string
+        wantPlaces      []int
+    }{
+        {
+            "mass decides",
+            []Performance{ { "a", 10, 30 }, { "b", 50, 30 }, { "c", 20, 30 } },
+            []string{ "b", "c", "a" },
+            []int{ 1, 2, 3 },
+        },
+        {
+            "survival time decides between dead bots",
+            []Performance{ { "a", 0, 10 }, { "b", 0, 20 }, { "c", 5, 1 } },
+            []string{ "c", "b", "a" },
+            []int{ 1, 2, 3 },
+        },
+        {
+            "equal performances share a place",
+            []Performance{ { "a", 10, 30 }, { "b", 10, 30 }, { "c", 0, 5 } },
+            []string{ "a", "b", "c" },
+            []int{ 1, 1, 3 },
+        },
+    }
+
+    for _, test := range tests {
+        placements := Place(test.performances)
+        for i, placement := range placements {
+            if placement.Repository != test.wantOrder[i] || placement.Place != test.wantPlaces[i] {
+                t.Errorf("%v: placement %v is %v on %v, want %v on %v", test.name, i, placement.Repository, placement.Place, test.wantOrder[i], test.wantPlaces[i])
+            }
+        }
+    }
+}
+
+func TestRateGame(t *testing.T) {
+    ratings := NewRatings()
+    ratings.RateGame("game", []Performance{ { "a", 100, 60 }, { "b", 50, 60 }, { "c", 0, 10 } })
+
+    a, b, c := ratings.Ratings["a"], ratings.Ratings["b"], ratings.Ratings["c"]
+    if !(a.Rating > b.Rating && b.Rating > c.Rating) {
+        t.Errorf("ratings are not in the order of the placements: %v %v %v", a.Rating, b.Rating, c.Rating)
+    }
+    if math.Abs(a.Rating - (initialRating + kFactor / 2)) > 1e-9 || math.Abs(b.Rating - initialRating) > 1e-9 {
+        t.Errorf("ratings of equal players are %v and %v", a.Rating, b.Rating)
+    }
+    if sum := a.Rating + b.Rating + c.Rating; math.Abs(sum - 3 * initialRating) > 1e-9 {
+        t.Errorf("sum of the ratings changed to %v", sum)
+    }
+    if a.Games != 1 || a.Wins != 1 || c.Wins != 0 || len(ratings.History) != 1 {
+        t.Errorf("games and wins are not counted: %+v %+v %v", a, c, len(ratings.History))
+    }
+
+    // An expected win against a much weaker repository changes less.
+    before := ratings.Ratings["a"].Rating
+    ratings.RateGame("game", []Performance{ { "a", 100, 60 }, { "c", 0, 10 } })
+    if change := ratings.Ratings["a"].Rating - before; change <= 0 || change >= kFactor / 2 {
+        t.Errorf("change of an expected win is %v", change)
+    }
+
+    if ranking := ratings.Ranking(); ranking[0].Repository != "a" || ranking[2].Repository != "c" {
+        t.Errorf("ranking is %+v", ranking)
+    }
+}
+
+func TestSinglePlayerIsNotRated(t *testing.T) {
+    ratings := NewRatings()
+    ratings.RateGame("game", []Performance{ { "a", 100, 60 } })
+    if len(ratings.Ratings) != 0 || len(ratings.History) != 0 {
+        t.Errorf("game with one repository is rated: %+v", ratings)
+    }
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/results"
+
+    "bufio"
+    "compress/gzip"
+    "encoding/gob"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "reflect"
+    "strings"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Replay Format
+//
+////////////////////////////////////////////////////////////////////////
+
+// A replay file is a gzip compressed stream of gob values. It starts with one
+// ReplayHeader, followed by one ReplayRecord per simulation step.
+// The first record and every replayKeyframeEvery-th record carry a keyframe with
+// the complete game state. The random generator of the simulation is reseeded at
+// every keyframe, so a replay can be started at any of them.
+
+const (
+    replayDirectory     = "../Replays/"
+    replayVersion       = 3
+    replayKeyframeEvery = 300
+)
+
+type ReplayHeader struct {
+    Version         int
+    GameName        string
+    Created         time.Time
+    Deterministic   bool
+}
+
+type ReplayRecord struct {
+    Input           TickInput
+    Keyframe        *ReplayKeyframe
+}
+
+type ReplaySettings struct {
+    // Zero in recordings from before the field size could change.
+    FieldSize                   Vec2
+
+    MinNumberOfBots             int
+    MaxNumberOfBots             int
+    MaxNumberOfFoods            int
+    MaxNumberOfToxins           int
+
+    BotsToStart                 []string
+    BotCount                    int
+
+    FoodDistributionName        string
+    ToxinDistributionName       string
+    BotDistributionName         string
+    WallsName                   string
+
+    // The values are stored as well, the profile file might have changed since the recording.
+    PhysicsName                 string
+    Physics                     Physics
+
+    Teams                       []Team
+    FriendlyFire                bool
+}
+
+type ReplayKeyframe struct {
+    Seed            int64
+
+    GameTime        float32
+    GameMode        bool
+    Stopped         bool
+    Game            Game
+    Lobby           Lobby
+    Results         ResultRecord
+    GameOver        *GameOver
+    Settings        ReplaySettings
+    Ids             Ids
+    Teams           map[TeamId]TeamScore
+
+    Foods           map[FoodId]Food
+    Toxins          map[ToxinId]Toxin
+    Bots            map[BotId]Bot
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Keyframes
+//
+////////////////////////////////////////////////////////////////////////
+
+func makeReplayKeyframe(gameState *GameState, seed int64) ReplayKeyframe {
+    app.stoppedMutex.Lock()
+    stopped := app.stopped
+    app.stoppedMutex.Unlock()
+
+    return ReplayKeyframe{
+        Seed:       seed,
+        GameTime:   gameState.GameTime,
+        GameMode:   app.gameMode,
+        Stopped:    stopped,
+        Game:       app.game,
+        Lobby:      app.lobby,
+        Results:    app.results,
+        GameOver:   app.gameOver,
+        Settings:   ReplaySettings{
+            FieldSize:              app.settings.FieldSize,
+            MinNumberOfBots:        app.settings.MinNumberOfBots,
+            MaxNumberOfBots:        app.settings.MaxNumberOfBots,
+            MaxNumberOfFoods:       app.settings.MaxNumberOfFoods,
+            MaxNumberOfToxins:      app.settings.MaxNumberOfToxins,
+            BotsToStart:            app.settings.BotsToStart,
+            BotCount:               app.settings.BotCount,
+            FoodDistributionName:   app.settings.FoodDistributionName,
+            ToxinDistributionName:  app.settings.ToxinDistributionName,
+            BotDistributionName:    app.settings.BotDistributionName,
+            WallsName:              app.settings.WallsName,
+            PhysicsName:            app.settings.PhysicsName,
+            Physics:                app.settings.Physics,
+            Teams:                  app.settings.Teams,
+            FriendlyFire:           app.settings.FriendlyFire,
+        },
+        Ids:        gameState.Ids,
+        Teams:      gameState.Teams,
+        Foods:      gameState.Foods,
+        Toxins:     gameState.Toxins,
+        Bots:       gameState.Bots,
+    }
+}
+
+func restoreReplayKeyframe(gameState *GameState, keyframe ReplayKeyframe) {
+    app.stoppedMutex.Lock()
+    app.stopped = keyframe.Stopped
+    app.stoppedMutex.Unlock()
+
+    app.gameMode                = keyframe.GameMode
+    app.game                    = keyframe.Game
+    app.lobby                   = keyframe.Lobby
+    app.results                 = keyframe.Results
+    app.gameOver                = keyframe.GameOver
+
+    settings := keyframe.Settings
+    app.settings.MinNumberOfBots   = settings.MinNumberOfBots
+    app.settings.MaxNumberOfBots   = settings.MaxNumberOfBots
+    app.settings.MaxNumberOfFoods  = settings.MaxNumberOfFoods
+    app.settings.MaxNumberOfToxins = settings.MaxNumberOfToxins
+    app.settings.BotsToStart       = settings.BotsToStart
+    app.settings.BotCount          = settings.BotCount
+    app.settings.PhysicsName       = settings.PhysicsName
+    app.settings.Physics           = settings.Physics
+    app.settings.Teams             = settings.Teams
+    app.settings.FriendlyFire      = settings.FriendlyFire
+    // The field size goes first, it changes the spawn distributions. The walls are checked against the new spawn images.
+    app.settings.SetFieldSize(settings.FieldSize)
+    if app.settings.FoodDistributionName != settings.FoodDistributionName {
+        app.settings.SetFoodSpawn(settings.FoodDistributionName)
+    }
+    if app.settings.ToxinDistributionName != settings.ToxinDistributionName {
+        app.settings.SetToxinSpawn(settings.ToxinDistributionName)
+    }
+    if app.settings.BotDistributionName != settings.BotDistributionName {
+        app.settings.SetBotSpawn(settings.BotDistributionName)
+    }
+    if app.settings.WallsName != settings.WallsName {
+        if err := app.settings.SetWalls(settings.WallsName); err != nil {
+            Logf(LtDebug, "The walls of the replay could not be set: %v\n", err.Error())
+        }
+    }
+
+    gameState.Ids      = keyframe.Ids
+    gameState.GameTime = keyframe.GameTime
+
+    // gob leaves empty maps out, so they come back as nil.
+    gameState.Foods  = make(map[FoodId]Food)
+    gameState.Toxins = make(map[ToxinId]Toxin)
+    gameState.Bots   = make(map[BotId]Bot)
+    gameState.ResetTeams()
+
+    for teamId, score := range keyframe.Teams {
+        gameState.Teams[teamId] = score
+    }
+
+    // Everything is marked as new, so the guis get the complete state again.
+    for foodId, food := range keyframe.Foods {
+        food.IsNew = true
+        gameState.Foods[foodId] = food
+    }
+    for toxinId, toxin := range keyframe.Toxins {
+        toxin.IsNew = true
+        gameState.Toxins[toxinId] = toxin
+    }
+    for botId, bot := range keyframe.Bots {
+        if bot.Blobs == nil {
+            bot.Blobs = make(map[BlobId]Blob)
+        }
+        bot.GuiNeedsInfoUpdate = true
+        gameState.Bots[botId] = bot
+    }
+
+    gameState.Random.Seed(keyframe.Seed)
+}
+
+// Checks, if the simulation still produces exactly the recorded game state.
+func matchesReplayKeyframe(gameState *GameState, keyframe ReplayKeyframe) bool {
+    if gameState.GameTime != keyframe.GameTime || gameState.Ids != keyframe.Ids {
+        return false
+    }
+
+    if len(gameState.Foods) != len(keyframe.Foods) || len(gameState.Toxins) != len(keyframe.Toxins) || len(gameState.Bots) != len(keyframe.Bots) {
+        return false
+    }
+
+    for foodId, food := range gameState.Foods {
+        if recorded, ok := keyframe.Foods[foodId]; !ok || recorded != food {
+            return false
+        }
+    }
+
+    for toxinId, toxin := range gameState.Toxins {
+        if recorded, ok := keyframe.Toxins[toxinId]; !ok || recorded != toxin {
+            return false
+        }
+    }
+
+    for botId, bot := range gameState.Bots {
+        recorded, ok := keyframe.Bots[botId]
+        if !ok || !reflect.DeepEqual(recorded.Command, bot.Command) || recorded.StatisticsThisGame != bot.StatisticsThisGame || len(recorded.Blobs) != len(bot.Blobs) {
+            return false
+        }
+        for blobId, blob := range bot.Blobs {
+            if recordedBlob, ok := recorded.Blobs[blobId]; !ok || recordedBlob != blob {
+                return false
+            }
+        }
+    }
+
+    return true
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Recorder
+//
+////////////////////////////////////////////////////////////////////////
+
+type Recorder struct {
+    file            *os.File
+    buffer          *bufio.Writer
+    zip             *gzip.Writer
+    encoder         *gob.Encoder
+    tick            int
+}
+
+func NewRecorder(gameName string) *Recorder {
+    var recorder Recorder
+    recorder.open(gameName)
+    return &recorder
+}
+
+func (recorder *Recorder) open(gameName string) {
+    if err := os.MkdirAll(replayDirectory, 0755); err != nil {
+        LogfColored(LtDebug, LcRed, "Could not create the replay directory: %v\n", err)
+        return
+    }
+
+    name := replayDirectory + time.Now().Format("2006-01-02_15-04-05") + "_" + strings.Replace(gameName, "/", "_", -1) + ".replay"
+    file, err := os.Create(name)
+    if err != nil {
+        LogfColored(LtDebug, LcRed, "Could not create the replay file %v: %v\n", name, err)
+        return
+    }
+
+    recorder.file    = file
+    recorder.buffer  = bufio.NewWriter(file)
+    recorder.zip     = gzip.NewWriter(recorder.buffer)
+    recorder.encoder = gob.NewEncoder(recorder.zip)
+    recorder.tick    = 0
+
+    header := ReplayHeader{
+        Version:        replayVersion,
+        GameName:       gameName,
+        Created:        time.Now(),
+        Deterministic:  app.deterministic,
+    }
+    if err := recorder.encoder.Encode(header); err != nil {
+        recorder.fail(err)
+        return
+    }
+
+    LogfColored(LtDebug, LcGreen, "Recording to %v\n", name)
+}
+
+func (recorder *Recorder) fail(err error) {
+    LogfColored(LtDebug, LcRed, "Recording stopped because of: %v\n", err)
+    recorder.file.Close()
+    recorder.file = nil
+}
+
+func (recorder *Recorder) flush() error {
+    if err := recorder.zip.Flush(); err != nil {
+        return err
+    }
+    return recorder.buffer.Flush()
+}
+
+func (recorder *Recorder) close() {
+    if recorder.file == nil {
+        return
+    }
+
+    if err := recorder.zip.Close(); err != nil {
+        recorder.fail(err)
+        return
+    }
+    if err := recorder.buffer.Flush(); err != nil {
+        recorder.fail(err)
+        return
+    }
+    recorder.file.Close()
+    recorder.file = nil
+}
+
+// Has to be called before the input is applied to the game state.
+func (recorder *Recorder) record(gameState *GameState, input TickInput) {
+    // Every game gets a file of its own.
+    for _, command := range input.ServerCommands {
+        if command.Type == "GameName" {
+            recorder.close()
+            recorder.open(command.GameName)
+        }
+    }
+
+    if recorder.file == nil {
+        return
+    }
+
+    // The password of the running config does not belong into a file that might be passed around.
+    commands := make([]Command, len(input.ServerCommands))
+    for i, command := range input.ServerCommands {
+        if command.Config != nil {
+            config := *command.Config
+            config.Password = ""
+            command.Config = &config
+        }
+        commands[i] = command
+    }
+    input.ServerCommands = commands
+
+    record := ReplayRecord{ Input: input }
+
+    isKeyframe := recorder.tick % replayKeyframeEvery == 0
+    if isKeyframe {
+        seed := gameState.Random.Int63()
+        gameState.Random.Seed(seed)
+        keyframe := makeReplayKeyframe(gameState, seed)
+        record.Keyframe = &keyframe
+    }
+
+    if err := recorder.encoder.Encode(record); err != nil {
+        recorder.fail(err)
+        return
+    }
+    recorder.tick += 1
+
+    // Flushing at the keyframes keeps most of the game, if the server crashes.
+    if isKeyframe {
+        if err := recorder.flush(); err != nil {
+            recorder.fail(err)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// ReplayPlayer
+//
+////////////////////////////////////////////////////////////////////////
+
+type ReplayPlayer struct {
+    file            *os.File
+    decoder         *gob.Decoder
+    header          ReplayHeader
+    tick            int
+    // The first step that is shown. The replay starts at the first keyframe from there on.
+    from            int
+    synced          bool
+    finished        bool
+}
+
+func OpenReplay(path string, from int) (*ReplayPlayer, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+
+    reader, err := gzip.NewReader(bufio.NewReader(file))
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    player := ReplayPlayer{
+        file:       file,
+        decoder:    gob.NewDecoder(reader),
+        from:       from,
+    }
+
+    if err := player.decoder.Decode(&player.header); err != nil {
+        file.Close()
+        return nil, err
+    }
+    if player.header.Version != replayVersion {
+        file.Close()
+        return nil, errors.New(fmt.Sprintf("The replay has version %v, but this server plays version %v.", player.header.Version, replayVersion))
+    }
+
+    LogfColored(LtDebug, LcGreen, "Replaying game \"%v\" recorded at %v\n", player.header.GameName, player.header.Created)
+
+    return &player, nil
+}
+
+// Returns the input of the next step. false means, that the replay is over.
+func (player *ReplayPlayer) next(gameState *GameState) (TickInput, bool) {
+    for !player.finished {
+        var record ReplayRecord
+        if err := player.decoder.Decode(&record); err != nil {
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                LogfColored(LtDebug, LcGreen, "Replay finished after %v steps\n", player.tick)
+            } else {
+                LogfColored(LtDebug, LcRed, "Replay stopped because of: %v\n", err)
+            }
+            player.finished = true
+            player.file.Close()
+            break
+        }
+
+        tick := player.tick
+        player.tick += 1
+
+        if keyframe := record.Keyframe; keyframe != nil {
+            if player.synced {
+                // The recorder reseeded the generator with its next value at this point.
+                seed := gameState.Random.Int63()
+                if seed != keyframe.Seed || !matchesReplayKeyframe(gameState, *keyframe) {
+                    LogfColored(LtDebug, LcRed, "The replay diverged before step %v. Continuing from the recorded state.\n", tick)
+                    restoreReplayKeyframe(gameState, *keyframe)
+                } else {
+                    gameState.Random.Seed(seed)
+                }
+            } else if tick >= player.from {
+                restoreReplayKeyframe(gameState, *keyframe)
+                player.synced = true
+            }
+        }
+
+        if player.synced {
+            return record.Input, true
+        }
+    }
+
+    return TickInput{}, false
+}
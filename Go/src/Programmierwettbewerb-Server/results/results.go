@@ -0,0 +1,233 @@
+package results
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/rating"
+
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "sort"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    ResultDirectory = "../Statistics/Results/"
+
+    // How many results of the same game can be written in one second.
+    maxResultFiles  = 100
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Scoring
+//
+////////////////////////////////////////////////////////////////////////
+
+// The rule that decides the ranking at the end of a game. It is set with
+// "Scoring" in the definition of the game.
+type Scoring int
+const (
+    // The mass at the end of the game. The survival time decides between the dead bots.
+    ScMass          Scoring = iota
+    // The biggest mass a bot of the player had during the game.
+    ScMaxMass
+    // The bots the player killed completely.
+    ScKills
+    // The longest survival time of the bots of the player.
+    ScSurvival
+)
+
+var scoringNames = map[Scoring]string{
+    ScMass:     "mass",
+    ScMaxMass:  "maxMass",
+    ScKills:    "kills",
+    ScSurvival: "survival",
+}
+
+func (scoring Scoring) String() string {
+    return scoringNames[scoring]
+}
+
+// An empty name is the mass.
+func ParseScoring(name string) (Scoring, error) {
+    if name == "" {
+        return ScMass, nil
+    }
+    for scoring, scoringName := range scoringNames {
+        if scoringName == name {
+            return scoring, nil
+        }
+    }
+    return ScMass, errors.New(fmt.Sprintf("The scoring '%v' is unknown.", name))
+}
+
+func (scoring Scoring) score(standing GameStanding) float32 {
+    switch scoring {
+    case ScMaxMass:
+        return standing.MaxMass
+    case ScKills:
+        return float32(standing.Kills)
+    case ScSurvival:
+        return standing.SurvivalTime
+    }
+    return standing.Mass
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Result Record
+//
+////////////////////////////////////////////////////////////////////////
+
+// Collects how every player did during a game. The fields are exported for the replays.
+type ResultRecord struct {
+    Players         map[string]*GameStanding
+    // The player of every repository that played. In the team mode several repositories play for one team.
+    Repositories    map[string]string
+}
+
+func NewResultRecord() ResultRecord {
+    return ResultRecord{ Players: make(map[string]*GameStanding), Repositories: make(map[string]string) }
+}
+
+// Dead bots are added, when they die, with a mass of 0. The living bots are added at the end of the game.
+// The masses and kills of the bots of a player add up, the maximal mass and the survival time do not.
+// Bots without a repository are ranked, but not rated.
+func (record *ResultRecord) AddBot(player string, repository string, mass float32, statistics Statistics, alive bool) {
+    if record.Players == nil {
+        record.Players = make(map[string]*GameStanding)
+    }
+    if record.Repositories == nil {
+        record.Repositories = make(map[string]string)
+    }
+    if repository != "" {
+        record.Repositories[repository] = player
+    }
+    standing, ok := record.Players[player]
+    if !ok {
+        standing = &GameStanding{ Player: player }
+        record.Players[player] = standing
+    }
+    standing.Mass += mass
+    standing.MaxMass = float32(math.Max(float64(standing.MaxMass), float64(statistics.MaxSize)))
+    standing.Kills += statistics.BotKillCount
+    standing.SurvivalTime = float32(math.Max(float64(standing.SurvivalTime), float64(statistics.MaxSurvivalTime)))
+    if alive {
+        standing.Alive += 1
+    }
+}
+
+// The score of the rule decides, then the mass and then the survival time.
+// Equal players share a place. The players of a place are sorted by name.
+func (record *ResultRecord) Rank(scoring Scoring) []GameStanding {
+    standings := make([]GameStanding, 0, len(record.Players))
+    for _, standing := range record.Players {
+        standing := *standing
+        standing.Score = scoring.score(standing)
+        standings = append(standings, standing)
+    }
+    sort.Slice(standings, func(i, j int) bool { return standings[i].Player < standings[j].Player })
+    sort.SliceStable(standings, func(i, j int) bool { return isBetter(standings[i], standings[j]) })
+
+    for i := range standings {
+        standings[i].Place = i + 1
+        if i > 0 && !isBetter(standings[i - 1], standings[i]) {
+            standings[i].Place = standings[i - 1].Place
+        }
+    }
+    return standings
+}
+
+func isBetter(a GameStanding, b GameStanding) bool {
+    if a.Score != b.Score {
+        return a.Score > b.Score
+    }
+    if a.Mass != b.Mass {
+        return a.Mass > b.Mass
+    }
+    return a.SurvivalTime > b.SurvivalTime
+}
+
+// The ratings are kept per repository. Every repository gets the standing of its player,
+// so the repositories of a team share the result of the team. Sorted by repository.
+func (record *ResultRecord) Performances() []Performance {
+    performances := make([]Performance, 0, len(record.Repositories))
+    for repository, player := range record.Repositories {
+        standing := record.Players[player]
+        performances = append(performances, Performance{ Repository: repository, Mass: standing.Mass, SurvivalTime: standing.SurvivalTime })
+    }
+    sort.Slice(performances, func(i, j int) bool { return performances[i].Repository < performances[j].Repository })
+    return performances
+}
+
+func MakeGameOver(game string, scoring Scoring, standings []GameStanding) GameOver {
+    gameOver := GameOver{ Game: game, Scoring: scoring.String(), Winners: []string{}, Standings: standings }
+    for _, standing := range standings {
+        if standing.Place == 1 {
+            gameOver.Winners = append(gameOver.Winners, standing.Player)
+        }
+    }
+    return gameOver
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Files
+//
+////////////////////////////////////////////////////////////////////////
+
+// What is written for every finished game.
+type Result struct {
+    GameOver
+    Finished    time.Time   `json:"finished"`
+    // Only the same in a replay, if the game was played in deterministic mode.
+    Seed        int64       `json:"seed"`
+}
+
+// Every result gets a new read-only file. An existing file is never overwritten.
+// Returns the name of the file.
+func (result Result) Save() (string, error) {
+    return result.save(ResultDirectory)
+}
+
+func (result Result) save(directory string) (string, error) {
+    if err := os.MkdirAll(directory, 0755); err != nil {
+        return "", err
+    }
+
+    content, err := json.MarshalIndent(result, "", "    ")
+    if err != nil {
+        return "", err
+    }
+
+    base := fmt.Sprintf("%v%v_%v", directory, result.Game, result.Finished.Format("2006-01-02_15-04-05"))
+    for i := 1; i <= maxResultFiles; i++ {
+        filename := base + ".json"
+        if i > 1 {
+            filename = fmt.Sprintf("%v_%v.json", base, i)
+        }
+
+        file, err := os.OpenFile(filename, os.O_WRONLY | os.O_CREATE | os.O_EXCL, 0444)
+        if os.IsExist(err) {
+            continue
+        }
+        if err != nil {
+            return "", err
+        }
+        if _, err := file.Write(content); err != nil {
+            file.Close()
+            return "", err
+        }
+        return filename, file.Close()
+    }
+    return "", errors.New(fmt.Sprintf("There are already %v results of the game %v from %v.", maxResultFiles, result.Game, result.Finished))
+}
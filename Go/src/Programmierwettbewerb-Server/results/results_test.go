@@ -0,0 +1,176 @@
+package results
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/rating"
+
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type testBot struct {
+    player      string
+    mass        float32
+    statistics  Statistics
+    alive       bool
+}
+
+func testRecord() ResultRecord {
+    record := NewResultRecord()
+    for _, bot := range []testBot{
+        { "a", 300, Statistics{ MaxSize: 400, BotKillCount: 1, MaxSurvivalTime: 60 }, true },
+        { "b", 0, Statistics{ MaxSize: 900, BotKillCount: 3, MaxSurvivalTime: 40 }, false },
+        { "c", 150, Statistics{ MaxSize: 150, BotKillCount: 0, MaxSurvivalTime: 60 }, true },
+        // Two bots of the same player.
+        { "c", 150, Statistics{ MaxSize: 200, BotKillCount: 1, MaxSurvivalTime: 20 }, true },
+        { "d", 0, Statistics{ MaxSize: 100, BotKillCount: 0, MaxSurvivalTime: 50 }, false },
+    } {
+        record.AddBot(bot.player, bot.player, bot.mass, bot.statistics, bot.alive)
+    }
+    return record
+}
+
+func TestRank(t *testing.T) {
+    tests := []struct {
+        scoring         Scoring
+        wantOrder       []string
+        wantPlaces      []int
+    }{
+        // The survival time decides between the dead bots.
+        { ScMass,       []string{ "a", "c", "d", "b" }, []int{ 1, 1, 3, 4 } },
+        { ScMaxMass,    []string{ "b", "a", "c", "d" }, []int{ 1, 2, 3, 4 } },
+        // The mass decides between equal kills.
+        { ScKills,      []string{ "b", "a", "c", "d" }, []int{ 1, 2, 2, 4 } },
+        { ScSurvival,   []string{ "a", "c", "d", "b" }, []int{ 1, 1, 3, 4 } },
+    }
+
+    for _, test := range tests {
+        record := testRecord()
+        standings := record.Rank(test.scoring)
+        if len(standings) != len(test.wantOrder) {
+            t.Fatalf("%v: %v standings", test.scoring, len(standings))
+        }
+        for i, standing := range standings {
+            if standing.Player != test.wantOrder[i] || standing.Place != test.wantPlaces[i] {
+                t.Errorf("%v: standing %v is %v on %v, want %v on %v", test.scoring, i, standing.Player, standing.Place, test.wantOrder[i], test.wantPlaces[i])
+            }
+        }
+    }
+
+    record := testRecord()
+    c := *record.Players["c"]
+    if c.Mass != 300 || c.MaxMass != 200 || c.Kills != 1 || c.SurvivalTime != 60 || c.Alive != 2 {
+        t.Errorf("the bots of a player do not add up: %+v", c)
+    }
+}
+
+func TestPerformances(t *testing.T) {
+    record := NewResultRecord()
+    record.AddBot("team1", "pwb_02", 0, Statistics{ MaxSurvivalTime: 20 }, false)
+    record.AddBot("team1", "pwb_01", 100, Statistics{ MaxSurvivalTime: 60 }, true)
+    record.AddBot("team2", "pwb_03", 50, Statistics{ MaxSurvivalTime: 60 }, true)
+    // A built-in bot helps its team, but is not rated.
+    record.AddBot("team2", "", 30, Statistics{ MaxSurvivalTime: 60 }, true)
+
+    want := []Performance{
+        { Repository: "pwb_01", Mass: 100, SurvivalTime: 60 },
+        { Repository: "pwb_02", Mass: 100, SurvivalTime: 60 },
+        { Repository: "pwb_03", Mass: 80, SurvivalTime: 60 },
+    }
+    if performances := record.Performances(); !reflect.DeepEqual(performances, want) {
+        t.Errorf("the performances are %+v, want %+v", performances, want)
+    }
+}
+
+// The repositories of a team share its standing, so they share a place and their rating changes.
+func TestRateTeammates(t *testing.T) {
+    record := NewResultRecord()
+    record.AddBot("team1", "pwb_01", 100, Statistics{ MaxSurvivalTime: 60 }, true)
+    record.AddBot("team1", "pwb_02", 0, Statistics{ MaxSurvivalTime: 20 }, false)
+    record.AddBot("team2", "pwb_03", 50, Statistics{ MaxSurvivalTime: 60 }, true)
+
+    ratings := NewRatings()
+    gameRating := ratings.RateGame("game", record.Performances())
+    places := map[string]int{}
+    for _, placement := range gameRating.Placements {
+        places[placement.Repository] = placement.Place
+    }
+    if places["pwb_01"] != 1 || places["pwb_02"] != 1 || places["pwb_03"] != 3 {
+        t.Errorf("the places are %v", places)
+    }
+
+    first, second, third := ratings.Ratings["pwb_01"], ratings.Ratings["pwb_02"], ratings.Ratings["pwb_03"]
+    if first.LastChange <= 0 || first.LastChange != second.LastChange || first.Rating != second.Rating || third.LastChange >= 0 {
+        t.Errorf("the rating changes are %v, %v and %v", first.LastChange, second.LastChange, third.LastChange)
+    }
+    if first.Wins != 1 || second.Wins != 1 || third.Wins != 0 {
+        t.Errorf("the wins are %v, %v and %v", first.Wins, second.Wins, third.Wins)
+    }
+}
+
+func TestParseScoring(t *testing.T) {
+    for _, scoring := range []Scoring{ ScMass, ScMaxMass, ScKills, ScSurvival } {
+        if parsed, err := ParseScoring(scoring.String()); err != nil || parsed != scoring {
+            t.Errorf("%v is parsed as %v, %v", scoring, parsed, err)
+        }
+    }
+    if scoring, err := ParseScoring(""); err != nil || scoring != ScMass {
+        t.Errorf("the default scoring is %v, %v", scoring, err)
+    }
+    if _, err := ParseScoring("luck"); err == nil {
+        t.Errorf("an unknown scoring is accepted")
+    }
+}
+
+func TestMakeGameOver(t *testing.T) {
+    record := testRecord()
+    gameOver := MakeGameOver("game", ScMass, record.Rank(ScMass))
+    if gameOver.Scoring != "mass" || len(gameOver.Winners) != 2 || gameOver.Winners[0] != "a" || gameOver.Winners[1] != "c" {
+        t.Errorf("the game over is %+v", gameOver)
+    }
+
+    // Without players there is no winner.
+    empty := NewResultRecord()
+    if gameOver := MakeGameOver("game", ScMass, empty.Rank(ScMass)); len(gameOver.Winners) != 0 {
+        t.Errorf("the winners of an empty game are %v", gameOver.Winners)
+    }
+}
+
+func TestSaveResult(t *testing.T) {
+    directory, err := ioutil.TempDir("", "results")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(directory)
+
+    record := testRecord()
+    result := Result{ GameOver: MakeGameOver("game", ScKills, record.Rank(ScKills)), Finished: time.Now() }
+
+    // A result of the same game in the same second gets its own file.
+    first, err := result.save(directory + "/")
+    if err != nil {
+        t.Fatal(err)
+    }
+    second, err := result.save(directory + "/")
+    if err != nil || second == first {
+        t.Fatalf("the second result is written to %v, %v", second, err)
+    }
+
+    info, err := os.Stat(first)
+    if err != nil || info.Mode().Perm() & 0222 != 0 {
+        t.Errorf("the result file is writable: %v, %v", info.Mode(), err)
+    }
+
+    content, err := ioutil.ReadFile(first)
+    var saved Result
+    if err != nil || json.Unmarshal(content, &saved) != nil {
+        t.Fatalf("the result cannot be read: %v", err)
+    }
+    if saved.Game != "game" || saved.Scoring != "kills" || len(saved.Standings) != 4 || saved.Winners[0] != "b" {
+        t.Errorf("the saved result is %+v", saved)
+    }
+}
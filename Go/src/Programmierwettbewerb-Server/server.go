@@ -1,19 +1,21 @@
 package main
 
 import (
-    . "Programmierwettbewerb-Server/vector"
     . "Programmierwettbewerb-Server/shared"
     . "Programmierwettbewerb-Server/organisation"
-    . "Programmierwettbewerb-Server/data"
     . "Programmierwettbewerb-Server/connections"
     . "Programmierwettbewerb-Server/distribution"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/integrity"
+    . "Programmierwettbewerb-Server/tournament"
+    . "Programmierwettbewerb-Server/rating"
+    . "Programmierwettbewerb-Server/results"
 
     "github.com/BurntSushi/toml"
     "golang.org/x/net/websocket"
     "fmt"
     "log"
     "net/http"
-    "math"
     "math/rand"
     "time"
     "strconv"
@@ -21,7 +23,6 @@ import (
     "os"
     "encoding/json"
     "io/ioutil"
-    "golang.org/x/image/bmp"
     "html/template"
     "os/exec"
     "sync"
@@ -30,6 +31,7 @@ import (
     "runtime"
     "compress/gzip"
     "bytes"
+    "flag"
 )
 
 ////////////////////////////////////////////////////////////////////////
@@ -39,122 +41,21 @@ import (
 ////////////////////////////////////////////////////////////////////////
 
 const (
-    foodMassMin = 1
-    foodMassMax = 3
-    thrownFoodMass = 10
-    massToBeAllowedToThrow = 100
-    botMinMass = 10
-    botMaxMass = 10000.0
-    blobReunionTime = 10.0
-    blobSplitMass   = 100.0
-    blobSplitVelocity = 1.5
-    blobMinSpeedFactor = 0.225
-    toxinMassMin = 50
-    toxinMassMax = 69
-    windowMin = 100
-    windowMax = 400
-    massLossFactor = 20.0
-    minBlobMassToExplode = 400.0
-    maxBlobCountToExplode = 10
-    minBlobMass = 10
-
-    velocityDecreaseFactor = 0.95
-
     mwMessageEvery = 1
     guiMessageEvery = 1
     guiStatisticsMessageEvery = 1
     serverGuiPasswordFile = "../server_gui_password"
     runningConfFile = "../server_running.conf"
-    allocatorLogFile = "../allocator_log"
     statisticsDirectory = "../Statistics/"
     gamesFile = "../games.json"
 )
 
-////////////////////////////////////////////////////////////////////////
-//
-// Profiling
-//
-////////////////////////////////////////////////////////////////////////
-
-type ProfileEvent struct {
-    Name            string
-    Start           time.Time
-    Duration        time.Duration
-    Children        []*ProfileEvent
-}
-
-type Profile struct {
-    root    *ProfileEvent
-    stack   []*ProfileEvent
-}
-
-func NewProfile() Profile {
-    return Profile{ root: nil, stack: make([]*ProfileEvent, 0, 10) }
-}
-
-func startProfileEvent(profile *Profile, name string) {
-    profileEvent := ProfileEvent{
-        Name:       name,
-        Start:      time.Now(),
-        Children:   make([]*ProfileEvent, 0, 10),
-    }
-
-    if len(profile.stack) > 0 {
-        lastEvent := profile.stack[len(profile.stack) - 1]
-        lastEvent.Children = append(lastEvent.Children, &profileEvent)
-    } else {
-        profile.root = &profileEvent
-    }
-
-    profile.stack = append(profile.stack, &profileEvent)
-}
-
-func endProfileEvent(profile *Profile) {
-    if len(profile.stack) <= 0 {
-        panic("There is no event to end.")
-    }
-
-    profileEvent := profile.stack[len(profile.stack) - 1]
-    profile.stack = profile.stack[:len(profile.stack) - 1]
-
-    profileEvent.Duration = time.Since(profileEvent.Start)
-}
-
-func printProfileEvent(profileEvent *ProfileEvent, currentIndent string, indentation string) {
-    fmt.Printf("%s%s: %v (%.2f)\n", currentIndent, profileEvent.Name, profileEvent.Duration, 0.0)
-    for _, child := range profileEvent.Children {
-        printProfileEvent(child, currentIndent + indentation, indentation)
-    }
-}
-
-func printProfile(profile *Profile) {
-    if profile.root == nil {
-        fmt.Printf("Profile is empty\n")
-        return
-    }
-
-    printProfileEvent(profile.root, "", "  ")
-}
-
 ////////////////////////////////////////////////////////////////////////
 //
 // Games
 //
 ////////////////////////////////////////////////////////////////////////
 
-type Games map[string]Game
-
-type Game struct {
-    GameTime        float32
-    BotsToStart     []string
-    BotCount        int
-    Foods           int
-    Toxins          int
-    FoodSpawn       string
-    ToxinSpawn      string
-    BotSpawn        string
-}
-
 var games Games
 
 func readGames() {
@@ -163,14 +64,13 @@ func readGames() {
         return
     }
 
-    file, err := ioutil.ReadFile(gamesFile)
+    var err error
+    games, err = ReadGames(gamesFile)
     if err != nil {
         Logln(LtDebug, "Could not read the games files")
         return
     }
 
-    json.Unmarshal(file, &games)
-
     LogfColored(LtDebug, LcGreen, "Games\n")
     for gameName := range games {
         LogfColored(LtDebug, LcGreen, "  - %v: %v\n", gameName, games[gameName])
@@ -184,9 +84,11 @@ func readGames() {
 ////////////////////////////////////////////////////////////////////////
 
 type MiddlewareRegistration struct {
-    botId                   BotId
-    botInfo                 BotInfo
-    statistics              Statistics
+    BotId                   BotId
+    BotInfo                 BotInfo
+    Statistics              Statistics
+    // The SVN repository of the bot name.
+    Repository              string
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -196,59 +98,69 @@ type MiddlewareRegistration struct {
 ////////////////////////////////////////////////////////////////////////
 
 type MiddlewareCommand struct {
-    botId                   BotId
-    botCommand              BotCommand
+    BotId                   BotId
+    BotCommand              BotCommand
 }
 
 ////////////////////////////////////////////////////////////////////////
 //
-// ServerSettings
+// TickInput
 //
 ////////////////////////////////////////////////////////////////////////
 
-type ServerSettings struct {
-    fieldSize                   Vec2
-
-    MinNumberOfBots             int
-    MaxNumberOfBots             int
-    MaxNumberOfFoods            int
-    MaxNumberOfToxins           int
-
-    BotsToStart                 []string
-    BotCount                    int
-
-    foodDistributionName        string
-    toxinDistributionName       string
-    botDistributionName         string
-
-    foodDistribution            []Vec2
-    toxinDistribution           []Vec2
-    botDistribution             []Vec2
+// Everything that reaches the simulation from the outside during one step.
+// The update loop only changes the game state through this, so a recorded
+// list of inputs is enough to play a match again.
+type TickInput struct {
+    Dt                      float32
+    ServerCommands          []Command
+    Registrations           []MiddlewareRegistration
+    Commands                []MiddlewareCommand
+    Terminations            []BotId
 }
 
-func NewSettings() ServerSettings {
-    defaultDistributionName := "black.bmp"
-    defaultFieldSize := Vec2{ 1000, 1000 }
+// Takes everything that arrived since the last step from the connections.
+func collectTickInput(dt float32) TickInput {
+    input := TickInput{ Dt: dt }
 
-    return ServerSettings{
-        fieldSize:              defaultFieldSize,
+    app.integrity.NextTick(app.settings.FieldSize)
 
-        MinNumberOfBots:        8,
-        MaxNumberOfBots:        30,
-        MaxNumberOfFoods:       1000,
-        MaxNumberOfToxins:      30,
+    app.serverCommandsMutex.Lock()
+    input.ServerCommands = app.serverCommands
+    app.serverCommands = make([]Command, 0)
+    app.serverCommandsMutex.Unlock()
 
-        BotsToStart:            []string{},
-        BotCount:               0,
+    ProcessNewRegistrations:
+    for {
+        select {
+            case middlewareRegistration := <-app.middlewareRegistrations:
+                input.Registrations = append(input.Registrations, middlewareRegistration)
+            default:
+                break ProcessNewRegistrations
+        }
+    }
 
-        foodDistributionName:   defaultDistributionName,
-        toxinDistributionName:  defaultDistributionName,
-        botDistributionName:    defaultDistributionName,
+    ProcessingNewCommands:
+    for {
+        select {
+            case middlewareCommand := <-app.middlewareCommands:
+                input.Commands = append(input.Commands, middlewareCommand)
+            default:
+                break ProcessingNewCommands
+        }
+    }
 
-        foodDistribution:       loadSpawnImage(defaultFieldSize, defaultDistributionName, 20),
-        toxinDistribution:      loadSpawnImage(defaultFieldSize, defaultDistributionName, 20),
-        botDistribution:        loadSpawnImage(defaultFieldSize, defaultDistributionName, 20),
+    ProcessingTerminations:
+    for {
+        select {
+            case botId := <-app.middlewareTerminations:
+                input.Terminations = append(input.Terminations, botId)
+            default:
+                break ProcessingTerminations
+        }
     }
+
+    return input
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -264,41 +176,13 @@ type Command struct {
     Image       string  `json:"image"`
     GameName    string  `json:"gameName"`
     Bots        string  `json:"string"`
-}
-
-////////////////////////////////////////////////////////////////////////
-//
-// GameState
-//
-////////////////////////////////////////////////////////////////////////
+    Profile     string  `json:"profile"`
+    Tournament  string  `json:"tournament"`
 
-type GameState struct {
-    foods                   map[FoodId]Food
-    toxins                  map[ToxinId]Toxin
-    bots                    map[BotId]Bot
-}
-
-func NewGameState(serverSettings ServerSettings) GameState {
-    var gameState GameState
-
-    gameState.foods         = make(map[FoodId]Food)
-    gameState.bots          = make(map[BotId]Bot)
-    gameState.toxins        = make(map[ToxinId]Toxin)
-
-    for i := FoodId(0); i < FoodId(app.settings.MaxNumberOfFoods); i++ {
-        mass := foodMassMin + rand.Float32() * (foodMassMax - foodMassMin)
-        if pos, ok := newFoodPos(); ok {
-            gameState.foods[i] = Food{ true, false, false, BotId(0), mass, pos, RandomVec2() }
-        }
-    }
-
-    for i := 0; i < app.settings.MaxNumberOfToxins; i++ {
-        if pos, ok := newToxinPos(); ok {
-            gameState.toxins[ToxinId(i)] = Toxin{true, false, pos, false, BotId(0), toxinMassMin, RandomVec2()}
-        }
-    }
-
-    return gameState
+    // Filled in by the server when a "ReloadConfig" is queued, so a replay does not depend on the file.
+    Config      *RunningConfig  `json:"-"`
+    // Closed by the update loop, when it has handled the command. Only the API waits for it.
+    done        chan bool
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -344,33 +228,27 @@ func (connectionRoutinesWaiter *ConnectionRoutinesWaiter) ReceivingDone() {
 
 ////////////////////////////////////////////////////////////////////////
 //
-// Ids
+// ConnectionIds
 //
 ////////////////////////////////////////////////////////////////////////
 
-type Ids struct {
+// The ids of the connections. Everything inside the game gets its id from the simulation.
+type ConnectionIds struct {
     mutex                       sync.Mutex
     nextGuiId                   GuiId
     nextBotId                   BotId
-    nextTeamId                  TeamId
-    nextBlobId                  BlobId
-    nextFoodId                  FoodId
-    nextToxinId                 ToxinId
     nextServerCommandId         CommandId
 }
 
-func NewIds(settings ServerSettings) Ids {
-    return Ids{
+func NewConnectionIds() ConnectionIds {
+    return ConnectionIds{
         nextGuiId:              0,
         nextBotId:              1,
-        nextBlobId:             1,
         nextServerCommandId:    0,
-        nextFoodId:             FoodId(settings.MaxNumberOfFoods) + 1,
-        nextToxinId:            ToxinId(settings.MaxNumberOfToxins) + 1,
     }
 }
 
-func (ids* Ids) createGuiId() GuiId {
+func (ids* ConnectionIds) createGuiId() GuiId {
     ids.mutex.Lock()
     defer ids.mutex.Unlock()
 
@@ -379,7 +257,7 @@ func (ids* Ids) createGuiId() GuiId {
     return id
 }
 
-func (ids* Ids) createServerCommandId() CommandId {
+func (ids* ConnectionIds) createServerCommandId() CommandId {
     ids.mutex.Lock()
     defer ids.mutex.Unlock()
 
@@ -388,7 +266,7 @@ func (ids* Ids) createServerCommandId() CommandId {
     return id
 }
 
-func (ids* Ids) createBotId() BotId {
+func (ids* ConnectionIds) createBotId() BotId {
     ids.mutex.Lock()
     defer ids.mutex.Unlock()
 
@@ -397,48 +275,6 @@ func (ids* Ids) createBotId() BotId {
     return id
 }
 
-func (ids *Ids) createTeamId(gameState *GameState, name string) TeamId {
-    ids.mutex.Lock()
-    defer ids.mutex.Unlock()
-
-    for _, bot := range gameState.bots {
-        if bot.Info.Name == name {
-            return bot.TeamId
-        }
-    }
-
-    var id = ids.nextTeamId
-    ids.nextTeamId = id + 1
-    return id
-}
-
-func (ids* Ids) createBlobId() BlobId {
-    ids.mutex.Lock()
-    defer ids.mutex.Unlock()
-
-    var id = ids.nextBlobId
-    ids.nextBlobId = id + 1
-    return id
-}
-
-func (ids* Ids) createFoodId() FoodId {
-    ids.mutex.Lock()
-    defer ids.mutex.Unlock()
-
-    var id = ids.nextFoodId
-    ids.nextFoodId = id + 1
-    return id
-}
-
-func (ids* Ids) createToxinId() ToxinId {
-    ids.mutex.Lock()
-    defer ids.mutex.Unlock()
-
-    var id = ids.nextToxinId
-    ids.nextToxinId = id + 1
-    return id
-}
-
 ////////////////////////////////////////////////////////////////////////
 //
 // ServerGuiCommands
@@ -459,10 +295,15 @@ type ServerGuiCommand struct {
 type RunningConfig struct {
     UpdateSVN       bool
     DummyBots       int
+    // The built-in bots, that fill the arena up to DummyBots, e.g. "hunter:hard".
+    // Without any, the server starts dummy middlewares with startMiddleware.sh.
+    BuiltinBots     []string
     Password        string
     MassLoss        float64
 }
 
+var defaultBuiltinBots = []string{ "food:easy", "food:medium", "hunter:easy", "hunter:medium", "splitter:medium", "toxin:medium", "hunter:hard", "splitter:hard" }
+
 type Application struct {
     standbyMutex                sync.Mutex
     standby                     *sync.Cond
@@ -490,19 +331,50 @@ type Application struct {
     runningConfig               RunningConfig
 
     game                        Game
+    gameName                    string
 
     guiConnections              GuiConnections
     middlewareConnections       MiddlewareConnections
     settings                    ServerSettings
-    ids                         Ids
+    ids                         ConnectionIds
+
+    // Checks the commands of the middlewares and keeps the reports of the violations.
+    integrity                   Monitor
+    // Keeps the bots of dropped middleware connections alive for a while.
+    sessions                    Sessions
+    builtinBots                 BuiltinBots
+    // Encodes the frames of the binary guis.
+    guiStreams                  map[GuiCamera]*GuiCameraStream
 
-    gameTime                    float32
     gameMode                    bool
+    // The bots wait here until a game starts.
+    lobby                       Lobby
+
+    // In deterministic mode the simulation uses FixedTimeStep instead of the measured time.
+    deterministic               bool
+    seed                        int64
+    random                      *rand.Rand
+
+    // Set with -record. Every game is written to its own file in replayDirectory.
+    recorder                    *Recorder
+    // Set with -replay. The inputs come from the file instead of the connections.
+    replay                      *ReplayPlayer
+
+    // The running tournament, nil if there is none.
+    tournament                  *TournamentRunner
+
+    // The repositories of the bots in the game. Only used by the update loop.
+    repositories                map[BotId]string
+    // The ratings of all games. The running game is rated with its results.
+    ratings                     Ratings
+    // How the players do in the running game and its final ranking, nil until the time is over.
+    results                     ResultRecord
+    gameOver                    *GameOver
 }
 
 var app Application
 
-func (app* Application) initialize() {
+func (app* Application) initialize(seed int64, deterministic bool) {
     app.standby                     = sync.NewCond(&app.standbyMutex)
     app.stopped                     = false
 
@@ -519,12 +391,23 @@ func (app* Application) initialize() {
 
     app.runningConfig               = RunningConfig{}
 
+    app.deterministic               = deterministic
+    app.seed                        = seed
+    app.random                      = rand.New(rand.NewSource(seed))
+
     app.guiConnections              = NewGuiConnections()
+    app.guiStreams                  = make(map[GuiCamera]*GuiCameraStream)
     app.middlewareConnections       = NewMiddlewareConnections()
     app.settings                    = NewSettings()
-    app.ids                         = NewIds(app.settings)
+    app.ids                         = NewConnectionIds()
+    app.integrity                   = NewMonitor(app.settings.FieldSize)
+    app.sessions                    = NewSessions()
+    app.builtinBots                 = NewBuiltinBots()
+
+    app.repositories                = make(map[BotId]string)
+    app.ratings                     = NewRatings()
+    app.results                     = NewResultRecord()
 
-    app.gameTime                    = 300.0
     app.gameMode                    = false
 }
 
@@ -542,26 +425,6 @@ func isServerRunning() bool {
     return app.runningState
 }
 
-////////////////////////////////////////////////////////////////////////
-//
-// IdsContainer
-//
-////////////////////////////////////////////////////////////////////////
-
-type IdPair struct {
-    BotId   BotId
-    BlobId  BlobId
-}
-type IdsContainer []IdPair
-
-func NewIdsContainer() IdsContainer {
-    return make([]IdPair, 0)
-}
-
-func (blobContainer *IdsContainer) insert(botId BotId, blobId BlobId) {
-    (*blobContainer) = append((*blobContainer), IdPair{ botId, blobId })
-}
-
 ////////////////////////////////////////////////////////////////////////
 //
 // Connections
@@ -575,7 +438,13 @@ func hasStandbyRelevantConnections() bool {
             numRealBots += 1
         }
     })
-    return numRealBots > 0 || app.guiConnections.Count() > 0
+
+    // The API waits for its commands, so they are handled even without any connection.
+    app.serverCommandsMutex.Lock()
+    numServerCommands := len(app.serverCommands)
+    app.serverCommandsMutex.Unlock()
+
+    return numRealBots > 0 || app.guiConnections.Count() > 0 || numServerCommands > 0
 }
 
 type WaitNotifier func(active bool)
@@ -621,926 +490,168 @@ func wakeUpFromStandby() {
 //
 ////////////////////////////////////////////////////////////////////////
 
-func makeLocalSpawnName(name string) string {
-    return fmt.Sprintf("../Public/spawns/%v", name)
-}
-
 func makeURLSpawnName(name string) string {
     return fmt.Sprintf("/spawns/%v", name)
 }
 
 ////////////////////////////////////////////////////////////////////////
 //
-// Finding Positions
+// Physics
 //
 ////////////////////////////////////////////////////////////////////////
 
-func newFoodPos() (Vec2, bool) {
-    length := len(app.settings.foodDistribution)
-    if length == 0 {
-        return Vec2{}, false
-    }
-    return app.settings.foodDistribution[rand.Intn(length)], true
+// The mass loss of the running config is the default, a profile may still override it.
+func basePhysics() Physics {
+    physics := DefaultPhysics()
+    physics.MassLoss = app.runningConfig.MassLoss
+    return physics
 }
 
-func newToxinPos() (Vec2, bool) {
-    length := len(app.settings.toxinDistribution)
-    if length == 0 {
-        return Vec2{}, false
+func setPhysics(name string) {
+    if err := app.settings.SetPhysics(basePhysics(), name); err != nil {
+        Logf(LtDebug, "Could not load the physics profile \"%v\": %v\n", name, err.Error())
     }
-    return app.settings.toxinDistribution[rand.Intn(length)], true
-}
-
-func newBotPos(gameState *GameState, settings *ServerSettings) (Vec2, bool) {
-    length := len(settings.botDistribution)
-    if length == 0 {
-        return Vec2{}, false
-    }
-    // Check, that the player doesn't spawn inside another blob!
-    for i := 1; i < 10; i++{
-        pos := settings.botDistribution[rand.Intn(length)]
-        if len(gameState.bots) == 0 {
-            return pos, true
-        }
-        allGood := true
-        for _,bot := range(gameState.bots) {
-            for _,blob := range(bot.Blobs) {
-                var dist = Dist(pos, blob.Position)
-                var minDist  = blob.Radius() + 30
-
-                if minDist > dist {
-                    allGood = false
-                    break
-                }
-            }
-            if !allGood {
-                break
-            }
-        }
-        if allGood {
-            return pos, true
-        }
-    }
-
-    Logf(LtDebug, "Bot position could NOT be determined. Bot is started at a random position!\n")
-
-    pos := settings.botDistribution[rand.Intn(length)]
-    return pos, true
 }
 
 ////////////////////////////////////////////////////////////////////////
 //
-// Simulations
+// Rating
 //
 ////////////////////////////////////////////////////////////////////////
 
-func calcBlobVelocityFromMass(vel Vec2, mass float32) Vec2 {
-    // This is the maximum mass for now.
-    var factor = 1.0 - mass/botMaxMass
-    if mass > 0.9*botMaxMass {
-        // So blobs never stop moving completely.
-        factor = blobMinSpeedFactor
-    }
-    if Length(vel) <= 0.01 {
-        vel = RandomVec2()
-    }
-    return Muls(NormalizeOrZero(vel), factor)
-}
-
-func calcBlobVelocity(blob *Blob, targetPos Vec2) Vec2 {
-    var diff = Sub(targetPos, blob.Position)
-
-    if blob.VelocityFac < 0.2 && Length(diff) <= 0.5 {
-        diff = RandomVec2()
-        return NullVec2()
-    }
-
-    var velocity = calcBlobVelocityFromMass(diff, blob.Mass)
-
-    //Logf(LtDebug, "velocity: %v, diff: %v, mass: %v, targetPos: %v, pos: %v\n", velocity, diff, blob.Mass, targetPos, blob.Position)
-    var vel = Add(velocity, Muls(velocity, blob.VelocityFac))
-
-    if math.IsNaN(float64(vel.X)) || math.IsNaN(float64(vel.Y)) {
-        vel = Vec2{0,0}
-    }
-
-    return vel
-}
-
-func calcBlobbMassLoss(mass float32, dt float32) float32 {
-    if mass > botMinMass {
-        return mass - (mass/botMaxMass)*dt*float32(app.runningConfig.MassLoss)
+// Rates the finished game with the results of finishGame.
+func rateGame() {
+    gameRating := app.ratings.RateGame(app.gameName, app.results.Performances())
+    for _, placement := range gameRating.Placements {
+        LogfColored(LtDebug, LcGreen, "  %v. %v: rating %.0f -> %.0f\n", placement.Place, placement.Repository, placement.RatingBefore, placement.RatingAfter)
     }
 
-    return mass
-}
-
-func pushBlobsApart(blobs* map[BlobId]Blob) {
-    for index, subBlob := range *blobs {
-        for index2, subBlob2 := range *blobs {
-            // Just move them out of each other, if it is not newly split!
-            if index != index2 && subBlob.VelocityFac < 1.1 && subBlob2.VelocityFac < 1.1 {
-                var dist = Dist(subBlob.Position, subBlob2.Position)
-                var minDist  = subBlob.Radius() + subBlob2.Radius()
-
-                // ToDo(Maurice): Make reunion time dynamic!
-                if subBlob.ReunionTime <= 1.0 {
-                    minDist *= subBlob.ReunionTime
-                }
-
-                var distDiff = minDist - dist
-                // Push them out from each other
-                if distDiff > 0 {
-                    //fmt.Println("Pushing!")
-                    var sub = Sub(subBlob.Position, subBlob2.Position)
-                    if Length(sub) <= 0.01 {
-                        sub = RandomVec2()
-                    }
-                    var dir = Muls(NormalizeOrZero(sub), distDiff/2)
-                    var tmp = (*blobs)[index]
-                    tmp.Position  = Add((*blobs)[index].Position, dir)
-                    (*blobs)[index] = tmp
-                    var tmp2 = (*blobs)[index2]
-                    tmp2.Position = Sub((*blobs)[index2].Position, dir)
-                    (*blobs)[index2] = tmp2
-
-                }
-            }
-        }
+    if err := app.ratings.Save(); err != nil {
+        Logf(LtDebug, "Could not save the ratings: %v\n", err.Error())
     }
 }
 
-func calcSubblobReunion(killedBlobs *IdsContainer, botId BotId, bot *Bot) {
-    for k,subBlob := range (*bot).Blobs {
-        for k2,subBlob2 := range (*bot).Blobs {
-            if k != k2 {
-                var dist = Dist(subBlob.Position, subBlob2.Position)
-                var shouldBe = subBlob.Radius() + subBlob2.Radius()
-                if subBlob2.ReunionTime < 0.1 && dist < shouldBe && shouldBe - dist > subBlob2.Radius() {
-                    // Merge them together.
-                    var tmp = (*bot).Blobs[k]
-                    tmp.Mass += (*bot).Blobs[k2].Mass
-                    tmp.IsSplit = false
-                    (*bot).Blobs[k] = tmp
-
-                    // Delete blob
-                    killedBlobs.insert(botId, k2)
-                    delete((*bot).Blobs, k2)
-
-                }
-            }
-        }
-    }
-}
-
-func splitAllBlobsOfBot(bot *Bot, ids *Ids) {
-    var newBlobMap = make(map[BlobId]Blob)
-    for subBlobToSplit, subBlob := range (*bot).Blobs {
-        // Just split if bigger than 100
-        if (*bot).Blobs[subBlobToSplit].Mass >= blobSplitMass {
-            var newMass = subBlob.Mass / 2.0
-
-            // Override the old mass and time to reunion, so it is not eaten right away.
-            var tmp = (*bot).Blobs[subBlobToSplit]
-            tmp.Mass = newMass
-            tmp.ReunionTime = subBlob.ReunionTime + 1.0
-            (*bot).Blobs[subBlobToSplit] = tmp
-
-            var newIndex = ids.createBlobId()
-            newBlobMap[newIndex] = Blob{ subBlob.Position, newMass, blobSplitVelocity, true, blobReunionTime, NullVec2()}
-        }
-    }
-
-    // Just so we don't edit the map while iterating over it!
-    for index,blob := range newBlobMap {
-        (*bot).Blobs[index] = blob
-    }
-}
-
-func throwAllBlobsOfBot(gameState *GameState, bot *Bot, botId BotId) bool {
-    somebodyThrew := false
-    for blobId, blob := range (*bot).Blobs {
-        if blob.Mass > massToBeAllowedToThrow {
-            foodId := app.ids.createFoodId()
-            sub := Sub(bot.Command.Target, blob.Position)
-            if Length(sub) <= 0.01 {
-                sub = RandomVec2()
-            }
-            targetDirection := NormalizeOrZero(sub)
-            food := Food{
-                IsNew:    true,
-                IsMoving: true,
-                IsThrown: true,
-                IsThrownBy: botId,
-                Mass:     thrownFoodMass,
-                Position: Add(blob.Position, Muls(targetDirection, 1.5*(blob.Radius() + Radius(thrownFoodMass)))),
-                Velocity: Muls(targetDirection, 150),
-            }
-            gameState.foods[foodId] = food
-
-            blob.Mass = blob.Mass - thrownFoodMass
-
-            somebodyThrew = true
-        }
-        (*bot).Blobs[blobId] = blob
-    }
-    return somebodyThrew
-}
-
-// Calculates a vectors which are equally divided on a circle with given radius!
-func randomVecOnCircle(radius float32) Vec2 {
-    var angle = rand.Float64() * math.Pi * 2.0;
-    var x = float32(math.Cos(angle)) * radius;
-    var y = float32(math.Sin(angle)) * radius;
-    return Vec2{x, y}
-}
-
-func explodeBlob(gameState *GameState, botId BotId, blobId BlobId, newMap *map[BlobId]Blob, ids *Ids)  {
-    blobCount := 12
-    splitRadius := float32(3.0)
-
-    // ToDo(Maurice): Make exploded Bubbles in random/different sizes with one of them
-    // consisting of half the mass!
-    blob := gameState.bots[botId].Blobs[blobId]
-    for i := 0; i < blobCount; i++ {
-        newIndex  := ids.createBlobId()
-        (*newMap)[newIndex] = Blob{
-            Add(RandomVec2(), blob.Position),
-            blob.Mass/float32(blobCount),
-            // We need the 0.2 (or something small!) here, so that we don't
-            // try to push them apart in the first step. Otherwise we have the exact same
-            // position and the diff-Vector is undefined/null. Can't push them apart!
-            blob.VelocityFac+0.1,
-            false,
-            10.0,
-            // Random Vector with about same length. Should be uniformly divided!
-            randomVecOnCircle(splitRadius),
-        }
-    }
-}
-
-func makeServerMiddlewareBlob(botId BotId, blobId BlobId, teamId TeamId, blob Blob) ServerMiddlewareBlob {
-    return ServerMiddlewareBlob{
-        BotId:  uint32(botId),
-        TeamId: uint32(teamId),
-        Index:  uint32(blobId),
-        Position: ToFixedVec2(blob.Position, 100),
-        Mass:   uint32(blob.Mass),
-    }
-}
-
-func makeServerMiddlewareBlobs(gameState *GameState, botId BotId) []ServerMiddlewareBlob {
-    var blobArray []ServerMiddlewareBlob
-
-    bot := gameState.bots[botId]
-    for blobId, blob := range bot.Blobs {
-        blobArray = append(blobArray, makeServerMiddlewareBlob(botId, blobId, bot.TeamId, blob))
-    }
-
-    return blobArray
-}
-
-func makeServerMiddlewareFood(food Food) Food {
-    return Food{
-        Mass:       float32(uint32(food.Mass)),
-        Position:   ToFixedVec2(food.Position, 100),
-    }
-}
-
-func makeServerMiddlewareToxin(toxin Toxin) Toxin {
-    return Toxin{
-        Mass:       float32(uint32(toxin.Mass)),
-        Position:   ToFixedVec2(toxin.Position, 100),
-    }
-}
-
-func limitPosition(settings *ServerSettings, position *Vec2) {
-    if (*position).X < 0 { (*position).X = 0 }
-    if (*position).Y < 0 { (*position).Y = 0 }
-    if (*position).X > settings.fieldSize.X { (*position).X = settings.fieldSize.X }
-    if (*position).Y > settings.fieldSize.Y { (*position).Y = settings.fieldSize.Y }
-}
-
 ////////////////////////////////////////////////////////////////////////
 //
-// NaN Problem
+// Results
 //
 ////////////////////////////////////////////////////////////////////////
 
-func checkNaNV (v Vec2, prefix string, s string) {
-    if math.IsNaN(float64(v.X)) || math.IsNaN(float64(v.Y)) {
-        Logf(LtDebug, "NaN ( Vec ) is found for: __%v__ %v\n", prefix, s)
+// A bot plays for its team in the team mode, otherwise for its repository.
+// Bots without a repository play under their own name.
+func playerOf(botId BotId, botName string) string {
+    if app.settings.TeamMode() {
+        return app.settings.TeamName(botName)
     }
-}
-func checkNaNF (f float32, prefix string, s string) {
-    if math.IsNaN(float64(f)) {
-        Logf(LtDebug, "NaN (Float) is found for: __%v__ %v\n", prefix, s)
+    if repository := app.repositories[botId]; repository != "" {
+        return repository
     }
+    return botName
 }
-func checkAllValuesOnNaN(gameState *GameState, prefix string) {
-    for _,bot := range gameState.bots {
-        checkNaNV(bot.ViewWindow.Position, prefix, "bot.ViewWindow.Position")
-        checkNaNV(bot.ViewWindow.Size, prefix, "bot.ViewWindow.Size")
-        for _,blob := range bot.Blobs {
-            checkNaNV(blob.Position, prefix, "blob.Position")
-            checkNaNV(blob.IndividualTargetVec, prefix, "blob.IndividualTargetVec")
-            checkNaNF(blob.Mass, prefix, "blob.Mass")
-            checkNaNF(blob.ReunionTime, prefix, "blob.ReunionTime")
-            checkNaNF(blob.VelocityFac, prefix, "blob.VelocityFac")
+
+// Ranks the players of the finished game with the dead bots and the bots that are still alive.
+// The bots and guis get the standings until the next game starts.
+func finishGame(gameState *GameState, live bool) {
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        var mass float32
+        for _, blobId := range SortedBlobIds(bot.Blobs) {
+            mass += bot.Blobs[blobId].Mass
         }
+        app.results.AddBot(playerOf(botId, bot.Info.Name), app.repositories[botId], mass, bot.StatisticsThisGame, true)
     }
-    for _,food := range gameState.foods {
-        checkNaNF(food.Mass, prefix, "food.Mass")
-        checkNaNV(food.Position, prefix, "food.Position")
-        checkNaNV(food.Velocity, prefix, "food.Velocity")
-    }
-    for _,toxin := range gameState.toxins {
-        checkNaNV(toxin.Position, prefix, "toxin.Position")
-        checkNaNF(toxin.Mass, prefix, "toxin.Mass")
-        checkNaNV(toxin.Velocity, prefix, "toxin.Velocity")
-    }
-}
 
-func readServerPassword() (bool, string) {
-    pw, err := ioutil.ReadFile(serverGuiPasswordFile)
+    scoring, err := ParseScoring(app.game.Scoring)
     if err != nil {
-        Logf(LtDebug, "Error while trying to load the password file %v. err: %v\n", serverGuiPasswordFile, err)
-        return false, ""
+        Logf(LtDebug, "%v The mass decides.\n", err.Error())
     }
-    return true, strings.Trim(string(pw), "\n \t")
-}
-
-func checkPassword(password string) bool {
-    return app.runningConfig.Password == password
-}
-
-////////////////////////////////////////////////////////////////////////
-//
-// FoodBuffer for QuadTree
-//
-////////////////////////////////////////////////////////////////////////
+    gameOver := MakeGameOver(app.gameName, scoring, app.results.Rank(scoring))
+    app.gameOver = &gameOver
 
-const foodBufferSize int = 100
-type FoodBuffer struct {
-    values      [foodBufferSize]interface{}
-    count       int
-}
-
-func (buffer *FoodBuffer) Append(value interface{}) {
-    if buffer.count + 1 < foodBufferSize {
-        buffer.values[buffer.count] = value
-        buffer.count += 1
+    LogfColored(LtDebug, LcGreen, "Winner: %v (scoring: %v)\n", strings.Join(gameOver.Winners, ", "), gameOver.Scoring)
+    for _, standing := range gameOver.Standings {
+        LogfColored(LtDebug, LcGreen, "  %v. %v: %v\n", standing.Place, standing.Player, standing.Score)
     }
-}
-
-////////////////////////////////////////////////////////////////////////
-//
-// BotKill
-//
-////////////////////////////////////////////////////////////////////////
-
-type BotKill struct {
-    botId               BotId
-    name                string
-    statisticsThisGame  Statistics
-}
 
-func NewBotKill(botId BotId, bot Bot) BotKill {
-    return BotKill{
-        botId:              botId,
-        name:               bot.Info.Name,
-        statisticsThisGame: bot.StatisticsThisGame,
+    if !live {
+        return
+    }
+    result := Result{ GameOver: gameOver, Finished: time.Now(), Seed: app.seed }
+    if filename, err := result.Save(); err != nil {
+        Logf(LtDebug, "Could not write the result: %v\n", err.Error())
+    } else {
+        Logf(LtDebug, "The result is written to %v\n", filename)
     }
 }
 
 ////////////////////////////////////////////////////////////////////////
 //
-// Update Function
+// Integrity
 //
 ////////////////////////////////////////////////////////////////////////
 
-func update(gameState *GameState, settings *ServerSettings, ids *Ids, profile *Profile, dt float32, simulationStepCounter int) ([]BotKill, []FoodId, []ToxinId) {
-    deadBots    := make([]BotKill, 0)
-    eatenFoods  := make([]FoodId,  0)
-    eatenToxins := make([]ToxinId, 0)
-
-    app.gameTime -= dt
-
-    ////////////////////////////////////////////////////////////////
-    // UPDATE BOT POSITION
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Update Bot Position")
-        for botId, bot := range gameState.bots {
-            botDied := false
-            for blobId, blob := range bot.Blobs {
-                if blob.Mass < minBlobMass {
-                    delete(bot.Blobs, blobId)
-                    if len(bot.Blobs) == 0 {
-                        botDied = true
-                        deadBots = append(deadBots, NewBotKill(botId, bot))
-                    }
-                    break
-                }
-
-                oldPosition := blob.Position
-                velocity    := calcBlobVelocity(&blob, bot.Command.Target)
-                time        := dt * 50
-                newVelocity := Muls(velocity, time)
-                newPosition := Add (oldPosition, newVelocity)
-                newPosition =  Add (newPosition, blob.IndividualTargetVec)
-
-                blob.Position = newPosition
-
-                //singleBlob.Position = Add(singleBlob.Position, Muls(calcBlobVelocity(&singleBlob, blob.IndividualTargetVec), dt * 100))
-                blob.Mass = calcBlobbMassLoss(blob.Mass, dt)
-                blob.VelocityFac = blob.VelocityFac * velocityDecreaseFactor
-
-                // So this is not added all the time but just for a short moment!
-                blob.IndividualTargetVec = Muls(blob.IndividualTargetVec, velocityDecreaseFactor)
-
-                if blob.ReunionTime > 0.0 {
-                    blob.ReunionTime -= dt
-                }
-
-                limitPosition(settings, &blob.Position)
-
-                gameState.bots[botId].Blobs[blobId] = blob
-            }
-            if !botDied {
-                gameState.bots[botId] = bot
-            }
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // UPDATE VIEW WINDOWS AND MAX MASS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "View Windows and max Mass")
-        for botId, bot := range gameState.bots {
-            //var diameter float32
-            var center Vec2
-            var completeMass float32 = 0
-            for _, blob1 := range bot.Blobs {
-                center = Add(center, blob1.Position)
-                completeMass += blob1.Mass
-            }
-
-            if completeMass > botMaxMass {
-
-                // Percentage to cut off
-                var dividor float32 = completeMass / botMaxMass
-
-                for blobId, blob := range bot.Blobs {
-                    blob.Mass /= dividor
-                    bot.Blobs[blobId] = blob
-                }
-
-            }
-
-            center = Muls(center, 1.0 / float32(len(bot.Blobs)))
-            var windowDiameter float32 = 50.0 * float32(math.Log(float64(completeMass))) - 20.0
-
-            bot.ViewWindow = ViewWindow{
-                Position:   Sub(center, Vec2{ windowDiameter / 2.0, windowDiameter / 2.0 }),
-                Size: Vec2{ windowDiameter, windowDiameter },
-            }
-            gameState.bots[botId] = bot
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // UPDATE FOOD POSITION
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Food Position")
-        for foodId, food := range gameState.foods {
-            if food.IsMoving {
-                food.Position = Add(food.Position, Muls(food.Velocity, dt))
-                limitPosition(settings, &food.Position)
-                food.Velocity = Muls(food.Velocity, velocityDecreaseFactor)
-                gameState.foods[foodId] = food
-                if Length(food.Velocity) <= 0.001 {
-                    food.IsMoving = false
-                }
-            }
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // UPDATE TOXIN POSITION
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Toxin Position")
-        for toxinId, toxin := range gameState.toxins {
-            if toxin.IsMoving {
-                toxin.Position = Add(toxin.Position, Muls(toxin.Velocity, dt))
-                limitPosition(settings, &toxin.Position)
-                toxin.Velocity = Muls(toxin.Velocity, velocityDecreaseFactor)
-                gameState.toxins[toxinId] = toxin
-                if Length(toxin.Velocity) <= 0.001 {
-                    toxin.IsMoving = false
-                }
-            }
-            gameState.toxins[toxinId] = toxin
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // SPLIT BOTS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Split Bot")
-        for botId, bot := range gameState.bots {
-            if bot.Command.Action == BatSplit && len(bot.Blobs) <= 10 {
-
-                var bot = gameState.bots[botId]
-                bot.StatisticsThisGame.SplitCount += 1
-                var botRef = &bot
-                splitAllBlobsOfBot(botRef, ids)
-                gameState.bots[botId] = *botRef
-
-            } else if bot.Command.Action == BatThrow {
-                bot := gameState.bots[botId]
-                throwAllBlobsOfBot(gameState, &bot, botId)
-                gameState.bots[botId] = bot
-            }
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // SPLIT THE TOXINS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Split Toxin")
-        for toxinId, toxin := range gameState.toxins {
-
-            if toxin.Mass > toxinMassMax {
-
-                // Create new Toxin (moving!)
-                newId := ids.createToxinId()
-                newToxin := Toxin {
-                    IsNew: true,
-                    IsMoving: true,
-                    Position: toxin.Position,
-                    IsSplit: true,
-                    IsSplitBy: toxin.IsSplitBy,
-                    Mass: toxinMassMin,
-                    Velocity: toxin.Velocity,
-                }
-                gameState.toxins[newId] = newToxin
-
-                possibleBot, foundIt := gameState.bots[toxin.IsSplitBy]
-                if foundIt {
-                    possibleBot.StatisticsThisGame.ToxinThrow += 1
-                    gameState.bots[toxin.IsSplitBy] = possibleBot
-                }
-
-                // Reset Mass
-                toxin.Mass = toxinMassMin
-                toxin.IsSplit = false
-                toxin.IsNew = false
-                toxin.IsSplitBy = BotId(0)
-                toxin.Velocity = RandomVec2()
-
-            }
-            gameState.toxins[toxinId] = toxin
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // REUNION OF BLOBS
-    ////////////////////////////////////////////////////////////////
-    killedBlobs := NewIdsContainer()
-    {
-        startProfileEvent(profile, "Blob reunion")
-        for botId, _ := range gameState.bots {
-            var bot = gameState.bots[botId]
-            var botRef = &bot
-            // Reunion of Subblobs
-            calcSubblobReunion(&killedBlobs, botId, botRef)
-            gameState.bots[botId] = *botRef
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // COLLISION WITH TOXINS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Collision with Toxin")
-        for tId,toxin := range gameState.toxins {
-            var toxinIsEaten = false
-            var toxinIsRepositioned = false
-
-            for botId, _ := range gameState.bots {
-                bot := gameState.bots[botId]
-
-                mapOfAllNewSingleBlobs := make(map[BlobId]Blob)
-                var blobsToDelete []BlobId
-                var exploded = false
-
-                // This loop should not alter ANY real data at all right now!
-                // Just writing to tmp maps without alterning real data.
-                for blobId,_ := range bot.Blobs {
-                    var singleBlob = bot.Blobs[blobId]
-
-                    if Dist(singleBlob.Position, toxin.Position) < singleBlob.Radius() && singleBlob.Mass >= minBlobMassToExplode {
-
-                        // If a bot already has > 10 blobs (i.e.), don't explode, eat it!!
-                        if len(bot.Blobs) > maxBlobCountToExplode && !toxin.IsSplit {
-                            if toxin.IsSplit || len(gameState.toxins) >= settings.MaxNumberOfToxins {
-                                eatenToxins = append(eatenToxins, tId)
-                                delete(gameState.toxins, tId)
-                                toxinIsEaten = true
-                            } else {
-                                if pos, ok := newToxinPos(); ok {
-                                    toxin.Position = pos
-                                    toxin.IsSplitBy = BotId(0)
-                                    toxin.IsSplit = false
-                                    toxin.IsNew = true
-                                    toxin.Mass = toxinMassMin
-                                    toxinIsRepositioned = true
-                                } else {
-                                    eatenToxins = append(eatenToxins, tId)
-                                    delete(gameState.toxins, tId)
-                                    toxinIsEaten = true
-                                }
-                            }
-                            break
-                        }
-
-                        subMap := make(map[BlobId]Blob)
-
-                        if toxin.IsSplit {
-                            possibleBot, foundIt := gameState.bots[toxin.IsSplitBy]
-                            if foundIt {
-                                possibleBot.StatisticsThisGame.SuccessfulToxin += 1
-                                gameState.bots[toxin.IsSplitBy] = possibleBot
-                            }
-                        }
-
-                        explodeBlob(gameState, botId, blobId, &subMap, ids)
-                        exploded = true
-
-                        // Add all the new explosions:
-                        for i,b := range subMap {
-                            mapOfAllNewSingleBlobs[i] = b
-                        }
-
-                        blobsToDelete = append(blobsToDelete, blobId)
-
-                        if pos, ok := newToxinPos(); ok {
-                            toxin.Position = pos
-                            toxin.IsSplitBy = BotId(0)
-                            toxin.IsSplit = false
-                            toxin.IsNew = true
-                            toxin.Mass = toxinMassMin
-                        } else {
-                            eatenToxins = append(eatenToxins, tId)
-                            delete(gameState.toxins, tId)
-                            toxinIsEaten = true
-                        }
-                    }
-                }
-
-                if toxinIsEaten || toxinIsRepositioned {
-                    break
-                }
-
-                if exploded {
-                    // Delete the origin of the exploded Blobs.
-                    for _,blobKey := range blobsToDelete {
-                        killedBlobs.insert(botId, blobKey)
-                        delete(bot.Blobs, blobKey)
-                    }
-
-                    // Add all new exploded Blobs.
-                    for i,b := range mapOfAllNewSingleBlobs {
-                        bot.Blobs[i] = b
-                    }
-                }
-
-                gameState.bots[botId] = bot
-            }
-
-            if !toxinIsEaten {
-                gameState.toxins[tId] = toxin
-            }
-        }
-        endProfileEvent(profile)
-    }
-
-    ////////////////////////////////////////////////////////////////
-    // PUSH BLOBS APART
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Push Blobs Apart")
-        for botId, _ := range gameState.bots {
-
-            var blob = gameState.bots[botId]
-
-            var tmpA = gameState.bots[botId].Blobs
-            pushBlobsApart(&tmpA)
-            blob.Blobs = tmpA
-
-            gameState.bots[botId] = blob
-        }
-        endProfileEvent(profile)
+func writeIntegrityReports() {
+    if err := app.integrity.WriteReports(); err != nil {
+        Logf(LtDebug, "Could not write the integrity reports: %v\n", err.Error())
     }
+}
 
-    ////////////////////////////////////////////////////////////////
-    // BUILD QUAD TREE FOR FOODS
-    ////////////////////////////////////////////////////////////////
-    allocator := NewAllocator(10000, 5000, 10000, 5000)
-    quadTree := NewQuadTree(NewQuad(Vec2{0,0}, 1000), &allocator)
-    {
-        startProfileEvent(profile, "QuadTree Building for Foods")
-        {
-            for foodId, food := range gameState.foods {
-                quadTree.Insert(food.Position, foodId)
-            }
-        }
-        if allocator.LimitWasHit {
-            f, err := os.Create(allocatorLogFile)
-            defer f.Close()
-            if err == nil {
-                serializingMap := make(map[string]Food)
-                for key, value := range gameState.foods {
-                    serializingMap[string(key)] = value
-                }
-                b, _ := json.Marshal(serializingMap)
-                f.Write(b)
-                f.Sync()
-            }
-            Logf(LtDebug, "Allocator Error Report:\n")
-            allocator.Report()
-        }
-        if simulationStepCounter % 1200 == 0 {
-            Logf(LtDebug, "Allocator Report:\n")
-            allocator.Report()
-        }
-        endProfileEvent(profile);
+// Every graded game writes the spawn decisions into its own file.
+func writeSpawnAudit(gameState *GameState) {
+    audit := MakeSpawnAudit(app.gameName, gameState.Spawns)
+    LogfColored(LtDebug, LcGreen, "Spawns: %v, unsafe: %v, minimal safety: %.0f\n", audit.Spawns, audit.Unsafe, audit.MinSafety)
+    if err := saveSpawnAudit(audit); err != nil {
+        Logf(LtDebug, "Could not write the spawn audit: %v\n", err.Error())
     }
+}
 
-    ////////////////////////////////////////////////////////////////
-    // EATING FOODS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "QuadTree Seaching (Blobs eating Foods)")
-        {
-            var buffer FoodBuffer
-
-            for botId, bot := range gameState.bots {
-                for blobId, blob := range bot.Blobs {
-                    radius := Radius(blob.Mass)
-                    blobQuad := NewQuad(Vec2{ blob.Position.X - radius, blob.Position.Y - radius }, 2*radius)
-
-                    quadTree.FindValuesInQuad(blobQuad, &buffer)
-
-                    // Plow through the result of the query from the tree.
-                    for i := 0; i < buffer.count; i = i + 1 {
-                        id, _ := buffer.values[i].(FoodId)
-
-                        foodId := id
-                        food := gameState.foods[foodId]
-
-                        if Length(Sub(food.Position, blob.Position)) < blob.Radius() {
-                            blob.Mass = blob.Mass + food.Mass
-                            if food.IsThrown {
-                                delete(gameState.foods, foodId)
-                                eatenFoods = append(eatenFoods, foodId)
-                            } else {
-                                if pos, ok := newFoodPos(); ok {
-                                    food.Position = pos
-                                    food.IsNew = true
-                                    gameState.foods[foodId] = food
-                                } else {
-                                    delete(gameState.foods, foodId)
-                                    eatenFoods = append(eatenFoods, foodId)
-                                }
-                            }
-                        }
-                    }
-                    bot.Blobs[blobId] = blob
-
-                    buffer.count = 0
-                }
-                gameState.bots[botId] = bot
-            }
-        }
-        endProfileEvent(profile)
+func saveSpawnAudit(audit SpawnAudit) error {
+    if err := os.MkdirAll(IntegrityDirectory, 0755); err != nil {
+        return err
     }
 
-    ////////////////////////////////////////////////////////////////
-    // TOXINS EATING FOODS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "QuadTree Searching (Toxins eating Foods)")
-        {
-            var buffer FoodBuffer
-
-            for tId, toxin := range gameState.toxins {
-                radius := Radius(toxin.Mass)
-                toxinQuad := NewQuad(Vec2{ toxin.Position.X - radius, toxin.Position.Y - radius }, 2*radius)
-
-                quadTree.FindValuesInQuad(toxinQuad, &buffer)
-
-                for i := 0; i < buffer.count; i = i + 1 {
-                    foodId, _ := buffer.values[i].(FoodId)
-                    food := gameState.foods[foodId]
-
-                    if food.IsThrown {
-                        if Length(Sub(food.Position, toxin.Position)) < Radius(toxin.Mass) {
-                            toxin.Mass = toxin.Mass + food.Mass
-                            // Always get the velocity of the last eaten food so the toxin (when split)
-                            // gets the right velocity of the last input.
-                            if Length(food.Velocity) <= 0.01 {
-                                food.Velocity = RandomVec2()
-                            }
-                            toxin.IsSplitBy = food.IsThrownBy
-                            //Logf(LtDebug, "Food is thrown by %v\n", toxin.IsSplitBy)
-                            toxin.Velocity = Muls(NormalizeOrZero(food.Velocity), 100)
-
-                            delete(gameState.foods, foodId)
-                            eatenFoods = append(eatenFoods, foodId)
-
-                        }
-                    }
-                }
-                gameState.toxins[tId] = toxin
-
-                buffer.count = 0
-            }
-        }
-        endProfileEvent(profile)
+    content, err := json.MarshalIndent(audit, "", "    ")
+    if err != nil {
+        return err
     }
 
-    ////////////////////////////////////////////////////////////////
-    // BLOBS EATING BLOBS
-    ////////////////////////////////////////////////////////////////
-    {
-        startProfileEvent(profile, "Eating Blobs")
-        for botId1, bot1 := range gameState.bots {
-
-            var bot1Mass float32
-            for blobId1, blob1 := range gameState.bots[botId1].Blobs {
-                bot1Mass += blob1.Mass
-
-                for botId2, bot2 := range gameState.bots {
-                    if botId1 != botId2 {
-                        for blobId2, blob2 := range gameState.bots[botId2].Blobs {
-                            inRadius := DistFast(blob2.Position, blob1.Position) < blob1.Radius()*blob1.Radius()
-                            smaller := blob2.Mass < 0.9*blob1.Mass
-
-                            if smaller && inRadius {
-                                blob1.Mass = blob1.Mass + blob2.Mass
-
-                                bot1.StatisticsThisGame.BlobKillCount += 1
-
-                                if blob1.IsSplit {
-                                    bot1.StatisticsThisGame.SuccessfulSplit += 1
-                                }
-
-                                killedBlobs.insert(botId2, blobId2)
-
-                                delete(gameState.bots[botId2].Blobs, blobId2)
-
-                                // Completely delete this bot.
-                                if len(gameState.bots[botId2].Blobs) <= 0 {
-                                    deadBots = append(deadBots, NewBotKill(botId2, bot2))
-
-                                    bot1.StatisticsThisGame.BotKillCount += 1
+    filename := fmt.Sprintf("%vspawns_%v_%v.json", IntegrityDirectory, audit.Game, time.Now().Format("2006-01-02_15-04-05"))
+    return ioutil.WriteFile(filename, content, 0644)
+}
 
-                                    delete(gameState.bots, botId2)
-                                    break
-                                }
-                            }
-                        }
-                    }
-                }
+func readServerPassword() (bool, string) {
+    pw, err := ioutil.ReadFile(serverGuiPasswordFile)
+    if err != nil {
+        Logf(LtDebug, "Error while trying to load the password file %v. err: %v\n", serverGuiPasswordFile, err)
+        return false, ""
+    }
+    return true, strings.Trim(string(pw), "\n \t")
+}
 
-                gameState.bots[botId1].Blobs[blobId1] = blob1
-            }
+// Called by the http handlers, so it uses the copy of the update loop.
+func checkPassword(password string) bool {
+    return currentServerPassword() == password
+}
 
-            stats := bot1.StatisticsThisGame
-            stats.MaxSize = float32(math.Max(float64(stats.MaxSize), float64(bot1Mass)))
-            stats.MaxSurvivalTime += dt
+// A bot that leaves the lobby never was in the game. Only its connection is removed.
+func leaveLobby(botId BotId) {
+    app.sessions.end(botId)
+    app.middlewareConnections.Delete(botId)
+    delete(app.repositories, botId)
+}
 
-            bot1.StatisticsThisGame = stats
-            gameState.bots[botId1] = bot1
-        }
-        endProfileEvent(profile)
+// Creates the bot of a registration, if the game has room for it.
+func spawnBot(gameState *GameState, settings *ServerSettings, registration MiddlewareRegistration) {
+    if len(gameState.Bots) >= settings.MaxNumberOfBots {
+        return
+    }
+    bot, ok := CreateStartingBot(gameState, settings, registration.BotInfo, registration.Statistics)
+    if ok {
+        gameState.Bots[registration.BotId] = bot
+        app.repositories[registration.BotId] = registration.Repository
+    } else {
+        Logf(LtDebug, "Due to a spawn image with a 0 spawn rate, there is no possible spawn position for this bot.\n")
     }
-
-    return deadBots, eatenFoods, eatenToxins
 }
 
 func (app* Application) startUpdateLoop(gameState* GameState) {
@@ -1557,6 +668,9 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
 
     var lastMiddlewareStart = float32(0.0)
 
+    // The JSON guis only get the walls, when they connect or the walls change.
+    var guiWallsName = ""
+
     ////////////////////////////////////////////////////////////////
     // Functions
     ////////////////////////////////////////////////////////////////
@@ -1573,7 +687,7 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
     ////////////////////////////////////////////////////////////////
     for t := range ticker.C {
         profile := NewProfile()
-        startProfileEvent(&profile, "Step")
+        StartProfileEvent(&profile, "Step")
 
         if simulationStepCounter % 300 == 0 {
             Logf(LtDebug, "Frame %v\n", simulationStepCounter)
@@ -1587,6 +701,10 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
             app.middlewareConnections.Foreach(func(botId BotId, middlewareConnection MiddlewareConnection) {
                 middlewareConnection.StopServerNotification <- true
             })
+            if app.recorder != nil {
+                app.recorder.close()
+            }
+            writeIntegrityReports()
             return
         }
 
@@ -1607,18 +725,27 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
         lastTime = t
 
         if dt >= 0.03 { dt = 0.03 }
+        if app.deterministic { dt = FixedTimeStep }
 
-        gameFinished := app.gameMode && app.gameTime <= 0
+        // A replay must not touch the files, scripts or remote machines of the live server.
+        live := app.replay == nil
+
+        gameFinished := app.gameMode && gameState.GameTime <= 0
 
         if gameFinished {
             if !app.stopped {
                 LogfColored(LtDebug, LcGreen, "Game finished\n")
+                finishGame(gameState, live)
+                if live {
+                    rateGame()
+                    writeSpawnAudit(gameState)
+                }
             }
             app.stopped = true
 
         }
 
-        if app.gameMode && !app.stopped && len(gameState.bots) <= 4 {
+        if app.gameMode && !app.stopped && len(gameState.Bots) <= 4 {
             app.settings.BotsToStart = app.game.BotsToStart
             app.settings.BotCount = app.game.BotCount
         }
@@ -1626,53 +753,67 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
         ////////////////////////////////////////////////////////////////
         // Save statistics
         ////////////////////////////////////////////////////////////////
-        if simulationStepCounter % 300 == 0 || gameFinished {
-            for _,bot := range gameState.bots {
-                go WriteStatisticToFile(bot.Info.Name, bot.StatisticsThisGame)
+        if live && (simulationStepCounter % 300 == 0 || gameFinished) {
+            for botId, bot := range gameState.Bots {
+                if !app.builtinBots.isBuiltin(botId) {
+                    go WriteStatisticToFile(bot.Info.Name, bot.StatisticsThisGame)
+                }
             }
+            go writeIntegrityReports()
         }
         simulationStepCounter += 1
 
+        ////////////////////////////////////////////////////////////////
+        // COLLECT THE INPUT OF THIS STEP
+        ////////////////////////////////////////////////////////////////
+        var input TickInput
+        if live {
+            input = collectTickInput(dt)
+            app.builtinBots.collect(gameState, &app.settings, app.runningConfig.BuiltinBots, &input, simulationStepCounter)
+        } else {
+            var ok bool
+            if input, ok = app.replay.next(gameState); !ok {
+                // The replay is over. The last state stays visible for the guis.
+                app.stoppedMutex.Lock()
+                app.stopped = true
+                app.stoppedMutex.Unlock()
+                input = TickInput{ Dt: dt }
+            }
+        }
+        if app.recorder != nil {
+            app.recorder.record(gameState, input)
+        }
+        dt = input.Dt
+
         ////////////////////////////////////////////////////////////////
         // HANDLE EVENTS
         ////////////////////////////////////////////////////////////////
         botsKilledByServerGui := make([]BotKill, 0)
         foodsEatenByServerGui := make([]FoodId, 0)
         toxinsEatenByServerGui := make([]ToxinId, 0)
+        newGame := false
         {
-            setFoodSpawn := func(image string) {
-                app.settings.foodDistribution     = loadSpawnImage(app.settings.fieldSize, image, 10)
-                app.settings.foodDistributionName = image
-            }
-
-            setToxinSpawn := func(image string) {
-                app.settings.toxinDistribution     = loadSpawnImage(app.settings.fieldSize, image, 10)
-                app.settings.toxinDistributionName = image
-            }
-
-            setBotSpawn := func(image string) {
-                app.settings.botDistribution     = loadSpawnImage(app.settings.fieldSize, image, 10)
-                app.settings.botDistributionName = image
-            }
-
             killAllBots := func() {
-                for botId, bot := range gameState.bots {
-                    delete(gameState.bots, botId)
+                for _, botId := range SortedBotIds(gameState.Bots) {
+                    bot := gameState.Bots[botId]
+                    delete(gameState.Bots, botId)
                     botsKilledByServerGui = append(botsKilledByServerGui, NewBotKill(botId, bot))
                 }
             }
 
-            startProfileEvent(&profile, "Handle Events")
-            if len(app.serverCommands) > 0 {
-                for _, command := range app.serverCommands {
+            StartProfileEvent(&profile, "Handle Events")
+            if len(input.ServerCommands) > 0 {
+                for _, command := range input.ServerCommands {
                     switch command.Type {
                     case "BotCount":
                         app.settings.BotCount = command.Value
                     case "BotsToStart":
                         app.settings.BotsToStart = strings.Split(command.Bots, ",")
                     case "KillAllRemoteBots":
-                        Logf(LtDebug, "KILL ALL REMOTE BOTS\n")
-                        go RemoteKillBots()
+                        if live {
+                            Logf(LtDebug, "KILL ALL REMOTE BOTS\n")
+                            go RemoteKillBots()
+                        }
                     case "MinNumberOfBots":
                         app.settings.MinNumberOfBots = command.Value
                     case "MaxNumberOfBots":
@@ -1682,9 +823,19 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     case "MaxNumberOfToxins":
                         app.settings.MaxNumberOfToxins = command.Value
                     case "UpdateServer":
+                        if !live {
+                            break
+                        }
                         Logf(LtDebug, "Updating the server\n")
                         go startBashScript("./updateServer.sh")
                     case "RestartServer":
+                        if !live {
+                            break
+                        }
+                        if app.recorder != nil {
+                            app.recorder.close()
+                        }
+                        writeIntegrityReports()
                         Logf(LtDebug, "Updating the server\n")
                         go startBashScript("./updateServer.sh")
                         time.Sleep(2000 * time.Millisecond)
@@ -1696,6 +847,36 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                         time.Sleep(3000 * time.Millisecond)
                         Logf(LtDebug, "Sleep finished\n")
                         os.Exit(1)
+                    case "ReloadConfig":
+                        if command.Config != nil {
+                            // Recordings do not contain the password.
+                            password := app.runningConfig.Password
+                            app.runningConfig = *command.Config
+                            if !live {
+                                app.runningConfig.Password = password
+                            }
+                            app.settings.MinNumberOfBots = app.runningConfig.DummyBots
+                            setPhysics(app.settings.PhysicsName)
+                        }
+                    case "StartSimulation":
+                        // The simulation starts, when the countdown of the lobby is over.
+                        if app.lobby.Active {
+                            app.lobby.startCountdown(app.game)
+                            LogfColored(LtDebug, LcBlue, "Countdown started: %v bots wait in the lobby\n", len(app.lobby.Waiting))
+                            break
+                        }
+                        app.stoppedMutex.Lock()
+                        app.stopped = false
+                        app.stoppedMutex.Unlock()
+                        LogfColored(LtDebug, LcBlue, "Simulation is started!\n")
+                    case "StopSimulation":
+                        if app.lobby.Active {
+                            app.lobby.Countdown = -1
+                        }
+                        app.stoppedMutex.Lock()
+                        app.stopped = true
+                        app.stoppedMutex.Unlock()
+                        LogfColored(LtDebug, LcBlue, "Simulation is stopped!\n")
                     case "ToggleProfiling":
                         Logf(LtDebug, "Toggle Profiling\n");
                         app.profiling = !app.profiling
@@ -1705,63 +886,100 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     case "KillBotsWithoutConnection":
                         Logf(LtDebug, "The server does not support the command \"KillBotsWithoutConnection\" anylonger.\n")
                     case "KillBotsAboveMassThreshold":
-                        for botId, bot := range gameState.bots {
+                        for _, botId := range SortedBotIds(gameState.Bots) {
+                            bot := gameState.Bots[botId]
                             var mass float32 = 0
-                            for _, blob := range bot.Blobs {
-                                mass += blob.Mass
+                            for _, blobId := range SortedBlobIds(bot.Blobs) {
+                                mass += bot.Blobs[blobId].Mass
                             }
                             if mass > float32(command.Value) {
-                                delete(gameState.bots, botId)
+                                delete(gameState.Bots, botId)
                                 botsKilledByServerGui = append(botsKilledByServerGui, NewBotKill(botId, bot))
                             }
                         }
                         Logf(LtDebug, "Killed bots above mass threshold\n")
                     case "FoodSpawnImage":
-                        setFoodSpawn(command.Image)
+                        app.settings.SetFoodSpawn(command.Image)
                     case "ToxinSpawnImage":
-                        setToxinSpawn(command.Image)
+                        app.settings.SetToxinSpawn(command.Image)
                     case "BotSpawnImage":
-                        setBotSpawn(command.Image)
+                        app.settings.SetBotSpawn(command.Image)
+                    case "WallsImage":
+                        if err := app.settings.SetWalls(command.Image); err != nil {
+                            Logf(LtDebug, "The walls %v are rejected: %v\n", command.Image, err.Error())
+                        }
+                        LogfColored(LtDebug, LcGreen, "Walls: %v\n", app.settings.WallsName)
+                    case "PhysicsProfile":
+                        setPhysics(command.Profile)
+                        LogfColored(LtDebug, LcGreen, "Physics: %v\n", app.settings.PhysicsName)
                     case "GameMode":
                         app.gameMode = command.State
+                        // Without a game there is nothing to wait for.
+                        if !app.gameMode && app.lobby.Active {
+                            app.lobby.close(gameState, &app.settings)
+                        }
                         LogfColored(LtDebug, LcGreen, "GameMode: %v\n", app.gameMode)
                     case "GameName":
                         game := games[command.GameName]
+                        app.gameName = command.GameName
+                        // A tournament match only starts its own players.
+                        if command.Bots != "" {
+                            game.BotsToStart = strings.Split(command.Bots, ",")
+                        }
                         LogfColored(LtDebug, LcGreen, "Changing game to: %v\n", command.GameName)
 
-                        StartNewGame(command.GameName)
-
-                        go RemoteKillBots()
+                        if live {
+                            StartNewGame(command.GameName)
+                            go RemoteKillBots()
+                        }
                         killAllBots()
+                        for _, registration := range app.lobby.Waiting {
+                            leaveLobby(registration.BotId)
+                        }
+                        app.lobby.open()
 
                         LogfColored(LtDebug, LcGreen, "Bots killed: %v\n", botsKilledByServerGui)
 
                         app.game = game
+                        newGame = true
+                        gameState.Spawns = nil
 
                         app.gameMode = true
-                        app.gameTime = game.GameTime
+                        gameState.GameTime = game.GameTime
 
                         app.settings.MinNumberOfBots = 0
                         app.settings.MaxNumberOfFoods = game.Foods
                         app.settings.MaxNumberOfToxins = game.Toxins
                         app.settings.BotsToStart = game.BotsToStart
                         app.settings.BotCount = game.BotCount
-                        setFoodSpawn(game.FoodSpawn)
-                        setToxinSpawn(game.ToxinSpawn)
-                        setBotSpawn(game.BotSpawn)
+                        if game.MaxBots > 0 {
+                            app.settings.MaxNumberOfBots = game.MaxBots
+                        }
+                        app.settings.Teams = game.Teams
+                        app.settings.FriendlyFire = game.FriendlyFire
+                        app.settings.SetFieldSize(game.FieldSize)
+                        app.settings.SetFoodSpawn(game.FoodSpawn)
+                        app.settings.SetToxinSpawn(game.ToxinSpawn)
+                        app.settings.SetBotSpawn(game.BotSpawn)
+                        // The walls are checked against the spawn images of the game.
+                        if err := app.settings.SetWalls(game.Walls); err != nil {
+                            Logf(LtDebug, "The walls %v of the game are rejected: %v\n", game.Walls, err.Error())
+                            app.settings.SetWalls("")
+                        }
+                        setPhysics(game.Physics)
 
                         LogfColored(LtDebug, LcGreen, "BotsToStart: %v BotCount: %v\n", app.settings.BotsToStart, app.settings.BotCount)
 
                         LogfColored(LtDebug, LcGreen, "Settings changed\n")
 
-                        for foodId,_ := range gameState.foods {
+                        for _, foodId := range SortedFoodIds(gameState.Foods) {
                             foodsEatenByServerGui = append(foodsEatenByServerGui, foodId)
-                            delete(gameState.foods, foodId)
+                            delete(gameState.Foods, foodId)
                         }
 
-                        for toxinId, _ := range gameState.toxins {
+                        for _, toxinId := range SortedToxinIds(gameState.Toxins) {
                             toxinsEatenByServerGui = append(toxinsEatenByServerGui, toxinId)
-                            delete(gameState.toxins, toxinId)
+                            delete(gameState.Toxins, toxinId)
                         }
 
                         LogfColored(LtDebug, LcGreen, "Removed foods\n")
@@ -1773,18 +991,58 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
 
                         LogfColored(LtDebug, LcGreen, "Stopped\n")
 
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "MinNumberOfBots", Data: app.settings.MinNumberOfBots }
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "MaxNumberOfFoods", Data: app.settings.MaxNumberOfFoods }
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "MaxNumberOfToxins", Data: app.settings.MaxNumberOfToxins }
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "FoodSpawn", Data: app.settings.foodDistributionName }
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "ToxinSpawn", Data: app.settings.toxinDistributionName }
-                        app.messagesToServerGui <- ServerGuiCommand{ Type: "BotSpawn", Data: app.settings.botDistributionName }
+                        if live {
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "MinNumberOfBots", Data: app.settings.MinNumberOfBots }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "MaxNumberOfFoods", Data: app.settings.MaxNumberOfFoods }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "MaxNumberOfToxins", Data: app.settings.MaxNumberOfToxins }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "FoodSpawn", Data: app.settings.FoodDistributionName }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "ToxinSpawn", Data: app.settings.ToxinDistributionName }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "BotSpawn", Data: app.settings.BotDistributionName }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "PhysicsProfile", Data: app.settings.PhysicsName }
+                            app.messagesToServerGui <- ServerGuiCommand{ Type: "Walls", Data: app.settings.WallsName }
+                        }
+                    case "StartTournament":
+                        if !live {
+                            break
+                        }
+                        if app.tournament != nil {
+                            Logf(LtDebug, "The tournament %v is still running.\n", app.tournament.tournament.Name)
+                            break
+                        }
+                        runner, err := startTournament(command.Tournament)
+                        if err != nil {
+                            Logf(LtDebug, "Could not start the tournament \"%v\": %v\n", command.Tournament, err.Error())
+                            break
+                        }
+                        app.tournament = runner
+                    case "StopTournament":
+                        if !live || app.tournament == nil {
+                            break
+                        }
+                        // The table keeps the finished matches, so the tournament can be started again later.
+                        app.tournament.save()
+                        LogfColored(LtDebug, LcGreen, "Tournament %v stopped\n", app.tournament.tournament.Name)
+                        app.tournament = nil
                     }
                 }
+            }
+            updateApiStatus(gameState)
+            for _, command := range input.ServerCommands {
+                if command.done != nil {
+                    close(command.done)
+                }
+            }
+            EndProfileEvent(&profile)
+        }
 
-                app.serverCommands = make([]Command, 0)
+        ////////////////////////////////////////////////////////////////
+        // TOURNAMENT
+        ////////////////////////////////////////////////////////////////
+        if live && app.tournament != nil {
+            app.tournament.update(gameState, gameFinished, dt)
+            if app.tournament.isFinished() {
+                app.tournament = nil
             }
-            endProfileEvent(&profile)
         }
 
         ////////////////////////////////////////////////////////////////
@@ -1792,65 +1050,47 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
         ////////////////////////////////////////////////////////////////
         terminatedBots := make([]BotKill, 0, 10)
         {
-            startProfileEvent(&profile, "Read from Middleware")
-
-            startProfileEvent(&profile, "Process New Registrations")
-            ProcessNewRegistrations:
-            for {
-                select {
-                    case middlewareRegistration := <-app.middlewareRegistrations:
-                        if len(gameState.bots) < app.settings.MaxNumberOfBots {
-                            bot, ok := createStartingBot(gameState, middlewareRegistration.botInfo, middlewareRegistration.statistics)
-                            if ok {
-                                gameState.bots[middlewareRegistration.botId] = bot
-                            } else {
-                                Logf(LtDebug, "Due to a spawn image with a 0 spawn rate, there is no possible spawn position for this bot.\n")
-                            }
-                        }
-                    default:
-                        break ProcessNewRegistrations
+            StartProfileEvent(&profile, "Read from Middleware")
+
+            StartProfileEvent(&profile, "Process New Registrations")
+            for _, middlewareRegistration := range input.Registrations {
+                if !app.lobby.Active {
+                    spawnBot(gameState, &app.settings, middlewareRegistration)
+                } else if len(gameState.Bots) + len(app.lobby.Waiting) < app.settings.MaxNumberOfBots {
+                    app.lobby.Waiting = append(app.lobby.Waiting, middlewareRegistration)
+                    app.repositories[middlewareRegistration.BotId] = middlewareRegistration.Repository
                 }
             }
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
 
-            startProfileEvent(&profile, "Process New Commands")
-            ProcessingNewCommands:
-            for {
-                select {
-                case middlewareCommand := <-app.middlewareCommands:
-                    if bot, ok := gameState.bots[middlewareCommand.botId]; ok {
-                        bot.Command = middlewareCommand.botCommand
-                        gameState.bots[middlewareCommand.botId] = bot
-                    }
-                default:
-                    break ProcessingNewCommands
+            StartProfileEvent(&profile, "Process New Commands")
+            for _, middlewareCommand := range input.Commands {
+                if bot, ok := gameState.Bots[middlewareCommand.BotId]; ok {
+                    bot.Command = middlewareCommand.BotCommand
+                    gameState.Bots[middlewareCommand.BotId] = bot
                 }
             }
-            endProfileEvent(&profile)
-
-            startProfileEvent(&profile, "Process Terminations")
-            ProcessingTerminations:
-            for {
-                select {
-                case botId := <-app.middlewareTerminations:
-                    if bot, ok := gameState.bots[botId]; ok {
-                        delete(gameState.bots, botId)
-                        terminatedBots = append(terminatedBots, NewBotKill(botId, bot))
-                    }
-                default:
-                    break ProcessingTerminations
+            EndProfileEvent(&profile)
+
+            StartProfileEvent(&profile, "Process Terminations")
+            for _, botId := range input.Terminations {
+                if bot, ok := gameState.Bots[botId]; ok {
+                    delete(gameState.Bots, botId)
+                    terminatedBots = append(terminatedBots, NewBotKill(botId, bot))
+                } else if app.lobby.leave(botId) {
+                    leaveLobby(botId)
                 }
             }
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
 
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
         }
 
         ////////////////////////////////////////////////////////////////
         // START SPECIFIC REMOTE BOTS
         ////////////////////////////////////////////////////////////////
         {
-            startProfileEvent(&profile, "Add Interface Bot")
+            StartProfileEvent(&profile, "Add Interface Bot")
 
             if app.settings.BotCount > 0 {
                 Logf(LtDebug, "There are bots to start.\n")
@@ -1863,29 +1103,42 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     }
                 }
 
-                count := RemoteStartBots(finalSvnList, getServerAddress())
-                Logf(LtDebug, "Started remote bots: %v\n", count)
+                if live {
+                    count := RemoteStartBots(finalSvnList, getServerAddress())
+                    Logf(LtDebug, "Started remote bots: %v\n", count)
+                }
 
                 app.settings.BotsToStart = []string{}
                 app.settings.BotCount = 0
             }
 
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
         }
 
         ////////////////////////////////////////////////////////////////
         // ADD SOME MIDDLEWARES/BOTS IF NEEDED
         ////////////////////////////////////////////////////////////////
         {
-            startProfileEvent(&profile, "Add Dummy Bots")
-            if lastMiddlewareStart > 2 {
-                if len(gameState.bots) < app.settings.MinNumberOfBots {
+            StartProfileEvent(&profile, "Add Dummy Bots")
+            if live && lastMiddlewareStart > 2 && len(app.runningConfig.BuiltinBots) == 0 {
+                if len(gameState.Bots) < app.settings.MinNumberOfBots {
                     go startBashScript("./startMiddleware.sh")
                     lastMiddlewareStart = 0
                 }
             }
             lastMiddlewareStart += dt
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
+        }
+
+        ////////////////////////////////////////////////////////////////
+        // START THE GAME AFTER THE COUNTDOWN OF THE LOBBY
+        ////////////////////////////////////////////////////////////////
+        if app.lobby.update(dt) {
+            app.lobby.close(gameState, &app.settings)
+            app.stoppedMutex.Lock()
+            app.stopped = false
+            app.stoppedMutex.Unlock()
+            LogfColored(LtDebug, LcBlue, "Simulation is started!\n")
         }
 
         ////////////////////////////////////////////////////////////////
@@ -1899,122 +1152,85 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
         stopped :=  app.stopped
         app.stoppedMutex.Unlock()
         if !stopped {
-            deadBots, eatenFoods, eatenToxins = update(gameState, &app.settings, &app.ids, &profile, dt, simulationStepCounter)
+            deadBots, eatenFoods, eatenToxins = Update(gameState, &app.settings, &profile, dt, simulationStepCounter)
         }
         deadBots = append(deadBots, botsKilledByServerGui...)
         deadBots = append(deadBots, terminatedBots...)
 
+        // The bots of the last game do not count for the teams of the new one.
+        if newGame {
+            gameState.ResetTeams()
+        } else {
+            gameState.RecordDeadBots(&app.settings, deadBots)
+        }
+
         eatenFoods = append(eatenFoods, foodsEatenByServerGui...)
         eatenToxins = append(eatenToxins, toxinsEatenByServerGui...)
 
         ////////////////////////////////////////////////////////////////
-        // DELETE RANDOM TOXIN IF THERE ARE TOO MANY
+        // KEEP THE NUMBER OF FOODS AND TOXINS
         ////////////////////////////////////////////////////////////////
-        for toxinId,_ := range gameState.toxins {
-            if len(gameState.toxins) <= app.settings.MaxNumberOfToxins {
-                break;
-            }
-            eatenToxins = append(eatenToxins, toxinId)
-            delete(gameState.toxins, toxinId)
+        {
+            removedFoods, removedToxins := Replenish(gameState, &app.settings)
+            eatenFoods = append(eatenFoods, removedFoods...)
+            eatenToxins = append(eatenToxins, removedToxins...)
         }
 
         ////////////////////////////////////////////////////////////////
-        // DELETE RANDOM FOOD IF THERE ARE TOO MANY
+        // CHECK ANYTHING ON NaN VALUES
         ////////////////////////////////////////////////////////////////
-        for foodId,_ := range gameState.foods {
-            if len(gameState.foods) <= app.settings.MaxNumberOfFoods {
-                break;
-            }
-            eatenFoods = append(eatenFoods, foodId)
-            delete(gameState.foods, foodId)
-        }
+        CheckAllValuesOnNaN(gameState, "end")
 
         ////////////////////////////////////////////////////////////////
-        // POSSIBLY ADD A TOXIN
+        // WRITE STATISTICS FOR DEAD BOTS
         ////////////////////////////////////////////////////////////////
-        for len(gameState.toxins) < app.settings.MaxNumberOfToxins {
-            if pos, ok := newToxinPos(); ok {
-                newToxinId := app.ids.createToxinId()
-                gameState.toxins[newToxinId] = Toxin{true, false, pos, false, 0, toxinMassMin, RandomVec2()}
+        if live {
+            for _, botKill := range deadBots {
+                if !app.builtinBots.isBuiltin(botKill.BotId) {
+                    go WriteStatisticToFile(botKill.Name, botKill.StatisticsThisGame)
+                }
             }
         }
 
         ////////////////////////////////////////////////////////////////
-        // POSSIBLY ADD A FOOD
+        // RECORD THE RESULTS
         ////////////////////////////////////////////////////////////////
-        for len(gameState.foods) < app.settings.MaxNumberOfFoods {
-            mass := foodMassMin + rand.Float32() * (foodMassMax - foodMassMin)
-            if pos, ok := newFoodPos(); ok {
-                newFoodId := app.ids.createFoodId()
-                gameState.foods[newFoodId] = Food{ true, false, false, 0, mass, pos, RandomVec2() }
+        if newGame {
+            app.results = NewResultRecord()
+            app.gameOver = nil
+        } else if app.gameMode && app.gameOver == nil {
+            for _, botKill := range deadBots {
+                app.results.AddBot(playerOf(botKill.BotId, botKill.Name), app.repositories[botKill.BotId], 0, botKill.StatisticsThisGame, false)
             }
         }
 
-        ////////////////////////////////////////////////////////////////
-        // CHECK ANYTHING ON NaN VALUES
-        ////////////////////////////////////////////////////////////////
-        checkAllValuesOnNaN(gameState, "end")
-
-        ////////////////////////////////////////////////////////////////
-        // WRITE STATISTICS FOR DEAD BOTS
-        ////////////////////////////////////////////////////////////////
-        for _, botKill := range deadBots {
-            go WriteStatisticToFile(botKill.name, botKill.statisticsThisGame)
-        }
-
         ////////////////////////////////////////////////////////////////
         // REMOVE THE CONNECTIONS OF THE DEAD BOTS
         ////////////////////////////////////////////////////////////////
         for _, botKill := range deadBots {
-            app.middlewareConnections.Delete(botKill.botId)
+            app.sessions.end(botKill.BotId)
+            app.middlewareConnections.Delete(botKill.BotId)
+            delete(app.repositories, botKill.BotId)
         }
 
         ////////////////////////////////////////////////////////////////
         // PREPARE DATA TO BE SENT TO THE MIDDLEWARES
         ////////////////////////////////////////////////////////////////
         {
-            startProfileEvent(&profile, "Prepare data to be sent to the middlewares")
+            StartProfileEvent(&profile, "Prepare data to be sent to the middlewares")
             if simulationStepCounter % mwMessageEvery == 0 {
                 app.middlewareConnections.Foreach(func(botId BotId, middlewareConnection MiddlewareConnection) {
                     channel := middlewareConnection.MessageChannel
 
-                    bot, ok := gameState.bots[botId]
+                    wrapper, ok := MakeServerMiddlewareGameState(gameState, &app.settings, botId, simulationStepCounter)
+                    if !ok && app.lobby.isWaiting(botId) {
+                        wrapper, ok = app.lobby.message(&app.settings, gameState.GameTime, simulationStepCounter), true
+                    }
+                    if !app.gameMode {
+                        wrapper.GameTime = -1
+                    }
+                    wrapper.GameOver = app.gameOver
                     if (ok) {
-                        // Collecting other blobs
-                        var otherBlobs []ServerMiddlewareBlob
-                        for otherBotId, otherBot := range gameState.bots {
-                            if botId != otherBotId {
-                                for otherBlobId, otherBlob := range otherBot.Blobs {
-                                    if IsInViewWindow(bot.ViewWindow, otherBlob.Position, otherBlob.Radius()) {
-                                        otherBlobs = append(otherBlobs, makeServerMiddlewareBlob(otherBotId, otherBlobId, otherBot.TeamId, otherBlob))
-                                    }
-                                }
-                            }
-                        }
-
-                        // Collecting foods
-                        var foods []Food
-                        for _, food := range gameState.foods {
-                            if IsInViewWindow(bot.ViewWindow, food.Position, Radius(food.Mass)) {
-                                foods = append(foods, makeServerMiddlewareFood(food))
-                            }
-                        }
-
-                        // Collecting toxins
-                        var toxins []Toxin
-                        for _, toxin := range gameState.toxins {
-                            if IsInViewWindow(bot.ViewWindow, toxin.Position, Radius(toxin.Mass)) {
-                                toxins = append(toxins, makeServerMiddlewareToxin(toxin))
-                            }
-                        }
-
-                        var wrapper = ServerMiddlewareGameState{
-                            MyBlob:         makeServerMiddlewareBlobs(gameState, botId),
-                            OtherBlobs:     otherBlobs,
-                            Food:           foods,
-                            Toxin:          toxins,
-                        }
-
                         select {
                             case channel <- wrapper:
                             default: Logf(LtDebug, "NO MIDDLEWARE MESSAGE SENT: %v in channel.\n", len(channel))
@@ -2024,25 +1240,64 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     }
                 })
             }
-            endProfileEvent(&profile)
+            EndProfileEvent(&profile)
         }
 
         ////////////////////////////////////////////////////////////////
         // PREPARE DATA TO BE SENT TO THE GUIS
         ////////////////////////////////////////////////////////////////
         {
-            startProfileEvent(&profile, "Prepare data to be sent to the middlewares")
+            StartProfileEvent(&profile, "Prepare data to be sent to the middlewares")
+            teamTotals := TeamTotals(gameState, &app.settings)
+
+            var gameTime float32 = -1
+            if app.gameMode {
+                gameTime = float32(int(gameState.GameTime*100)) / 100
+            }
+
+            var standings []GameStanding
+            if app.gameOver != nil {
+                standings = app.gameOver.Standings
+            }
+
+            // All binary guis with the same camera get the same frame, so it is only encoded once.
+            // A camera without guis starts again with a keyframe.
+            cameras := app.guiConnections.BinaryCameras()
+            for camera := range app.guiStreams {
+                if !cameras[camera] {
+                    delete(app.guiStreams, camera)
+                }
+            }
+            frames := make(map[GuiCamera]*GuiFrame)
+            if simulationStepCounter % guiMessageEvery == 0 {
+                for camera := range cameras {
+                    stream, ok := app.guiStreams[camera]
+                    if !ok {
+                        stream = NewGuiCameraStream(camera)
+                        app.guiStreams[camera] = stream
+                    }
+                    frames[camera] = stream.Encode(gameState.Bots, gameState.Foods, gameState.Toxins, teamTotals, app.settings.Walls.Rects, gameTime, app.settings.FieldSize, standings)
+                }
+            }
+
             app.guiConnections.Foreach(func(index int, guiId GuiId, guiConnection GuiConnection) {
+                if guiConnection.Binary {
+                    if frame, ok := frames[guiConnection.Camera]; ok {
+                        select {
+                            case guiConnection.FrameChannel <- frame:
+                            default: Logf(LtDebug, "NO GUI FRAME SENT\n")
+                        }
+                    }
+                    return
+                }
+
                 channel := guiConnection.MessageChannel
                 message := NewServerGuiUpdateMessage()
+                message.GameTime = gameTime
+                message.FieldSize = app.settings.FieldSize
+                message.GameOver = app.gameOver
 
-                if app.gameMode {
-                    message.GameTime = float32(int(app.gameTime*100)) / 100
-                } else {
-                    message.GameTime = -1
-                }
-
-                for botId, bot := range gameState.bots {
+                for botId, bot := range gameState.Bots {
                     key := strconv.Itoa(int(botId))
                     if bot.GuiNeedsInfoUpdate || guiConnection.IsNewConnection {
                         message.CreatedOrUpdatedBotInfos[key] = bot.Info
@@ -2061,17 +1316,25 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     }
                 }
 
+                if simulationStepCounter % 10 == index || guiConnection.IsNewConnection {
+                    message.Teams = teamTotals
+                }
+
+                if app.settings.WallsName != guiWallsName || guiConnection.IsNewConnection {
+                    message.Walls = append([]Wall{}, app.settings.Walls.Rects...)
+                }
+
                 deadBotIds := make([]BotId, 0, 10)
                 for _, botKill := range deadBots {
-                    Logf(LtDebug, "Dead Bot: %v\n", botKill.botId)
-                    deadBotIds = append(deadBotIds, botKill.botId)
+                    Logf(LtDebug, "Dead Bot: %v\n", botKill.BotId)
+                    deadBotIds = append(deadBotIds, botKill.BotId)
                 }
 
                 message.DeletedBotInfos = deadBotIds
                 message.DeletedBots = deadBotIds
 
                 if simulationStepCounter % guiMessageEvery == 0 {
-                    for foodId, food := range gameState.foods {
+                    for foodId, food := range gameState.Foods {
                         if food.IsMoving || food.IsNew || guiConnection.IsNewConnection {
                             key := strconv.Itoa(int(foodId))
                             message.CreatedOrUpdatedFoods[key] = NewServerGuiFood(food)
@@ -2082,7 +1345,7 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                 message.DeletedFoods = eatenFoods
 
                 if simulationStepCounter % guiMessageEvery == 0 {
-                    for toxinId, toxin := range gameState.toxins {
+                    for toxinId, toxin := range gameState.Toxins {
                         if toxin.IsNew || toxin.IsMoving || guiConnection.IsNewConnection {
                             key := strconv.Itoa(int(toxinId))
                             message.CreatedOrUpdatedToxins[key] = NewServerGuiToxin(toxin)
@@ -2097,27 +1360,28 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
                     default: Logf(LtDebug, "NO GUI MESSAGE SENT\n")
                 }
             })
-            endProfileEvent(&profile)
+            guiWallsName = app.settings.WallsName
+            EndProfileEvent(&profile)
         }
 
         ////////////////////////////////////////////////////////////////
         // RESET UPDATE INDICATORS OF THE GAME OBJECTS
         ////////////////////////////////////////////////////////////////
-        for toxinId, toxin := range gameState.toxins {
+        for toxinId, toxin := range gameState.Toxins {
             if toxin.IsNew {
                 toxin.IsNew = false
-                gameState.toxins[toxinId] = toxin
+                gameState.Toxins[toxinId] = toxin
             }
         }
-        for foodId, food := range gameState.foods {
+        for foodId, food := range gameState.Foods {
             if food.IsNew {
                 food.IsNew = false
-                gameState.foods[foodId] = food
+                gameState.Foods[foodId] = food
             }
         }
-        for botId, bot := range gameState.bots {
+        for botId, bot := range gameState.Bots {
             bot.GuiNeedsInfoUpdate = false
-            gameState.bots[botId] = bot
+            gameState.Bots[botId] = bot
         }
 
         app.guiConnections.MakeAllOld()
@@ -2125,9 +1389,9 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
         ////////////////////////////////////////////////////////////////
         // RESETTING BOT COMMANDS
         ////////////////////////////////////////////////////////////////
-        for botId, bot := range gameState.bots {
-            bot.Command = BotCommand{ BatNone, bot.Command.Target }
-            gameState.bots[botId] = bot
+        for botId, bot := range gameState.Bots {
+            bot.Command = bot.Command.WithoutActions()
+            gameState.Bots[botId] = bot
         }
 
         ////////////////////////////////////////////////////////////////
@@ -2150,7 +1414,7 @@ func (app* Application) startUpdateLoop(gameState* GameState) {
             //app.messagesToServerGui <- events
         }
 
-        endProfileEvent(&profile)
+        EndProfileEvent(&profile)
     }
 }
 
@@ -2159,11 +1423,20 @@ func handleGui(ws *websocket.Conn) {
     LogfColored(LtDebug, LcYellow, "===> Got connection for Gui %v\n", guiId)
 
     messageChannel         := make(chan ServerGuiUpdateMessage, 1000)
+    frameChannel           := make(chan *GuiFrame, 120)
     stopServerNotification := make(chan bool, 1)
+    binary                 := ws.Request().URL.Query().Get("format") == "binary"
 
     sendingDone := make(chan bool, 1)
 
-    app.guiConnections.Add(guiId, GuiConnection{ ws, true, messageChannel, stopServerNotification })
+    app.guiConnections.Add(guiId, GuiConnection{
+        Connection:             ws,
+        IsNewConnection:        true,
+        MessageChannel:         messageChannel,
+        StopServerNotification: stopServerNotification,
+        Binary:                 binary,
+        FrameChannel:           frameChannel,
+    })
     defer func() {
         app.guiConnections.Delete(guiId)
         LogfColored(LtDebug, LcYellow, "<=== Gui connection (GuiId: %v): Connection was handled.\n", guiId)
@@ -2171,6 +1444,25 @@ func handleGui(ws *websocket.Conn) {
 
     wakeUpFromStandby()
 
+    ////////////////////////////////////////////////////////////////
+    // RECEIVING
+    ////////////////////////////////////////////////////////////////
+    // Binary guis can choose their camera. The go-routine ends, when the connection is closed.
+    go func() {
+        for {
+            var data []byte
+            if err := websocket.Message.Receive(ws, &data); err != nil {
+                return
+            }
+            camera, err := ParseGuiCamera(data)
+            if err != nil {
+                LogfColored(LtDebug, LcYellow, "<=== Gui connection (GuiId: %v): %v\n", guiId, err.Error())
+                continue
+            }
+            app.guiConnections.SetCamera(guiId, camera)
+        }
+    }()
+
     ////////////////////////////////////////////////////////////////
     // SENDING
     ////////////////////////////////////////////////////////////////
@@ -2181,6 +1473,11 @@ func handleGui(ws *websocket.Conn) {
             LogfColored(LtDebug, LcYellow, "<=== Gui connection (BotId: %v): Go-routine for sending messages is shutting down.\n", guiId)
         }()
 
+        if binary {
+            sendGuiFrames(ws, guiId, frameChannel)
+            return
+        }
+
         timeoutDuration := 5*time.Second
         timeout := time.NewTimer(timeoutDuration)
 
@@ -2238,42 +1535,48 @@ func handleGui(ws *websocket.Conn) {
     }
 }
 
-func createStartingBot(gameState *GameState, botInfo BotInfo, statistics Statistics) (Bot, bool) {
-    if pos, ok := newBotPos(gameState, &app.settings); ok {
-        blob := Blob {
-            Position:       pos,
-            Mass:           100.0,
-            VelocityFac:    1.0,
-            IsSplit:        false,
-            ReunionTime:    0.0,
-            IndividualTargetVec:      NullVec2(),
-        }
-        statisticNew := Statistics{
-            MaxSize:            100.0,
-            MaxSurvivalTime:    0.0,
-            BlobKillCount:      0,
-            BotKillCount:       0,
-            ToxinThrow:         0,
-            SuccessfulToxin:    0,
-            SplitCount:         0,
-            SuccessfulSplit:    0,
-            SuccessfulTeam:     0,
-            BadTeaming:         0,
-        }
+// Sends the deltas to a binary gui. The gui gets a keyframe first, whenever it has missed a frame
+// and after it has changed its camera.
+func sendGuiFrames(ws *websocket.Conn, guiId GuiId, frameChannel chan *GuiFrame) {
+    timeoutDuration := 5*time.Second
+    timeout := time.NewTimer(timeoutDuration)
+
+    var lastSequence uint32 = 0
+    var lastCamera GuiCamera
+    for {
+        select {
+            case frame, isOpen := <-frameChannel:
+                if !isOpen { return }
+
+                // A gui, that is behind, skips to the newest frame.
+                Consuming:
+                for {
+                    select {
+                        case newerFrame, isOpen := <-frameChannel:
+                            if !isOpen { return }
+                            frame = newerFrame
+                        default:
+                            break Consuming
+                    }
+                }
 
-        return Bot{
-            Info:                   botInfo,
-            TeamId:                 app.ids.createTeamId(gameState, botInfo.Name),
-            GuiNeedsInfoUpdate:     true,
-            ViewWindow:             ViewWindow{ Position: Vec2{0,0}, Size:Vec2{100,100} },
-            Blobs:                  map[BlobId]Blob{ 0: blob },
-            StatisticsThisGame:     statisticNew,
-            StatisticsOverall:      statistics,
-            Command:                BotCommand{ BatNone, RandomVec2(), },
-        }, true
-    }
+                data := frame.Delta
+                if lastSequence == 0 || frame.Sequence != lastSequence + 1 || frame.Camera != lastCamera {
+                    data = frame.Keyframe()
+                }
+                if err := websocket.Message.Send(ws, data); err != nil {
+                    LogfColored(LtDebug, LcYellow, "<=== Gui frame could not be sent because of: %v\n", err)
+                    return
+                }
+                lastSequence = frame.Sequence
+                lastCamera = frame.Camera
 
-    return Bot{}, false
+                timeout.Reset(timeoutDuration)
+            case <-timeout.C:
+                LogfColored(LtDebug, LcYellow, "<=== Gui connection (GuiId: %v): Timeout for Gui frames.\n", guiId)
+                return
+        }
+    }
 }
 
 func handleServerCommands(ws *websocket.Conn) {
@@ -2354,29 +1657,22 @@ func handleServerCommands(ws *websocket.Conn) {
             var command Command
             err := json.Unmarshal([]byte(message), &command)
             if err == nil {
-                switch command.Type {
-                    case "ReloadConfig":
-                        Logf(LtDebug, "Reloading Config!\n")
-                        conf, err := readConfig(runningConfFile)
-                        if err == nil {
-                            app.runningConfig = conf
-                            app.settings.MinNumberOfBots = app.runningConfig.DummyBots
-                        }
-                    case "StartSimulation":
-                        app.stoppedMutex.Lock()
-                        app.stopped = false
-                        app.stoppedMutex.Unlock()
-                        LogfColored(LtDebug, LcBlue, "Simulation is started!\n")
-                    case "StopSimulation":
-                        app.stoppedMutex.Lock()
-                        app.stopped = true
-                        app.stoppedMutex.Unlock()
-                        LogfColored(LtDebug, LcBlue, "Simulation is stopped!\n")
-                    default:
-                        app.serverCommandsMutex.Lock()
-                        app.serverCommands = append(app.serverCommands, command)
-                        app.serverCommandsMutex.Unlock()
+                if app.replay != nil {
+                    Logf(LtDebug, "Ignoring the server command %v, because a replay is running.\n", command.Type)
+                    continue
+                }
+
+                // All commands go through the update loop, so they are part of a recording.
+                if command.Type == "ReloadConfig" {
+                    Logf(LtDebug, "Reloading Config!\n")
+                    conf, err := readConfig(runningConfFile)
+                    if err != nil {
+                        continue
+                    }
+                    command.Config = &conf
                 }
+
+                queueServerCommand(command)
             } else {
                 if err != nil {
                     Logf(LtDebug, "Err: %v\n", err.Error())
@@ -2392,11 +1688,31 @@ func handleServerCommands(ws *websocket.Conn) {
 }
 
 func handleMiddleware(ws *websocket.Conn) {
+    if app.replay != nil {
+        LogfColored(LtDebug, LcYellow, "===> Refusing a middleware connection, because a replay is running.\n")
+        return
+    }
+
     var botId = app.ids.createBotId()
 
+    // A resumed session replaces the id, while the go-routine for sending is already running.
+    var botIdMutex sync.Mutex
+    currentBotId := func() BotId {
+        botIdMutex.Lock()
+        defer botIdMutex.Unlock()
+        return botId
+    }
+
     defer func() {
+        botId := currentBotId()
         app.middlewareConnections.Delete(botId)
-        app.middlewareTerminations <- botId
+        app.integrity.Unregister(botId)
+        terminate := func() {
+            app.middlewareTerminations <- botId
+        }
+        if !app.sessions.disconnect(botId, terminate) {
+            terminate()
+        }
         LogfColored(LtDebug, LcYellow, "<=== Middleware connection (BotId: %v): Connection was handled.\n", botId)
     }()
 
@@ -2416,8 +1732,8 @@ func handleMiddleware(ws *websocket.Conn) {
     go func() {
         defer func() {
             waiter.SendingDone()
-            app.middlewareConnections.Delete(botId)
-            LogfColored(LtDebug, LcYellow, "<=== Middleware connection (BotId: %v): Go-routine for sending messages is shutting down.\n", botId)
+            app.middlewareConnections.Delete(currentBotId())
+            LogfColored(LtDebug, LcYellow, "<=== Middleware connection (BotId: %v): Go-routine for sending messages is shutting down.\n", currentBotId())
         }()
 
         // This also means, that the bots have "timeoutDuration" to register themselves.
@@ -2440,7 +1756,7 @@ func handleMiddleware(ws *websocket.Conn) {
                                     break Consuming
                             }
                             if len(otherMessages) > 60 {
-                                LogfColored(LtDebug, LcYellow, "<=== More than 10 messages are in the Queue for middleware %v. So we just shut it down!\n", botId)
+                                LogfColored(LtDebug, LcYellow, "<=== More than 10 messages are in the Queue for middleware %v. So we just shut it down!\n", currentBotId())
                                 return
                             }
                         }
@@ -2450,7 +1766,7 @@ func handleMiddleware(ws *websocket.Conn) {
                         if len(otherMessages) == 0 {
                             err = websocket.JSON.Send(ws, message)
                         } else {
-                            LogfColored(LtDebug, LcYellow, "<=== Middleware %v skips one message, as it is not fast enough receiving the ones before...\n", botId)
+                            LogfColored(LtDebug, LcYellow, "<=== Middleware %v skips one message, as it is not fast enough receiving the ones before...\n", currentBotId())
                         }
 
                         if err != nil {
@@ -2467,7 +1783,7 @@ func handleMiddleware(ws *websocket.Conn) {
                         timeout.Reset(timeoutDuration)
                     }
                 case <-timeout.C:
-                    LogfColored(LtDebug, LcYellow, "<=== Middleware connection (BotId: %v): Timeout for Middleware messages.\n", botId)
+                    LogfColored(LtDebug, LcYellow, "<=== Middleware connection (BotId: %v): Timeout for Middleware messages.\n", currentBotId())
                     return
             }
         }
@@ -2495,19 +1811,60 @@ func handleMiddleware(ws *websocket.Conn) {
             switch (message.Type) {
                 case MmstBotCommand:
                     if message.BotCommand != nil {
-                        app.middlewareCommands <- MiddlewareCommand{
-                                                      botId:   botId,
-                                                      botCommand: *message.BotCommand,
-                                                  }
+                        botCommand := *message.BotCommand
+                        switch app.integrity.CheckCommand(botId, &botCommand) {
+                            case CvAccept:
+                                app.middlewareCommands <- MiddlewareCommand{
+                                                              BotId:      botId,
+                                                              BotCommand: botCommand,
+                                                          }
+                            case CvKick:
+                                LogfColored(LtDebug, LcRed, "KICKED. BotId=%v. The middleware floods the server with commands.\n", botId)
+                                app.sessions.end(botId)
+                                ws.Close()
+                                select {
+                                    case stopServerNotification <- true:
+                                    default:
+                                }
+                                return
+                        }
                     } else {
                         LogfColored(LtDebug, LcRed, "Got a dirty message from bot %v. BotCommand is nil.\n", botId)
                     }
+                case MmstLatencyReport:
+                    if message.Latency != nil {
+                        app.integrity.AddLatency(botId, *message.Latency)
+                    }
                 case MmstBotInfo:
-                    if message.BotInfo != nil {
+                    if message.Session != "" {
+                        resumedBotId, name, err := app.sessions.resume(message.Session)
+                        if err != nil {
+                            websocket.JSON.Send(ws, ServerMiddlewareRegistration{ Error: err.Error(), Retry: err == errSessionConnected })
+                            LogfColored(LtDebug, LcMagenta, "WRONG_SESSION. IP=\"%s\". %v\n", ws.Request().RemoteAddr, err.Error())
+                            return
+                        }
+
+                        botIdMutex.Lock()
+                        botId = resumedBotId
+                        botIdMutex.Unlock()
+
+                        websocket.JSON.Send(ws, ServerMiddlewareRegistration{ BotId: uint32(botId), Session: message.Session, GracePeriod: float32(sessionGracePeriod.Seconds()) })
+                        app.integrity.Register(botId, name)
+                        app.middlewareConnections.Add(botId, NewMiddlewareConnection(ws, messageChannel, standbyNotification, stopServerNotification, name != "dummy"))
+                        isRegistered = true
+
+                        wakeUpFromStandby()
+
+                        LogfColored(LtDebug, LcGreen, "RESUMED_BOT. NAME=\"%v\". BotId=%v. IP=\"%s\".\n", name, botId, ws.Request().RemoteAddr)
+                    } else if message.BotInfo != nil {
                         // Check, if a player with this name is actually allowed to play
                         // So we take the time to sort out old statistics from files here and not
                         // in the main game loop (so adding, say, 100 bots, doesn't affect the other, normal computations!)
-                        isAllowed, repository, statisticsOverall := CheckPotentialPlayer(message.BotInfo.Name, app.runningConfig.UpdateSVN)
+                        isAllowed, repository, statisticsOverall := CheckPotentialPlayer(message.BotInfo.Name, message.BotInfo.Token, app.runningConfig.UpdateSVN)
+
+                        // The token must not end up in the guis or in the replays.
+                        botInfo := *message.BotInfo
+                        botInfo.Token = ""
 
             var sourceIP string
             remoteAddr := ws.Request().RemoteAddr
@@ -2520,15 +1877,20 @@ func handleMiddleware(ws *websocket.Conn) {
                         myIP := getIP()
 
                         if message.BotInfo.Name == "dummy" && sourceIP != myIP && sourceIP != "localhost" && sourceIP != "127.0.0.1" && sourceIP != "::1" {
-                            isAllowed = false
                             LogfColored(LtDebug, LcRed, "FORBIDDEN. NAME=\"dummy\". IP=\"%s\".\n", sourceIP)
+                            return
                         }
 
                         if isAllowed {
+                            session := app.sessions.create(botId, message.BotInfo.Name)
+                            websocket.JSON.Send(ws, ServerMiddlewareRegistration{ BotId: uint32(botId), Session: session, GracePeriod: float32(sessionGracePeriod.Seconds()) })
+
+                            app.integrity.Register(botId, message.BotInfo.Name)
                             app.middlewareRegistrations <- MiddlewareRegistration{
-                                                               botId:       botId,
-                                                               botInfo:     *message.BotInfo,
-                                                               statistics:  statisticsOverall,
+                                                               BotId:       botId,
+                                                               BotInfo:     botInfo,
+                                                               Statistics:  statisticsOverall,
+                                                               Repository:  repository,
                                                        }
 
                             app.middlewareConnections.Add(botId, NewMiddlewareConnection(ws, messageChannel, standbyNotification, stopServerNotification, message.BotInfo.Name != "dummy"))
@@ -2537,7 +1899,12 @@ func handleMiddleware(ws *websocket.Conn) {
                             wakeUpFromStandby()
 
                             LogfColored(LtDebug, LcGreen, "NEW_BOT. NAME=\"%v\". SVN=\"%v\". IP=\"%s\".\n", message.BotInfo.Name, repository, sourceIP)
+                        } else if repository != "" {
+                            websocket.JSON.Send(ws, ServerMiddlewareRegistration{ Error: "The token is wrong." })
+                            LogfColored(LtDebug, LcMagenta, "WRONG_TOKEN. NAME=\"%v\". SVN=\"%v\". IP=\"%s\".\n", message.BotInfo.Name, repository, sourceIP)
+                            return
                         } else {
+                            websocket.JSON.Send(ws, ServerMiddlewareRegistration{ Error: "The name is not in the bot.names of any repository." })
                             LogfColored(LtDebug, LcMagenta, "WRONG_NAME. NAME=\"%v\". IP=\"%s\".\n", message.BotInfo.Name, sourceIP)
                             return
                         }
@@ -2557,53 +1924,6 @@ func handleMiddleware(ws *websocket.Conn) {
     }
 }
 
-func loadSpawnImage(fieldSize Vec2, imageName string, shadesOfGray int) []Vec2 {
-    var filename = makeLocalSpawnName(imageName)
-
-    var distributionArray []Vec2
-    fImg, err1 := os.Open(filename)
-    image, err2 := bmp.Decode(fImg)
-    if err1 != nil || err2 != nil {
-        Logf(LtDebug, "Error while trying to load image %v. err1: %v and err2: %v\n", filename, err1, err2)
-        return distributionArray
-    }
-
-    rgbToGrayscale := func(r, g, b uint32) uint8 {
-        y := (299*r + 587*g + 114*b + 500) / 1000
-        return uint8(y >> 8)
-    }
-
-    for x := image.Bounds().Min.X; x < image.Bounds().Max.X; x++ {
-        for y := image.Bounds().Min.Y; y < image.Bounds().Max.Y; y++ {
-            r, g, b, _ := image.At(x,y).RGBA()
-            gray := (255 - float32(rgbToGrayscale(r,g,b))) / 255.0
-
-            arrayCount := int(gray * float32(shadesOfGray))
-
-            for i := 0; i < arrayCount; i++ {
-                minX := (x-1) * (int(fieldSize.X) / image.Bounds().Max.X)
-                maxX :=  x    * (int(fieldSize.X) / image.Bounds().Max.X)
-                if x == 0 {
-                    minX = maxX
-                }
-                minY := (y-1) * (int(fieldSize.Y) / image.Bounds().Max.Y)
-                maxY :=  y    * (int(fieldSize.Y) / image.Bounds().Max.Y)
-                if y == 0 {
-                    minY = maxY
-                }
-
-                // We make this calculation so the position is random but bounded by our 100x100 picture.
-                // So we have actually 10x10 radius (fieldsize == 1000) to set the food or bot...
-                pos := Vec2{float32(rand.Intn(maxX-minX+1)+minX), float32(rand.Intn(maxY-minY+1)+minY)}
-                distributionArray = append(distributionArray, pos)
-            }
-
-        }
-    }
-
-    return distributionArray
-}
-
 func getServerAddress() string {
     content, err := ioutil.ReadFile("../pwb.conf")
     if err != nil {
@@ -2635,12 +1955,7 @@ func handleServerControlFinal(w http.ResponseWriter, r *http.Request) {
     Logf(LtDebug, "Request for Password: %v\n", r.PostFormValue("Password"))
 
     if checkPassword(r.PostFormValue("Password")) {
-        entries, _ := ioutil.ReadDir("../Public/spawns")
-        for _, entry := range entries {
-            if filepath.Ext(makeLocalSpawnName(entry.Name())) == ".bmp" {
-                imageNames = append(imageNames, entry.Name())
-            }
-        }
+        imageNames = spawnImageNames()
 
         gameNames := make([]string, len(games))
         for gameName := range games {
@@ -2654,6 +1969,10 @@ func handleServerControlFinal(w http.ResponseWriter, r *http.Request) {
             ToxinSpawnImage     string
             BotSpawnImage       string
             GameNames           []string
+            TournamentNames     []string
+            PhysicsNames        []string
+            PhysicsProfile      string
+            WallsImage          string
             MinNumberOfBots     int
             MaxNumberOfBots     int
             MaxNumberOfFoods    int
@@ -2661,10 +1980,14 @@ func handleServerControlFinal(w http.ResponseWriter, r *http.Request) {
         }{
             Address:            "ws://" + getServerAddress() + "/servercommand/",
             ImageNames:         imageNames,
-            FoodSpawnImage:     makeURLSpawnName(app.settings.foodDistributionName),
-            ToxinSpawnImage:    makeURLSpawnName(app.settings.toxinDistributionName),
-            BotSpawnImage:      makeURLSpawnName(app.settings.botDistributionName),
+            FoodSpawnImage:     makeURLSpawnName(app.settings.FoodDistributionName),
+            ToxinSpawnImage:    makeURLSpawnName(app.settings.ToxinDistributionName),
+            BotSpawnImage:      makeURLSpawnName(app.settings.BotDistributionName),
             GameNames:          gameNames,
+            TournamentNames:    TournamentNames(),
+            PhysicsNames:       PhysicsNames(),
+            PhysicsProfile:     app.settings.PhysicsName,
+            WallsImage:         app.settings.WallsName,
             MinNumberOfBots:    app.settings.MinNumberOfBots,
             MaxNumberOfBots:    app.settings.MaxNumberOfBots,
             MaxNumberOfFoods:   app.settings.MaxNumberOfFoods,
@@ -2695,6 +2018,10 @@ func handleStatistics(w http.ResponseWriter, r *http.Request) {
     }
 
     for _, file := range files {
+        // The ratings have their own directory in there.
+        if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+            continue
+        }
         Logf(LtDebug, "%v\n", file.Name())
         svnPlayerData, err := LoadSvnPlayerData(statisticsDirectory + file.Name())
         if err != nil {
@@ -2704,10 +2031,17 @@ func handleStatistics(w http.ResponseWriter, r *http.Request) {
         }
     }
 
+    ratings, err := LoadRatings()
+    if err != nil {
+        Logf(LtDebug, "Could not read the ratings: %v\n", err.Error())
+    }
+
     data := struct{
         Games Games
+        Ranking []Rating
     }{
         Games: games,
+        Ranking: ratings.Ranking(),
     }
     t.Execute(w, data)
 }
@@ -2776,6 +2110,13 @@ func readConfig(configfile string) (RunningConfig, error) {
 func main() {
     runtime.GOMAXPROCS(32)
 
+    var seedFlag          = flag.Int64("seed", 0, "Seed for the simulation. 0 takes the current time.")
+    var deterministicFlag = flag.Bool("deterministic", false, "Simulate with a fixed time step, so a seed and the same bot commands reproduce a match.")
+    var recordFlag        = flag.Bool("record", false, "Record every game into the replay directory.")
+    var replayFlag        = flag.String("replay", "", "Play the given replay file to the guis instead of running a live game.")
+    var replayFromFlag    = flag.Int("replayFrom", 0, "Start the replay at the first keyframe from this step on.")
+    flag.Parse()
+
     SetLoggingDebug(true)
     SetLoggingVerbose(false)
 
@@ -2783,7 +2124,12 @@ func main() {
 
     readGames()
 
-    app.initialize()
+    seed := *seedFlag
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+    app.initialize(seed, *deterministicFlag)
+    LogfColored(LtDebug, LcGreen, "Simulation seed: %v (deterministic: %v)\n", app.seed, app.deterministic)
 
     var err error = nil
     app.runningConfig, err = readConfig(runningConfFile)
@@ -2793,18 +2139,37 @@ func main() {
         app.runningConfig = RunningConfig{
                 UpdateSVN:  true,
                 DummyBots:  8,
+                BuiltinBots: defaultBuiltinBots,
                 Password:   pw,
-                MassLoss:   float64(massLossFactor),
+                MassLoss:   DefaultPhysics().MassLoss,
             }
     }
     app.settings.MinNumberOfBots = app.runningConfig.DummyBots
+    setPhysics("")
+
+    if *replayFlag != "" {
+        app.replay, err = OpenReplay(*replayFlag, *replayFromFlag)
+        if err != nil {
+            log.Fatal("Could not open the replay: ", err)
+        }
+    }
+
+    if app.replay == nil {
+        if app.ratings, err = LoadRatings(); err != nil {
+            Logf(LtDebug, "Could not load the ratings: %v\n", err.Error())
+        }
+        InitOrganisation()
+        StartNewGame("initialGame")
+        InitRemoteDistribution()
+        UpdateAllSVN(app.runningConfig.UpdateSVN, true)
 
-    InitOrganisation()
-    StartNewGame("initialGame")
-    InitRemoteDistribution()
-    UpdateAllSVN(app.runningConfig.UpdateSVN, true)
+        if *recordFlag {
+            app.recorder = NewRecorder("initialGame")
+        }
+    }
 
-    gameState := NewGameState(app.settings)
+    gameState := NewGameState(app.settings, app.random)
+    updateApiStatus(&gameState)
     go app.startUpdateLoop(&gameState)
 
     // HTML sites
@@ -2814,6 +2179,9 @@ func main() {
     http.HandleFunc("/server2/", handleServerControlFinal)
     http.HandleFunc("/stats/", handleStatistics)
 
+    // Admin API
+    http.HandleFunc(apiPrefix, handleApi)
+
     // Websocket connections
 
     // LEAVE THIS HERE. The handleGui call must stay like this!
@@ -0,0 +1,132 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "sync"
+    "time"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Sessions
+//
+////////////////////////////////////////////////////////////////////////
+
+// Every registered middleware gets a session. When its connection drops, the
+// bot stays in the game with its last command for sessionGracePeriod. The
+// middleware can resume the session with a new connection during that time
+// and keeps its BotId. Otherwise the bot is terminated as before.
+
+const (
+    sessionGracePeriod = 10 * time.Second
+)
+
+var (
+    errSessionUnknown   = errors.New("The session is unknown or has expired.")
+    // The middleware noticed the drop before the server did. It can try again.
+    errSessionConnected = errors.New("The session is still connected.")
+)
+
+type Session struct {
+    token           string
+    botId           BotId
+    name            string
+    connected       bool
+    // Counts the connections, so an old grace timer does not end a resumed session.
+    connection      int
+}
+
+type Sessions struct {
+    mutex           sync.Mutex
+    byToken         map[string]*Session
+    byBotId         map[BotId]*Session
+}
+
+func NewSessions() Sessions {
+    return Sessions{
+        byToken:    make(map[string]*Session),
+        byBotId:    make(map[BotId]*Session),
+    }
+}
+
+func createSessionToken() string {
+    bytes := make([]byte, 16)
+    if _, err := rand.Read(bytes); err != nil {
+        Logf(LtDebug, "Could not create a random session token: %v\n", err.Error())
+    }
+    return hex.EncodeToString(bytes)
+}
+
+func (sessions *Sessions) create(botId BotId, name string) string {
+    sessions.mutex.Lock()
+    defer sessions.mutex.Unlock()
+
+    session := &Session{ token: createSessionToken(), botId: botId, name: name, connected: true }
+    sessions.byToken[session.token] = session
+    sessions.byBotId[botId] = session
+    return session.token
+}
+
+// Only a session, whose connection has dropped, can be resumed.
+func (sessions *Sessions) resume(token string) (BotId, string, error) {
+    sessions.mutex.Lock()
+    defer sessions.mutex.Unlock()
+
+    session, ok := sessions.byToken[token]
+    if !ok {
+        return 0, "", errSessionUnknown
+    }
+    if session.connected {
+        return 0, "", errSessionConnected
+    }
+    session.connected = true
+    session.connection += 1
+    return session.botId, session.name, nil
+}
+
+// Returns false, if the bot has no session and has to be terminated right away.
+func (sessions *Sessions) disconnect(botId BotId, terminate func()) bool {
+    sessions.mutex.Lock()
+    defer sessions.mutex.Unlock()
+
+    session, ok := sessions.byBotId[botId]
+    if !ok {
+        return false
+    }
+    session.connected = false
+    connection := session.connection
+
+    time.AfterFunc(sessionGracePeriod, func() {
+        sessions.mutex.Lock()
+        expired := !session.connected && session.connection == connection && sessions.byBotId[botId] == session
+        if expired {
+            sessions.remove(session)
+        }
+        sessions.mutex.Unlock()
+
+        if expired {
+            LogfColored(LtDebug, LcYellow, "<=== Session of bot %v expired.\n", botId)
+            terminate()
+        }
+    })
+    return true
+}
+
+// Dead and kicked bots can not come back.
+func (sessions *Sessions) end(botId BotId) {
+    sessions.mutex.Lock()
+    defer sessions.mutex.Unlock()
+
+    if session, ok := sessions.byBotId[botId]; ok {
+        sessions.remove(session)
+    }
+}
+
+func (sessions *Sessions) remove(session *Session) {
+    delete(sessions.byToken, session.token)
+    delete(sessions.byBotId, session.botId)
+}
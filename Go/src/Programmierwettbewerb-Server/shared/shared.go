@@ -35,11 +35,42 @@ type MessageMiddlewareServerType int
 const (
     MmstBotInfo         MessageMiddlewareServerType = iota
     MmstBotCommand
+    MmstLatencyReport
 )
 
+// Steers a single blob of a bot.
+type BlobCommand struct {
+    BlobId  BlobId
+    Action  BotActionType
+    Target  Vec2
+}
+
+// The Action and Target are used for all blobs that have no own BlobCommand.
 type BotCommand struct {
     Action  BotActionType
     Target  Vec2
+    Blobs   []BlobCommand   `json:",omitempty"`
+}
+
+func (command BotCommand) ForBlob(blobId BlobId) (BotActionType, Vec2) {
+    for _, blobCommand := range command.Blobs {
+        if blobCommand.BlobId == blobId {
+            return blobCommand.Action, blobCommand.Target
+        }
+    }
+    return command.Action, command.Target
+}
+
+// The actions are only done once, the targets are kept until the next command arrives.
+func (command BotCommand) WithoutActions() BotCommand {
+    blobs := make([]BlobCommand, len(command.Blobs))
+    for i, blobCommand := range command.Blobs {
+        blobs[i] = BlobCommand{ BlobId: blobCommand.BlobId, Action: BatNone, Target: blobCommand.Target }
+    }
+    if len(blobs) == 0 {
+        blobs = nil
+    }
+    return BotCommand{ Action: BatNone, Target: command.Target, Blobs: blobs }
 }
 
 type Statistics struct {
@@ -70,12 +101,29 @@ type BotInfo struct {
     Name        string  `json:"name"`
     Color       Color   `json:"color"`
     ImagePath   string  `json:"image"` // This is not used right now.
+    // The secret of the repository. The server removes it after the registration.
+    Token       string  `json:"token,omitempty"`
 }
 
 type MessageMiddlewareServer struct {
     Type                MessageMiddlewareServerType
     BotCommand          *BotCommand
     BotInfo             *BotInfo
+    Latency             *LatencyHistogram   `json:",omitempty"`
+    // Set instead of the token to resume a session after the connection dropped.
+    Session             string              `json:",omitempty"`
+}
+
+// The answer of the server to a registration.
+type ServerMiddlewareRegistration struct {
+    BotId       uint32      `json:"botId"`
+    // Empty if the registration failed.
+    Session     string      `json:"session"`
+    // Seconds the server keeps the bot alive without a connection.
+    GracePeriod float32     `json:"gracePeriod"`
+    Error       string      `json:"error"`
+    // The registration can be tried again.
+    Retry       bool        `json:"retry"`
 }
 
 type Food struct {
@@ -105,13 +153,170 @@ type ServerMiddlewareBlob struct {
     Index       uint32      `json:"index"`
     Position    Vec2        `json:"pos"`
     Mass        uint32      `json:"mass"`
+    // Units per second in the last step.
+    Velocity    Vec2        `json:"velocity"`
+    // Only set for the own blobs. A split blob can reunite with the others when the time is over.
+    IsSplit     bool        `json:"isSplit"`
+    ReunionTime float32     `json:"reunionTime"`
+}
+
+type ServerMiddlewareFood struct {
+    Position    Vec2        `json:"pos"`
+    Mass        float32     `json:"mass"`
+    // Units per second. Only thrown foods move.
+    Velocity    Vec2        `json:"velocity"`
+}
+
+type ServerMiddlewareToxin struct {
+    Position    Vec2        `json:"pos"`
+    Mass        float32     `json:"mass"`
+    // Units per second. Only shot toxins move.
+    Velocity    Vec2        `json:"velocity"`
+}
+
+type ServerMiddlewareViewWindow struct {
+    Position    Vec2        `json:"pos"`
+    Size        Vec2        `json:"size"`
+}
+
+// A solid rectangle of the map. Blobs, food and toxins cannot pass it.
+type Wall struct {
+    Position    Vec2        `json:"pos"`
+    Size        Vec2        `json:"size"`
 }
 
 type ServerMiddlewareGameState struct {
-    MyBlob      []ServerMiddlewareBlob  `json:"myBlobs"`
-    OtherBlobs  []ServerMiddlewareBlob  `json:"otherBlobs"`
-    Food        []Food                  `json:"food"`
-    Toxin       []Toxin                 `json:"toxin"`
+    MyBlob      []ServerMiddlewareBlob      `json:"myBlobs"`
+    OtherBlobs  []ServerMiddlewareBlob      `json:"otherBlobs"`
+    Food        []ServerMiddlewareFood      `json:"food"`
+    Toxin       []ServerMiddlewareToxin     `json:"toxin"`
+    // The walls that reach into the view window.
+    Walls       []Wall                      `json:"walls"`
+    // Only the things inside of the view window are sent.
+    ViewWindow  ServerMiddlewareViewWindow  `json:"viewWindow"`
+    FieldSize   Vec2                        `json:"fieldSize"`
+    // Seconds until the end of the game, -1 if no game with a time limit is running.
+    GameTime    float32                     `json:"gameTime"`
+    // The number of the simulation step.
+    Tick        int                         `json:"tick"`
+    // True while the bot waits in the lobby for the start of the game. It has no blobs then.
+    Lobby       bool                        `json:"lobby"`
+    // Seconds until the game starts, -1 while the start is not planned yet. 0 outside of the lobby.
+    Countdown   float32                     `json:"countdown"`
+    // The final ranking, only set after the time of the game is over.
+    GameOver    *GameOver                   `json:"gameOver,omitempty"`
+}
+
+// -------------------------------------------------------------------------------------------------
+// Results
+// -------------------------------------------------------------------------------------------------
+
+// The place of a player at the end of a game. A player is a team in the team mode,
+// otherwise the repository of the bots or the name of a bot without one.
+type GameStanding struct {
+    // 1 is the winner. Equal players share a place.
+    Place           int         `json:"place"`
+    Player          string      `json:"player"`
+    // The value, that the scoring rule of the game takes.
+    Score           float32     `json:"score"`
+    // The mass of the bots that are alive at the end.
+    Mass            float32     `json:"mass"`
+    MaxMass         float32     `json:"maxMass"`
+    // The bots killed completely.
+    Kills           int         `json:"kills"`
+    SurvivalTime    float32     `json:"survivalTime"`
+    // The bots of the player that are alive at the end.
+    Alive           int         `json:"alive"`
+}
+
+// Sent to the bots and guis, when the time of a game is over.
+type GameOver struct {
+    Game        string          `json:"game"`
+    Scoring     string          `json:"scoring"`
+    // The players on the first place.
+    Winners     []string        `json:"winners"`
+    Standings   []GameStanding  `json:"standings"`
+}
+
+// -------------------------------------------------------------------------------------------------
+// Latency
+// -------------------------------------------------------------------------------------------------
+
+// The upper bounds of the latency buckets. The last bucket has no upper bound.
+var LatencyBucketBounds = [...]time.Duration{
+    5 * time.Millisecond,
+    10 * time.Millisecond,
+    20 * time.Millisecond,
+    50 * time.Millisecond,
+    100 * time.Millisecond,
+    200 * time.Millisecond,
+    500 * time.Millisecond,
+}
+
+// How long a bot needed to answer the game states. The middleware sends it
+// to the server from time to time.
+type LatencyHistogram struct {
+    Buckets     [len(LatencyBucketBounds) + 1]int   `json:"buckets"`
+    Answers     int                                 `json:"answers"`
+    // Answers that came after the deadline.
+    Late        int                                 `json:"late"`
+    // Game states without an answer before the deadline.
+    Missed      int                                 `json:"missed"`
+    TotalMs     float64                             `json:"totalMs"`
+    MaxMs       float64                             `json:"maxMs"`
+}
+
+func (histogram *LatencyHistogram) Add(latency time.Duration, late bool) {
+    bucket := len(LatencyBucketBounds)
+    for i, bound := range LatencyBucketBounds {
+        if latency < bound {
+            bucket = i
+            break
+        }
+    }
+    histogram.Buckets[bucket] += 1
+    histogram.Answers += 1
+    if late {
+        histogram.Late += 1
+    }
+
+    ms := latency.Seconds() * 1000
+    histogram.TotalMs += ms
+    if ms > histogram.MaxMs {
+        histogram.MaxMs = ms
+    }
+}
+
+func (histogram *LatencyHistogram) Merge(other LatencyHistogram) {
+    for i, count := range other.Buckets {
+        histogram.Buckets[i] += count
+    }
+    histogram.Answers += other.Answers
+    histogram.Late += other.Late
+    histogram.Missed += other.Missed
+    histogram.TotalMs += other.TotalMs
+    if other.MaxMs > histogram.MaxMs {
+        histogram.MaxMs = other.MaxMs
+    }
+}
+
+func (histogram LatencyHistogram) MeanMs() float64 {
+    if histogram.Answers == 0 {
+        return 0
+    }
+    return histogram.TotalMs / float64(histogram.Answers)
+}
+
+func (histogram LatencyHistogram) String() string {
+    str := fmt.Sprintf("%v answers, mean %.1fms, max %.1fms, %v late, %v missed |", histogram.Answers, histogram.MeanMs(), histogram.MaxMs, histogram.Late, histogram.Missed)
+    for i, count := range histogram.Buckets {
+        if i < len(LatencyBucketBounds) {
+            str += fmt.Sprintf(" <%v: %v", LatencyBucketBounds[i], count)
+        } else {
+            str += fmt.Sprintf(" >=%v: %v", LatencyBucketBounds[i - 1], count)
+        }
+    }
+    return str
 }
 
 // -------------------------------------------------------------------------------------------------
@@ -188,7 +393,7 @@ func log(f LogFun, logType LogType, format string, a ...interface{}) (n int, err
             lineString = fmt.Sprintf(" %s", lineString)
         }
         str := fmt.Sprintf("%s Line:%s |  ", time.Now().Format("02 Jan 15:04:05"), lineString)
-        fmt.Printf(str)
+        fmt.Print(str)
     }
     return f(format, a...)
 }
@@ -0,0 +1,92 @@
+package simulation
+
+import (
+    "fmt"
+    "encoding/json"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Physics
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    PhysicsDirectory = "../Physics/"
+)
+
+// The rules of the game. A physics profile in PhysicsDirectory overrides
+// some of these values, everything it does not mention keeps its default.
+type Physics struct {
+    FoodMassMin                 float32
+    FoodMassMax                 float32
+    ThrownFoodMass              float32
+    MassToBeAllowedToThrow      float32
+    BotMinMass                  float32
+    BotMaxMass                  float32
+    BlobReunionTime             float32
+    BlobSplitMass               float32
+    BlobSplitVelocity           float32
+    BlobMinSpeedFactor          float32
+    ToxinMassMin                float32
+    ToxinMassMax                float32
+    MassLoss                    float64
+    MinBlobMassToExplode        float32
+    MaxBlobCountToExplode       int
+    MinBlobMass                 float32
+    VelocityDecreaseFactor      float32
+}
+
+func DefaultPhysics() Physics {
+    return Physics{
+        FoodMassMin:                1,
+        FoodMassMax:                3,
+        ThrownFoodMass:             10,
+        MassToBeAllowedToThrow:     100,
+        BotMinMass:                 10,
+        BotMaxMass:                 10000.0,
+        BlobReunionTime:            10.0,
+        BlobSplitMass:              100.0,
+        BlobSplitVelocity:          1.5,
+        BlobMinSpeedFactor:         0.225,
+        ToxinMassMin:               50,
+        ToxinMassMax:               69,
+        MassLoss:                   20.0,
+        MinBlobMassToExplode:       400.0,
+        MaxBlobCountToExplode:      10,
+        MinBlobMass:                10,
+        VelocityDecreaseFactor:     0.95,
+    }
+}
+
+func MakeLocalPhysicsName(name string) string {
+    return fmt.Sprintf("%v%v.json", PhysicsDirectory, name)
+}
+
+// Applies the profile with the given name on top of base.
+func LoadPhysics(base Physics, name string) (Physics, error) {
+    file, err := ioutil.ReadFile(MakeLocalPhysicsName(name))
+    if err != nil {
+        return base, err
+    }
+
+    physics := base
+    if err := json.Unmarshal(file, &physics); err != nil {
+        return base, err
+    }
+    return physics, nil
+}
+
+func PhysicsNames() []string {
+    var names []string
+    entries, _ := ioutil.ReadDir(PhysicsDirectory)
+    for _, entry := range entries {
+        if filepath.Ext(entry.Name()) == ".json" {
+            names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+        }
+    }
+    return names
+}
@@ -0,0 +1,1720 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/data"
+    . "Programmierwettbewerb-Server/connections"
+
+    "fmt"
+    "math"
+    "math/rand"
+    "time"
+    "os"
+    "encoding/json"
+    "io/ioutil"
+    "golang.org/x/image/bmp"
+    "sort"
+    "strconv"
+    "hash/crc32"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    windowMin = 100
+    windowMax = 400
+
+    defaultGameTime = 300.0
+
+    // The time step that is used instead of the measured one in deterministic mode.
+    FixedTimeStep = 0.03
+
+    // The spawn images are quantized to this many shades, so a distribution only depends on its image.
+    spawnShadesOfGray = 10
+
+    // The default distribution is denser, like it always was.
+    defaultShadesOfGray = 20
+    defaultDistributionName = "black.bmp"
+
+    // The size of the field, when a game does not define one.
+    defaultFieldSize = 1000
+
+    // The nodes of the food quad tree are allocated for at least this many foods.
+    minAllocatorFoods = 5000
+
+    allocatorLogFile = "../allocator_log"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Profiling
+//
+////////////////////////////////////////////////////////////////////////
+
+type ProfileEvent struct {
+    Name            string
+    Start           time.Time
+    Duration        time.Duration
+    Children        []*ProfileEvent
+}
+
+type Profile struct {
+    root    *ProfileEvent
+    stack   []*ProfileEvent
+}
+
+func NewProfile() Profile {
+    return Profile{ root: nil, stack: make([]*ProfileEvent, 0, 10) }
+}
+
+func StartProfileEvent(profile *Profile, name string) {
+    profileEvent := ProfileEvent{
+        Name:       name,
+        Start:      time.Now(),
+        Children:   make([]*ProfileEvent, 0, 10),
+    }
+
+    if len(profile.stack) > 0 {
+        lastEvent := profile.stack[len(profile.stack) - 1]
+        lastEvent.Children = append(lastEvent.Children, &profileEvent)
+    } else {
+        profile.root = &profileEvent
+    }
+
+    profile.stack = append(profile.stack, &profileEvent)
+}
+
+func EndProfileEvent(profile *Profile) {
+    if len(profile.stack) <= 0 {
+        panic("There is no event to end.")
+    }
+
+    profileEvent := profile.stack[len(profile.stack) - 1]
+    profile.stack = profile.stack[:len(profile.stack) - 1]
+
+    profileEvent.Duration = time.Since(profileEvent.Start)
+}
+
+func printProfileEvent(profileEvent *ProfileEvent, currentIndent string, indentation string) {
+    fmt.Printf("%s%s: %v (%.2f)\n", currentIndent, profileEvent.Name, profileEvent.Duration, 0.0)
+    for _, child := range profileEvent.Children {
+        printProfileEvent(child, currentIndent + indentation, indentation)
+    }
+}
+
+func PrintProfile(profile *Profile) {
+    if profile.root == nil {
+        fmt.Printf("Profile is empty\n")
+        return
+    }
+
+    printProfileEvent(profile.root, "", "  ")
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Games
+//
+////////////////////////////////////////////////////////////////////////
+
+type Games map[string]Game
+
+type Game struct {
+    GameTime        float32
+    // Seconds of the countdown in the lobby before the game starts. 0 means 5 seconds.
+    LobbyTime       float32
+    BotsToStart     []string
+    BotCount        int
+    // The number of bots that may play at once. 0 keeps the limit of the server.
+    MaxBots         int
+    // Width and height. Zero means 1000x1000.
+    FieldSize       Vec2
+    Foods           int
+    Toxins          int
+    FoodSpawn       string
+    ToxinSpawn      string
+    BotSpawn        string
+    // Image in the spawns directory, whose dark pixels are walls. Empty means no walls.
+    Walls           string
+    // Name of a profile in PhysicsDirectory. Empty means the default physics.
+    Physics         string
+    // Without teams every bot plays for itself.
+    Teams           []Team
+    // Whether blobs of the same team can eat each other.
+    FriendlyFire    bool
+    // How the players are ranked at the end: "mass", "maxMass", "kills" or "survival". Empty means mass.
+    Scoring         string
+}
+
+func ReadGames(path string) (Games, error) {
+    var games Games
+
+    file, err := ioutil.ReadFile(path)
+    if err != nil {
+        return games, err
+    }
+
+    err = json.Unmarshal(file, &games)
+    return games, err
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// ServerSettings
+//
+////////////////////////////////////////////////////////////////////////
+
+type ServerSettings struct {
+    FieldSize                   Vec2
+
+    MinNumberOfBots             int
+    MaxNumberOfBots             int
+    MaxNumberOfFoods            int
+    MaxNumberOfToxins           int
+
+    BotsToStart                 []string
+    BotCount                    int
+
+    PhysicsName                 string
+    Physics                     Physics
+
+    Teams                       []Team
+    FriendlyFire                bool
+
+    FoodDistributionName        string
+    ToxinDistributionName       string
+    BotDistributionName         string
+
+    FoodDistribution            []Vec2
+    ToxinDistribution           []Vec2
+    BotDistribution             []Vec2
+
+    WallsName                   string
+    Walls                       Walls
+}
+
+func NewSettings() ServerSettings {
+    fieldSize := Vec2{ X: defaultFieldSize, Y: defaultFieldSize }
+
+    return ServerSettings{
+        FieldSize:              fieldSize,
+
+        MinNumberOfBots:        8,
+        MaxNumberOfBots:        30,
+        MaxNumberOfFoods:       1000,
+        MaxNumberOfToxins:      30,
+
+        BotsToStart:            []string{},
+        BotCount:               0,
+
+        PhysicsName:            "",
+        Physics:                DefaultPhysics(),
+
+        Teams:                  []Team{},
+        FriendlyFire:           false,
+
+        FoodDistributionName:   defaultDistributionName,
+        ToxinDistributionName:  defaultDistributionName,
+        BotDistributionName:    defaultDistributionName,
+
+        FoodDistribution:       LoadSpawnImage(fieldSize, defaultDistributionName),
+        ToxinDistribution:      LoadSpawnImage(fieldSize, defaultDistributionName),
+        BotDistribution:        LoadSpawnImage(fieldSize, defaultDistributionName),
+
+        WallsName:              "",
+        Walls:                  Walls{},
+    }
+}
+
+// Nothing spawns inside of a wall.
+func (settings *ServerSettings) SetFoodSpawn(image string) {
+    settings.FoodDistribution     = settings.Walls.freePositions(LoadSpawnImage(settings.FieldSize, image))
+    settings.FoodDistributionName = image
+}
+
+func (settings *ServerSettings) SetToxinSpawn(image string) {
+    settings.ToxinDistribution     = settings.Walls.freePositions(LoadSpawnImage(settings.FieldSize, image))
+    settings.ToxinDistributionName = image
+}
+
+func (settings *ServerSettings) SetBotSpawn(image string) {
+    settings.BotDistribution     = settings.Walls.freePositions(LoadSpawnImage(settings.FieldSize, image))
+    settings.BotDistributionName = image
+}
+
+// The spawn distributions are loaded again, so they leave out the new walls.
+// Walls that cannot be loaded or cover every position of a spawn image are rejected and the settings stay unchanged.
+func (settings *ServerSettings) SetWalls(image string) error {
+    walls, err := LoadWalls(settings.FieldSize, image)
+    if err != nil {
+        return err
+    }
+    if err := walls.checkSpawns(settings.FieldSize, settings.spawnImages()); err != nil {
+        return err
+    }
+    settings.Walls     = walls
+    settings.WallsName = image
+
+    settings.SetFoodSpawn(settings.FoodDistributionName)
+    settings.SetToxinSpawn(settings.ToxinDistributionName)
+    settings.SetBotSpawn(settings.BotDistributionName)
+    return nil
+}
+
+func (settings *ServerSettings) spawnImages() []string {
+    return []string{ settings.FoodDistributionName, settings.ToxinDistributionName, settings.BotDistributionName }
+}
+
+func fieldSizeOrDefault(size Vec2) Vec2 {
+    if size.X <= 0 || size.Y <= 0 {
+        return Vec2{ X: defaultFieldSize, Y: defaultFieldSize }
+    }
+    return size
+}
+
+// A zero size selects the default size. The walls and spawn distributions are loaded again for the new size.
+// When the walls cover a spawn image at the new size, they are removed.
+func (settings *ServerSettings) SetFieldSize(size Vec2) {
+    size = fieldSizeOrDefault(size)
+    if size == settings.FieldSize {
+        return
+    }
+    settings.FieldSize = size
+    if err := settings.SetWalls(settings.WallsName); err != nil {
+        Logf(LtDebug, "The walls %v are removed: %v\n", settings.WallsName, err.Error())
+        settings.SetWalls("")
+    }
+}
+
+// An empty name selects base itself. If the profile cannot be loaded, the physics stay unchanged.
+func (settings *ServerSettings) SetPhysics(base Physics, name string) error {
+    physics := base
+    if name != "" {
+        var err error
+        if physics, err = LoadPhysics(base, name); err != nil {
+            return err
+        }
+    }
+    settings.Physics     = physics
+    settings.PhysicsName = name
+    return nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// GameState
+//
+////////////////////////////////////////////////////////////////////////
+
+type GameState struct {
+    Foods                   map[FoodId]Food
+    Toxins                  map[ToxinId]Toxin
+    Bots                    map[BotId]Bot
+
+    Ids                     Ids
+
+    Teams                   map[TeamId]TeamScore
+
+    // Counts down during a game.
+    GameTime                float32
+
+    // Where the bots spawned and how safe that was.
+    Spawns                  []SpawnDecision
+
+    // Every random decision of the simulation is taken from this generator.
+    // Together with the sorted iteration below, a seed reproduces a match.
+    Random                  *rand.Rand
+}
+
+func NewGameState(serverSettings ServerSettings, random *rand.Rand) GameState {
+    var gameState GameState
+
+    gameState.Foods         = make(map[FoodId]Food)
+    gameState.Bots          = make(map[BotId]Bot)
+    gameState.Toxins        = make(map[ToxinId]Toxin)
+    gameState.Ids           = NewIds(serverSettings)
+    gameState.Teams         = make(map[TeamId]TeamScore)
+    gameState.GameTime      = defaultGameTime
+    gameState.Random        = random
+
+    physics := &serverSettings.Physics
+    for i := FoodId(0); i < FoodId(serverSettings.MaxNumberOfFoods); i++ {
+        mass := physics.FoodMassMin + random.Float32() * (physics.FoodMassMax - physics.FoodMassMin)
+        if pos, ok := newFoodPos(&serverSettings, random); ok {
+            gameState.Foods[i] = Food{ true, false, false, BotId(0), mass, pos, RandomVec2From(random) }
+        }
+    }
+
+    for i := 0; i < serverSettings.MaxNumberOfToxins; i++ {
+        if pos, ok := newToxinPos(&serverSettings, random); ok {
+            gameState.Toxins[ToxinId(i)] = Toxin{true, false, pos, false, BotId(0), physics.ToxinMassMin, RandomVec2From(random)}
+        }
+    }
+
+    return gameState
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Sorted Ids
+//
+////////////////////////////////////////////////////////////////////////
+
+// Go does not guarantee any iteration order for maps. Everything that changes
+// the game state iterates over sorted ids instead, so the order is always the same.
+
+func SortedBotIds(bots map[BotId]Bot) []BotId {
+    ids := make([]BotId, 0, len(bots))
+    for id := range bots {
+        ids = append(ids, id)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+func SortedBlobIds(blobs map[BlobId]Blob) []BlobId {
+    ids := make([]BlobId, 0, len(blobs))
+    for id := range blobs {
+        ids = append(ids, id)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+func SortedFoodIds(foods map[FoodId]Food) []FoodId {
+    ids := make([]FoodId, 0, len(foods))
+    for id := range foods {
+        ids = append(ids, id)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+func SortedToxinIds(toxins map[ToxinId]Toxin) []ToxinId {
+    ids := make([]ToxinId, 0, len(toxins))
+    for id := range toxins {
+        ids = append(ids, id)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    return ids
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Ids
+//
+////////////////////////////////////////////////////////////////////////
+
+// The ids of everything that is created inside the simulation.
+// Bot ids are handed out by the server, when a connection comes in.
+type Ids struct {
+    NextTeamId                  TeamId
+    NextBlobId                  BlobId
+    NextFoodId                  FoodId
+    NextToxinId                 ToxinId
+}
+
+func NewIds(settings ServerSettings) Ids {
+    return Ids{
+        NextTeamId:             0,
+        NextBlobId:             1,
+        NextFoodId:             FoodId(settings.MaxNumberOfFoods) + 1,
+        NextToxinId:            ToxinId(settings.MaxNumberOfToxins) + 1,
+    }
+}
+
+func (gameState *GameState) createTeamId(settings *ServerSettings, name string) TeamId {
+    teamName := settings.TeamName(name)
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        if settings.TeamName(bot.Info.Name) == teamName {
+            return bot.TeamId
+        }
+    }
+    for teamId, score := range gameState.Teams {
+        if score.Name == teamName {
+            return teamId
+        }
+    }
+
+    var id = gameState.Ids.NextTeamId
+    gameState.Ids.NextTeamId = id + 1
+    return id
+}
+
+func (ids* Ids) createBlobId() BlobId {
+    var id = ids.NextBlobId
+    ids.NextBlobId = id + 1
+    return id
+}
+
+func (ids* Ids) createFoodId() FoodId {
+    var id = ids.NextFoodId
+    ids.NextFoodId = id + 1
+    return id
+}
+
+func (ids* Ids) createToxinId() ToxinId {
+    var id = ids.NextToxinId
+    ids.NextToxinId = id + 1
+    return id
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// IdsContainer
+//
+////////////////////////////////////////////////////////////////////////
+
+type IdPair struct {
+    BotId   BotId
+    BlobId  BlobId
+}
+type IdsContainer []IdPair
+
+func NewIdsContainer() IdsContainer {
+    return make([]IdPair, 0)
+}
+
+func (blobContainer *IdsContainer) insert(botId BotId, blobId BlobId) {
+    (*blobContainer) = append((*blobContainer), IdPair{ botId, blobId })
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Spawn Image Paths
+//
+////////////////////////////////////////////////////////////////////////
+
+func MakeLocalSpawnName(name string) string {
+    return fmt.Sprintf("../Public/spawns/%v", name)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Finding Positions
+//
+////////////////////////////////////////////////////////////////////////
+
+func newFoodPos(settings *ServerSettings, random *rand.Rand) (Vec2, bool) {
+    length := len(settings.FoodDistribution)
+    if length == 0 {
+        return Vec2{}, false
+    }
+    return settings.FoodDistribution[random.Intn(length)], true
+}
+
+func newToxinPos(settings *ServerSettings, random *rand.Rand) (Vec2, bool) {
+    length := len(settings.ToxinDistribution)
+    if length == 0 {
+        return Vec2{}, false
+    }
+    return settings.ToxinDistribution[random.Intn(length)], true
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Simulations
+//
+////////////////////////////////////////////////////////////////////////
+
+func calcBlobVelocityFromMass(vel Vec2, mass float32, physics *Physics, random *rand.Rand) Vec2 {
+    // This is the maximum mass for now.
+    var factor = 1.0 - mass/physics.BotMaxMass
+    if mass > 0.9*physics.BotMaxMass {
+        // So blobs never stop moving completely.
+        factor = physics.BlobMinSpeedFactor
+    }
+    if Length(vel) <= 0.01 {
+        vel = RandomVec2From(random)
+    }
+    return Muls(NormalizeOrZero(vel), factor)
+}
+
+func calcBlobVelocity(blob *Blob, targetPos Vec2, physics *Physics, random *rand.Rand) Vec2 {
+    var diff = Sub(targetPos, blob.Position)
+
+    if blob.VelocityFac < 0.2 && Length(diff) <= 0.5 {
+        diff = RandomVec2From(random)
+        return NullVec2()
+    }
+
+    var velocity = calcBlobVelocityFromMass(diff, blob.Mass, physics, random)
+
+    //Logf(LtDebug, "velocity: %v, diff: %v, mass: %v, targetPos: %v, pos: %v\n", velocity, diff, blob.Mass, targetPos, blob.Position)
+    var vel = Add(velocity, Muls(velocity, blob.VelocityFac))
+
+    if math.IsNaN(float64(vel.X)) || math.IsNaN(float64(vel.Y)) {
+        vel = Vec2{0,0}
+    }
+
+    return vel
+}
+
+func calcBlobbMassLoss(mass float32, dt float32, physics *Physics) float32 {
+    if mass > physics.BotMinMass {
+        return mass - (mass/physics.BotMaxMass)*dt*float32(physics.MassLoss)
+    }
+
+    return mass
+}
+
+func pushBlobsApart(blobs* map[BlobId]Blob, random *rand.Rand) {
+    blobIds := SortedBlobIds(*blobs)
+    for _, index := range blobIds {
+        subBlob := (*blobs)[index]
+        for _, index2 := range blobIds {
+            subBlob2 := (*blobs)[index2]
+            // Just move them out of each other, if it is not newly split!
+            if index != index2 && subBlob.VelocityFac < 1.1 && subBlob2.VelocityFac < 1.1 {
+                var dist = Dist(subBlob.Position, subBlob2.Position)
+                var minDist  = subBlob.Radius() + subBlob2.Radius()
+
+                // ToDo(Maurice): Make reunion time dynamic!
+                if subBlob.ReunionTime <= 1.0 {
+                    minDist *= subBlob.ReunionTime
+                }
+
+                var distDiff = minDist - dist
+                // Push them out from each other
+                if distDiff > 0 {
+                    //fmt.Println("Pushing!")
+                    var sub = Sub(subBlob.Position, subBlob2.Position)
+                    if Length(sub) <= 0.01 {
+                        sub = RandomVec2From(random)
+                    }
+                    var dir = Muls(NormalizeOrZero(sub), distDiff/2)
+                    var tmp = (*blobs)[index]
+                    tmp.Position  = Add((*blobs)[index].Position, dir)
+                    (*blobs)[index] = tmp
+                    var tmp2 = (*blobs)[index2]
+                    tmp2.Position = Sub((*blobs)[index2].Position, dir)
+                    (*blobs)[index2] = tmp2
+
+                }
+            }
+        }
+    }
+}
+
+func calcSubblobReunion(killedBlobs *IdsContainer, botId BotId, bot *Bot) {
+    blobIds := SortedBlobIds((*bot).Blobs)
+    for _, k := range blobIds {
+        subBlob, ok := (*bot).Blobs[k]
+        if !ok {
+            continue
+        }
+        for _, k2 := range blobIds {
+            subBlob2, ok := (*bot).Blobs[k2]
+            if !ok {
+                continue
+            }
+            if k != k2 {
+                var dist = Dist(subBlob.Position, subBlob2.Position)
+                var shouldBe = subBlob.Radius() + subBlob2.Radius()
+                if subBlob2.ReunionTime < 0.1 && dist < shouldBe && shouldBe - dist > subBlob2.Radius() {
+                    // Merge them together.
+                    var tmp = (*bot).Blobs[k]
+                    tmp.Mass += (*bot).Blobs[k2].Mass
+                    tmp.IsSplit = false
+                    (*bot).Blobs[k] = tmp
+
+                    // Delete blob
+                    killedBlobs.insert(botId, k2)
+                    delete((*bot).Blobs, k2)
+
+                }
+            }
+        }
+    }
+}
+
+// Is the action commanded for at least one blob of the bot?
+func botHasAction(bot *Bot, action BotActionType) bool {
+    for blobId := range bot.Blobs {
+        if blobAction, _ := bot.Command.ForBlob(blobId); blobAction == action {
+            return true
+        }
+    }
+    return false
+}
+
+// Splits the blobs of the bot, that are commanded to split.
+func splitBlobsOfBot(bot *Bot, ids *Ids, physics *Physics) {
+    var newBlobMap = make(map[BlobId]Blob)
+    for _, subBlobToSplit := range SortedBlobIds((*bot).Blobs) {
+        subBlob := (*bot).Blobs[subBlobToSplit]
+        if action, _ := bot.Command.ForBlob(subBlobToSplit); action != BatSplit {
+            continue
+        }
+        // Just split if bigger than 100
+        if (*bot).Blobs[subBlobToSplit].Mass >= physics.BlobSplitMass {
+            var newMass = subBlob.Mass / 2.0
+
+            // Override the old mass and time to reunion, so it is not eaten right away.
+            var tmp = (*bot).Blobs[subBlobToSplit]
+            tmp.Mass = newMass
+            tmp.ReunionTime = subBlob.ReunionTime + 1.0
+            (*bot).Blobs[subBlobToSplit] = tmp
+
+            var newIndex = ids.createBlobId()
+            newBlobMap[newIndex] = Blob{ subBlob.Position, newMass, physics.BlobSplitVelocity, true, physics.BlobReunionTime, NullVec2(), NullVec2() }
+        }
+    }
+
+    // Just so we don't edit the map while iterating over it!
+    for index,blob := range newBlobMap {
+        (*bot).Blobs[index] = blob
+    }
+}
+
+// Every blob, that is commanded to throw, throws food towards its target.
+func throwBlobsOfBot(gameState *GameState, bot *Bot, botId BotId, physics *Physics) bool {
+    somebodyThrew := false
+    for _, blobId := range SortedBlobIds((*bot).Blobs) {
+        blob := (*bot).Blobs[blobId]
+        action, target := bot.Command.ForBlob(blobId)
+        if action == BatThrow && blob.Mass > physics.MassToBeAllowedToThrow {
+            foodId := gameState.Ids.createFoodId()
+            sub := Sub(target, blob.Position)
+            if Length(sub) <= 0.01 {
+                sub = RandomVec2From(gameState.Random)
+            }
+            targetDirection := NormalizeOrZero(sub)
+            food := Food{
+                IsNew:    true,
+                IsMoving: true,
+                IsThrown: true,
+                IsThrownBy: botId,
+                Mass:     physics.ThrownFoodMass,
+                Position: Add(blob.Position, Muls(targetDirection, 1.5*(blob.Radius() + Radius(physics.ThrownFoodMass)))),
+                Velocity: Muls(targetDirection, 150),
+            }
+            gameState.Foods[foodId] = food
+
+            blob.Mass = blob.Mass - physics.ThrownFoodMass
+
+            somebodyThrew = true
+        }
+        (*bot).Blobs[blobId] = blob
+    }
+    return somebodyThrew
+}
+
+// Calculates a vectors which are equally divided on a circle with given radius!
+func randomVecOnCircle(radius float32, random *rand.Rand) Vec2 {
+    var angle = random.Float64() * math.Pi * 2.0;
+    var x = float32(math.Cos(angle)) * radius;
+    var y = float32(math.Sin(angle)) * radius;
+    return Vec2{x, y}
+}
+
+func explodeBlob(gameState *GameState, botId BotId, blobId BlobId, newMap *map[BlobId]Blob, ids *Ids)  {
+    blobCount := 12
+    splitRadius := float32(3.0)
+
+    // ToDo(Maurice): Make exploded Bubbles in random/different sizes with one of them
+    // consisting of half the mass!
+    blob := gameState.Bots[botId].Blobs[blobId]
+    for i := 0; i < blobCount; i++ {
+        newIndex  := ids.createBlobId()
+        (*newMap)[newIndex] = Blob{
+            Add(RandomVec2From(gameState.Random), blob.Position),
+            blob.Mass/float32(blobCount),
+            // We need the 0.2 (or something small!) here, so that we don't
+            // try to push them apart in the first step. Otherwise we have the exact same
+            // position and the diff-Vector is undefined/null. Can't push them apart!
+            blob.VelocityFac+0.1,
+            false,
+            10.0,
+            // Random Vector with about same length. Should be uniformly divided!
+            randomVecOnCircle(splitRadius, gameState.Random),
+            NullVec2(),
+        }
+    }
+}
+
+func makeServerMiddlewareBlob(botId BotId, blobId BlobId, teamId TeamId, blob Blob) ServerMiddlewareBlob {
+    return ServerMiddlewareBlob{
+        BotId:  uint32(botId),
+        TeamId: uint32(teamId),
+        Index:  uint32(blobId),
+        Position: ToFixedVec2(blob.Position, 100),
+        Mass:   uint32(blob.Mass),
+        Velocity: ToFixedVec2(blob.Velocity, 100),
+    }
+}
+
+func makeServerMiddlewareBlobs(gameState *GameState, botId BotId) []ServerMiddlewareBlob {
+    var blobArray []ServerMiddlewareBlob
+
+    bot := gameState.Bots[botId]
+    for _, blobId := range SortedBlobIds(bot.Blobs) {
+        blob := bot.Blobs[blobId]
+        serverMiddlewareBlob := makeServerMiddlewareBlob(botId, blobId, bot.TeamId, blob)
+        serverMiddlewareBlob.IsSplit = blob.IsSplit
+        serverMiddlewareBlob.ReunionTime = float32(math.Max(0, float64(ToFixed(blob.ReunionTime, 100))))
+        blobArray = append(blobArray, serverMiddlewareBlob)
+    }
+
+    return blobArray
+}
+
+// The velocity is only used while something is moving, otherwise it is left over from the last movement.
+func movingVelocity(isMoving bool, velocity Vec2) Vec2 {
+    if !isMoving {
+        return NullVec2()
+    }
+    return ToFixedVec2(velocity, 100)
+}
+
+func makeServerMiddlewareFood(food Food) ServerMiddlewareFood {
+    return ServerMiddlewareFood{
+        Mass:       ToFixed(food.Mass, 100),
+        Position:   ToFixedVec2(food.Position, 100),
+        Velocity:   movingVelocity(food.IsMoving, food.Velocity),
+    }
+}
+
+func makeServerMiddlewareToxin(toxin Toxin) ServerMiddlewareToxin {
+    return ServerMiddlewareToxin{
+        Mass:       ToFixed(toxin.Mass, 100),
+        Position:   ToFixedVec2(toxin.Position, 100),
+        Velocity:   movingVelocity(toxin.IsMoving, toxin.Velocity),
+    }
+}
+
+// Everything the bot can see from the game. false, if there is no such bot.
+// The GameTime is the one of the game state, the caller sets it to -1 if there is no timed game.
+func MakeServerMiddlewareGameState(gameState *GameState, settings *ServerSettings, botId BotId, tick int) (ServerMiddlewareGameState, bool) {
+    bot, ok := gameState.Bots[botId]
+    if !ok {
+        return ServerMiddlewareGameState{}, false
+    }
+
+    // Everything is collected in the order of the ids, so a bot sees the same game state
+    // in every replay of a game.
+
+    // Collecting other blobs
+    var otherBlobs []ServerMiddlewareBlob
+    for _, otherBotId := range SortedBotIds(gameState.Bots) {
+        if botId != otherBotId {
+            otherBot := gameState.Bots[otherBotId]
+            for _, otherBlobId := range SortedBlobIds(otherBot.Blobs) {
+                otherBlob := otherBot.Blobs[otherBlobId]
+                if IsInViewWindow(bot.ViewWindow, otherBlob.Position, otherBlob.Radius()) {
+                    otherBlobs = append(otherBlobs, makeServerMiddlewareBlob(otherBotId, otherBlobId, otherBot.TeamId, otherBlob))
+                }
+            }
+        }
+    }
+
+    // Collecting foods
+    var foods []ServerMiddlewareFood
+    for _, foodId := range SortedFoodIds(gameState.Foods) {
+        food := gameState.Foods[foodId]
+        if IsInViewWindow(bot.ViewWindow, food.Position, Radius(food.Mass)) {
+            foods = append(foods, makeServerMiddlewareFood(food))
+        }
+    }
+
+    // Collecting toxins
+    var toxins []ServerMiddlewareToxin
+    for _, toxinId := range SortedToxinIds(gameState.Toxins) {
+        toxin := gameState.Toxins[toxinId]
+        if IsInViewWindow(bot.ViewWindow, toxin.Position, Radius(toxin.Mass)) {
+            toxins = append(toxins, makeServerMiddlewareToxin(toxin))
+        }
+    }
+
+    return ServerMiddlewareGameState{
+        MyBlob:         makeServerMiddlewareBlobs(gameState, botId),
+        OtherBlobs:     otherBlobs,
+        Food:           foods,
+        Toxin:          toxins,
+        Walls:          settings.Walls.InView(bot.ViewWindow),
+        ViewWindow:     ServerMiddlewareViewWindow{
+            Position:   ToFixedVec2(bot.ViewWindow.Position, 100),
+            Size:       ToFixedVec2(bot.ViewWindow.Size, 100),
+        },
+        FieldSize:      settings.FieldSize,
+        GameTime:       ToFixed(gameState.GameTime, 100),
+        Tick:           tick,
+    }, true
+}
+
+// Big games with many foods need more nodes than the usual ones.
+func newFoodAllocator(numFoods int) Allocator {
+    if numFoods < minAllocatorFoods {
+        numFoods = minAllocatorFoods
+    }
+    return NewAllocator(2*numFoods, numFoods, 2*numFoods, numFoods)
+}
+
+func limitPosition(settings *ServerSettings, position *Vec2) {
+    if (*position).X < 0 { (*position).X = 0 }
+    if (*position).Y < 0 { (*position).Y = 0 }
+    if (*position).X > settings.FieldSize.X { (*position).X = settings.FieldSize.X }
+    if (*position).Y > settings.FieldSize.Y { (*position).Y = settings.FieldSize.Y }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// NaN Problem
+//
+////////////////////////////////////////////////////////////////////////
+
+func checkNaNV (v Vec2, prefix string, s string) {
+    if math.IsNaN(float64(v.X)) || math.IsNaN(float64(v.Y)) {
+        Logf(LtDebug, "NaN ( Vec ) is found for: __%v__ %v\n", prefix, s)
+    }
+}
+func checkNaNF (f float32, prefix string, s string) {
+    if math.IsNaN(float64(f)) {
+        Logf(LtDebug, "NaN (Float) is found for: __%v__ %v\n", prefix, s)
+    }
+}
+func CheckAllValuesOnNaN(gameState *GameState, prefix string) {
+    for _,bot := range gameState.Bots {
+        checkNaNV(bot.ViewWindow.Position, prefix, "bot.ViewWindow.Position")
+        checkNaNV(bot.ViewWindow.Size, prefix, "bot.ViewWindow.Size")
+        for _,blob := range bot.Blobs {
+            checkNaNV(blob.Position, prefix, "blob.Position")
+            checkNaNV(blob.IndividualTargetVec, prefix, "blob.IndividualTargetVec")
+            checkNaNF(blob.Mass, prefix, "blob.Mass")
+            checkNaNF(blob.ReunionTime, prefix, "blob.ReunionTime")
+            checkNaNF(blob.VelocityFac, prefix, "blob.VelocityFac")
+        }
+    }
+    for _,food := range gameState.Foods {
+        checkNaNF(food.Mass, prefix, "food.Mass")
+        checkNaNV(food.Position, prefix, "food.Position")
+        checkNaNV(food.Velocity, prefix, "food.Velocity")
+    }
+    for _,toxin := range gameState.Toxins {
+        checkNaNV(toxin.Position, prefix, "toxin.Position")
+        checkNaNF(toxin.Mass, prefix, "toxin.Mass")
+        checkNaNV(toxin.Velocity, prefix, "toxin.Velocity")
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// FoodBuffer for QuadTree
+//
+////////////////////////////////////////////////////////////////////////
+
+const foodBufferSize int = 100
+type FoodBuffer struct {
+    values      [foodBufferSize]interface{}
+    count       int
+}
+
+func (buffer *FoodBuffer) Append(value interface{}) {
+    if buffer.count + 1 < foodBufferSize {
+        buffer.values[buffer.count] = value
+        buffer.count += 1
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// BotKill
+//
+////////////////////////////////////////////////////////////////////////
+
+type BotKill struct {
+    BotId               BotId
+    TeamId              TeamId
+    Name                string
+    StatisticsThisGame  Statistics
+}
+
+func NewBotKill(botId BotId, bot Bot) BotKill {
+    return BotKill{
+        BotId:              botId,
+        TeamId:             bot.TeamId,
+        Name:               bot.Info.Name,
+        StatisticsThisGame: bot.StatisticsThisGame,
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Update Function
+//
+////////////////////////////////////////////////////////////////////////
+
+// Advances the game state by dt seconds with the commands that are stored in the bots.
+// Returns the bots that died and the foods and toxins that were removed.
+func Update(gameState *GameState, settings *ServerSettings, profile *Profile, dt float32, simulationStepCounter int) ([]BotKill, []FoodId, []ToxinId) {
+    deadBots    := make([]BotKill, 0)
+    eatenFoods  := make([]FoodId,  0)
+    eatenToxins := make([]ToxinId, 0)
+
+    ids := &gameState.Ids
+    physics := &settings.Physics
+
+    gameState.GameTime -= dt
+
+    ////////////////////////////////////////////////////////////////
+    // UPDATE BOT POSITION
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Update Bot Position")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            bot := gameState.Bots[botId]
+            botDied := false
+            for _, blobId := range SortedBlobIds(bot.Blobs) {
+                blob := bot.Blobs[blobId]
+                if blob.Mass < physics.MinBlobMass {
+                    delete(bot.Blobs, blobId)
+                    if len(bot.Blobs) == 0 {
+                        botDied = true
+                        deadBots = append(deadBots, NewBotKill(botId, bot))
+                    }
+                    break
+                }
+
+                _, target   := bot.Command.ForBlob(blobId)
+                oldPosition := blob.Position
+                velocity    := calcBlobVelocity(&blob, target, physics, gameState.Random)
+                time        := dt * 50
+                newVelocity := Muls(velocity, time)
+                newPosition := Add (oldPosition, newVelocity)
+                newPosition =  Add (newPosition, blob.IndividualTargetVec)
+
+                blob.Position = newPosition
+
+                //singleBlob.Position = Add(singleBlob.Position, Muls(calcBlobVelocity(&singleBlob, blob.IndividualTargetVec), dt * 100))
+                blob.Mass = calcBlobbMassLoss(blob.Mass, dt, physics)
+                blob.VelocityFac = blob.VelocityFac * physics.VelocityDecreaseFactor
+
+                // So this is not added all the time but just for a short moment!
+                blob.IndividualTargetVec = Muls(blob.IndividualTargetVec, physics.VelocityDecreaseFactor)
+
+                if blob.ReunionTime > 0.0 {
+                    blob.ReunionTime -= dt
+                }
+
+                limitPosition(settings, &blob.Position)
+                if position, normal, hit := settings.Walls.Move(oldPosition, blob.Position, blob.Radius()); hit {
+                    blob.Position = position
+                    // A blob that was split or shot into a wall does not keep pushing against it.
+                    if into := dot(blob.IndividualTargetVec, normal); into < 0 {
+                        blob.IndividualTargetVec = Sub(blob.IndividualTargetVec, Muls(normal, into))
+                    }
+                }
+                if dt > 0 {
+                    blob.Velocity = Muls(Sub(blob.Position, oldPosition), 1 / dt)
+                }
+
+                gameState.Bots[botId].Blobs[blobId] = blob
+            }
+            if !botDied {
+                gameState.Bots[botId] = bot
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // UPDATE VIEW WINDOWS AND MAX MASS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "View Windows and max Mass")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            bot := gameState.Bots[botId]
+            //var diameter float32
+            var center Vec2
+            var completeMass float32 = 0
+            for _, blobId := range SortedBlobIds(bot.Blobs) {
+                blob1 := bot.Blobs[blobId]
+                center = Add(center, blob1.Position)
+                completeMass += blob1.Mass
+            }
+
+            if completeMass > physics.BotMaxMass {
+
+                // Percentage to cut off
+                var dividor float32 = completeMass / physics.BotMaxMass
+
+                for blobId, blob := range bot.Blobs {
+                    blob.Mass /= dividor
+                    bot.Blobs[blobId] = blob
+                }
+
+            }
+
+            center = Muls(center, 1.0 / float32(len(bot.Blobs)))
+            var windowDiameter float32 = 50.0 * float32(math.Log(float64(completeMass))) - 20.0
+
+            bot.ViewWindow = ViewWindow{
+                Position:   Sub(center, Vec2{ windowDiameter / 2.0, windowDiameter / 2.0 }),
+                Size: Vec2{ windowDiameter, windowDiameter },
+            }
+            gameState.Bots[botId] = bot
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // UPDATE FOOD POSITION
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Food Position")
+        for _, foodId := range SortedFoodIds(gameState.Foods) {
+            food := gameState.Foods[foodId]
+            if food.IsMoving {
+                oldPosition := food.Position
+                food.Position = Add(food.Position, Muls(food.Velocity, dt))
+                limitPosition(settings, &food.Position)
+                if position, normal, hit := settings.Walls.Move(oldPosition, food.Position, Radius(food.Mass)); hit {
+                    food.Position = position
+                    food.Velocity = bounce(food.Velocity, normal)
+                }
+                food.Velocity = Muls(food.Velocity, physics.VelocityDecreaseFactor)
+                gameState.Foods[foodId] = food
+                if Length(food.Velocity) <= 0.001 {
+                    food.IsMoving = false
+                }
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // UPDATE TOXIN POSITION
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Toxin Position")
+        for _, toxinId := range SortedToxinIds(gameState.Toxins) {
+            toxin := gameState.Toxins[toxinId]
+            if toxin.IsMoving {
+                oldPosition := toxin.Position
+                toxin.Position = Add(toxin.Position, Muls(toxin.Velocity, dt))
+                limitPosition(settings, &toxin.Position)
+                if position, normal, hit := settings.Walls.Move(oldPosition, toxin.Position, Radius(toxin.Mass)); hit {
+                    toxin.Position = position
+                    toxin.Velocity = bounce(toxin.Velocity, normal)
+                }
+                toxin.Velocity = Muls(toxin.Velocity, physics.VelocityDecreaseFactor)
+                gameState.Toxins[toxinId] = toxin
+                if Length(toxin.Velocity) <= 0.001 {
+                    toxin.IsMoving = false
+                }
+            }
+            gameState.Toxins[toxinId] = toxin
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // SPLIT BOTS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Split Bot")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            bot := gameState.Bots[botId]
+            // With commands per blob, some blobs can split while others throw.
+            if botHasAction(&bot, BatSplit) && len(bot.Blobs) <= 10 {
+                bot.StatisticsThisGame.SplitCount += 1
+                splitBlobsOfBot(&bot, ids, physics)
+                gameState.Bots[botId] = bot
+            }
+            if botHasAction(&bot, BatThrow) {
+                throwBlobsOfBot(gameState, &bot, botId, physics)
+                gameState.Bots[botId] = bot
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // SPLIT THE TOXINS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Split Toxin")
+        for _, toxinId := range SortedToxinIds(gameState.Toxins) {
+            toxin := gameState.Toxins[toxinId]
+
+            if toxin.Mass > physics.ToxinMassMax {
+
+                // Create new Toxin (moving!)
+                newId := ids.createToxinId()
+                newToxin := Toxin {
+                    IsNew: true,
+                    IsMoving: true,
+                    Position: toxin.Position,
+                    IsSplit: true,
+                    IsSplitBy: toxin.IsSplitBy,
+                    Mass: physics.ToxinMassMin,
+                    Velocity: toxin.Velocity,
+                }
+                gameState.Toxins[newId] = newToxin
+
+                possibleBot, foundIt := gameState.Bots[toxin.IsSplitBy]
+                if foundIt {
+                    possibleBot.StatisticsThisGame.ToxinThrow += 1
+                    gameState.Bots[toxin.IsSplitBy] = possibleBot
+                }
+
+                // Reset Mass
+                toxin.Mass = physics.ToxinMassMin
+                toxin.IsSplit = false
+                toxin.IsNew = false
+                toxin.IsSplitBy = BotId(0)
+                toxin.Velocity = RandomVec2From(gameState.Random)
+
+            }
+            gameState.Toxins[toxinId] = toxin
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // REUNION OF BLOBS
+    ////////////////////////////////////////////////////////////////
+    killedBlobs := NewIdsContainer()
+    {
+        StartProfileEvent(profile, "Blob reunion")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            var bot = gameState.Bots[botId]
+            var botRef = &bot
+            // Reunion of Subblobs
+            calcSubblobReunion(&killedBlobs, botId, botRef)
+            gameState.Bots[botId] = *botRef
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // COLLISION WITH TOXINS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Collision with Toxin")
+        for _, tId := range SortedToxinIds(gameState.Toxins) {
+            toxin := gameState.Toxins[tId]
+            var toxinIsEaten = false
+            var toxinIsRepositioned = false
+
+            for _, botId := range SortedBotIds(gameState.Bots) {
+                bot := gameState.Bots[botId]
+
+                mapOfAllNewSingleBlobs := make(map[BlobId]Blob)
+                var blobsToDelete []BlobId
+                var exploded = false
+
+                // This loop should not alter ANY real data at all right now!
+                // Just writing to tmp maps without alterning real data.
+                for _, blobId := range SortedBlobIds(bot.Blobs) {
+                    var singleBlob = bot.Blobs[blobId]
+
+                    if Dist(singleBlob.Position, toxin.Position) < singleBlob.Radius() && singleBlob.Mass >= physics.MinBlobMassToExplode {
+
+                        // If a bot already has > 10 blobs (i.e.), don't explode, eat it!!
+                        if len(bot.Blobs) > physics.MaxBlobCountToExplode && !toxin.IsSplit {
+                            if toxin.IsSplit || len(gameState.Toxins) >= settings.MaxNumberOfToxins {
+                                eatenToxins = append(eatenToxins, tId)
+                                delete(gameState.Toxins, tId)
+                                toxinIsEaten = true
+                            } else {
+                                if pos, ok := newToxinPos(settings, gameState.Random); ok {
+                                    toxin.Position = pos
+                                    toxin.IsSplitBy = BotId(0)
+                                    toxin.IsSplit = false
+                                    toxin.IsNew = true
+                                    toxin.Mass = physics.ToxinMassMin
+                                    toxinIsRepositioned = true
+                                } else {
+                                    eatenToxins = append(eatenToxins, tId)
+                                    delete(gameState.Toxins, tId)
+                                    toxinIsEaten = true
+                                }
+                            }
+                            break
+                        }
+
+                        subMap := make(map[BlobId]Blob)
+
+                        if toxin.IsSplit {
+                            possibleBot, foundIt := gameState.Bots[toxin.IsSplitBy]
+                            if foundIt {
+                                possibleBot.StatisticsThisGame.SuccessfulToxin += 1
+                                gameState.Bots[toxin.IsSplitBy] = possibleBot
+                            }
+                        }
+
+                        explodeBlob(gameState, botId, blobId, &subMap, ids)
+                        exploded = true
+
+                        // Add all the new explosions:
+                        for i,b := range subMap {
+                            mapOfAllNewSingleBlobs[i] = b
+                        }
+
+                        blobsToDelete = append(blobsToDelete, blobId)
+
+                        if pos, ok := newToxinPos(settings, gameState.Random); ok {
+                            toxin.Position = pos
+                            toxin.IsSplitBy = BotId(0)
+                            toxin.IsSplit = false
+                            toxin.IsNew = true
+                            toxin.Mass = physics.ToxinMassMin
+                        } else {
+                            eatenToxins = append(eatenToxins, tId)
+                            delete(gameState.Toxins, tId)
+                            toxinIsEaten = true
+                        }
+                    }
+                }
+
+                if toxinIsEaten || toxinIsRepositioned {
+                    break
+                }
+
+                if exploded {
+                    // Delete the origin of the exploded Blobs.
+                    for _,blobKey := range blobsToDelete {
+                        killedBlobs.insert(botId, blobKey)
+                        delete(bot.Blobs, blobKey)
+                    }
+
+                    // Add all new exploded Blobs.
+                    for i,b := range mapOfAllNewSingleBlobs {
+                        bot.Blobs[i] = b
+                    }
+                }
+
+                gameState.Bots[botId] = bot
+            }
+
+            if !toxinIsEaten {
+                gameState.Toxins[tId] = toxin
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // PUSH BLOBS APART
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Push Blobs Apart")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+
+            var blob = gameState.Bots[botId]
+
+            var tmpA = gameState.Bots[botId].Blobs
+            pushBlobsApart(&tmpA, gameState.Random)
+            blob.Blobs = tmpA
+
+            gameState.Bots[botId] = blob
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // PUSH BLOBS OUT OF WALLS
+    ////////////////////////////////////////////////////////////////
+    if settings.Walls.HasWalls() {
+        StartProfileEvent(profile, "Push Blobs out of Walls")
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            bot := gameState.Bots[botId]
+            for _, blobId := range SortedBlobIds(bot.Blobs) {
+                blob := bot.Blobs[blobId]
+                if position, _, hit := settings.Walls.Collide(blob.Position, blob.Radius()); hit {
+                    blob.Position = position
+                    limitPosition(settings, &blob.Position)
+                    bot.Blobs[blobId] = blob
+                }
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // BUILD QUAD TREE FOR FOODS
+    ////////////////////////////////////////////////////////////////
+    allocator := newFoodAllocator(len(gameState.Foods))
+    quadTree := NewQuadTree(NewQuad(Vec2{0,0}, float32(math.Max(float64(settings.FieldSize.X), float64(settings.FieldSize.Y)))), &allocator)
+    {
+        StartProfileEvent(profile, "QuadTree Building for Foods")
+        {
+            for _, foodId := range SortedFoodIds(gameState.Foods) {
+                quadTree.Insert(gameState.Foods[foodId].Position, foodId)
+            }
+        }
+        if allocator.LimitWasHit {
+            f, err := os.Create(allocatorLogFile)
+            defer f.Close()
+            if err == nil {
+                serializingMap := make(map[string]Food)
+                for key, value := range gameState.Foods {
+                    serializingMap[strconv.Itoa(int(key))] = value
+                }
+                b, _ := json.Marshal(serializingMap)
+                f.Write(b)
+                f.Sync()
+            }
+            Logf(LtDebug, "Allocator Error Report:\n")
+            allocator.Report()
+        }
+        if simulationStepCounter % 1200 == 0 {
+            Logf(LtDebug, "Allocator Report:\n")
+            allocator.Report()
+        }
+        EndProfileEvent(profile);
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // EATING FOODS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "QuadTree Seaching (Blobs eating Foods)")
+        {
+            var buffer FoodBuffer
+
+            for _, botId := range SortedBotIds(gameState.Bots) {
+                bot := gameState.Bots[botId]
+                for _, blobId := range SortedBlobIds(bot.Blobs) {
+                    blob := bot.Blobs[blobId]
+                    radius := Radius(blob.Mass)
+                    blobQuad := NewQuad(Vec2{ blob.Position.X - radius, blob.Position.Y - radius }, 2*radius)
+
+                    quadTree.FindValuesInQuad(blobQuad, &buffer)
+
+                    // Plow through the result of the query from the tree.
+                    for i := 0; i < buffer.count; i = i + 1 {
+                        id, _ := buffer.values[i].(FoodId)
+
+                        foodId := id
+                        food := gameState.Foods[foodId]
+
+                        if Length(Sub(food.Position, blob.Position)) < blob.Radius() {
+                            blob.Mass = blob.Mass + food.Mass
+                            if food.IsThrown && food.IsThrownBy != botId {
+                                // Feeding a team mate.
+                                if thrower, ok := gameState.Bots[food.IsThrownBy]; ok && settings.areTeamMates(thrower, bot) {
+                                    thrower.StatisticsThisGame.SuccessfulTeam += 1
+                                    gameState.Bots[food.IsThrownBy] = thrower
+                                }
+                            }
+                            if food.IsThrown {
+                                delete(gameState.Foods, foodId)
+                                eatenFoods = append(eatenFoods, foodId)
+                            } else {
+                                if pos, ok := newFoodPos(settings, gameState.Random); ok {
+                                    food.Position = pos
+                                    food.IsNew = true
+                                    gameState.Foods[foodId] = food
+                                } else {
+                                    delete(gameState.Foods, foodId)
+                                    eatenFoods = append(eatenFoods, foodId)
+                                }
+                            }
+                        }
+                    }
+                    bot.Blobs[blobId] = blob
+
+                    buffer.count = 0
+                }
+                gameState.Bots[botId] = bot
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // TOXINS EATING FOODS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "QuadTree Searching (Toxins eating Foods)")
+        {
+            var buffer FoodBuffer
+
+            for _, tId := range SortedToxinIds(gameState.Toxins) {
+                toxin := gameState.Toxins[tId]
+                radius := Radius(toxin.Mass)
+                toxinQuad := NewQuad(Vec2{ toxin.Position.X - radius, toxin.Position.Y - radius }, 2*radius)
+
+                quadTree.FindValuesInQuad(toxinQuad, &buffer)
+
+                for i := 0; i < buffer.count; i = i + 1 {
+                    foodId, _ := buffer.values[i].(FoodId)
+                    food := gameState.Foods[foodId]
+
+                    if food.IsThrown {
+                        if Length(Sub(food.Position, toxin.Position)) < Radius(toxin.Mass) {
+                            toxin.Mass = toxin.Mass + food.Mass
+                            // Always get the velocity of the last eaten food so the toxin (when split)
+                            // gets the right velocity of the last input.
+                            if Length(food.Velocity) <= 0.01 {
+                                food.Velocity = RandomVec2From(gameState.Random)
+                            }
+                            toxin.IsSplitBy = food.IsThrownBy
+                            //Logf(LtDebug, "Food is thrown by %v\n", toxin.IsSplitBy)
+                            toxin.Velocity = Muls(NormalizeOrZero(food.Velocity), 100)
+
+                            delete(gameState.Foods, foodId)
+                            eatenFoods = append(eatenFoods, foodId)
+
+                        }
+                    }
+                }
+                gameState.Toxins[tId] = toxin
+
+                buffer.count = 0
+            }
+        }
+        EndProfileEvent(profile)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // BLOBS EATING BLOBS
+    ////////////////////////////////////////////////////////////////
+    {
+        StartProfileEvent(profile, "Eating Blobs")
+        for _, botId1 := range SortedBotIds(gameState.Bots) {
+            bot1, ok := gameState.Bots[botId1]
+            if !ok {
+                continue
+            }
+
+            var bot1Mass float32
+            for _, blobId1 := range SortedBlobIds(bot1.Blobs) {
+                blob1 := bot1.Blobs[blobId1]
+                bot1Mass += blob1.Mass
+
+                for _, botId2 := range SortedBotIds(gameState.Bots) {
+                    bot2 := gameState.Bots[botId2]
+                    teamMates := settings.areTeamMates(bot1, bot2)
+                    if botId1 != botId2 && (!teamMates || settings.FriendlyFire) {
+                        for _, blobId2 := range SortedBlobIds(bot2.Blobs) {
+                            blob2 := bot2.Blobs[blobId2]
+                            inRadius := DistFast(blob2.Position, blob1.Position) < blob1.Radius()*blob1.Radius()
+                            smaller := blob2.Mass < 0.9*blob1.Mass
+
+                            if smaller && inRadius {
+                                blob1.Mass = blob1.Mass + blob2.Mass
+
+                                if teamMates {
+                                    bot1.StatisticsThisGame.BadTeaming += 1
+                                } else {
+                                    bot1.StatisticsThisGame.BlobKillCount += 1
+
+                                    if blob1.IsSplit {
+                                        bot1.StatisticsThisGame.SuccessfulSplit += 1
+                                    }
+                                }
+
+                                killedBlobs.insert(botId2, blobId2)
+
+                                delete(gameState.Bots[botId2].Blobs, blobId2)
+
+                                // Completely delete this bot.
+                                if len(gameState.Bots[botId2].Blobs) <= 0 {
+                                    deadBots = append(deadBots, NewBotKill(botId2, bot2))
+
+                                    if !teamMates {
+                                        bot1.StatisticsThisGame.BotKillCount += 1
+                                    }
+
+                                    delete(gameState.Bots, botId2)
+                                    break
+                                }
+                            }
+                        }
+                    }
+                }
+
+                gameState.Bots[botId1].Blobs[blobId1] = blob1
+            }
+
+            stats := bot1.StatisticsThisGame
+            stats.MaxSize = float32(math.Max(float64(stats.MaxSize), float64(bot1Mass)))
+            stats.MaxSurvivalTime += dt
+
+            bot1.StatisticsThisGame = stats
+            gameState.Bots[botId1] = bot1
+        }
+        EndProfileEvent(profile)
+    }
+
+    return deadBots, eatenFoods, eatenToxins
+}
+
+// Removes the foods and toxins above the limits of the settings and refills the missing ones.
+// Returns the ids of the removed ones.
+func Replenish(gameState *GameState, settings *ServerSettings) ([]FoodId, []ToxinId) {
+    eatenFoods  := make([]FoodId,  0)
+    eatenToxins := make([]ToxinId, 0)
+
+    physics := &settings.Physics
+
+    ////////////////////////////////////////////////////////////////
+    // DELETE RANDOM TOXIN IF THERE ARE TOO MANY
+    ////////////////////////////////////////////////////////////////
+    for _, toxinId := range SortedToxinIds(gameState.Toxins) {
+        if len(gameState.Toxins) <= settings.MaxNumberOfToxins {
+            break;
+        }
+        eatenToxins = append(eatenToxins, toxinId)
+        delete(gameState.Toxins, toxinId)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // DELETE RANDOM FOOD IF THERE ARE TOO MANY
+    ////////////////////////////////////////////////////////////////
+    for _, foodId := range SortedFoodIds(gameState.Foods) {
+        if len(gameState.Foods) <= settings.MaxNumberOfFoods {
+            break;
+        }
+        eatenFoods = append(eatenFoods, foodId)
+        delete(gameState.Foods, foodId)
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // POSSIBLY ADD A TOXIN
+    ////////////////////////////////////////////////////////////////
+    for len(gameState.Toxins) < settings.MaxNumberOfToxins {
+        pos, ok := newToxinPos(settings, gameState.Random)
+        if !ok {
+            break
+        }
+        newToxinId := gameState.Ids.createToxinId()
+        gameState.Toxins[newToxinId] = Toxin{true, false, pos, false, 0, physics.ToxinMassMin, RandomVec2From(gameState.Random)}
+    }
+
+    ////////////////////////////////////////////////////////////////
+    // POSSIBLY ADD A FOOD
+    ////////////////////////////////////////////////////////////////
+    for len(gameState.Foods) < settings.MaxNumberOfFoods {
+        mass := physics.FoodMassMin + gameState.Random.Float32() * (physics.FoodMassMax - physics.FoodMassMin)
+        pos, ok := newFoodPos(settings, gameState.Random)
+        if !ok {
+            break
+        }
+        newFoodId := gameState.Ids.createFoodId()
+        gameState.Foods[newFoodId] = Food{ true, false, false, 0, mass, pos, RandomVec2From(gameState.Random) }
+    }
+
+    return eatenFoods, eatenToxins
+}
+
+func CreateStartingBot(gameState *GameState, settings *ServerSettings, botInfo BotInfo, statistics Statistics) (Bot, bool) {
+    if pos, ok := planBotPosition(gameState, settings, botInfo.Name); ok {
+        blob := Blob {
+            Position:       pos,
+            Mass:           startingMass,
+            VelocityFac:    1.0,
+            IsSplit:        false,
+            ReunionTime:    0.0,
+            IndividualTargetVec:      NullVec2(),
+        }
+        statisticNew := Statistics{
+            MaxSize:            100.0,
+            MaxSurvivalTime:    0.0,
+            BlobKillCount:      0,
+            BotKillCount:       0,
+            ToxinThrow:         0,
+            SuccessfulToxin:    0,
+            SplitCount:         0,
+            SuccessfulSplit:    0,
+            SuccessfulTeam:     0,
+            BadTeaming:         0,
+        }
+
+        return Bot{
+            Info:                   botInfo,
+            TeamId:                 gameState.createTeamId(settings, botInfo.Name),
+            GuiNeedsInfoUpdate:     true,
+            ViewWindow:             ViewWindow{ Position: Vec2{0,0}, Size:Vec2{100,100} },
+            Blobs:                  map[BlobId]Blob{ 0: blob },
+            StatisticsThisGame:     statisticNew,
+            StatisticsOverall:      statistics,
+            Command:                BotCommand{ Action: BatNone, Target: RandomVec2From(gameState.Random) },
+        }, true
+    }
+
+    return Bot{}, false
+}
+
+// The same as a completely black spawn image. Used when the images are not available.
+func UniformDistribution(fieldSize Vec2) []Vec2 {
+    const cellSize = 10
+    var distributionArray []Vec2
+    for x := float32(cellSize / 2); x < fieldSize.X; x += cellSize {
+        for y := float32(cellSize / 2); y < fieldSize.Y; y += cellSize {
+            distributionArray = append(distributionArray, Vec2{ X: x, Y: y })
+        }
+    }
+    return distributionArray
+}
+
+// The whole units inside of the pixel at index. A pixel narrower than a unit gets the unit it starts in.
+func pixelRange(index int, cellSize float32) (int, int) {
+    min := int(math.Ceil(float64(float32(index) * cellSize)))
+    max := int(math.Ceil(float64(float32(index + 1) * cellSize))) - 1
+    if max < min {
+        return int(float32(index) * cellSize), int(float32(index) * cellSize)
+    }
+    return min, max
+}
+
+// The positions inside a pixel are taken from a generator seeded with the image name.
+// So the same image always gives the same distribution and replays do not have to store it.
+func LoadSpawnImage(fieldSize Vec2, imageName string) []Vec2 {
+    var filename = MakeLocalSpawnName(imageName)
+    var random = rand.New(rand.NewSource(int64(crc32.ChecksumIEEE([]byte(imageName)))))
+    var shadesOfGray = spawnShadesOfGray
+    if imageName == defaultDistributionName {
+        shadesOfGray = defaultShadesOfGray
+    }
+
+    var distributionArray []Vec2
+    fImg, err1 := os.Open(filename)
+    image, err2 := bmp.Decode(fImg)
+    if err1 != nil || err2 != nil {
+        Logf(LtDebug, "Error while trying to load image %v. err1: %v and err2: %v\n", filename, err1, err2)
+        return distributionArray
+    }
+
+    rgbToGrayscale := func(r, g, b uint32) uint8 {
+        y := (299*r + 587*g + 114*b + 500) / 1000
+        return uint8(y >> 8)
+    }
+
+    // A pixel covers this many units. They are not rounded, so every field size is covered completely.
+    cellWidth  := fieldSize.X / float32(image.Bounds().Max.X)
+    cellHeight := fieldSize.Y / float32(image.Bounds().Max.Y)
+
+    for x := image.Bounds().Min.X; x < image.Bounds().Max.X; x++ {
+        for y := image.Bounds().Min.Y; y < image.Bounds().Max.Y; y++ {
+            r, g, b, _ := image.At(x,y).RGBA()
+            gray := (255 - float32(rgbToGrayscale(r,g,b))) / 255.0
+
+            arrayCount := int(gray * float32(shadesOfGray))
+
+            // The pixel covers [x*cellWidth, (x+1)*cellWidth), like the cells of the walls.
+            minX, maxX := pixelRange(x, cellWidth)
+            minY, maxY := pixelRange(y, cellHeight)
+
+            for i := 0; i < arrayCount; i++ {
+                // The position is random but bounded by the pixel. With a 100x100 picture
+                // and a field of 1000x1000 we have a 10x10 area to set the food or bot...
+                pos := Vec2{float32(random.Intn(maxX-minX+1)+minX), float32(random.Intn(maxY-minY+1)+minY)}
+                distributionArray = append(distributionArray, pos)
+            }
+
+        }
+    }
+
+    return distributionArray
+}
+
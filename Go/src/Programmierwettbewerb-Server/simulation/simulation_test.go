@@ -0,0 +1,850 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "encoding/json"
+    "math"
+    "math/rand"
+    "testing"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Fixtures
+//
+////////////////////////////////////////////////////////////////////////
+
+const epsilon = 0.001
+
+// Everything that respawns, respawns at this position.
+var respawnPosition = Vec2{ X: 900, Y: 900 }
+
+// Without mass loss the masses of the fixtures stay exact.
+func newTestSettings() ServerSettings {
+    physics := DefaultPhysics()
+    physics.MassLoss = 0
+
+    return ServerSettings{
+        FieldSize:              Vec2{ X: 1000, Y: 1000 },
+        MinNumberOfBots:        1,
+        MaxNumberOfBots:        30,
+        MaxNumberOfFoods:       1000,
+        MaxNumberOfToxins:      30,
+        BotsToStart:            []string{},
+        Physics:                physics,
+        Teams:                  []Team{},
+        FoodDistribution:       []Vec2{ respawnPosition },
+        ToxinDistribution:      []Vec2{ respawnPosition },
+        BotDistribution:        []Vec2{ respawnPosition },
+    }
+}
+
+// An empty game state. The fixtures add their bots, foods and toxins by hand.
+func newTestGameState(settings ServerSettings) GameState {
+    gameState := GameState{
+        Foods:      make(map[FoodId]Food),
+        Toxins:     make(map[ToxinId]Toxin),
+        Bots:       make(map[BotId]Bot),
+        Ids:        NewIds(settings),
+        Teams:      make(map[TeamId]TeamScore),
+        GameTime:   defaultGameTime,
+        Random:     rand.New(rand.NewSource(1)),
+    }
+    // The fixtures number their blobs by hand, new ones must not collide with them.
+    gameState.Ids.NextBlobId = 100
+    return gameState
+}
+
+func newTestBlob(x, y, mass float32) Blob {
+    return Blob{
+        Position:               Vec2{ X: x, Y: y },
+        Mass:                   mass,
+        VelocityFac:            0,
+        IsSplit:                false,
+        ReunionTime:            0,
+        IndividualTargetVec:    NullVec2(),
+    }
+}
+
+// The blobs get the ids 1, 2, 3, ...
+func newTestBot(name string, teamId TeamId, target Vec2, blobs ...Blob) Bot {
+    bot := Bot{
+        Info:       BotInfo{ Name: name },
+        TeamId:     teamId,
+        Blobs:      make(map[BlobId]Blob),
+        Command:    BotCommand{ Action: BatNone, Target: target },
+    }
+    for i, blob := range blobs {
+        bot.Blobs[BlobId(i + 1)] = blob
+    }
+    return bot
+}
+
+func updateOnce(gameState *GameState, settings *ServerSettings) ([]BotKill, []FoodId, []ToxinId) {
+    profile := NewProfile()
+    return Update(gameState, settings, &profile, FixedTimeStep, 1)
+}
+
+func totalMass(bot Bot) float32 {
+    var mass float32
+    for _, blob := range bot.Blobs {
+        mass += blob.Mass
+    }
+    return mass
+}
+
+func near(a, b float32) bool {
+    return math.Abs(float64(a - b)) < epsilon
+}
+
+func nearVec2(a, b Vec2) bool {
+    return near(a.X, b.X) && near(a.Y, b.Y)
+}
+
+func containsBot(botKills []BotKill, botId BotId) bool {
+    for _, botKill := range botKills {
+        if botKill.BotId == botId {
+            return true
+        }
+    }
+    return false
+}
+
+func containsFood(foodIds []FoodId, foodId FoodId) bool {
+    for _, id := range foodIds {
+        if id == foodId {
+            return true
+        }
+    }
+    return false
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Movement
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateMovement(t *testing.T) {
+    // How far a blob of mass 100 moves in one step.
+    step := (1 - 100 / DefaultPhysics().BotMaxMass) * FixedTimeStep * 50
+
+    tests := []struct {
+        name        string
+        blob        Blob
+        target      Vec2
+        massLoss    float64
+        wantPos     Vec2
+        wantMass    float32
+    }{
+        { "standing on the target", newTestBlob(500, 500, 100), Vec2{ X: 500, Y: 500 },  0, Vec2{ X: 500, Y: 500 },        100 },
+        { "moving right",           newTestBlob(500, 500, 100), Vec2{ X: 600, Y: 500 },  0, Vec2{ X: 500 + step, Y: 500 }, 100 },
+        { "moving up",              newTestBlob(500, 500, 100), Vec2{ X: 500, Y: 400 },  0, Vec2{ X: 500, Y: 500 - step }, 100 },
+        { "limited by the field",   newTestBlob(1000, 500, 100), Vec2{ X: 2000, Y: 500 }, 0, Vec2{ X: 1000, Y: 500 },      100 },
+        { "losing mass",            newTestBlob(500, 500, 1000), Vec2{ X: 500, Y: 500 }, 20, Vec2{ X: 500, Y: 500 },       1000 - 0.1 * FixedTimeStep * 20 },
+        { "no loss at min mass",    newTestBlob(500, 500, 10),  Vec2{ X: 500, Y: 500 }, 20, Vec2{ X: 500, Y: 500 },        10 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        settings.Physics.MassLoss = test.massLoss
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, test.target, test.blob)
+
+        updateOnce(&gameState, &settings)
+
+        blob := gameState.Bots[1].Blobs[1]
+        if !nearVec2(blob.Position, test.wantPos) {
+            t.Errorf("%v: position is %v, want %v", test.name, blob.Position, test.wantPos)
+        }
+        if !near(blob.Mass, test.wantMass) {
+            t.Errorf("%v: mass is %v, want %v", test.name, blob.Mass, test.wantMass)
+        }
+        if wantVelocity := Muls(Sub(test.wantPos, test.blob.Position), 1 / FixedTimeStep); !nearVec2(blob.Velocity, wantVelocity) {
+            t.Errorf("%v: velocity is %v, want %v", test.name, blob.Velocity, wantVelocity)
+        }
+    }
+}
+
+func TestMakeServerMiddlewareGameState(t *testing.T) {
+    settings := newTestSettings()
+    gameState := newTestGameState(settings)
+
+    own := newTestBlob(500, 500, 100)
+    own.IsSplit = true
+    own.ReunionTime = 4.5
+    own.Velocity = Vec2{ X: 3, Y: -2 }
+    other := newTestBlob(520, 500, 80)
+    other.IsSplit = true
+    other.ReunionTime = 2
+    gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, own)
+    gameState.Bots[2] = newTestBot("b", 0, Vec2{ X: 500, Y: 500 }, other)
+    gameState.Foods[1] = Food{ IsMoving: true, Mass: 2.5, Position: Vec2{ X: 510, Y: 510 }, Velocity: Vec2{ X: 7, Y: 0 } }
+    gameState.Toxins[1] = Toxin{ IsMoving: true, Mass: 50, Position: Vec2{ X: 490, Y: 490 }, Velocity: Vec2{ X: 0, Y: 9 } }
+    // Far outside of the view window.
+    gameState.Foods[2] = Food{ Mass: 1, Position: Vec2{ X: 10, Y: 10 } }
+    // Lying still with the velocity of the last movement.
+    gameState.Foods[3] = Food{ Mass: 1, Position: Vec2{ X: 480, Y: 520 }, Velocity: Vec2{ X: 1, Y: 1 } }
+
+    // The view window is calculated by the update.
+    updateOnce(&gameState, &settings)
+    gameState.GameTime = 42.5
+
+    state, ok := MakeServerMiddlewareGameState(&gameState, &settings, 1, 17)
+    if !ok {
+        t.Fatalf("no game state for an existing bot")
+    }
+    if _, ok := MakeServerMiddlewareGameState(&gameState, &settings, 3, 17); ok {
+        t.Errorf("game state for a missing bot")
+    }
+
+    if len(state.MyBlob) != 1 || !state.MyBlob[0].IsSplit || state.MyBlob[0].ReunionTime <= 0 {
+        t.Errorf("own blobs are %+v", state.MyBlob)
+    }
+    if len(state.OtherBlobs) != 1 || state.OtherBlobs[0].IsSplit || state.OtherBlobs[0].ReunionTime != 0 {
+        t.Errorf("other blobs show their split state: %+v", state.OtherBlobs)
+    }
+    if len(state.Food) != 2 {
+        t.Fatalf("foods are %+v", state.Food)
+    }
+    for _, food := range state.Food {
+        if (food.Mass == 2.5) != (food.Velocity.X > 0) || food.Velocity.Y != 0 {
+            t.Errorf("food has the wrong mass or velocity: %+v", food)
+        }
+    }
+    if len(state.Toxin) != 1 || state.Toxin[0].Velocity.Y <= 0 {
+        t.Errorf("toxins are %+v", state.Toxin)
+    }
+    if state.FieldSize != settings.FieldSize || state.GameTime != 42.5 || state.Tick != 17 {
+        t.Errorf("field size, game time or tick are wrong: %v %v %v", state.FieldSize, state.GameTime, state.Tick)
+    }
+    if window := gameState.Bots[1].ViewWindow; state.ViewWindow.Size.X <= 0 || !nearVec2(state.ViewWindow.Position, window.Position) {
+        t.Errorf("view window is %+v, want %+v", state.ViewWindow, window)
+    }
+}
+
+func TestUpdateRemovesTooSmallBlobs(t *testing.T) {
+    tests := []struct {
+        name        string
+        blobs       []Blob
+        wantBlobs   int
+        wantDead    bool
+    }{
+        { "last blob dies",     []Blob{ newTestBlob(500, 500, 5) },                                 0, true },
+        { "other blob remains", []Blob{ newTestBlob(500, 500, 5), newTestBlob(100, 100, 100) },     1, false },
+        { "big enough",         []Blob{ newTestBlob(500, 500, 10) },                                1, false },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, test.blobs...)
+
+        deadBots, _, _ := updateOnce(&gameState, &settings)
+
+        if count := len(gameState.Bots[1].Blobs); count != test.wantBlobs {
+            t.Errorf("%v: bot has %v blobs, want %v", test.name, count, test.wantBlobs)
+        }
+        if dead := containsBot(deadBots, 1); dead != test.wantDead {
+            t.Errorf("%v: bot is dead: %v, want %v", test.name, dead, test.wantDead)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Splitting and Throwing
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateSplit(t *testing.T) {
+    var manyBlobs []Blob
+    for i := 0; i < 11; i++ {
+        manyBlobs = append(manyBlobs, newTestBlob(50 + 60*float32(i), 500, 200))
+    }
+
+    tests := []struct {
+        name            string
+        blobs           []Blob
+        wantBlobs       int
+        wantSplitCount  int
+    }{
+        { "big blob splits",        []Blob{ newTestBlob(500, 500, 200) },                               2, 1 },
+        { "small blob stays",       []Blob{ newTestBlob(500, 500, 50) },                                1, 1 },
+        { "only big blobs split",   []Blob{ newTestBlob(500, 500, 200), newTestBlob(100, 100, 50) },    3, 1 },
+        { "too many blobs",         manyBlobs,                                                          11, 0 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        bot := newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, test.blobs...)
+        bot.Command.Action = BatSplit
+        gameState.Bots[1] = bot
+        massBefore := totalMass(bot)
+
+        updateOnce(&gameState, &settings)
+
+        bot = gameState.Bots[1]
+        if count := len(bot.Blobs); count != test.wantBlobs {
+            t.Errorf("%v: bot has %v blobs, want %v", test.name, count, test.wantBlobs)
+        }
+        if bot.StatisticsThisGame.SplitCount != test.wantSplitCount {
+            t.Errorf("%v: SplitCount is %v, want %v", test.name, bot.StatisticsThisGame.SplitCount, test.wantSplitCount)
+        }
+        if mass := totalMass(bot); !near(mass, massBefore) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, massBefore)
+        }
+        for blobId, blob := range bot.Blobs {
+            if blobId >= 100 && (!blob.IsSplit || blob.VelocityFac < 1.0) {
+                t.Errorf("%v: new blob %v is not moving away as a split blob: %v", test.name, blobId, blob)
+            }
+        }
+    }
+}
+
+func TestUpdateThrow(t *testing.T) {
+    physics := DefaultPhysics()
+
+    tests := []struct {
+        name        string
+        mass        float32
+        wantFoods   int
+        wantMass    float32
+    }{
+        { "big blob throws",        200,    1, 200 - physics.ThrownFoodMass },
+        { "small blob can not",     100,    0, 100 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        bot := newTestBot("a", 0, Vec2{ X: 600, Y: 500 }, newTestBlob(500, 500, test.mass))
+        bot.Command.Action = BatThrow
+        gameState.Bots[1] = bot
+
+        updateOnce(&gameState, &settings)
+
+        if count := len(gameState.Foods); count != test.wantFoods {
+            t.Errorf("%v: there are %v foods, want %v", test.name, count, test.wantFoods)
+        }
+        for _, food := range gameState.Foods {
+            if !food.IsThrown || food.IsThrownBy != 1 || food.Position.X <= 500 {
+                t.Errorf("%v: food is not thrown to the right by the bot: %v", test.name, food)
+            }
+        }
+        if mass := totalMass(gameState.Bots[1]); !near(mass, test.wantMass) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, test.wantMass)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Toxins
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateBlobCommands(t *testing.T) {
+    settings := newTestSettings()
+    gameState := newTestGameState(settings)
+    bot := newTestBot("a", 0, Vec2{ X: 0, Y: 800 }, newTestBlob(200, 800, 200), newTestBlob(500, 500, 200), newTestBlob(800, 200, 200))
+    bot.Command.Blobs = []BlobCommand{
+        { BlobId: 1, Action: BatSplit, Target: Vec2{ X: 1000, Y: 800 } },
+        { BlobId: 2, Action: BatThrow, Target: Vec2{ X: 500, Y: 0 } },
+    }
+    gameState.Bots[1] = bot
+
+    updateOnce(&gameState, &settings)
+
+    bot = gameState.Bots[1]
+    if count := len(bot.Blobs); count != 4 {
+        t.Errorf("bot has %v blobs, want 4", count)
+    }
+    if bot.StatisticsThisGame.SplitCount != 1 {
+        t.Errorf("SplitCount is %v, want 1", bot.StatisticsThisGame.SplitCount)
+    }
+    if blob := bot.Blobs[1]; blob.Position.X <= 200 || blob.Mass != 100 {
+        t.Errorf("blob 1 did not split and move right: %v", blob)
+    }
+    if blob := bot.Blobs[2]; blob.Position.Y >= 500 || blob.Mass != 200 - DefaultPhysics().ThrownFoodMass {
+        t.Errorf("blob 2 did not throw and move up: %v", blob)
+    }
+    if blob := bot.Blobs[3]; blob.Position.X >= 800 || blob.Mass != 200 {
+        t.Errorf("blob 3 does not follow the target of the bot: %v", blob)
+    }
+    if count := len(gameState.Foods); count != 1 {
+        t.Errorf("there are %v foods, want 1", count)
+    }
+    for _, food := range gameState.Foods {
+        if food.Position.Y >= 500 {
+            t.Errorf("food is not thrown up: %v", food)
+        }
+    }
+
+    // The actions are only done once, the targets stay.
+    command := bot.Command.WithoutActions()
+    if action, target := command.ForBlob(1); action != BatNone || target != (Vec2{ X: 1000, Y: 800 }) {
+        t.Errorf("blob 1 keeps %v, %v", action, target)
+    }
+}
+
+func TestUpdateToxinSplit(t *testing.T) {
+    tests := []struct {
+        name            string
+        mass            float32
+        splitBy         BotId
+        wantToxins      int
+        wantToxinThrow  int
+    }{
+        { "toxin at max mass",      69, 1, 1, 0 },
+        { "too heavy toxin splits", 75, 1, 2, 1 },
+        { "thrower is gone",        75, 7, 2, 0 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 100, Y: 100 }, newTestBlob(100, 100, 100))
+        gameState.Toxins[1] = Toxin{ Position: Vec2{ X: 500, Y: 500 }, Mass: test.mass, IsSplitBy: test.splitBy }
+
+        updateOnce(&gameState, &settings)
+
+        if count := len(gameState.Toxins); count != test.wantToxins {
+            t.Errorf("%v: there are %v toxins, want %v", test.name, count, test.wantToxins)
+        }
+        if throws := gameState.Bots[1].StatisticsThisGame.ToxinThrow; throws != test.wantToxinThrow {
+            t.Errorf("%v: ToxinThrow is %v, want %v", test.name, throws, test.wantToxinThrow)
+        }
+        for toxinId, toxin := range gameState.Toxins {
+            if toxin.Mass > settings.Physics.ToxinMassMax {
+                t.Errorf("%v: toxin %v is still too heavy: %v", test.name, toxinId, toxin.Mass)
+            }
+        }
+    }
+}
+
+func TestUpdateToxinExplosion(t *testing.T) {
+    var smallBlobs []Blob
+    for i := 0; i < 10; i++ {
+        smallBlobs = append(smallBlobs, newTestBlob(50 + 40*float32(i), 100, 20))
+    }
+
+    tests := []struct {
+        name                string
+        blobs               []Blob
+        toxinIsSplit        bool
+        wantBlobs           int
+        wantToxinPos        Vec2
+        wantSuccessful      int
+    }{
+        { "heavy blob explodes",        []Blob{ newTestBlob(500, 500, 500) },                               false,  12, respawnPosition,    0 },
+        { "light blob passes",          []Blob{ newTestBlob(500, 500, 300) },                               false,  1,  Vec2{ X: 500, Y: 500 },   0 },
+        { "split toxin counts",         []Blob{ newTestBlob(500, 500, 500) },                               true,   12, respawnPosition,    1 },
+        { "too many blobs to explode",  append([]Blob{ newTestBlob(500, 500, 500) }, smallBlobs...),        false,  11, respawnPosition,    0 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, test.blobs...)
+        gameState.Bots[2] = newTestBot("b", 1, Vec2{ X: 900, Y: 100 }, newTestBlob(900, 100, 50))
+        gameState.Toxins[1] = Toxin{ Position: Vec2{ X: 500, Y: 500 }, Mass: 50, IsSplit: test.toxinIsSplit, IsSplitBy: 2 }
+        massBefore := totalMass(gameState.Bots[1])
+
+        updateOnce(&gameState, &settings)
+
+        bot := gameState.Bots[1]
+        if count := len(bot.Blobs); count != test.wantBlobs {
+            t.Errorf("%v: bot has %v blobs, want %v", test.name, count, test.wantBlobs)
+        }
+        if mass := totalMass(bot); !near(mass, massBefore) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, massBefore)
+        }
+        if toxin := gameState.Toxins[1]; !nearVec2(toxin.Position, test.wantToxinPos) {
+            t.Errorf("%v: toxin is at %v, want %v", test.name, toxin.Position, test.wantToxinPos)
+        }
+        if successful := gameState.Bots[2].StatisticsThisGame.SuccessfulToxin; successful != test.wantSuccessful {
+            t.Errorf("%v: SuccessfulToxin is %v, want %v", test.name, successful, test.wantSuccessful)
+        }
+    }
+}
+
+func TestUpdateToxinsEatingFoods(t *testing.T) {
+    tests := []struct {
+        name            string
+        food            Food
+        wantMass        float32
+        wantSplitBy     BotId
+        wantEaten       bool
+    }{
+        { "thrown food is eaten",   Food{ IsThrown: true,  IsThrownBy: 3, Mass: 10, Position: Vec2{ X: 501, Y: 500 }, Velocity: Vec2{ X: 10, Y: 0 } }, 60, 3, true },
+        { "normal food stays",      Food{ IsThrown: false, Mass: 10, Position: Vec2{ X: 501, Y: 500 } },                                      50, 0, false },
+        { "thrown food too far",    Food{ IsThrown: true,  IsThrownBy: 3, Mass: 10, Position: Vec2{ X: 520, Y: 500 } },                       50, 0, false },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Toxins[1] = Toxin{ Position: Vec2{ X: 500, Y: 500 }, Mass: 50 }
+        gameState.Foods[1] = test.food
+
+        _, eatenFoods, _ := updateOnce(&gameState, &settings)
+
+        toxin := gameState.Toxins[1]
+        if !near(toxin.Mass, test.wantMass) {
+            t.Errorf("%v: toxin mass is %v, want %v", test.name, toxin.Mass, test.wantMass)
+        }
+        if toxin.IsSplitBy != test.wantSplitBy {
+            t.Errorf("%v: toxin is split by %v, want %v", test.name, toxin.IsSplitBy, test.wantSplitBy)
+        }
+        if _, ok := gameState.Foods[1]; ok == test.wantEaten || containsFood(eatenFoods, 1) != test.wantEaten {
+            t.Errorf("%v: food is eaten: %v, want %v", test.name, !ok, test.wantEaten)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Blobs of one Bot
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateBlobReunion(t *testing.T) {
+    tests := []struct {
+        name            string
+        secondPos       Vec2
+        reunionTime     float32
+        wantBlobs       int
+    }{
+        { "reunion time is over",       Vec2{ X: 500, Y: 500 }, 0.05, 1 },
+        { "reunion time is running",    Vec2{ X: 500, Y: 500 }, 5,    2 },
+        { "too far apart",              Vec2{ X: 600, Y: 500 }, 0.05, 2 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        blob1 := newTestBlob(500, 500, 100)
+        blob1.ReunionTime = test.reunionTime
+        blob2 := newTestBlob(test.secondPos.X, test.secondPos.Y, 50)
+        blob2.ReunionTime = test.reunionTime
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, blob1, blob2)
+
+        updateOnce(&gameState, &settings)
+
+        bot := gameState.Bots[1]
+        if count := len(bot.Blobs); count != test.wantBlobs {
+            t.Errorf("%v: bot has %v blobs, want %v", test.name, count, test.wantBlobs)
+        }
+        if mass := totalMass(bot); !near(mass, 150) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, 150)
+        }
+    }
+}
+
+func TestUpdatePushBlobsApart(t *testing.T) {
+    minDist := 2 * Radius(100)
+
+    tests := []struct {
+        name            string
+        sameBot         bool
+        reunionTime     float32
+        wantDist        float32
+    }{
+        { "blobs are pushed apart",         true,   5,      minDist },
+        { "reunion lets them come closer",  true,   0.5,    minDist * (0.5 - FixedTimeStep) },
+        { "other bots are not pushed",      false,  5,      0.4 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        // Both blobs are close enough to the target to stand still.
+        target := Vec2{ X: 500.2, Y: 500 }
+        blob1 := newTestBlob(500, 500, 100)
+        blob1.ReunionTime = test.reunionTime
+        blob2 := newTestBlob(500.4, 500, 100)
+        blob2.ReunionTime = test.reunionTime
+
+        var pos1, pos2 Vec2
+        if test.sameBot {
+            gameState.Bots[1] = newTestBot("a", 0, target, blob1, blob2)
+            updateOnce(&gameState, &settings)
+            pos1, pos2 = gameState.Bots[1].Blobs[1].Position, gameState.Bots[1].Blobs[2].Position
+        } else {
+            gameState.Bots[1] = newTestBot("a", 0, target, blob1)
+            gameState.Bots[2] = newTestBot("b", 1, target, blob2)
+            updateOnce(&gameState, &settings)
+            pos1, pos2 = gameState.Bots[1].Blobs[1].Position, gameState.Bots[2].Blobs[1].Position
+        }
+
+        if dist := Dist(pos1, pos2); !near(dist, test.wantDist) {
+            t.Errorf("%v: distance is %v, want %v", test.name, dist, test.wantDist)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Eating
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateEatingFoods(t *testing.T) {
+    tests := []struct {
+        name            string
+        food            Food
+        wantMass        float32
+        wantFoodPos     Vec2
+        wantEaten       bool
+    }{
+        { "food in reach respawns", Food{ Mass: 2, Position: Vec2{ X: 501, Y: 500 } },                                    102, respawnPosition,  false },
+        { "food out of reach",      Food{ Mass: 2, Position: Vec2{ X: 520, Y: 500 } },                                    100, Vec2{ X: 520, Y: 500 }, false },
+        { "thrown food is removed", Food{ IsThrown: true, IsThrownBy: 2, Mass: 10, Position: Vec2{ X: 501, Y: 500 } },    110, Vec2{},           true },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, newTestBlob(500, 500, 100))
+        gameState.Foods[1] = test.food
+
+        _, eatenFoods, _ := updateOnce(&gameState, &settings)
+
+        if mass := totalMass(gameState.Bots[1]); !near(mass, test.wantMass) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, test.wantMass)
+        }
+        food, ok := gameState.Foods[1]
+        if ok == test.wantEaten || containsFood(eatenFoods, 1) != test.wantEaten {
+            t.Errorf("%v: food is removed: %v, want %v", test.name, !ok, test.wantEaten)
+        }
+        if ok && !nearVec2(food.Position, test.wantFoodPos) {
+            t.Errorf("%v: food is at %v, want %v", test.name, food.Position, test.wantFoodPos)
+        }
+    }
+}
+
+// The quad tree of the foods has to cover big fields that are not square.
+func TestUpdateEatingFoodsOnABigField(t *testing.T) {
+    settings := newTestSettings()
+    settings.FieldSize = Vec2{ X: 4000, Y: 10000 }
+    gameState := newTestGameState(settings)
+    gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 3500, Y: 9500 }, newTestBlob(3500, 9500, 100))
+    gameState.Foods[1] = Food{ Mass: 2, Position: Vec2{ X: 3501, Y: 9500 } }
+    for foodId := FoodId(2); foodId < 20000; foodId++ {
+        gameState.Foods[foodId] = Food{ Mass: 2, Position: Vec2{ X: float32(foodId % 200) * 20, Y: float32(foodId / 200) * 20 } }
+    }
+
+    updateOnce(&gameState, &settings)
+
+    if mass := totalMass(gameState.Bots[1]); !near(mass, 102) {
+        t.Errorf("mass is %v, the food far away from the origin was not eaten", mass)
+    }
+}
+
+func TestUpdateBlobsEatingBlobs(t *testing.T) {
+    splitBlob := newTestBlob(500, 500, 200)
+    splitBlob.IsSplit = true
+
+    tests := []struct {
+        name                string
+        blob                Blob
+        otherBlobs          []Blob
+        wantMass            float32
+        wantBlobKills       int
+        wantBotKills        int
+        wantSuccessfulSplit int
+        wantDead            bool
+    }{
+        { "smaller blob is eaten",      newTestBlob(500, 500, 200), []Blob{ newTestBlob(501, 500, 50) },                                250, 1, 1, 0, true },
+        { "similar blob is not eaten",  newTestBlob(500, 500, 200), []Blob{ newTestBlob(501, 500, 190) },                               200, 0, 0, 0, false },
+        { "blob out of reach",          newTestBlob(500, 500, 200), []Blob{ newTestBlob(520, 500, 50) },                                200, 0, 0, 0, false },
+        { "bot keeps other blobs",      newTestBlob(500, 500, 200), []Blob{ newTestBlob(501, 500, 50), newTestBlob(100, 100, 50) },     250, 1, 0, 0, false },
+        { "split blob eats",            splitBlob,                  []Blob{ newTestBlob(501, 500, 50) },                                250, 1, 1, 1, true },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, test.blob.Position, test.blob)
+        gameState.Bots[2] = newTestBot("b", 1, test.otherBlobs[0].Position, test.otherBlobs...)
+
+        deadBots, _, _ := updateOnce(&gameState, &settings)
+
+        bot := gameState.Bots[1]
+        stats := bot.StatisticsThisGame
+        if mass := totalMass(bot); !near(mass, test.wantMass) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, test.wantMass)
+        }
+        if stats.BlobKillCount != test.wantBlobKills {
+            t.Errorf("%v: BlobKillCount is %v, want %v", test.name, stats.BlobKillCount, test.wantBlobKills)
+        }
+        if stats.BotKillCount != test.wantBotKills {
+            t.Errorf("%v: BotKillCount is %v, want %v", test.name, stats.BotKillCount, test.wantBotKills)
+        }
+        if stats.SuccessfulSplit != test.wantSuccessfulSplit {
+            t.Errorf("%v: SuccessfulSplit is %v, want %v", test.name, stats.SuccessfulSplit, test.wantSuccessfulSplit)
+        }
+        _, alive := gameState.Bots[2]
+        if alive == test.wantDead || containsBot(deadBots, 2) != test.wantDead {
+            t.Errorf("%v: other bot is dead: %v, want %v", test.name, !alive, test.wantDead)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Teams
+//
+////////////////////////////////////////////////////////////////////////
+
+func TestUpdateTeamMatesEating(t *testing.T) {
+    tests := []struct {
+        name            string
+        teams           []Team
+        friendlyFire    bool
+        wantMass        float32
+        wantBlobKills   int
+        wantBotKills    int
+        wantBadTeaming  int
+    }{
+        { "team mates are safe",        []Team{ { "red", []string{ "a", "b" } } },  false,  200, 0, 0, 0 },
+        { "friendly fire",              []Team{ { "red", []string{ "a", "b" } } },  true,   250, 0, 0, 1 },
+        { "same team id without teams", []Team{},                                   false,  250, 1, 1, 0 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        settings.Teams = test.teams
+        settings.FriendlyFire = test.friendlyFire
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, newTestBlob(500, 500, 200))
+        gameState.Bots[2] = newTestBot("b", 0, Vec2{ X: 501, Y: 500 }, newTestBlob(501, 500, 50))
+
+        updateOnce(&gameState, &settings)
+
+        stats := gameState.Bots[1].StatisticsThisGame
+        if mass := totalMass(gameState.Bots[1]); !near(mass, test.wantMass) {
+            t.Errorf("%v: mass is %v, want %v", test.name, mass, test.wantMass)
+        }
+        if stats.BlobKillCount != test.wantBlobKills {
+            t.Errorf("%v: BlobKillCount is %v, want %v", test.name, stats.BlobKillCount, test.wantBlobKills)
+        }
+        if stats.BotKillCount != test.wantBotKills {
+            t.Errorf("%v: BotKillCount is %v, want %v", test.name, stats.BotKillCount, test.wantBotKills)
+        }
+        if stats.BadTeaming != test.wantBadTeaming {
+            t.Errorf("%v: BadTeaming is %v, want %v", test.name, stats.BadTeaming, test.wantBadTeaming)
+        }
+    }
+}
+
+func TestUpdateFeedingTeamMates(t *testing.T) {
+    tests := []struct {
+        name                string
+        teams               []Team
+        wantSuccessfulTeam  int
+    }{
+        { "feeding a team mate",    []Team{ { "red", []string{ "a", "b" } } },  1 },
+        { "feeding an opponent",    []Team{},                                   0 },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        settings.Teams = test.teams
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 500, Y: 500 }, newTestBlob(500, 500, 100))
+        gameState.Bots[2] = newTestBot("b", 0, Vec2{ X: 100, Y: 100 }, newTestBlob(100, 100, 100))
+        gameState.Foods[1] = Food{ IsThrown: true, IsThrownBy: 2, Mass: 10, Position: Vec2{ X: 501, Y: 500 } }
+
+        updateOnce(&gameState, &settings)
+
+        if successful := gameState.Bots[2].StatisticsThisGame.SuccessfulTeam; successful != test.wantSuccessfulTeam {
+            t.Errorf("%v: SuccessfulTeam is %v, want %v", test.name, successful, test.wantSuccessfulTeam)
+        }
+    }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Whole Games
+//
+////////////////////////////////////////////////////////////////////////
+
+// Plays a game with randomly steered bots and returns the final state as JSON.
+func playTestGame(t *testing.T, seed int64, steps int) []byte {
+    settings := newTestSettings()
+    settings.MaxNumberOfFoods = 200
+    settings.MaxNumberOfToxins = 10
+    var spawns []Vec2
+    for x := 50; x < 1000; x += 100 {
+        for y := 50; y < 1000; y += 100 {
+            spawns = append(spawns, Vec2{ X: float32(x), Y: float32(y) })
+        }
+    }
+    settings.FoodDistribution  = spawns
+    settings.ToxinDistribution = spawns
+    settings.BotDistribution   = spawns
+
+    gameState := NewGameState(settings, rand.New(rand.NewSource(seed)))
+    for i, name := range []string{ "a", "b", "c", "d" } {
+        bot, ok := CreateStartingBot(&gameState, &settings, BotInfo{ Name: name }, Statistics{})
+        if !ok {
+            t.Fatalf("bot %v could not be started", name)
+        }
+        gameState.Bots[BotId(i + 1)] = bot
+    }
+
+    commands := rand.New(rand.NewSource(seed))
+    profile := NewProfile()
+    for step := 1; step <= steps; step++ {
+        for _, botId := range SortedBotIds(gameState.Bots) {
+            bot := gameState.Bots[botId]
+            bot.Command = BotCommand{
+                Action: BotActionType(commands.Intn(3)),
+                Target: Vec2{ X: commands.Float32() * 1000, Y: commands.Float32() * 1000 },
+            }
+            gameState.Bots[botId] = bot
+        }
+
+        deadBots, _, _ := Update(&gameState, &settings, &profile, FixedTimeStep, step)
+        for _, botKill := range deadBots {
+            delete(gameState.Bots, botKill.BotId)
+        }
+        Replenish(&gameState, &settings)
+    }
+
+    for botId, bot := range gameState.Bots {
+        for blobId, blob := range bot.Blobs {
+            position := blob.Position
+            if position.X < 0 || position.Y < 0 || position.X > settings.FieldSize.X || position.Y > settings.FieldSize.Y {
+                t.Errorf("blob %v of bot %v left the field: %v", blobId, botId, position)
+            }
+        }
+    }
+    if len(gameState.Foods) != settings.MaxNumberOfFoods || len(gameState.Toxins) != settings.MaxNumberOfToxins {
+        t.Errorf("there are %v foods and %v toxins after replenishing", len(gameState.Foods), len(gameState.Toxins))
+    }
+
+    state, err := json.Marshal(struct {
+        Bots    map[BotId]Bot
+        Foods   map[FoodId]Food
+        Toxins  map[ToxinId]Toxin
+    }{ gameState.Bots, gameState.Foods, gameState.Toxins })
+    if err != nil {
+        t.Fatalf("the game state can not be serialized: %v", err)
+    }
+    return state
+}
+
+func TestUpdateIsDeterministic(t *testing.T) {
+    first  := playTestGame(t, 42, 300)
+    second := playTestGame(t, 42, 300)
+    if string(first) != string(second) {
+        t.Errorf("two games with the same seed ended differently")
+    }
+}
@@ -0,0 +1,185 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "math"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Spawn Planner
+//
+////////////////////////////////////////////////////////////////////////
+
+// A new bot spawns at the position of the bot distribution, that is the farthest
+// away from everything that could eat it. Every blob needs a safety distance,
+// that grows with its mass, because big blobs reach much further with a split.
+// The safety score of a position is the smallest distance to any blob minus the
+// safety distance of that blob, so it is positive, when the bot spawns safely.
+
+const (
+    startingMass            = 100.0
+    // The number of positions of the distribution that are compared.
+    spawnCandidates         = 32
+    // A distribution of up to this many positions is searched completely.
+    spawnFullSearch         = 288
+    // The space between a new bot and any other blob.
+    spawnMargin             = 30
+    // Blobs that can eat the new bot keep this many of their radii in addition. About the reach of a split.
+    spawnThreatRadii        = 2
+    // Only the newest decisions are kept, so free play does not grow the log without end.
+    maxSpawnDecisions       = 10000
+)
+
+// One spawn, so the fairness of a graded game can be audited afterwards.
+type SpawnDecision struct {
+    // The game time that was left.
+    GameTime        float32     `json:"gameTime"`
+    Bot             string      `json:"bot"`
+    Position        Vec2        `json:"position"`
+    Safety          float32     `json:"safety"`
+    // The bot whose blob limits the safety score and the mass of that blob. Empty, if there was no blob.
+    Threat          string      `json:"threat"`
+    ThreatMass      float32     `json:"threatMass"`
+    Candidates      int         `json:"candidates"`
+    Safe            bool        `json:"safe"`
+}
+
+type SpawnAudit struct {
+    Game            string          `json:"game"`
+    Spawns          int             `json:"spawns"`
+    Unsafe          int             `json:"unsafe"`
+    MinSafety       float32         `json:"minSafety"`
+    Decisions       []SpawnDecision `json:"decisions"`
+}
+
+func MakeSpawnAudit(game string, decisions []SpawnDecision) SpawnAudit {
+    audit := SpawnAudit{ Game: game, Spawns: len(decisions), Decisions: decisions }
+    for i, decision := range decisions {
+        if !decision.Safe {
+            audit.Unsafe++
+        }
+        if i == 0 || decision.Safety < audit.MinSafety {
+            audit.MinSafety = decision.Safety
+        }
+    }
+    return audit
+}
+
+// Teammates cannot eat each other without friendly fire. The split reach only counts
+// for blobs that are big enough to eat the new bot after the split.
+func safetyDistance(settings *ServerSettings, blob Blob, teamMate bool) float32 {
+    distance := blob.Radius() + Radius(startingMass) + spawnMargin
+    if (!teamMate || settings.FriendlyFire) && startingMass < 0.9*blob.Mass {
+        distance += spawnThreatRadii * blob.Radius()
+    }
+    return distance
+}
+
+// A blob that limits the safety of a new bot.
+type spawnThreat struct {
+    botId           BotId
+    blob            Blob
+    distance        float32
+}
+
+// The safety distances only depend on the blobs, so they are computed once for every spawn.
+func spawnThreats(gameState *GameState, settings *ServerSettings, name string) []spawnThreat {
+    threats := []spawnThreat{}
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        teamMate := settings.TeamMode() && settings.TeamName(bot.Info.Name) == settings.TeamName(name)
+        for _, blobId := range SortedBlobIds(bot.Blobs) {
+            blob := bot.Blobs[blobId]
+            threats = append(threats, spawnThreat{ botId: botId, blob: blob, distance: safetyDistance(settings, blob, teamMate) })
+        }
+    }
+    return threats
+}
+
+// The safety score of a position and the blob that limits it.
+// Without any blob the score is the diagonal of the field.
+func spawnSafety(threats []spawnThreat, settings *ServerSettings, position Vec2) (float32, BotId, Blob) {
+    safety := Length(settings.FieldSize)
+    var threat BotId
+    var threatBlob Blob
+    for _, t := range threats {
+        if score := Dist(position, t.blob.Position) - t.distance; score < safety {
+            safety, threat, threatBlob = score, t.botId, t.blob
+        }
+    }
+    return safety, threat, threatBlob
+}
+
+// A stride that is coprime to the length visits every position once. It is about
+// the golden ratio of the length, so consecutive positions lie far apart.
+func spawnStride(length int) int {
+    stride := int(float64(length) * 0.618)
+    if stride < 1 {
+        stride = 1
+    }
+    for gcd(stride, length) != 1 {
+        stride++
+    }
+    return stride
+}
+
+func gcd(a, b int) int {
+    for b != 0 {
+        a, b = b, a % b
+    }
+    return a
+}
+
+func planBotPosition(gameState *GameState, settings *ServerSettings, name string) (Vec2, bool) {
+    length := len(settings.BotDistribution)
+    if length == 0 {
+        return Vec2{}, false
+    }
+
+    threats := spawnThreats(gameState, settings, name)
+    decision := SpawnDecision{ GameTime: gameState.GameTime, Bot: name, Safety: -math.MaxFloat32 }
+    var threat BotId
+    consider := func(position Vec2) {
+        safety, botId, blob := spawnSafety(threats, settings, position)
+        decision.Candidates++
+        if safety > decision.Safety {
+            decision.Position, decision.Safety, decision.ThreatMass = position, safety, blob.Mass
+            threat = botId
+        }
+    }
+
+    // A small distribution is searched completely. It starts at a random position, so the first bot does not always spawn at the same place.
+    if length <= spawnFullSearch {
+        offset := gameState.Random.Intn(length)
+        for i := 0; i < length; i++ {
+            consider(settings.BotDistribution[(offset + i) % length])
+        }
+    } else {
+        for i := 0; i < spawnCandidates; i++ {
+            consider(settings.BotDistribution[gameState.Random.Intn(length)])
+        }
+        // When none of them is safe, the whole distribution is searched until a safe position is found.
+        offset, stride := gameState.Random.Intn(length), spawnStride(length)
+        for i := 0; i < length && decision.Safety < 0; i++ {
+            consider(settings.BotDistribution[(offset + i*stride) % length])
+        }
+    }
+
+    decision.Safe = decision.Safety >= 0
+    if bot, ok := gameState.Bots[threat]; ok && decision.ThreatMass > 0 {
+        decision.Threat = bot.Info.Name
+    }
+    if !decision.Safe {
+        Logf(LtDebug, "Bot %v spawns %.0f closer to %v than it should, there was no safe position.\n", name, -decision.Safety, decision.Threat)
+    }
+
+    gameState.Spawns = append(gameState.Spawns, decision)
+    if len(gameState.Spawns) > maxSpawnDecisions {
+        gameState.Spawns = gameState.Spawns[len(gameState.Spawns) - maxSpawnDecisions:]
+    }
+    return decision.Position, true
+}
@@ -0,0 +1,129 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "math"
+    "testing"
+)
+
+func TestPlanBotPosition(t *testing.T) {
+    a := Vec2{ X: 100, Y: 100 }
+    b := Vec2{ X: 900, Y: 900 }
+    team := []Team{ { Name: "team", Bots: []string{ "new", "mate" } } }
+
+    tests := []struct {
+        name            string
+        teams           []Team
+        friendlyFire    bool
+        bots            []Bot
+        wantPosition    Vec2
+        wantSafe        bool
+        wantThreat      string
+    }{
+        // Every position is equally good.
+        { "empty field",                nil,    false,  nil,                                                                                                            Vec2{}, true,   "" },
+        { "away from a big enemy",      nil,    false,  []Bot{ newTestBot("enemy", 1, a, newTestBlob(150, 150, 2000)) },                                               b,  true,   "enemy" },
+        // The small enemy is closer to b, but a split of the big one reaches a.
+        { "bigger threats keep more",   nil,    false,  []Bot{ newTestBot("big", 1, a, newTestBlob(100, 250, 5000)), newTestBot("small", 2, a, newTestBlob(900, 800, 150)) },  b,  true,   "small" },
+        { "teammates are no threat",    team,   false,  []Bot{ newTestBot("mate", 1, a, newTestBlob(100, 200, 2000)), newTestBot("enemy", 2, a, newTestBlob(900, 850, 150)) }, a,  true,   "mate" },
+        { "friendly fire",              team,   true,   []Bot{ newTestBot("mate", 1, a, newTestBlob(100, 200, 2000)), newTestBot("enemy", 2, a, newTestBlob(900, 850, 150)) }, b,  false,  "enemy" },
+        { "no safe position",           nil,    false,  []Bot{ newTestBot("enemy", 1, a, newTestBlob(400, 400, 1000000)) },                                            b,  false,  "enemy" },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        settings.Teams = test.teams
+        settings.FriendlyFire = test.friendlyFire
+        settings.BotDistribution = []Vec2{ a, b }
+        gameState := newTestGameState(settings)
+        for i, bot := range test.bots {
+            gameState.Bots[BotId(i + 1)] = bot
+        }
+
+        bot, ok := CreateStartingBot(&gameState, &settings, BotInfo{ Name: "new" }, Statistics{})
+        position := bot.Blobs[0].Position
+        if !ok || (test.wantPosition != Vec2{} && position != test.wantPosition) || (position != a && position != b) {
+            t.Errorf("%v: the bot spawned at %v, want %v", test.name, position, test.wantPosition)
+        }
+        if len(gameState.Spawns) != 1 {
+            t.Fatalf("%v: %v spawn decisions", test.name, len(gameState.Spawns))
+        }
+        decision := gameState.Spawns[0]
+        if decision.Safe != test.wantSafe || decision.Threat != test.wantThreat || decision.Candidates != 2 || decision.Bot != "new" {
+            t.Errorf("%v: the decision is %+v", test.name, decision)
+        }
+        if test.bots == nil && math.Abs(float64(decision.Safety - Length(settings.FieldSize))) > epsilon {
+            t.Errorf("%v: the safety of an empty field is %v", test.name, decision.Safety)
+        }
+    }
+}
+
+// A big distribution is searched completely, before a bot spawns at an unsafe position.
+func TestPlanBotPositionInABigDistribution(t *testing.T) {
+    a := Vec2{ X: 100, Y: 100 }
+    b := Vec2{ X: 900, Y: 900 }
+    enemy := newTestBot("enemy", 1, a, newTestBlob(150, 150, 2000))
+
+    tests := []struct {
+        name            string
+        safeIndices     []int
+        wantSafe        bool
+    }{
+        { "one safe position",      []int{ 1500 },  true },
+        { "no safe position",       nil,            false },
+    }
+
+    for _, test := range tests {
+        settings := newTestSettings()
+        settings.BotDistribution = make([]Vec2, 2000)
+        for i := range settings.BotDistribution {
+            settings.BotDistribution[i] = a
+        }
+        for _, index := range test.safeIndices {
+            settings.BotDistribution[index] = b
+        }
+        gameState := newTestGameState(settings)
+        gameState.Bots[1] = enemy
+
+        position, ok := planBotPosition(&gameState, &settings, "new")
+        decision := gameState.Spawns[0]
+        if !ok || decision.Safe != test.wantSafe || (test.wantSafe && position != b) {
+            t.Errorf("%v: the bot spawned at %v, the decision is %+v", test.name, position, decision)
+        }
+        if !test.wantSafe && decision.Candidates != spawnCandidates + len(settings.BotDistribution) {
+            t.Errorf("%v: only %v positions were compared", test.name, decision.Candidates)
+        }
+    }
+}
+
+func TestSafetyDistanceGrowsWithTheMass(t *testing.T) {
+    settings := newTestSettings()
+    var last float32
+    for _, mass := range []float32{ 50, 100, 200, 1000, 5000 } {
+        distance := safetyDistance(&settings, newTestBlob(0, 0, mass), false)
+        if distance <= last {
+            t.Errorf("the safety distance of a blob with a mass of %v is %v, it was %v for a smaller one", mass, distance, last)
+        }
+        last = distance
+    }
+
+    // Blobs that cannot eat the new bot only keep the margin.
+    blob := newTestBlob(0, 0, 100)
+    if distance := safetyDistance(&settings, blob, false); math.Abs(float64(distance - blob.Radius() - Radius(startingMass) - spawnMargin)) > epsilon {
+        t.Errorf("the safety distance of a harmless blob is %v", distance)
+    }
+}
+
+func TestMakeSpawnAudit(t *testing.T) {
+    audit := MakeSpawnAudit("game", []SpawnDecision{
+        { Bot: "a", Safety: 120, Safe: true },
+        { Bot: "b", Safety: -15, Safe: false },
+        { Bot: "c", Safety: 40, Safe: true },
+    })
+    if audit.Spawns != 3 || audit.Unsafe != 1 || audit.MinSafety != -15 {
+        t.Errorf("the audit is %+v", audit)
+    }
+}
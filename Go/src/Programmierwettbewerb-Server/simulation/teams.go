@@ -0,0 +1,115 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "math"
+    "strconv"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Teams
+//
+////////////////////////////////////////////////////////////////////////
+
+// The bots with one of these names play together.
+type Team struct {
+    Name        string
+    Bots        []string
+}
+
+// The team rules only apply, when the game defines teams. Otherwise bots
+// with the same name still share a TeamId, but they play against each other.
+func (settings *ServerSettings) TeamMode() bool {
+    return len(settings.Teams) > 0
+}
+
+// Bots that are not part of a team play in a team of their own name.
+func (settings *ServerSettings) TeamName(botName string) string {
+    for _, team := range settings.Teams {
+        for _, name := range team.Bots {
+            if name == botName {
+                return team.Name
+            }
+        }
+    }
+    return botName
+}
+
+func (settings *ServerSettings) areTeamMates(bot1 Bot, bot2 Bot) bool {
+    return settings.TeamMode() && bot1.TeamId == bot2.TeamId
+}
+
+// The statistics of the bots of a team that already died in this game.
+type TeamScore struct {
+    Name        string
+    Statistics  Statistics
+}
+
+// The maxima stay maxima, everything else is summed up.
+func addStatistics(a Statistics, b Statistics) Statistics {
+    return Statistics{
+        MaxSize:            float32(math.Max(float64(a.MaxSize), float64(b.MaxSize))),
+        MaxSurvivalTime:    float32(math.Max(float64(a.MaxSurvivalTime), float64(b.MaxSurvivalTime))),
+        BlobKillCount:      a.BlobKillCount + b.BlobKillCount,
+        BotKillCount:       a.BotKillCount + b.BotKillCount,
+        ToxinThrow:         a.ToxinThrow + b.ToxinThrow,
+        SuccessfulToxin:    a.SuccessfulToxin + b.SuccessfulToxin,
+        SplitCount:         a.SplitCount + b.SplitCount,
+        SuccessfulSplit:    a.SuccessfulSplit + b.SuccessfulSplit,
+        SuccessfulTeam:     a.SuccessfulTeam + b.SuccessfulTeam,
+        BadTeaming:         a.BadTeaming + b.BadTeaming,
+    }
+}
+
+// Keeps the statistics of dead bots, so they still count for their team.
+func (gameState *GameState) RecordDeadBots(settings *ServerSettings, botKills []BotKill) {
+    if !settings.TeamMode() {
+        return
+    }
+    for _, botKill := range botKills {
+        score, ok := gameState.Teams[botKill.TeamId]
+        if !ok {
+            score.Name = settings.TeamName(botKill.Name)
+        }
+        score.Statistics = addStatistics(score.Statistics, botKill.StatisticsThisGame)
+        gameState.Teams[botKill.TeamId] = score
+    }
+}
+
+// Starts the scores of a new game.
+func (gameState *GameState) ResetTeams() {
+    gameState.Teams = make(map[TeamId]TeamScore)
+}
+
+// The totals of all teams of the living and the dead bots. Empty, if there is no team mode.
+func TeamTotals(gameState *GameState, settings *ServerSettings) map[string]ServerGuiTeam {
+    teams := make(map[string]ServerGuiTeam)
+    if !settings.TeamMode() {
+        return teams
+    }
+
+    for teamId, score := range gameState.Teams {
+        teams[strconv.Itoa(int(teamId))] = ServerGuiTeam{ Name: score.Name, Statistics: score.Statistics }
+    }
+
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        key := strconv.Itoa(int(bot.TeamId))
+
+        team, ok := teams[key]
+        if !ok {
+            team.Name = settings.TeamName(bot.Info.Name)
+        }
+        for _, blob := range bot.Blobs {
+            team.Mass += int(blob.Mass)
+        }
+        team.Bots += 1
+        team.Statistics = addStatistics(team.Statistics, bot.StatisticsThisGame)
+        teams[key] = team
+    }
+
+    return teams
+}
@@ -0,0 +1,309 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "errors"
+    "fmt"
+    "math"
+    "os"
+    "golang.org/x/image/bmp"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Walls
+//
+////////////////////////////////////////////////////////////////////////
+
+// The walls come from an image in the spawns directory like the spawn distributions.
+// Every pixel is a cell of the field. Dark pixels are solid, bright pixels are free.
+type Walls struct {
+    Columns     int
+    Rows        int
+    CellSize    Vec2
+    // Row by row, true for every solid cell.
+    Solid       []bool
+    // The solid cells merged into rectangles, for the bots and the guis.
+    Rects       []Wall
+}
+
+// Pixels darker than this are solid.
+const wallDarkness = 0.5
+
+func NewWalls(fieldSize Vec2, columns, rows int, solid []bool) Walls {
+    walls := Walls{
+        Columns:    columns,
+        Rows:       rows,
+        CellSize:   Vec2{ X: fieldSize.X / float32(columns), Y: fieldSize.Y / float32(rows) },
+        Solid:      solid,
+    }
+    walls.Rects = walls.mergeCells()
+    return walls
+}
+
+// An empty name gives a field without walls.
+func LoadWalls(fieldSize Vec2, imageName string) (Walls, error) {
+    if imageName == "" {
+        return Walls{}, nil
+    }
+
+    var filename = MakeLocalSpawnName(imageName)
+    fImg, err := os.Open(filename)
+    if err != nil {
+        return Walls{}, errors.New(fmt.Sprintf("The walls %v can not be loaded: %v", filename, err.Error()))
+    }
+    defer fImg.Close()
+    image, err := bmp.Decode(fImg)
+    if err != nil {
+        return Walls{}, errors.New(fmt.Sprintf("The walls %v can not be loaded: %v", filename, err.Error()))
+    }
+
+    bounds := image.Bounds()
+    columns, rows := bounds.Dx(), bounds.Dy()
+    solid := make([]bool, columns * rows)
+    for row := 0; row < rows; row++ {
+        for column := 0; column < columns; column++ {
+            r, g, b, _ := image.At(bounds.Min.X + column, bounds.Min.Y + row).RGBA()
+            gray := (299*float32(r) + 587*float32(g) + 114*float32(b)) / 1000 / 0xffff
+            solid[row * columns + column] = 1 - gray >= wallDarkness
+        }
+    }
+    return NewWalls(fieldSize, columns, rows, solid), nil
+}
+
+func (walls *Walls) HasWalls() bool {
+    return len(walls.Rects) > 0
+}
+
+// Cells outside of the field are never solid, limitPosition keeps everything inside.
+func (walls *Walls) isSolid(column, row int) bool {
+    return walls.isInside(column, row) && walls.Solid[row * walls.Columns + column]
+}
+
+func (walls *Walls) isInside(column, row int) bool {
+    return column >= 0 && row >= 0 && column < walls.Columns && row < walls.Rows
+}
+
+func (walls *Walls) cell(position Vec2) (int, int) {
+    return int(math.Floor(float64(position.X / walls.CellSize.X))), int(math.Floor(float64(position.Y / walls.CellSize.Y)))
+}
+
+// Whether the position is not inside of a wall.
+func (walls *Walls) IsFree(position Vec2) bool {
+    if !walls.HasWalls() {
+        return true
+    }
+    column, row := walls.cell(position)
+    return !walls.isSolid(column, row)
+}
+
+// Only the positions of a spawn distribution that are not inside of a wall.
+func (walls *Walls) freePositions(distribution []Vec2) []Vec2 {
+    if !walls.HasWalls() {
+        return distribution
+    }
+    var free []Vec2
+    for _, position := range distribution {
+        if walls.IsFree(position) {
+            free = append(free, position)
+        }
+    }
+    return free
+}
+
+// Walls that cover every position of a spawn image leave nothing to spawn there.
+func (walls *Walls) checkSpawns(fieldSize Vec2, spawnImages []string) error {
+    if !walls.HasWalls() {
+        return nil
+    }
+    for _, image := range spawnImages {
+        distribution := LoadSpawnImage(fieldSize, image)
+        if len(distribution) > 0 && len(walls.freePositions(distribution)) == 0 {
+            return errors.New(fmt.Sprintf("The walls cover every position of the spawn image %v.", image))
+        }
+    }
+    return nil
+}
+
+// Checks the walls image before the settings are changed. A zero size is the default size.
+func CheckWalls(fieldSize Vec2, wallsImage string, spawnImages ...string) error {
+    fieldSize = fieldSizeOrDefault(fieldSize)
+    walls, err := LoadWalls(fieldSize, wallsImage)
+    if err != nil {
+        return err
+    }
+    return walls.checkSpawns(fieldSize, spawnImages)
+}
+
+// The walls that reach into the view window.
+func (walls *Walls) InView(viewWindow ViewWindow) []Wall {
+    var result []Wall
+    for _, wall := range walls.Rects {
+        if wall.Position.X < viewWindow.Position.X + viewWindow.Size.X &&
+           wall.Position.Y < viewWindow.Position.Y + viewWindow.Size.Y &&
+           wall.Position.X + wall.Size.X > viewWindow.Position.X &&
+           wall.Position.Y + wall.Size.Y > viewWindow.Position.Y {
+            result = append(result, wall)
+        }
+    }
+    return result
+}
+
+// Neighbouring solid cells of a row become one rectangle. Equal rectangles in consecutive rows are merged as well.
+func (walls *Walls) mergeCells() []Wall {
+    type run struct {
+        start, end  int
+    }
+    var rects []Wall
+    open := make(map[run]int)
+    for row := 0; row < walls.Rows; row++ {
+        next := make(map[run]int)
+        for column := 0; column < walls.Columns; column++ {
+            if !walls.isSolid(column, row) {
+                continue
+            }
+            current := run{ start: column }
+            for column < walls.Columns && walls.isSolid(column, row) {
+                column++
+            }
+            current.end = column
+
+            if index, ok := open[current]; ok {
+                rects[index].Size.Y += walls.CellSize.Y
+                next[current] = index
+            } else {
+                next[current] = len(rects)
+                rects = append(rects, Wall{
+                    Position:   Vec2{ X: float32(current.start) * walls.CellSize.X, Y: float32(row) * walls.CellSize.Y },
+                    Size:       Vec2{ X: float32(current.end - current.start) * walls.CellSize.X, Y: walls.CellSize.Y },
+                })
+            }
+        }
+        open = next
+    }
+    return rects
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Collisions
+//
+////////////////////////////////////////////////////////////////////////
+
+func clamp(value, min, max float32) float32 {
+    return float32(math.Max(float64(min), math.Min(float64(max), float64(value))))
+}
+
+func dot(a, b Vec2) float32 {
+    return a.X*b.X + a.Y*b.Y
+}
+
+// Pushes a circle out of all walls it overlaps.
+// Returns the new position, the direction it was pushed in and whether it touched a wall at all.
+func (walls *Walls) Collide(position Vec2, radius float32) (Vec2, Vec2, bool) {
+    if !walls.HasWalls() {
+        return position, Vec2{}, false
+    }
+
+    var normal Vec2
+    hit := false
+    minColumn, minRow := walls.cell(Sub(position, Vec2{ X: radius, Y: radius }))
+    maxColumn, maxRow := walls.cell(Add(position, Vec2{ X: radius, Y: radius }))
+    for row := minRow; row <= maxRow; row++ {
+        for column := minColumn; column <= maxColumn; column++ {
+            if !walls.isSolid(column, row) {
+                continue
+            }
+            cellMin := Vec2{ X: float32(column) * walls.CellSize.X, Y: float32(row) * walls.CellSize.Y }
+            cellMax := Add(cellMin, walls.CellSize)
+            closest := Vec2{ X: clamp(position.X, cellMin.X, cellMax.X), Y: clamp(position.Y, cellMin.Y, cellMax.Y) }
+
+            var push Vec2
+            if distance := Dist(position, closest); distance > 0 {
+                if distance >= radius {
+                    continue
+                }
+                push = Muls(Sub(position, closest), (radius - distance) / distance)
+            } else {
+                push = walls.pushOut(position, radius, column, row, cellMin, cellMax)
+            }
+            position = Add(position, push)
+            normal = Add(normal, push)
+            hit = true
+        }
+    }
+    return position, NormalizeOrZero(normal), hit
+}
+
+// The center is inside of the cell. The circle leaves it over the nearest side
+// that has no solid neighbour, or over the nearest side at all, if it is buried.
+func (walls *Walls) pushOut(position Vec2, radius float32, column, row int, cellMin, cellMax Vec2) Vec2 {
+    sides := []struct {
+        push            Vec2
+        column, row     int
+    }{
+        { Vec2{ X: cellMin.X - radius - position.X }, column - 1, row },
+        { Vec2{ X: cellMax.X + radius - position.X }, column + 1, row },
+        { Vec2{ Y: cellMin.Y - radius - position.Y }, column, row - 1 },
+        { Vec2{ Y: cellMax.Y + radius - position.Y }, column, row + 1 },
+    }
+    var best, nearest Vec2
+    var bestLength, nearestLength float32 = math.MaxFloat32, math.MaxFloat32
+    for _, side := range sides {
+        length := Length(side.push)
+        if length < nearestLength {
+            nearest, nearestLength = side.push, length
+        }
+        if walls.isInside(side.column, side.row) && !walls.isSolid(side.column, side.row) && length < bestLength {
+            best, bestLength = side.push, length
+        }
+    }
+    if bestLength < math.MaxFloat32 {
+        return best
+    }
+    return nearest
+}
+
+// Moves a circle along the way from one position to another. The way is checked
+// in steps of half a cell, so small and fast things cannot pass through a wall.
+// At a wall the circle slides along it.
+// Returns the new position, the normal of the last wall it touched and whether it touched one.
+func (walls *Walls) Move(from, to Vec2, radius float32) (Vec2, Vec2, bool) {
+    if !walls.HasWalls() {
+        return to, Vec2{}, false
+    }
+
+    stepLength := float32(math.Min(float64(walls.CellSize.X), float64(walls.CellSize.Y))) / 2
+    steps := int(math.Ceil(float64(Dist(from, to) / stepLength)))
+    if steps < 1 {
+        steps = 1
+    }
+    step := Muls(Sub(to, from), 1 / float32(steps))
+
+    position := from
+    var normal Vec2
+    hit := false
+    for i := 0; i < steps; i++ {
+        var stepNormal Vec2
+        var stepHit bool
+        if position, stepNormal, stepHit = walls.Collide(Add(position, step), radius); stepHit {
+            normal = stepNormal
+            hit = true
+            if into := dot(step, normal); into < 0 {
+                step = Sub(step, Muls(normal, into))
+            }
+        }
+    }
+    return position, normal, hit
+}
+
+// Mirrors a velocity at a wall, if it points into the wall.
+func bounce(velocity Vec2, normal Vec2) Vec2 {
+    if into := dot(velocity, normal); into < 0 {
+        return Sub(velocity, Muls(normal, 2 * into))
+    }
+    return velocity
+}
@@ -0,0 +1,152 @@
+package simulation
+
+import (
+    . "Programmierwettbewerb-Server/vector"
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/connections"
+
+    "reflect"
+    "testing"
+)
+
+// A field of 100x100 with cells of 10x10:
+//     ..........
+//     .###......
+//     .###......
+//     ..........
+//     .....#....
+//     ..........
+func newTestWalls() Walls {
+    solid := make([]bool, 10 * 10)
+    for _, cell := range [][2]int{ { 1, 1 }, { 2, 1 }, { 3, 1 }, { 1, 2 }, { 2, 2 }, { 3, 2 }, { 5, 4 } } {
+        solid[cell[1] * 10 + cell[0]] = true
+    }
+    return NewWalls(Vec2{ X: 100, Y: 100 }, 10, 10, solid)
+}
+
+func TestWallsMergeCells(t *testing.T) {
+    walls := newTestWalls()
+    want := []Wall{
+        { Position: Vec2{ X: 10, Y: 10 }, Size: Vec2{ X: 30, Y: 20 } },
+        { Position: Vec2{ X: 50, Y: 40 }, Size: Vec2{ X: 10, Y: 10 } },
+    }
+    if !reflect.DeepEqual(walls.Rects, want) {
+        t.Errorf("the walls are %v, want %v", walls.Rects, want)
+    }
+
+    inView := walls.InView(ViewWindow{ Position: Vec2{ X: 45, Y: 45 }, Size: Vec2{ X: 50, Y: 50 } })
+    if len(inView) != 1 || inView[0] != want[1] {
+        t.Errorf("the walls in view are %v", inView)
+    }
+}
+
+func TestWallsCollide(t *testing.T) {
+    walls := newTestWalls()
+    tests := []struct {
+        name        string
+        position    Vec2
+        radius      float32
+        want        Vec2
+        hit         bool
+    }{
+        { "free",                   Vec2{ X: 80, Y: 80 }, 5, Vec2{ X: 80, Y: 80 },             false },
+        { "touching the left side", Vec2{ X: 8, Y: 20 },  5, Vec2{ X: 5, Y: 20 },              true },
+        { "touching a corner",      Vec2{ X: 62, Y: 52 }, 5, Vec2{ X: 63.5355, Y: 53.5355 },   true },
+        { "center inside",          Vec2{ X: 52, Y: 45 }, 1, Vec2{ X: 49, Y: 45 },             true },
+        // The nearest side of the cell is the one to the other cell of the wall.
+        { "inside of a thick wall", Vec2{ X: 29, Y: 15 }, 1, Vec2{ X: 29, Y: 9 },              true },
+    }
+    for _, test := range tests {
+        position, _, hit := walls.Collide(test.position, test.radius)
+        if hit != test.hit || !nearVec2(position, test.want) {
+            t.Errorf("%v: position %v and hit %v, want %v and %v", test.name, position, hit, test.want, test.hit)
+        }
+    }
+
+    if !walls.IsFree(Vec2{ X: 5, Y: 5 }) || walls.IsFree(Vec2{ X: 15, Y: 25 }) {
+        t.Errorf("IsFree does not know the walls")
+    }
+}
+
+func TestWallsMoveDoesNotTunnel(t *testing.T) {
+    walls := newTestWalls()
+
+    // Much faster than a cell per step.
+    position, normal, hit := walls.Move(Vec2{ X: 55, Y: 35 }, Vec2{ X: 55, Y: 75 }, 1)
+    if !hit || position.Y > 39 || !nearVec2(normal, Vec2{ X: 0, Y: -1 }) {
+        t.Errorf("the food ends at %v with the normal %v", position, normal)
+    }
+
+    // Sliding along the top of the wall.
+    position, _, _ = walls.Move(Vec2{ X: 15, Y: 5 }, Vec2{ X: 35, Y: 15 }, 4)
+    if !nearVec2(position, Vec2{ X: 35, Y: 6 }) {
+        t.Errorf("the blob slides to %v", position)
+    }
+}
+
+func TestUpdateWalls(t *testing.T) {
+    settings := newTestSettings()
+    solid := make([]bool, 10 * 10)
+    // A vertical wall from x = 600 to 700.
+    for row := 0; row < 10; row++ {
+        solid[row * 10 + 6] = true
+    }
+    settings.Walls = NewWalls(settings.FieldSize, 10, 10, solid)
+
+    gameState := newTestGameState(settings)
+    gameState.Bots[1] = newTestBot("a", 0, Vec2{ X: 900, Y: 500 }, newTestBlob(590, 500, 100))
+    gameState.Foods[1] = Food{ IsMoving: true, Position: Vec2{ X: 595, Y: 300 }, Velocity: Vec2{ X: 1000, Y: 0 }, Mass: 1 }
+
+    updateOnce(&gameState, &settings)
+
+    blob := gameState.Bots[1].Blobs[1]
+    if blob.Position.X + blob.Radius() > 600 + epsilon {
+        t.Errorf("the blob is at %v inside of the wall", blob.Position)
+    }
+    food := gameState.Foods[1]
+    if food.Position.X > 600 || food.Velocity.X >= 0 {
+        t.Errorf("the food is at %v with the velocity %v", food.Position, food.Velocity)
+    }
+}
+
+func TestReplenishWithoutFreePositions(t *testing.T) {
+    settings := newTestSettings()
+    settings.FoodDistribution  = nil
+    settings.ToxinDistribution = nil
+
+    // Nothing can be placed, but the refill must not wait for a free position.
+    gameState := newTestGameState(settings)
+    Replenish(&gameState, &settings)
+    if len(gameState.Foods) != 0 || len(gameState.Toxins) != 0 {
+        t.Errorf("%v foods and %v toxins are placed without a free position", len(gameState.Foods), len(gameState.Toxins))
+    }
+}
+
+func TestSpawnPixelsMatchTheWallCells(t *testing.T) {
+    tests := []struct {
+        index       int
+        cellSize    float32
+        wantMin     int
+        wantMax     int
+    }{
+        { 0,    10,     0,  9 },
+        { 1,    10,     10, 19 },
+        { 1,    2.5,    3,  4 },
+        { 2,    2.5,    5,  7 },
+    }
+
+    for _, test := range tests {
+        min, max := pixelRange(test.index, test.cellSize)
+        if min != test.wantMin || max != test.wantMax {
+            t.Errorf("pixel %v of size %v covers %v to %v, want %v to %v", test.index, test.cellSize, min, max, test.wantMin, test.wantMax)
+        }
+
+        // The spawn positions of a pixel are inside of the wall cell of the same pixel.
+        walls := Walls{ CellSize: Vec2{ X: test.cellSize, Y: test.cellSize } }
+        for _, position := range []int{ min, max } {
+            if column, _ := walls.cell(Vec2{ X: float32(position) }); column != test.index {
+                t.Errorf("the position %v of pixel %v is in the cell %v", position, test.index, column)
+            }
+        }
+    }
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    . "Programmierwettbewerb-Server/shared"
+    . "Programmierwettbewerb-Server/simulation"
+    . "Programmierwettbewerb-Server/tournament"
+
+    "errors"
+    "fmt"
+    "strings"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Tournament Runner
+//
+////////////////////////////////////////////////////////////////////////
+
+// The runner plays the matches of a tournament one after another. It only uses
+// the same server commands as the server gui, so a recording of a tournament
+// game can be replayed without it.
+
+const (
+    // The started bots need some time to connect before the game starts.
+    tournamentStartDelay = 10
+)
+
+type TournamentPhase int
+const (
+    TpWaitingForBots    TournamentPhase = iota
+    TpPlaying
+)
+
+type TournamentRunner struct {
+    tournament          *Tournament
+    match               Match
+    phase               TournamentPhase
+    waited              float32
+}
+
+func startTournament(name string) (*TournamentRunner, error) {
+    tournament, err := LoadTournament(name)
+    if err != nil {
+        return nil, err
+    }
+    if _, ok := games[tournament.Game]; !ok {
+        return nil, errors.New(fmt.Sprintf("The game \"%v\" of the tournament is not in the games file.", tournament.Game))
+    }
+
+    runner := &TournamentRunner{ tournament: tournament }
+    runner.startNextMatch()
+    return runner, nil
+}
+
+func (runner *TournamentRunner) isFinished() bool {
+    return runner.tournament.Finished
+}
+
+func (runner *TournamentRunner) save() {
+    if err := runner.tournament.Save(); err != nil {
+        Logf(LtDebug, "Could not save the tournament %v: %v\n", runner.tournament.Name, err.Error())
+    }
+}
+
+func (runner *TournamentRunner) startNextMatch() {
+    match, ok := runner.tournament.NextMatch()
+    if !ok {
+        runner.save()
+        LogfColored(LtDebug, LcGreen, "Tournament %v finished\n", runner.tournament.Name)
+        for i, standing := range runner.tournament.Standings() {
+            LogfColored(LtDebug, LcGreen, "  %v. %v: %v points, score %v\n", i + 1, standing.Participant, standing.Points, standing.Score)
+        }
+        return
+    }
+
+    runner.match = match
+    runner.phase = TpWaitingForBots
+    runner.waited = 0
+
+    LogfColored(LtDebug, LcGreen, "Tournament %v, round %v: %v\n", runner.tournament.Name, match.Round, strings.Join(match.Players, " vs. "))
+    queueServerCommand(Command{ Type: "GameName", GameName: runner.tournament.Game, Bots: strings.Join(match.Svns(), ",") })
+}
+
+// Called by the update loop after the server commands of the step are handled.
+func (runner *TournamentRunner) update(gameState *GameState, gameFinished bool, dt float32) {
+    switch runner.phase {
+    case TpWaitingForBots:
+        runner.waited += dt
+        if runner.waited >= tournamentStartDelay {
+            runner.phase = TpPlaying
+            queueServerCommand(Command{ Type: "StartSimulation" })
+        }
+    case TpPlaying:
+        if gameFinished {
+            scores := matchScores(gameState)
+            Logf(LtDebug, "Tournament match finished: %v\n", scores)
+            runner.tournament.Record(scores)
+            runner.save()
+            runner.startNextMatch()
+        }
+    }
+}
+
+// The mass of all bots of a repository, that are still alive.
+func matchScores(gameState *GameState) map[string]float32 {
+    scores := make(map[string]float32)
+    for _, botId := range SortedBotIds(gameState.Bots) {
+        bot := gameState.Bots[botId]
+        repository := app.repositories[botId]
+        for _, blobId := range SortedBlobIds(bot.Blobs) {
+            scores[repository] += bot.Blobs[blobId].Mass
+        }
+    }
+    return scores
+}
+
+func queueServerCommand(command Command) {
+    app.serverCommandsMutex.Lock()
+    app.serverCommands = append(app.serverCommands, command)
+    app.serverCommandsMutex.Unlock()
+}
@@ -0,0 +1,519 @@
+package tournament
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Constants
+//
+////////////////////////////////////////////////////////////////////////
+
+const (
+    // A tournament is defined in TournamentDirectory/NAME.json. Its table,
+    // with every match that was played so far, is kept in NAME.table.json.
+    TournamentDirectory = "../Tournaments/"
+    tableSuffix         = ".table"
+
+    pointsWin           = 1.0
+    pointsDraw          = 0.5
+
+    // The participants are the checkouts of the repositories, for example pwb_04.
+    // Their bots are started remotely with the number of the SVN, for example 04.
+    repositoryPrefix    = "pwb_"
+)
+
+type Format string
+const (
+    FormatRoundRobin    Format = "roundrobin"
+    FormatSwiss         Format = "swiss"
+    FormatKnockout      Format = "knockout"
+)
+
+////////////////////////////////////////////////////////////////////////
+//
+// Match
+//
+////////////////////////////////////////////////////////////////////////
+
+// One game between two participants. A match with only one player is a bye and counts as a win.
+type Match struct {
+    Round           int
+    Players         []string
+    // The score of every player at the end of the game.
+    Scores          map[string]float32
+    // Empty for a draw.
+    Winner          string
+    Finished        bool
+}
+
+func (match *Match) IsBye() bool {
+    return len(match.Players) == 1
+}
+
+// The SVNs whose bots play the match.
+func (match *Match) Svns() []string {
+    svns := make([]string, 0, len(match.Players))
+    for _, player := range match.Players {
+        svns = append(svns, SvnOfRepository(player))
+    }
+    return svns
+}
+
+func SvnOfRepository(repository string) string {
+    return strings.TrimPrefix(repository, repositoryPrefix)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Tournament
+//
+////////////////////////////////////////////////////////////////////////
+
+type Tournament struct {
+    Name            string
+    Format          Format
+    // The game from games.json, that is played in every match.
+    Game            string
+    // The repositories of the participants, the best seed first.
+    Participants    []string
+    // Only used by swiss tournaments. 0 plays enough rounds to find a single winner.
+    Rounds          int
+
+    CurrentRound    int
+    Matches         []Match
+    Finished        bool
+}
+
+func NewTournament(name string, format Format, game string, participants []string, rounds int) (*Tournament, error) {
+    switch format {
+    case FormatRoundRobin, FormatSwiss, FormatKnockout:
+    default:
+        return nil, errors.New(fmt.Sprintf("The tournament format \"%v\" is unknown.", format))
+    }
+
+    if len(participants) < 2 {
+        return nil, errors.New("A tournament needs at least two participants.")
+    }
+    seen := make(map[string]bool)
+    for _, participant := range participants {
+        if participant == "" || seen[participant] {
+            return nil, errors.New(fmt.Sprintf("The participant \"%v\" is empty or appears twice.", participant))
+        }
+        seen[participant] = true
+    }
+
+    if format == FormatSwiss && rounds <= 0 {
+        for rounds = 0; 1 << uint(rounds) < len(participants); rounds++ {
+        }
+    }
+
+    tournament := &Tournament{
+        Name:           name,
+        Format:         format,
+        Game:           game,
+        Participants:   participants,
+        Rounds:         rounds,
+    }
+    tournament.scheduleRound()
+    return tournament, nil
+}
+
+// The next match that has to be played. When a round is over, the next one is scheduled.
+func (tournament *Tournament) NextMatch() (Match, bool) {
+    for !tournament.Finished {
+        if match := tournament.currentMatch(); match != nil {
+            return *match, true
+        }
+        tournament.scheduleRound()
+    }
+    return Match{}, false
+}
+
+// Finishes the match that NextMatch returned. Players without a score got 0.
+// A knockout match has no draws, the better seed wins.
+func (tournament *Tournament) Record(scores map[string]float32) {
+    match := tournament.currentMatch()
+    if match == nil {
+        return
+    }
+
+    match.Scores = make(map[string]float32)
+    for _, player := range match.Players {
+        match.Scores[player] = scores[player]
+    }
+
+    players := append([]string{}, match.Players...)
+    seeds := tournament.seeds()
+    sort.SliceStable(players, func(i, j int) bool {
+        if match.Scores[players[i]] != match.Scores[players[j]] {
+            return match.Scores[players[i]] > match.Scores[players[j]]
+        }
+        return seeds[players[i]] < seeds[players[j]]
+    })
+
+    isDraw := match.Scores[players[0]] == match.Scores[players[1]]
+    if isDraw && tournament.Format != FormatKnockout {
+        match.Winner = ""
+    } else {
+        match.Winner = players[0]
+    }
+    match.Finished = true
+}
+
+func (tournament *Tournament) currentMatch() *Match {
+    for i := range tournament.Matches {
+        if !tournament.Matches[i].Finished {
+            return &tournament.Matches[i]
+        }
+    }
+    return nil
+}
+
+func (tournament *Tournament) seeds() map[string]int {
+    seeds := make(map[string]int)
+    for i, participant := range tournament.Participants {
+        seeds[participant] = i
+    }
+    return seeds
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Scheduling
+//
+////////////////////////////////////////////////////////////////////////
+
+// Adds the matches of the next round. Finishes the tournament, if there is none.
+func (tournament *Tournament) scheduleRound() {
+    var pairings [][]string
+    switch tournament.Format {
+    case FormatRoundRobin:
+        pairings = roundRobinPairings(tournament.Participants, tournament.CurrentRound)
+    case FormatSwiss:
+        if tournament.CurrentRound < tournament.Rounds {
+            pairings = tournament.swissPairings()
+        }
+    case FormatKnockout:
+        pairings = tournament.knockoutPairings()
+    }
+
+    if len(pairings) == 0 {
+        tournament.Finished = true
+        return
+    }
+
+    tournament.CurrentRound += 1
+    for _, players := range pairings {
+        match := Match{ Round: tournament.CurrentRound, Players: players }
+        if match.IsBye() {
+            match.Winner = players[0]
+            match.Finished = true
+        }
+        tournament.Matches = append(tournament.Matches, match)
+    }
+}
+
+// The circle method: the first participant stays, all others rotate by one place every round.
+func roundRobinPairings(participants []string, round int) [][]string {
+    players := append([]string{}, participants...)
+    if len(players) % 2 == 1 {
+        // Whoever plays against nobody has a bye.
+        players = append(players, "")
+    }
+    count := len(players)
+    if round >= count - 1 {
+        return nil
+    }
+
+    others := players[1:]
+    shift := round % len(others)
+    arrangement := append([]string{ players[0] }, others[len(others) - shift:]...)
+    arrangement = append(arrangement, others[:len(others) - shift]...)
+
+    var pairings [][]string
+    for i := 0; i < count / 2; i++ {
+        pairings = append(pairings, makePairing(arrangement[i], arrangement[count - 1 - i]))
+    }
+    return pairings
+}
+
+// The best players of the standings play each other, if they did not play before.
+func (tournament *Tournament) swissPairings() [][]string {
+    played := make(map[string]map[string]bool)
+    hadBye := make(map[string]bool)
+    for _, match := range tournament.Matches {
+        if match.IsBye() {
+            hadBye[match.Players[0]] = true
+            continue
+        }
+        for _, player := range match.Players {
+            if played[player] == nil {
+                played[player] = make(map[string]bool)
+            }
+            for _, opponent := range match.Players {
+                played[player][opponent] = true
+            }
+        }
+    }
+
+    var players []string
+    for _, standing := range tournament.Standings() {
+        players = append(players, standing.Participant)
+    }
+
+    var pairings [][]string
+    if len(players) % 2 == 1 {
+        // The lowest player without a bye gets one.
+        bye := len(players) - 1
+        for i := len(players) - 1; i >= 0; i-- {
+            if !hadBye[players[i]] {
+                bye = i
+                break
+            }
+        }
+        pairings = append(pairings, []string{ players[bye] })
+        players = append(players[:bye], players[bye + 1:]...)
+    }
+
+    if rest, ok := pairWithoutRematches(players, played); ok {
+        return append(pairings, rest...)
+    }
+
+    // Everybody played everybody already, so rematches are unavoidable.
+    for i := 0; i + 1 < len(players); i += 2 {
+        pairings = append(pairings, []string{ players[i], players[i + 1] })
+    }
+    return pairings
+}
+
+// The best player gets the best opponent, that still leaves a pairing for the others.
+func pairWithoutRematches(players []string, played map[string]map[string]bool) ([][]string, bool) {
+    if len(players) == 0 {
+        return nil, true
+    }
+
+    for i := 1; i < len(players); i++ {
+        if played[players[0]][players[i]] {
+            continue
+        }
+        others := append(append([]string{}, players[1:i]...), players[i + 1:]...)
+        if rest, ok := pairWithoutRematches(others, played); ok {
+            return append([][]string{ { players[0], players[i] } }, rest...), true
+        }
+    }
+    return nil, false
+}
+
+// The first round is seeded, so the best two seeds can only meet in the final.
+// Missing players in a bracket, that is not a power of two, are byes for the best seeds.
+func (tournament *Tournament) knockoutPairings() [][]string {
+    if tournament.CurrentRound == 0 {
+        size := 1
+        for size < len(tournament.Participants) {
+            size *= 2
+        }
+        order := bracketOrder(size)
+
+        var pairings [][]string
+        for i := 0; i < size; i += 2 {
+            first := tournament.Participants[order[i]]
+            second := ""
+            if order[i + 1] < len(tournament.Participants) {
+                second = tournament.Participants[order[i + 1]]
+            }
+            pairings = append(pairings, makePairing(first, second))
+        }
+        return pairings
+    }
+
+    var winners []string
+    for _, match := range tournament.Matches {
+        if match.Round == tournament.CurrentRound {
+            winners = append(winners, match.Winner)
+        }
+    }
+    if len(winners) < 2 {
+        return nil
+    }
+
+    var pairings [][]string
+    for i := 0; i + 1 < len(winners); i += 2 {
+        pairings = append(pairings, []string{ winners[i], winners[i + 1] })
+    }
+    return pairings
+}
+
+// The seeds in the order of the bracket: 0,7,3,4,1,6,2,5 for 8 players.
+func bracketOrder(size int) []int {
+    order := []int{ 0 }
+    for length := 1; length < size; length *= 2 {
+        var next []int
+        for _, seed := range order {
+            next = append(next, seed, 2*length - 1 - seed)
+        }
+        order = next
+    }
+    return order
+}
+
+// An empty player means a bye.
+func makePairing(first string, second string) []string {
+    if first == "" {
+        return []string{ second }
+    }
+    if second == "" {
+        return []string{ first }
+    }
+    return []string{ first, second }
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Standings
+//
+////////////////////////////////////////////////////////////////////////
+
+type Standing struct {
+    Participant     string
+    Played          int
+    Won             int
+    Drawn           int
+    Lost            int
+    Points          float32
+    // The sum of the scores of all games, decides between equal points.
+    Score           float32
+    Eliminated      bool
+}
+
+// Sorted by points, score and seed.
+func (tournament *Tournament) Standings() []Standing {
+    standings := make(map[string]*Standing)
+    for _, participant := range tournament.Participants {
+        standings[participant] = &Standing{ Participant: participant }
+    }
+
+    for _, match := range tournament.Matches {
+        if !match.Finished {
+            continue
+        }
+        if match.IsBye() {
+            standing := standings[match.Players[0]]
+            standing.Won += 1
+            standing.Points += pointsWin
+            continue
+        }
+        for _, player := range match.Players {
+            standing := standings[player]
+            standing.Played += 1
+            standing.Score += match.Scores[player]
+            switch match.Winner {
+            case "":
+                standing.Drawn += 1
+                standing.Points += pointsDraw
+            case player:
+                standing.Won += 1
+                standing.Points += pointsWin
+            default:
+                standing.Lost += 1
+                standing.Eliminated = tournament.Format == FormatKnockout
+            }
+        }
+    }
+
+    seeds := tournament.seeds()
+    result := make([]Standing, 0, len(standings))
+    for _, standing := range standings {
+        result = append(result, *standing)
+    }
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].Points != result[j].Points {
+            return result[i].Points > result[j].Points
+        }
+        if result[i].Score != result[j].Score {
+            return result[i].Score > result[j].Score
+        }
+        return seeds[result[i].Participant] < seeds[result[j].Participant]
+    })
+    return result
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Files
+//
+////////////////////////////////////////////////////////////////////////
+
+// What is written to the table file.
+type Table struct {
+    Tournament      Tournament
+    Standings       []Standing
+}
+
+func makeDefinitionFileName(name string) string {
+    return fmt.Sprintf("%v%v.json", TournamentDirectory, name)
+}
+
+func makeTableFileName(name string) string {
+    return fmt.Sprintf("%v%v%v.json", TournamentDirectory, name, tableSuffix)
+}
+
+// The names of all tournament definitions.
+func TournamentNames() []string {
+    var names []string
+    entries, _ := ioutil.ReadDir(TournamentDirectory)
+    for _, entry := range entries {
+        name := strings.TrimSuffix(entry.Name(), ".json")
+        if filepath.Ext(entry.Name()) == ".json" && !strings.HasSuffix(name, tableSuffix) {
+            names = append(names, name)
+        }
+    }
+    return names
+}
+
+// A tournament that was already started continues with its table.
+func LoadTournament(name string) (*Tournament, error) {
+    if content, err := ioutil.ReadFile(makeTableFileName(name)); err == nil {
+        var table Table
+        if err := json.Unmarshal(content, &table); err != nil {
+            return nil, err
+        }
+        return &table.Tournament, nil
+    }
+
+    content, err := ioutil.ReadFile(makeDefinitionFileName(name))
+    if err != nil {
+        return nil, err
+    }
+
+    var definition Tournament
+    if err := json.Unmarshal(content, &definition); err != nil {
+        return nil, err
+    }
+    for _, participant := range definition.Participants {
+        if !strings.HasPrefix(participant, repositoryPrefix) || SvnOfRepository(participant) == "" {
+            return nil, errors.New(fmt.Sprintf("The participant \"%v\" is not a repository like %v04.", participant, repositoryPrefix))
+        }
+    }
+    return NewTournament(name, definition.Format, definition.Game, definition.Participants, definition.Rounds)
+}
+
+func (tournament *Tournament) Save() error {
+    if err := os.MkdirAll(TournamentDirectory, 0755); err != nil {
+        return err
+    }
+
+    content, err := json.MarshalIndent(Table{ Tournament: *tournament, Standings: tournament.Standings() }, "", "    ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(makeTableFileName(tournament.Name), content, 0644)
+}
@@ -0,0 +1,203 @@
+package tournament
+
+import (
+    "reflect"
+    "testing"
+)
+
+// Plays all matches. The participant that comes first in strength wins every game.
+func playTournament(t *testing.T, tournament *Tournament, strength []string) []Match {
+    rank := make(map[string]float32)
+    for i, participant := range strength {
+        rank[participant] = float32(len(strength) - i)
+    }
+
+    var played []Match
+    for i := 0; ; i++ {
+        if i > 1000 {
+            t.Fatalf("tournament does not finish")
+        }
+        match, ok := tournament.NextMatch()
+        if !ok {
+            break
+        }
+        tournament.Record(map[string]float32{ match.Players[0]: rank[match.Players[0]], match.Players[1]: rank[match.Players[1]] })
+        played = append(played, match)
+    }
+    return played
+}
+
+func TestNewTournamentValidation(t *testing.T) {
+    tests := []struct {
+        name            string
+        format          Format
+        participants    []string
+        wantError       bool
+    }{
+        { "valid",              FormatRoundRobin,   []string{ "a", "b" },       false },
+        { "unknown format",     Format("ladder"),   []string{ "a", "b" },       true },
+        { "one participant",    FormatKnockout,     []string{ "a" },            true },
+        { "duplicate",          FormatSwiss,        []string{ "a", "b", "a" },  true },
+        { "empty name",         FormatSwiss,        []string{ "a", "" },        true },
+    }
+
+    for _, test := range tests {
+        _, err := NewTournament("test", test.format, "game", test.participants, 0)
+        if (err != nil) != test.wantError {
+            t.Errorf("%v: error is %v, want error %v", test.name, err, test.wantError)
+        }
+    }
+}
+
+func TestRoundRobinPlaysEveryPairingOnce(t *testing.T) {
+    tests := []struct {
+        participants    []string
+        wantRounds      int
+    }{
+        { []string{ "a", "b", "c", "d" },        3 },
+        { []string{ "a", "b", "c", "d", "e" },   5 },
+    }
+
+    for _, test := range tests {
+        tournament, _ := NewTournament("test", FormatRoundRobin, "game", test.participants, 0)
+        played := playTournament(t, tournament, test.participants)
+
+        pairings := make(map[[2]string]int)
+        for _, match := range played {
+            first, second := match.Players[0], match.Players[1]
+            if first > second {
+                first, second = second, first
+            }
+            pairings[[2]string{ first, second }] += 1
+        }
+
+        n := len(test.participants)
+        if len(played) != n * (n - 1) / 2 || len(pairings) != len(played) {
+            t.Errorf("%v participants: %v matches with %v pairings", n, len(played), len(pairings))
+        }
+        if tournament.CurrentRound != test.wantRounds {
+            t.Errorf("%v participants: %v rounds, want %v", n, tournament.CurrentRound, test.wantRounds)
+        }
+
+        standings := tournament.Standings()
+        // With an odd number of participants everybody has one bye.
+        if standings[0].Participant != "a" || standings[0].Points != float32(n - 1 + n % 2) {
+            t.Errorf("%v participants: best standing is %+v", n, standings[0])
+        }
+    }
+}
+
+func TestKnockoutSeedsAndByes(t *testing.T) {
+    participants := []string{ "a", "b", "c", "d", "e", "f" }
+    tournament, _ := NewTournament("test", FormatKnockout, "game", participants, 0)
+
+    var firstRound [][]string
+    for _, match := range tournament.Matches {
+        firstRound = append(firstRound, match.Players)
+    }
+    want := [][]string{ { "a" }, { "d", "e" }, { "b" }, { "c", "f" } }
+    if !reflect.DeepEqual(firstRound, want) {
+        t.Errorf("first round is %v, want %v", firstRound, want)
+    }
+
+    // The weakest seed wins every game.
+    played := playTournament(t, tournament, []string{ "f", "e", "d", "c", "b", "a" })
+    final := played[len(played) - 1]
+    if !reflect.DeepEqual(final.Players, []string{ "e", "f" }) {
+        t.Errorf("final is %v, want [e f]", final.Players)
+    }
+
+    standings := tournament.Standings()
+    if standings[0].Participant != "f" || standings[0].Eliminated {
+        t.Errorf("winner is %+v, want f", standings[0])
+    }
+    for _, standing := range standings[1:] {
+        if !standing.Eliminated {
+            t.Errorf("%v is not eliminated", standing.Participant)
+        }
+    }
+}
+
+func TestKnockoutDrawGoesToBetterSeed(t *testing.T) {
+    tournament, _ := NewTournament("test", FormatKnockout, "game", []string{ "a", "b" }, 0)
+    tournament.NextMatch()
+    tournament.Record(map[string]float32{ "a": 5, "b": 5 })
+
+    if winner := tournament.Matches[0].Winner; winner != "a" {
+        t.Errorf("winner of the draw is %v, want a", winner)
+    }
+    if _, ok := tournament.NextMatch(); ok || !tournament.Finished {
+        t.Errorf("tournament is not finished after the final")
+    }
+}
+
+func TestSwissAvoidsRematchesAndRepeatedByes(t *testing.T) {
+    participants := []string{ "a", "b", "c", "d", "e" }
+    tournament, _ := NewTournament("test", FormatSwiss, "game", participants, 0)
+    if tournament.Rounds != 3 {
+        t.Fatalf("swiss with 5 participants has %v rounds, want 3", tournament.Rounds)
+    }
+
+    played := playTournament(t, tournament, participants)
+
+    pairings := make(map[[2]string]bool)
+    for _, match := range played {
+        key := [2]string{ match.Players[0], match.Players[1] }
+        if key[0] > key[1] {
+            key[0], key[1] = key[1], key[0]
+        }
+        if pairings[key] {
+            t.Errorf("%v play each other twice", key)
+        }
+        pairings[key] = true
+    }
+
+    byes := make(map[string]int)
+    for _, match := range tournament.Matches {
+        if match.IsBye() {
+            byes[match.Players[0]] += 1
+        }
+    }
+    if len(byes) != 3 {
+        t.Errorf("byes are %v, want three different players", byes)
+    }
+    if standings := tournament.Standings(); standings[0].Participant != "a" {
+        t.Errorf("best standing is %+v, want a", standings[0])
+    }
+}
+
+func TestRoundRobinDraw(t *testing.T) {
+    tournament, _ := NewTournament("test", FormatRoundRobin, "game", []string{ "a", "b" }, 0)
+    tournament.NextMatch()
+    tournament.Record(map[string]float32{ "a": 3, "b": 3 })
+
+    for _, standing := range tournament.Standings() {
+        if standing.Drawn != 1 || standing.Points != pointsDraw {
+            t.Errorf("standing after a draw is %+v", standing)
+        }
+    }
+}
+
+func TestMatchStartsTheSvnsOfTheRepositories(t *testing.T) {
+    tournament, err := NewTournament("test", FormatKnockout, "game", []string{ "pwb_04", "pwb_13", "pwb_20" }, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The best seed has a bye, so the first match is played by the other two.
+    match, ok := tournament.NextMatch()
+    if !ok || !reflect.DeepEqual(match.Svns(), []string{ "13", "20" }) {
+        t.Fatalf("the match %v starts the svns %v", match.Players, match.Svns())
+    }
+
+    // The scores of the game are kept per repository.
+    tournament.Record(map[string]float32{ "pwb_13": 10, "pwb_20": 30 })
+    if played := tournament.Matches[len(tournament.Matches) - 1]; played.Winner != "pwb_20" {
+        t.Errorf("the winner of %v is %q", played.Players, played.Winner)
+    }
+
+    match, ok = tournament.NextMatch()
+    if !ok || !reflect.DeepEqual(match.Svns(), []string{ "04", "20" }) {
+        t.Errorf("the final %v starts the svns %v", match.Players, match.Svns())
+    }
+}
@@ -69,6 +69,11 @@ func RandomVec2() Vec2 {
     return Vec2{ rand.Float32(), rand.Float32() }
 }
 
+// Same as RandomVec2, but takes the numbers from the given generator instead of the global one.
+func RandomVec2From(random *rand.Rand) Vec2 {
+    return Vec2{ random.Float32(), random.Float32() }
+}
+
 func CopyVec2(v Vec2) Vec2 {
     return Vec2{ v.X, v.Y }
 }
@@ -29,5 +29,8 @@ go install Programmierwettbewerb-Server
 echo "Build Middleware"
 go install Programmierwettbewerb-Middleware
 
+echo "Build Batch Runner"
+go install Programmierwettbewerb-Batch
+
 echo "Build Distribution Server"
 #go install Programmierwettbewerb-Distribution
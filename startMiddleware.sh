@@ -2,5 +2,5 @@
 
 #./bin/Programmierwettbewerb-Middleware -bot="python ./BotPython/script.py" -numBots=1 -name=dummy -connection=ws://localhost:8080/middleware/
 #./bin/Programmierwettbewerb-Middleware -bot=./BotPython/script.py -numBots=1 -name=Tim -connection=ws://localhost:8080/middleware/
-./bin/Programmierwettbewerb-Middleware -bot=./BotPython/script.py -name=dummy -connection=ws://localhost:8080/middleware/
+./bin/Programmierwettbewerb-Middleware -bot=./BotPython/script.py -name=dummy -token=$(cat SVN/dummy.token) -connection=ws://localhost:8080/middleware/
 #./bin/Programmierwettbewerb-Middleware -bot=./BotPython/script.py -numBots=1 -name=dummy